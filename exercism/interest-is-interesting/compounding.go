@@ -0,0 +1,51 @@
+package interest
+
+import "math"
+
+// Interest on loans and savings, with rates as annual percentages (4.5 for 4.5%).
+// Balances are in any unit, the results are in the same unit and not rounded.
+
+// MonthlyRate returns the rate per month, as a fraction, of an annual rate in percent.
+func MonthlyRate(annualRate float64) float64 {
+	return annualRate / 100 / 12
+}
+
+// MonthlyInterest calculates the interest for one month on the provided balance.
+func MonthlyInterest(balance float64, annualRate float64) float64 {
+	return balance * MonthlyRate(annualRate)
+}
+
+// MonthlyPayment calculates the fixed monthly payment that repays principal with its interest in months payments.
+func MonthlyPayment(principal float64, annualRate float64, months int) float64 {
+	if months <= 0 {
+		return principal
+	}
+	rate := MonthlyRate(annualRate)
+	if rate == 0 {
+		return principal / float64(months)
+	}
+	return principal * rate / (1 - math.Pow(1+rate, -float64(months)))
+}
+
+// Tier of a savings account: its annual rate applies to the whole balance once it reaches MinBalance.
+type Tier struct {
+	MinBalance float64
+	Rate       float64
+}
+
+// TierRate returns the annual rate of the highest tier whose minimum balance the provided balance reaches,
+// 0 below all of them. Tiers are sorted by their minimum balance.
+func TierRate(tiers []Tier, balance float64) float64 {
+	rate := 0.0
+	for _, tier := range tiers {
+		if balance >= tier.MinBalance {
+			rate = tier.Rate
+		}
+	}
+	return rate
+}
+
+// DailyInterest calculates the interest for one day on the provided balance.
+func DailyInterest(balance float64, annualRate float64) float64 {
+	return balance * annualRate / 100 / 365
+}
@@ -0,0 +1,256 @@
+package interest
+
+import "testing"
+
+func TestMonthlyRate(t *testing.T) {
+	tests := []struct {
+		name       string
+		annualRate float64
+		want       float64
+	}{
+		{
+			name:       "No interest",
+			annualRate: 0,
+			want:       0,
+		},
+		{
+			name:       "Whole rate",
+			annualRate: 12,
+			want:       0.01,
+		},
+		{
+			name:       "Fractional rate",
+			annualRate: 4.5,
+			want:       0.00375,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MonthlyRate(tt.annualRate)
+			if !floatingPointEquals(got, tt.want) {
+				t.Errorf(
+					"MonthlyRate(%f) = %f, want %f",
+					tt.annualRate,
+					got,
+					tt.want,
+				)
+			}
+		})
+	}
+}
+
+func TestMonthlyInterest(t *testing.T) {
+	tests := []struct {
+		name       string
+		balance    float64
+		annualRate float64
+		want       float64
+	}{
+		{
+			name:       "Interest on empty balance",
+			balance:    0,
+			annualRate: 5,
+			want:       0,
+		},
+		{
+			name:       "Interest on small balance",
+			balance:    1000,
+			annualRate: 5,
+			want:       4.166666666666667,
+		},
+		{
+			name:       "Interest on large balance",
+			balance:    250000,
+			annualRate: 3.5,
+			want:       729.1666666666666,
+		},
+		{
+			name:       "Interest on negative balance",
+			balance:    -300,
+			annualRate: 18,
+			want:       -4.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MonthlyInterest(tt.balance, tt.annualRate)
+			if !floatingPointEquals(got, tt.want) {
+				t.Errorf(
+					"MonthlyInterest(%f, %f) = %f, want %f",
+					tt.balance,
+					tt.annualRate,
+					got,
+					tt.want,
+				)
+			}
+		})
+	}
+}
+
+func TestMonthlyPayment(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  float64
+		annualRate float64
+		months     int
+		want       float64
+	}{
+		{
+			name:       "Payment without interest",
+			principal:  10000,
+			annualRate: 0,
+			months:     10,
+			want:       1000,
+		},
+		{
+			name:       "Payment of a one year loan",
+			principal:  1000,
+			annualRate: 12,
+			months:     12,
+			want:       88.8487886783416,
+		},
+		{
+			name:       "Payment of a car loan",
+			principal:  20000,
+			annualRate: 4.5,
+			months:     60,
+			want:       372.86038483034,
+		},
+		{
+			name:       "Payment of a mortgage",
+			principal:  200000,
+			annualRate: 6,
+			months:     360,
+			want:       1199.1010503055138,
+		},
+		{
+			name:       "Single payment",
+			principal:  5000,
+			annualRate: 3.25,
+			months:     1,
+			want:       5013.541666666645,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MonthlyPayment(tt.principal, tt.annualRate, tt.months)
+			if !floatingPointEquals(got, tt.want) {
+				t.Errorf(
+					"MonthlyPayment(%f, %f, %d) = %f, want %f",
+					tt.principal,
+					tt.annualRate,
+					tt.months,
+					got,
+					tt.want,
+				)
+			}
+		})
+	}
+}
+
+func TestDailyInterest(t *testing.T) {
+	tests := []struct {
+		name       string
+		balance    float64
+		annualRate float64
+		want       float64
+	}{
+		{
+			name:       "Interest on empty balance",
+			balance:    0,
+			annualRate: 2.475,
+			want:       0,
+		},
+		{
+			name:       "Interest of a whole day",
+			balance:    36500,
+			annualRate: 1,
+			want:       1,
+		},
+		{
+			name:       "Interest on large balance",
+			balance:    100000,
+			annualRate: 2.475,
+			want:       6.780821917808219,
+		},
+		{
+			name:       "Interest on negative balance",
+			balance:    -36500,
+			annualRate: 3.213,
+			want:       -3.213,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DailyInterest(tt.balance, tt.annualRate)
+			if !floatingPointEquals(got, tt.want) {
+				t.Errorf(
+					"DailyInterest(%f, %f) = %f, want %f",
+					tt.balance,
+					tt.annualRate,
+					got,
+					tt.want,
+				)
+			}
+		})
+	}
+}
+
+func TestTierRate(t *testing.T) {
+	tiers := []Tier{{MinBalance: 0, Rate: 0.5}, {MinBalance: 1000, Rate: 1.621}, {MinBalance: 5000, Rate: 2.475}}
+
+	tests := []struct {
+		name    string
+		balance float64
+		want    float64
+	}{
+		{
+			name:    "Minimal first interest rate",
+			balance: 0,
+			want:    0.5,
+		},
+		{
+			name:    "Maximum first interest rate",
+			balance: 999.9999,
+			want:    0.5,
+		},
+		{
+			name:    "Minimal second interest rate",
+			balance: 1000,
+			want:    1.621,
+		},
+		{
+			name:    "Minimal third interest rate",
+			balance: 5000,
+			want:    2.475,
+		},
+		{
+			name:    "Large third interest rate",
+			balance: 5639998.742909,
+			want:    2.475,
+		},
+		{
+			name:    "Rate on negative balance",
+			balance: -0.01,
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TierRate(tiers, tt.balance)
+			if !floatingPointEquals(got, tt.want) {
+				t.Errorf(
+					"TierRate(%f) = %f, want %f",
+					tt.balance,
+					got,
+					tt.want,
+				)
+			}
+		})
+	}
+}
@@ -4,44 +4,305 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 )
 
 const ROOT_URL = "http://localhost:9000"
 
+// Number of records requested per page from the collection endpoints
+const PAGE_SIZE = 500
+
+// Session of the signed-in user, issued by /authorize
+// The token is sent with every request, the server scopes all records to this user
+var session Session
+
 // Data Models - same with server
 // User Account, Bank Account, Bucket, and Line Item
 type UserAccount struct {
 	Id       int    `json:"id" bson:"id"`
 	Username string `json:"username" bson:"username"`
 	Name     string `json:"name" bson:"name"`
-	Pin      int    `json:"pin" bson:"pin"`
 }
 
 type BankAccount struct {
-	Id    int    `json:"id" bson:"id"`
-	Name  string `json:"name" bson:"name"`
-	Owner int    `json:"ownerid" bson:"ownerid"`
+	Id       int    `json:"id" bson:"id"`
+	Name     string `json:"name" bson:"name"`
+	Owner    int    `json:"ownerid" bson:"ownerid"`
+	Currency string `json:"currency" bson:"currency"`
 }
 
 type Bucket struct {
-	Id    int    `json:"id" bson:"id"`
-	Name  string `json:"name" bson:"name"`
-	Owner int    `json:"ownerid" bson:"ownerid"`
+	Id     int     `json:"id" bson:"id"`
+	Name   string  `json:"name" bson:"name"`
+	Owner  int     `json:"ownerid" bson:"ownerid"`
+	Budget *Budget `json:"budget" bson:"budget"`
+}
+
+// Amount a bucket may spend per period, null for a bucket without a budget
+type Budget struct {
+	Amount Money  `json:"amount" bson:"amount"`
+	Period string `json:"period" bson:"period"`
+	Start  string `json:"start,omitempty" bson:"start"`
+	Days   int    `json:"days,omitempty" bson:"days"`
+}
+
+func (b Budget) String() string {
+	return fmt.Sprintf("%s %s", b.Amount, b.Period)
+}
+
+// Spending of a bucket in one budget period, as returned by /buckets/{id}/status
+type PeriodStatus struct {
+	Start       string  `json:"start"`
+	End         string  `json:"end"`
+	Budget      Money   `json:"budget"`
+	Spent       Money   `json:"spent"`
+	Remaining   Money   `json:"remaining"`
+	PercentUsed float64 `json:"percent_used"`
+	Overspent   bool    `json:"overspent"`
+}
+
+type BucketStatus struct {
+	Current PeriodStatus   `json:"current"`
+	Past    []PeriodStatus `json:"past"`
+}
+
+// Rows of the /reports endpoints
+type IncomeExpense struct {
+	Period   string `json:"period"`
+	Currency string `json:"currency"`
+	Income   Money  `json:"income"`
+	Expenses Money  `json:"expenses"`
+	Net      Money  `json:"net"`
+}
+
+type BucketSpending struct {
+	Period   string `json:"period"`
+	Currency string `json:"currency"`
+	Name     string `json:"name"`
+	Spent    Money  `json:"spent"`
+}
+
+type PayeeTotal struct {
+	Title    string `json:"title"`
+	Currency string `json:"currency"`
+	Count    int    `json:"count"`
+	Total    Money  `json:"total"`
+}
+
+type CashFlow struct {
+	Period   string `json:"period"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	Inflow   Money  `json:"inflow"`
+	Outflow  Money  `json:"outflow"`
+	Net      Money  `json:"net"`
+}
+
+type Comparison struct {
+	Current        Money    `json:"current"`
+	Previous       Money    `json:"previous"`
+	LastYear       Money    `json:"last_year"`
+	ChangePrevious *float64 `json:"change_previous"`
+	ChangeLastYear *float64 `json:"change_last_year"`
+}
+
+type ReportRange struct {
+	Label string `json:"label"`
+}
+
+type ReportComparison struct {
+	Current  ReportRange `json:"current"`
+	Previous ReportRange `json:"previous"`
+	LastYear ReportRange `json:"last_year"`
+	Totals   []struct {
+		Currency string     `json:"currency"`
+		Income   Comparison `json:"income"`
+		Expenses Comparison `json:"expenses"`
+		Net      Comparison `json:"net"`
+	} `json:"totals"`
+	Buckets []struct {
+		Currency string     `json:"currency"`
+		Name     string     `json:"name"`
+		Spent    Comparison `json:"spent"`
+	} `json:"buckets"`
+}
+
+// Savings goal, tied to a bucket or a bank account, with its progress computed by the server
+type Goal struct {
+	Id           int     `json:"id"`
+	Name         string  `json:"name"`
+	TargetAmount Money   `json:"target_amount"`
+	TargetDate   string  `json:"target_date"`
+	StartDate    string  `json:"start_date,omitempty"`
+	Bucket       int     `json:"bucket"`
+	Bank         int     `json:"bank"`
+	Saved        Money   `json:"saved,omitempty"`
+	Progress     float64 `json:"progress,omitempty"`
+	Monthly      Money   `json:"monthly,omitempty"`
+	Status       string  `json:"status,omitempty"`
+}
+
+// Projected balance of a bank account, from /forecast
+type ForecastDay struct {
+	Date     string `json:"date"`
+	Known    Money  `json:"known"`
+	Balance  Money  `json:"balance"`
+	Negative bool   `json:"negative"`
+}
+
+type Forecast struct {
+	Name          string        `json:"name"`
+	Currency      string        `json:"currency"`
+	Balance       Money         `json:"balance"`
+	Lowest        ForecastDay   `json:"lowest"`
+	FirstNegative string        `json:"first_negative"`
+	Days          []ForecastDay `json:"days"`
+}
+
+// Balance of a bank account at the end of Date, from /bank/{id}/balance
+type BankBalance struct {
+	Bank struct {
+		OpeningBalance Money  `json:"opening_balance"`
+		OpeningDate    string `json:"opening_date"`
+	} `json:"bank"`
+	Date    string `json:"date"`
+	Balance Money  `json:"balance"`
+}
+
+// Tokens returned by /authorize and /refresh
+type Session struct {
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresAt    time.Time   `json:"expires_at"`
+	User         UserAccount `json:"user"`
 }
 
 type LineItem struct {
 	Id          int     `json:"id" bson:"id"`
 	Title       string  `json:"title" bson:"title"`
 	Description string  `json:"description" bson:"description"`
-	Amount      float64 `json:"amount" bson:"amount"`
+	Amount      Money   `json:"amount" bson:"amount"`
 	Bucket      int     `json:"bucket" bson:"bucket"`
 	Bank        int     `json:"bank" bson:"bank"`
 	Owner       int     `json:"ownerid" bson:"ownerid"`
+	OccurredOn  string  `json:"occurred_on" bson:"occurred_on"`
+	Transfer    int     `json:"transfer" bson:"transfer"`
+}
+
+// Money moved between two banks, recorded by the server as two linked line items
+type Transfer struct {
+	Id         int    `json:"id" bson:"id"`
+	Title      string `json:"title" bson:"title"`
+	Amount     Money  `json:"amount" bson:"amount"`
+	FromBank   int    `json:"from_bank" bson:"from_bank"`
+	ToBank     int    `json:"to_bank" bson:"to_bank"`
+	OccurredOn string `json:"occurred_on" bson:"occurred_on"`
+}
+
+// An existing line item that a new one likely duplicates, as returned by /duplicates/check
+type DuplicatePair struct {
+	Second    LineItem `json:"second"`
+	DaysApart int      `json:"days_apart"`
+}
+
+// Mapping of the columns of a bank's CSV statement to line items, saved on the server
+type ImportProfile struct {
+	Id                int    `json:"id" bson:"id"`
+	Name              string `json:"name" bson:"name"`
+	Bank              int    `json:"bank" bson:"bank"`
+	Delimiter         string `json:"delimiter" bson:"delimiter"`
+	HasHeader         bool   `json:"has_header" bson:"has_header"`
+	DateColumn        string `json:"date_column" bson:"date_column"`
+	DescriptionColumn string `json:"description_column" bson:"description_column"`
+	AmountColumn      string `json:"amount_column" bson:"amount_column"`
+	DebitColumn       string `json:"debit_column" bson:"debit_column"`
+	CreditColumn      string `json:"credit_column" bson:"credit_column"`
+	Sign              string `json:"sign" bson:"sign"`
+	DateFormat        string `json:"date_format" bson:"date_format"`
+	DecimalSeparator  string `json:"decimal_separator" bson:"decimal_separator"`
+}
+
+// Outcome of a statement import, with the rows that could not be read
+type ImportResult struct {
+	Rows       int        `json:"rows"`
+	Created    int        `json:"created"`
+	Duplicates int        `json:"duplicates"`
+	LineItems  []LineItem `json:"lineitems"`
+	Errors     []struct {
+		Row   int    `json:"row"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+// Layout of the date a line item occurred on
+const DATE_LAYOUT = "2006-01-02"
+
+// Exact amount in cents. The server sends amounts as numbers with two decimals.
+type Money int64
+
+var moneyPattern = regexp.MustCompile(`^([+-]?)(\d{1,16})(?:\.(\d{1,2}))?$`)
+
+// Parse a decimal amount such as "12", "-4.5" or "1234.56", without going through a float
+func parseMoney(value string) (Money, error) {
+	match := moneyPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, errors.New("invalid amount")
+	}
+	fraction := match[3]
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	cents, err := strconv.ParseInt(match[2]+fraction, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if match[1] == "-" {
+		cents = -cents
+	}
+	return Money(cents), nil
+}
+
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := string(data)
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	if value == "null" {
+		*m = 0
+		return nil
+	}
+	parsed, err := parseMoney(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
 }
 
 func main() {
@@ -101,7 +362,10 @@ func main() {
 			continue
 		}
 
-		authorizedUser := getUser(username, pin)
+		// The PIN is only needed to sign in, the session token is used from here on
+		pin = 0
+
+		authorizedUser := getUser()
 		fmt.Println(authorizedUser)
 
 		var banks []BankAccount
@@ -109,15 +373,18 @@ func main() {
 		var lineitems []LineItem
 
 		// Retrieve all data related to user
-		banks = getBanks(authorizedUser.Id)
-		buckets = getBuckets(authorizedUser.Id)
-		lineitems = getLineItems(authorizedUser.Id)
+		banks = getBanks()
+		buckets = getBuckets()
+		lineitems = getLineItems()
 
-		// Run function for supported CRUD processes
+		// Run function for supported CRUD processes, until the user logs out
 		for {
 			fmt.Println("-----------------------")
-			process(authorizedUser.Id, &banks, &buckets, &lineitems)
+			signedIn := process(authorizedUser.Id, &banks, &buckets, &lineitems)
 			fmt.Println("-----------------------")
+			if !signedIn {
+				break
+			}
 		}
 	}
 
@@ -138,6 +405,7 @@ func unauthorizedDetected() {
 }
 
 // Fire request to /authorize endpoint with user payload
+// Keeps the issued session token for the following requests
 // Returns boolean (true for success, false otherwise)
 func authorize(username string, pin int) bool {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
@@ -151,43 +419,490 @@ func authorize(username string, pin int) bool {
 	}
 	defer response.Body.Close()
 
+	// if failed, return unsuccessful (false), else true
+	if response.StatusCode >= 400 {
+		return false
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&session); err != nil {
+		log.Fatal(err)
+	}
+	return true
+}
+
+// Fire request to /users endpoint with the session token
+// Returns UserAccount object of the signed-in user
+func getUser() UserAccount {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	response, err := client.Do(newRequest("GET", "/users", nil))
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer response.Body.Close()
 
-	// if failed, return unsuccessful (false), else true
-	return response.StatusCode < 400
+	var users []UserAccount
+	if err := json.NewDecoder(response.Body).Decode(&users); err != nil {
+		log.Fatal(err)
+	}
+	if len(users) == 0 {
+		return session.User
+	}
+	return users[0]
 }
 
-// Fire request to /authorize endpoint with user payload
-// Returns UserAccount object
-func getUser(username string, pin int) UserAccount {
+// Fire request to /refresh endpoint with the refresh token
+// Replaces the session tokens, exits if the session can no longer be refreshed
+func refreshSession() {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	body := fmt.Sprintf("{\"username\": \"%s\", \"pin\": %d}", username, pin)
+	body := fmt.Sprintf("{\"refresh_token\": \"%s\"}", session.RefreshToken)
 	payload := bytes.NewBuffer([]byte(body))
 
-	response, err := client.Post(ROOT_URL+"/authorize", "application/json", payload)
+	response, err := client.Post(ROOT_URL+"/refresh", "application/json", payload)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer response.Body.Close()
 
-	if err != nil {
+	if response.StatusCode >= 400 {
+		log.Fatal("Session expired. Please sign in again.")
+	}
+	if err := json.NewDecoder(response.Body).Decode(&session); err != nil {
 		log.Fatal(err)
 	}
-	var user UserAccount
-	if err := json.NewDecoder(response.Body).Decode(&user); err != nil {
+}
+
+// Fire request to /logout endpoint, revoking the session token
+func logout() {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	response, err := client.Do(newRequest("POST", "/logout", nil))
+	if err != nil {
 		log.Fatal(err)
 	}
-	return user
+	defer response.Body.Close()
+
+	session = Session{}
+}
+
+// Ask for a date, defaulting to today when left empty
+func readDate(scanner *bufio.Scanner) string {
+	for {
+		fmt.Printf("Date (YYYY-MM-DD, empty for %s): ", time.Now().Format(DATE_LAYOUT))
+		occurredOn := ""
+		if scanner.Scan() {
+			occurredOn = scanner.Text()
+		}
+		if occurredOn == "" {
+			occurredOn = time.Now().Format(DATE_LAYOUT)
+		}
+
+		if _, err := time.Parse(DATE_LAYOUT, occurredOn); err != nil {
+			fmt.Println("Invalid Date. Try again!")
+			continue
+		}
+		return occurredOn
+	}
+}
+
+// Ask for an exact amount, with at most two decimals
+func readAmount(prompt string) Money {
+	for {
+		var amountText string
+		fmt.Print(prompt)
+		fmt.Scan(&amountText)
+
+		amount, err := parseMoney(amountText)
+		if err != nil {
+			fmt.Println("Invalid Amount. Use at most two decimals. Try again!")
+			continue
+		}
+		return amount
+	}
+}
+
+// Ask for a line of text, returning fallback when left empty
+func readLine(scanner *bufio.Scanner, prompt string, fallback string) string {
+	fmt.Print(prompt)
+	if scanner.Scan() && scanner.Text() != "" {
+		return scanner.Text()
+	}
+	return fallback
+}
+
+// Ask for the fields of a goal, keeping the ones of current when left empty
+func readGoal(current Goal, buckets []Bucket, banks []BankAccount) Goal {
+	hint := func(value string) string {
+		if current.Id == 0 {
+			return ""
+		}
+		return ", now " + value
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	goal := Goal{StartDate: current.StartDate}
+	goal.Name = readLine(scanner, fmt.Sprintf("Name%s: ", hint(current.Name)), current.Name)
+
+	for {
+		goal.TargetAmount = readAmount(fmt.Sprintf("Target amount%s: ", hint(current.TargetAmount.String())))
+		if goal.TargetAmount <= 0 {
+			fmt.Println("Amount must be positive. Try again!")
+			continue
+		}
+		break
+	}
+
+	for {
+		goal.TargetDate = readLine(scanner, fmt.Sprintf("Target date (YYYY-MM-DD%s): ", hint(current.TargetDate)), current.TargetDate)
+		if _, err := time.Parse(DATE_LAYOUT, goal.TargetDate); err != nil {
+			fmt.Println("Invalid Date. Try again!")
+			continue
+		}
+		break
+	}
+
+	// A goal saves into either a bucket or a bank
+	for {
+		var link string
+		var linkId int
+		fmt.Print("Save into [BUCKET BANK]: ")
+		fmt.Scan(&link)
+
+		valid := false
+		switch link {
+		case "BUCKET":
+			fmt.Print("Available Buckets: ")
+			fmt.Println(buckets)
+			fmt.Print("Choose the Bucket Id: ")
+			fmt.Scan(&linkId)
+			for _, buc := range buckets {
+				if linkId == buc.Id {
+					goal.Bucket, goal.Bank, valid = linkId, 0, true
+				}
+			}
+		case "BANK":
+			fmt.Print("Available Banks: ")
+			fmt.Println(banks)
+			fmt.Print("Choose the Bank Id: ")
+			fmt.Scan(&linkId)
+			for _, ban := range banks {
+				if linkId == ban.Id {
+					goal.Bank, goal.Bucket, valid = linkId, 0, true
+				}
+			}
+		}
+		if !valid {
+			fmt.Println("Invalid Bucket or Bank. Try again!")
+			continue
+		}
+		return goal
+	}
+}
+
+// Print savings goals with their progress
+func printGoals(goals []Goal) {
+	fmt.Println("Your goals:")
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "Id\tName\tSaved\tTarget\tBy\tProgress\tMonthly\tStatus\t")
+	for _, goal := range goals {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%.1f%%\t%s\t%s\t\n",
+			goal.Id, goal.Name, goal.Saved, goal.TargetAmount, goal.TargetDate, goal.Progress, goal.Monthly, goal.Status)
+	}
+	table.Flush()
+}
+
+// Import a bank statement into one of the banks
+// CSV files are read with a saved or a new column mapping profile, OFX and QIF files as they are.
+// Shows what would be imported before importing it.
+func importStatement(banks *[]BankAccount, lineitems *[]LineItem) {
+	*banks = getBanks()
+	fmt.Println("Your Banks: [Bank Id, Bank Name, Bank Owner Id, Currency]")
+	fmt.Println(*banks)
+
+	var bank int
+	fmt.Print("Enter the Bank Id to import into: ")
+	fmt.Scan(&bank)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	path := readLine(scanner, "Path of the statement file (.csv, .ofx, .qfx or .qif): ", "")
+	statement, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Could not read the file. " + err.Error())
+		return
+	}
+
+	var endpoint string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ofx", ".qfx":
+		endpoint = fmt.Sprintf("/import/ofx?bank=%d", bank)
+	case ".qif":
+		endpoint = fmt.Sprintf("/import/qif?bank=%d", bank)
+		if readLine(scanner, "Are dates written day first, e.g. 31/12/2021? (Y/N) ", "N") == "Y" {
+			endpoint += "&day_first=true"
+		}
+	default:
+		profile, ok := chooseImportProfile(scanner, bank)
+		if !ok {
+			return
+		}
+		endpoint = fmt.Sprintf("/import/csv?profile=%d", profile)
+	}
+
+	preview, ok := importFile(endpoint+"&dry_run=true", statement)
+	if !ok {
+		fmt.Println("Unexpected error occured. Check the file and try again!")
+		return
+	}
+	if len(preview.Errors) > 0 {
+		fmt.Printf("%d of %d rows could not be read, nothing can be imported:\n", len(preview.Errors), preview.Rows)
+		for _, rowError := range preview.Errors {
+			fmt.Printf("Row %d: %s\n", rowError.Row, rowError.Error)
+		}
+		return
+	}
+	fmt.Println("[Title, Description, Amount, Date]")
+	for _, lineitem := range preview.LineItems {
+		fmt.Println(lineitem.Title, lineitem.Description, lineitem.Amount, lineitem.OccurredOn)
+	}
+	fmt.Printf("%d new Line Items, %d imported before.\n", preview.Created, preview.Duplicates)
+	if preview.Created == 0 || readLine(scanner, "Import them? (Y/N) ", "N") != "Y" {
+		return
+	}
+
+	result, ok := importFile(endpoint, statement)
+	if !ok || len(result.Errors) > 0 {
+		fmt.Println("Unexpected error occured. Try again!")
+		return
+	}
+	fmt.Printf("Imported %d Line Items!\n", result.Created)
+	*lineitems = getLineItems()
+}
+
+// Ask for a saved Import Profile of a bank, or for the columns of a new one
+func chooseImportProfile(scanner *bufio.Scanner, bank int) (int, bool) {
+	fmt.Println("Saved import profiles of the bank:")
+	for _, profile := range getImportProfiles(bank) {
+		fmt.Printf("%d: %s (date %q, description %q, %s)\n", profile.Id, profile.Name, profile.DateColumn, profile.DescriptionColumn, profile.Sign)
+	}
+
+	id, _ := strconv.Atoi(readLine(scanner, "Enter the Import Profile Id (empty for a new profile): ", "0"))
+	if id != 0 {
+		return id, true
+	}
+
+	profile := ImportProfile{Bank: bank}
+	profile.Name = readLine(scanner, "Profile name: ", "")
+	profile.Delimiter = readLine(scanner, "Column delimiter (empty for ,): ", ",")
+	profile.HasHeader = readLine(scanner, "Does the first row hold the column names? (Y/N) ", "Y") == "Y"
+	fmt.Println("Name the columns by their header, or by their position counted from 1.")
+	profile.DateColumn = readLine(scanner, "Date column: ", "")
+	profile.DescriptionColumn = readLine(scanner, "Description column: ", "")
+	profile.Sign = readLine(scanner, "Sign convention [negative_expenses positive_expenses debit_credit] (empty for negative_expenses): ", "negative_expenses")
+	if profile.Sign == "debit_credit" {
+		profile.DebitColumn = readLine(scanner, "Debit column: ", "")
+		profile.CreditColumn = readLine(scanner, "Credit column: ", "")
+	} else {
+		profile.AmountColumn = readLine(scanner, "Amount column: ", "")
+	}
+	profile.DateFormat = readLine(scanner, "Date format, e.g. DD/MM/YYYY (empty for YYYY-MM-DD): ", "YYYY-MM-DD")
+	profile.DecimalSeparator = readLine(scanner, "Decimal separator [. ,] (empty for .): ", ".")
+
+	id, ok := createImportProfile(profile)
+	if !ok {
+		fmt.Println("Invalid Import Profile. Try again!")
+		return 0, false
+	}
+	fmt.Println("Import Profile saved!")
+	return id, true
+}
+
+// Export all finances to a file, as JSON, CSV or a ledger journal
+// JSON exports can be imported again by the server at /import/json.
+func exportFinances() {
+	scanner := bufio.NewScanner(os.Stdin)
+	format := readLine(scanner, "Format [json csv ledger] (empty for json): ", "json")
+	query := "format=" + format
+	if format == "csv" {
+		query += "&table=" + readLine(scanner, "Table [lineitems banks buckets] (empty for lineitems): ", "lineitems")
+	}
+	if from := readLine(scanner, "From date (YYYY-MM-DD, empty for all): ", ""); from != "" {
+		query += "&from=" + from
+	}
+	if to := readLine(scanner, "To date (YYYY-MM-DD, empty for all): ", ""); to != "" {
+		query += "&to=" + to
+	}
+
+	extension := map[string]string{"json": ".json", "csv": ".csv", "ledger": ".journal"}[format]
+	path := readLine(scanner, "Path of the export file (empty for monefy"+extension+"): ", "monefy"+extension)
+	if err := downloadExport(query, path); err != nil {
+		fmt.Println("Export failed. " + err.Error())
+		return
+	}
+	fmt.Println("Exported to " + path + "!")
+}
+
+// Ask for a report and print it as a table
+func printReport() {
+	reports := []string{"INCOME", "BUCKETS", "PAYEES", "CASHFLOW", "COMPARE"}
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Println(reports)
+	report := strings.ToUpper(readLine(scanner, "Which report? ", ""))
+
+	query := url.Values{}
+	query.Set("period", readLine(scanner, "Period [month year] (empty for month): ", "month"))
+	if report == "COMPARE" {
+		query.Set("date", readLine(scanner, "Compare the period of date (YYYY-MM-DD, empty for today): ", ""))
+	} else {
+		query.Set("from", readLine(scanner, "From date (YYYY-MM-DD, empty for all): ", ""))
+		query.Set("to", readLine(scanner, "To date (YYYY-MM-DD, empty for all): ", ""))
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	defer table.Flush()
+
+	switch report {
+	case "INCOME":
+		var rows []IncomeExpense
+		if !getReport("/reports/income-expense", query, &rows) {
+			return
+		}
+		fmt.Fprintln(table, "Period\tCurrency\tIncome\tExpenses\tNet\t")
+		for _, row := range rows {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t\n", row.Period, row.Currency, row.Income, row.Expenses, row.Net)
+		}
+	case "BUCKETS":
+		var rows []BucketSpending
+		if !getReport("/reports/buckets", query, &rows) {
+			return
+		}
+		fmt.Fprintln(table, "Period\tBucket\tCurrency\tSpent\t")
+		for _, row := range rows {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t\n", row.Period, orNone(row.Name), row.Currency, row.Spent)
+		}
+	case "PAYEES":
+		query.Set("type", readLine(scanner, "Type [expenses income] (empty for expenses): ", "expenses"))
+		var rows []PayeeTotal
+		if !getReport("/reports/payees", query, &rows) {
+			return
+		}
+		fmt.Fprintln(table, "Title\tCurrency\tCount\tTotal\t")
+		for _, row := range rows {
+			fmt.Fprintf(table, "%s\t%s\t%d\t%s\t\n", row.Title, row.Currency, row.Count, row.Total)
+		}
+	case "CASHFLOW":
+		var rows []CashFlow
+		if !getReport("/reports/cashflow", query, &rows) {
+			return
+		}
+		fmt.Fprintln(table, "Period\tBank\tCurrency\tIn\tOut\tNet\t")
+		for _, row := range rows {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t\n", row.Period, orNone(row.Name), row.Currency, row.Inflow, row.Outflow, row.Net)
+		}
+	case "COMPARE":
+		var comparison ReportComparison
+		if !getReport("/reports/compare", query, &comparison) {
+			return
+		}
+		fmt.Fprintf(table, "\tCurrency\t%s\t%s\tChange\t%s\tChange\t\n", comparison.Current.Label, comparison.Previous.Label, comparison.LastYear.Label)
+		for _, total := range comparison.Totals {
+			fmt.Fprintln(table, compareRow("Income", total.Currency, total.Income))
+			fmt.Fprintln(table, compareRow("Expenses", total.Currency, total.Expenses))
+			fmt.Fprintln(table, compareRow("Net", total.Currency, total.Net))
+		}
+		for _, bucket := range comparison.Buckets {
+			fmt.Fprintln(table, compareRow(orNone(bucket.Name), bucket.Currency, bucket.Spent))
+		}
+	default:
+		fmt.Println("Invalid Report, Try Again!")
+	}
+}
+
+// Ask for a forecast and print a sparkline and a table of the days with known line items per bank account
+func printForecast() {
+	scanner := bufio.NewScanner(os.Stdin)
+	query := url.Values{}
+	query.Set("bank", readLine(scanner, "Bank ID (empty for all): ", ""))
+	query.Set("months", readLine(scanner, "Months (empty for 3): ", ""))
+
+	var forecasts []Forecast
+	if !getReport("/forecast", query, &forecasts) {
+		return
+	}
+
+	for _, forecast := range forecasts {
+		fmt.Printf("\n%s (%s): %s today, lowest %s on %s\n", forecast.Name, forecast.Currency, forecast.Balance, forecast.Lowest.Balance, forecast.Lowest.Date)
+		if forecast.FirstNegative != "" {
+			fmt.Printf("WARNING: projected to go negative on %s\n", forecast.FirstNegative)
+		}
+		fmt.Println(sparkline(forecast.Days))
+
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(table, "Date\tKnown\tBalance\t\t")
+		for i, day := range forecast.Days {
+			if day.Known == 0 && day.Date != forecast.FirstNegative && i != len(forecast.Days)-1 {
+				continue
+			}
+			flag := ""
+			if day.Negative {
+				flag = "NEGATIVE"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t\n", day.Date, day.Known, day.Balance, flag)
+		}
+		table.Flush()
+	}
+}
+
+// sparkline draws the balances as one bar per day, scaled from the lowest to the highest
+func sparkline(days []ForecastDay) string {
+	bars := []rune("▁▂▃▄▅▆▇█")
+	if len(days) == 0 {
+		return ""
+	}
+	low, high := days[0].Balance, days[0].Balance
+	for _, day := range days {
+		if day.Balance < low {
+			low = day.Balance
+		}
+		if day.Balance > high {
+			high = day.Balance
+		}
+	}
+
+	var line strings.Builder
+	for _, day := range days {
+		bar := 0
+		if high > low {
+			bar = int((day.Balance - low) * Money(len(bars)-1) / (high - low))
+		}
+		line.WriteRune(bars[bar])
+	}
+	return line.String()
+}
+
+// A row of the comparison table
+func compareRow(name string, currency string, c Comparison) string {
+	change := func(percent *float64) string {
+		if percent == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%+.1f%%", *percent)
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s\t", name, currency, c.Current, c.Previous, change(c.ChangePrevious), c.LastYear, change(c.ChangeLastYear))
+}
+
+// Name of a bucket or bank, (none) for the line items without one
+func orNone(name string) string {
+	if name == "" {
+		return "(none)"
+	}
+	return name
 }
 
 // Process Function
-// Hosts all supported operations [Create, Read, Update, Delete]
-func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineItem) {
+// Hosts all supported operations [Create, Read, Update, Delete, Logout]
+// Returns false once the user logged out
+func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineItem) bool {
 
-	entities := []string{"BANK", "BUCKET", "LINEITEM"}
-	methods := []string{"CREATE", "VIEW", "UPDATE", "DELETE"}
+	entities := []string{"BANK", "BUCKET", "LINEITEM", "TRANSFER", "GOAL"}
+	methods := []string{"CREATE", "VIEW", "UPDATE", "DELETE", "IMPORT", "EXPORT", "REPORT", "FORECAST", "LOGOUT"}
 
 	var method string
 	for {
@@ -209,6 +924,32 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 		}
 	}
 
+	if method == "LOGOUT" {
+		logout()
+		fmt.Println("Logged out.")
+		return false
+	}
+
+	if method == "IMPORT" {
+		importStatement(banks, lineitems)
+		return true
+	}
+
+	if method == "EXPORT" {
+		exportFinances()
+		return true
+	}
+
+	if method == "REPORT" {
+		printReport()
+		return true
+	}
+
+	if method == "FORECAST" {
+		printForecast()
+		return true
+	}
+
 	var entity string
 	for {
 		fmt.Print("What record would you like to see? ")
@@ -233,40 +974,60 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 	case "CREATE":
 		switch entity {
 		case "BANK": // Operation for creating bank account
-			var name string
+			var name, currency string
 			fmt.Print("Creating Bank. \nName: ")
 			fmt.Scan(&name)
+			fmt.Print("Currency (e.g. USD, EUR): ")
+			fmt.Scan(&currency)
 
 			success := false
-			success = createBank(name, id)
+			success = createBank(name, currency, id)
 			if success {
 				fmt.Println("Bank created!")
-				fmt.Println("[Bank Id, Bank Name, Bank Owner Id]")
+				fmt.Println("[Bank Id, Bank Name, Bank Owner Id, Currency]")
 				fmt.Println("Your Banks: ")
-				*banks = getBanks(id)
+				*banks = getBanks()
 				fmt.Println(*banks)
 			} else {
 				fmt.Println("Unexpected error occured. Try again!")
 			}
 		case "BUCKET": // Operation for creating bucket
 			var name string
+			var budget *Budget
 			fmt.Print("Creating Bucket. \nName: ")
 			fmt.Scan(&name)
 
+			// Buckets can have a monthly or weekly budget
+			amount := readAmount("Budget (0 for no budget): ")
+			if amount > 0 {
+				budget = &Budget{Amount: amount}
+				for {
+					fmt.Print("Budget period [monthly weekly]: ")
+					fmt.Scan(&budget.Period)
+
+					if budget.Period != "monthly" && budget.Period != "weekly" {
+						fmt.Println("Invalid Period. Try again!")
+						continue
+					} else {
+						break
+					}
+				}
+			}
+
 			success := false
-			success = createBucket(name, id)
+			success = createBucket(name, budget, id)
 			if success {
 				fmt.Println("Bucket created!")
-				fmt.Println("[Bucket Id, Bucket Name, Bucket Owner Id]")
+				fmt.Println("[Bucket Id, Bucket Name, Bucket Owner Id, Budget]")
 				fmt.Println("Your Buckets: ")
-				*buckets = getBuckets(id)
+				*buckets = getBuckets()
 				fmt.Println(*buckets)
 			} else {
 				fmt.Println("Unexpected error occured. Try again!")
 			}
 		case "LINEITEM": // Operation for creating line item/expense entry
-			var title, description string
-			var amount float64
+			var title, description, occurredOn string
+			var amount Money
 			var bucket, bank int
 			fmt.Println("Creating Line Item Entry.")
 
@@ -281,8 +1042,10 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 				description = scanner.Text()
 			}
 
-			fmt.Print("Amount: ")
-			fmt.Scan(&amount)
+			occurredOn = readDate(scanner)
+
+			// Amounts are exact: negative for an expense, positive for income
+			amount = readAmount("Amount (negative for an expense): ")
 
 			// User can map line item entry to bucket
 			for {
@@ -320,8 +1083,84 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 						break
 					}
 				}
-				if !validBank {
-					fmt.Println("Invalid Bank. Try again!")
+				if !validBank {
+					fmt.Println("Invalid Bank. Try again!")
+					continue
+				} else {
+					break
+				}
+			}
+
+			// Warn before creating a line item that is probably there already, e.g. from an imported statement
+			if duplicates := checkDuplicate(title, occurredOn, amount, bank); len(duplicates) > 0 {
+				fmt.Println("This looks like a Line Item you already have: [Line Item Id, Title, Description, Amount, Bucket, Bank, Owner Id, Date, Transfer]")
+				for _, duplicate := range duplicates {
+					fmt.Println(duplicate.Second)
+				}
+
+				var create string
+				fmt.Print("Create it anyway? (Y/N) ")
+				fmt.Scan(&create)
+				if create != "Y" {
+					fmt.Println("Line Item not created.")
+					break
+				}
+			}
+
+			success := false
+			success = createLineItem(title, description, occurredOn, amount, bucket, bank, id)
+			if success {
+				fmt.Println("Line Item created!")
+				fmt.Println("[Line Item Id, Title, Description, Amount, Bucket, Bank, Owner Id, Date, Transfer]")
+				fmt.Println("Your Line Items: ")
+				fmt.Println(getLineItems())
+			} else {
+				fmt.Println("Unexpected error occured. Try again!")
+			}
+		case "TRANSFER": // Operation for moving money between two banks
+			var title, occurredOn string
+			var amount Money
+			var fromBank, toBank int
+			fmt.Println("Creating Transfer.")
+
+			scanner := bufio.NewScanner(os.Stdin)
+			fmt.Print("Title: ")
+			if scanner.Scan() {
+				title = scanner.Text()
+			}
+
+			occurredOn = readDate(scanner)
+
+			for {
+				amount = readAmount("Amount: ")
+				if amount <= 0 {
+					fmt.Println("Amount must be positive. Try again!")
+					continue
+				} else {
+					break
+				}
+			}
+
+			// Both banks must exist and differ
+			fmt.Print("Available Banks: ")
+			fmt.Println(*banks)
+			for {
+				fmt.Print("From Bank Id: ")
+				fmt.Scan(&fromBank)
+				fmt.Print("To Bank Id: ")
+				fmt.Scan(&toBank)
+
+				validFrom, validTo := false, false
+				for _, ban := range *banks {
+					if fromBank == ban.Id {
+						validFrom = true
+					}
+					if toBank == ban.Id {
+						validTo = true
+					}
+				}
+				if !validFrom || !validTo || fromBank == toBank {
+					fmt.Println("Invalid Banks. Try again!")
 					continue
 				} else {
 					break
@@ -329,36 +1168,82 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 			}
 
 			success := false
-			success = createLineItem(title, description, amount, bucket, bank, id)
+			success = createTransfer(title, occurredOn, amount, fromBank, toBank)
 			if success {
-				fmt.Println("Line Item created!")
-				fmt.Println("[Line Item Id, Title, Description, Amount, Bucket, Bank, Owner Id]")
-				fmt.Println("Your Line Items: ")
-				fmt.Println(getLineItems(id))
+				fmt.Println("Transfer created!")
+				fmt.Println("[Transfer Id, Title, Amount, From Bank, To Bank, Date]")
+				fmt.Println("Your Transfers: ")
+				fmt.Println(getTransfers())
+			} else {
+				fmt.Println("Unexpected error occured. Both banks need the same currency. Try again!")
+			}
+		case "GOAL": // Operation for creating a savings goal for a bucket or a bank
+			fmt.Println("Creating Goal.")
+			goal := readGoal(Goal{}, *buckets, *banks)
+
+			success := false
+			success = createGoal(goal)
+			if success {
+				fmt.Println("Goal created!")
+				printGoals(getGoals())
 			} else {
 				fmt.Println("Unexpected error occured. Try again!")
 			}
 		}
 	case "VIEW":
 		switch entity {
-		case "BANK": // Operation for retrieving bank records
-			fmt.Println("Your current banks: [Bank Id, Bank Name, Your ID]")
-			*banks = getBanks(id)
-			fmt.Println(*banks)
-		case "BUCKET": // Operation for retrieving bucket records
-			fmt.Println("Your current buckets: [Bucket Id, Bucket Name, Your ID]")
-			*buckets = getBuckets(id)
+		case "BANK": // Operation for retrieving bank records, with their balances
+			scanner := bufio.NewScanner(os.Stdin)
+			date := readLine(scanner, "Balances as of date (YYYY-MM-DD, empty for today): ", "")
+
+			*banks = getBanks()
+			fmt.Println("Your current banks: [Bank Id, Bank Name, Opening Balance, Balance]")
+			for _, bank := range *banks {
+				balance, ok := getBankBalance(bank.Id, date)
+				if !ok {
+					fmt.Println("Invalid Date. Try again!")
+					break
+				}
+				opening := fmt.Sprintf("%s %s", balance.Bank.OpeningBalance, bank.Currency)
+				if balance.Bank.OpeningDate != "" {
+					opening += " on " + balance.Bank.OpeningDate
+				}
+				fmt.Printf("%d  %s  %s  %s %s on %s\n", bank.Id, bank.Name, opening, balance.Balance, bank.Currency, balance.Date)
+			}
+		case "BUCKET": // Operation for retrieving bucket records, with their progress against the budget
+			fmt.Println("Your current buckets: [Bucket Id, Bucket Name, Your ID, Budget]")
+			*buckets = getBuckets()
 			fmt.Println(*buckets)
+
+			for _, bucket := range *buckets {
+				if bucket.Budget == nil {
+					continue
+				}
+				status := getBucketStatus(bucket.Id)
+				current := status.Current
+
+				line := fmt.Sprintf("%s: spent %s of %s (%.1f%%), %s left, %s to %s",
+					bucket.Name, current.Spent, current.Budget, current.PercentUsed, current.Remaining, current.Start, current.End)
+				if current.Overspent {
+					line += " - OVERSPENT"
+				}
+				fmt.Println(line)
+			}
 		case "LINEITEM": // Operation for retrieving line item/expense entries
 			fmt.Println("Your current items: [Line Item Id, Name, Description, Amount, Bucket, Bank, Your ID]")
-			*lineitems = getLineItems(id)
+			*lineitems = getLineItems()
 			fmt.Println(*lineitems)
+		case "TRANSFER": // Operation for retrieving transfers
+			fmt.Println("Your transfers: [Transfer Id, Title, Amount, From Bank, To Bank, Date]")
+			fmt.Println(getTransfers())
+		case "GOAL": // Operation for retrieving savings goals, with their progress
+			printGoals(getGoals())
 		}
 	case "UPDATE":
 		switch entity {
 		case "BANK": // Operation for updating bank records
 			fmt.Println("Your current banks: [Bank Id, Bank Name, Your ID]")
-			*banks = getBanks(id)
+			*banks = getBanks()
 			fmt.Println(*banks)
 
 			var bankId int
@@ -377,7 +1262,7 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 			}
 			if !found {
 				fmt.Println("Invalid ID. Returning to main menu.")
-				return
+				return true
 			}
 
 			var bankName string
@@ -396,9 +1281,9 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 
 			if success {
 				fmt.Println("Bank updated!")
-				fmt.Println("[Bank Id, Bank Name, Bank Owner Id]")
+				fmt.Println("[Bank Id, Bank Name, Bank Owner Id, Currency]")
 				fmt.Println("Your Banks: ")
-				*banks = getBanks(id)
+				*banks = getBanks()
 				fmt.Println(*banks)
 			} else {
 				fmt.Println("Unexpected error occured. Try again!")
@@ -406,7 +1291,7 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 
 		case "BUCKET": // Operation for updating bucket records
 			fmt.Println("Your current buckets: [Bucket Id, Bucket Name, Your ID]")
-			*buckets = getBuckets(id)
+			*buckets = getBuckets()
 			fmt.Println(*buckets)
 
 			var bucketId int
@@ -425,7 +1310,7 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 			}
 			if !found {
 				fmt.Println("Invalid ID. Returning to main menu.")
-				return
+				return true
 			}
 
 			var bucketName string
@@ -437,19 +1322,50 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 			}
 
 			success := false
-			success = updateBucket(bucketId, bucketName, id)
+			success = updateBucket(bucketId, bucketName, bucket.Budget, id)
 
 			if success {
 				fmt.Println("Bucket updated!")
 				fmt.Println("[Bucket Id, Bucket Name, Your ID]")
 				fmt.Println("Your Buckets: ")
-				*buckets = getBuckets(id)
+				*buckets = getBuckets()
 				fmt.Println(*buckets)
 			} else {
 				fmt.Println("Unexpected error occured. Try again!")
 			}
 
-		case "LINEITEM": // Updating Line Item will not be supported. Suggest to do DELETE then ADD
+		case "GOAL": // Operation for updating a savings goal
+			goals := getGoals()
+			printGoals(goals)
+
+			var goalId int
+			fmt.Print("Enter the Goal Id for update: ")
+			fmt.Scan(&goalId)
+
+			var goal Goal
+			found := false
+			for _, val := range goals {
+				if val.Id == goalId {
+					goal = val
+					found = true
+					break
+				}
+			}
+			if !found {
+				fmt.Println("Invalid ID. Returning to main menu.")
+				return true
+			}
+
+			success := false
+			success = updateGoal(goalId, readGoal(goal, *buckets, *banks))
+			if success {
+				fmt.Println("Goal updated!")
+				printGoals(getGoals())
+			} else {
+				fmt.Println("Unexpected error occured. Try again!")
+			}
+
+		case "LINEITEM", "TRANSFER": // Updating Line Item or Transfer will not be supported. Suggest to do DELETE then ADD
 			fmt.Println("Not supported! Please perform delete then add operation instead.")
 			fmt.Println("Returning to main menu...")
 		}
@@ -457,7 +1373,7 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 		switch entity {
 		case "BANK": // Operation for deleting bank record
 			fmt.Println("Your current banks: [Bank Id, Bank Name, Your ID]")
-			*banks = getBanks(id)
+			*banks = getBanks()
 			fmt.Println(*banks)
 
 			var bank int
@@ -468,9 +1384,9 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 			success = deleteBank(id, bank)
 			if success {
 				fmt.Println("Bank deleted!")
-				fmt.Println("[Bank Id, Bank Name, Bank Owner Id]")
+				fmt.Println("[Bank Id, Bank Name, Bank Owner Id, Currency]")
 				fmt.Println("Your Banks: ")
-				*banks = getBanks(id)
+				*banks = getBanks()
 				fmt.Println(*banks)
 			} else {
 				fmt.Println("Unexpected error occured. Try again!")
@@ -478,7 +1394,7 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 
 		case "BUCKET": // Operation for deleting bucket record
 			fmt.Println("Your current buckets: [Bucket Id, Bucket Name, Your ID]")
-			*buckets = getBuckets(id)
+			*buckets = getBuckets()
 			fmt.Println(*buckets)
 
 			var bucket int
@@ -491,7 +1407,7 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 				fmt.Println("Bucket deleted!")
 				fmt.Println("[Bucket Id, Bucket Name, Bucket Owner Id]")
 				fmt.Println("Your Buckets: ")
-				*buckets = getBuckets(id)
+				*buckets = getBuckets()
 				fmt.Println(*buckets)
 			} else {
 				fmt.Println("Unexpected error occured. Try again!")
@@ -499,7 +1415,7 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 
 		case "LINEITEM": // Operation for deleting line item/expense entry
 			fmt.Println("Your current items: [Line Item Id, Name, Description, Amount, Bucket, Bank, Your ID]")
-			*lineitems = getLineItems(id)
+			*lineitems = getLineItems()
 			fmt.Println(*lineitems)
 
 			var lineitem int
@@ -512,138 +1428,437 @@ func process(id int, banks *[]BankAccount, buckets *[]Bucket, lineitems *[]LineI
 				fmt.Println("LineItem deleted!")
 				fmt.Println("[LineItem Id, LineItem Name, LineItem Owner Id]")
 				fmt.Println("Your LineItems: ")
-				*lineitems = getLineItems(id)
+				*lineitems = getLineItems()
 				fmt.Println(*lineitems)
+			} else {
+				fmt.Println("Unexpected error occured. Line Items of a Transfer are deleted with the Transfer. Try again!")
+			}
+
+		case "TRANSFER": // Operation for deleting a transfer and both of its line items
+			fmt.Println("Your transfers: [Transfer Id, Title, Amount, From Bank, To Bank, Date]")
+			fmt.Println(getTransfers())
+
+			var transfer int
+			fmt.Print("Enter the Transfer Id for deletion: ")
+			fmt.Scan(&transfer)
+
+			success := false
+			success = deleteTransfer(transfer)
+			if success {
+				fmt.Println("Transfer deleted!")
+				fmt.Println("Your Transfers: ")
+				fmt.Println(getTransfers())
+			} else {
+				fmt.Println("Unexpected error occured. Try again!")
+			}
+
+		case "GOAL": // Operation for deleting a savings goal
+			printGoals(getGoals())
+
+			var goal int
+			fmt.Print("Enter the Goal Id for deletion: ")
+			fmt.Scan(&goal)
+
+			success := false
+			success = deleteGoal(goal)
+			if success {
+				fmt.Println("Goal deleted!")
+				printGoals(getGoals())
 			} else {
 				fmt.Println("Unexpected error occured. Try again!")
 			}
 		}
 	}
+	return true
+}
+
+// Build a request to the Server HTTP API on behalf of the signed-in user
+// Refreshes the session token first if it is about to expire
+func newRequest(method string, path string, body io.Reader) *http.Request {
+	if time.Now().Add(30 * time.Second).After(session.ExpiresAt) {
+		refreshSession()
+	}
+
+	request, err := http.NewRequest(method, ROOT_URL+path, body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+session.Token)
+	return request
 }
 
 // Get Bank Records from Server HTTP API
-func getBanks(ownerid int) []BankAccount {
+func getBanks() []BankAccount {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	response, err := client.Get(ROOT_URL + "/banks")
+	response, err := client.Do(newRequest("GET", "/banks", nil))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer response.Body.Close()
 
-	var banks, filtered []BankAccount
+	var banks []BankAccount
 
 	if err := json.NewDecoder(response.Body).Decode(&banks); err != nil {
 		log.Fatal(err)
 	}
 
-	for _, bank := range banks {
-		if bank.Owner == ownerid {
-			filtered = append(filtered, bank)
-		}
-	}
-
-	return filtered
+	return banks
 }
 
 // Get Bucket Records from Server HTTP API
-func getBuckets(ownerid int) []Bucket {
+func getBuckets() []Bucket {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	response, err := client.Get(ROOT_URL + "/buckets")
+	response, err := client.Do(newRequest("GET", "/buckets", nil))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer response.Body.Close()
 
-	var buckets, filtered []Bucket
+	var buckets []Bucket
 
 	if err := json.NewDecoder(response.Body).Decode(&buckets); err != nil {
 		log.Fatal(err)
 	}
 
-	for _, bucket := range buckets {
-		if bucket.Owner == ownerid {
-			filtered = append(filtered, bucket)
+	return buckets
+}
+
+// Get Line Item/Expense Entries from Server HTTP API
+// The server returns line items a page at a time, with the total count in X-Total-Count
+func getLineItems() []LineItem {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+
+	var lineitems []LineItem
+	for {
+		response, err := client.Do(newRequest("GET", fmt.Sprintf("/lineitems?limit=%d&offset=%d", PAGE_SIZE, len(lineitems)), nil))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var page []LineItem
+		if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+			log.Fatal(err)
+		}
+		response.Body.Close()
+
+		lineitems = append(lineitems, page...)
+		total, _ := strconv.Atoi(response.Header.Get("X-Total-Count"))
+		if len(page) == 0 || len(lineitems) >= total {
+			break
 		}
 	}
 
-	return filtered
+	return lineitems
 }
 
-// Get Line Item/Expense Entries from Server HTTP API
-func getLineItems(ownerid int) []LineItem {
+// Get the balance of a Bank Account via Server HTTP API, at the end of date (empty for today)
+func getBankBalance(id int, date string) (BankBalance, bool) {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	response, err := client.Get(ROOT_URL + "/lineitems")
+	response, err := client.Do(newRequest("GET", fmt.Sprintf("/bank/%d/balance?date=%s", id, url.QueryEscape(date)), nil))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer response.Body.Close()
 
-	var lineitems, filtered []LineItem
-
-	if err := json.NewDecoder(response.Body).Decode(&lineitems); err != nil {
-		log.Fatal(err)
+	var balance BankBalance
+	if response.StatusCode != http.StatusOK {
+		return balance, false
 	}
-
-	for _, lineitem := range lineitems {
-		if lineitem.Owner == ownerid {
-			filtered = append(filtered, lineitem)
-		}
+	if err := json.NewDecoder(response.Body).Decode(&balance); err != nil {
+		log.Fatal(err)
 	}
-
-	return filtered
+	return balance, true
 }
 
 // Delete Bank Record via Server HTTP API
 func deleteBank(ownerid int, id int) bool {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	url := fmt.Sprintf("%s/bank/%d", ROOT_URL, id)
-	request, err := http.NewRequest("DELETE", url, nil)
+	response, err := client.Do(newRequest("DELETE", fmt.Sprintf("/bank/%d", id), nil))
 	if err != nil {
 		log.Fatal(err)
 		return false
 	}
-	_, err2 := client.Do(request)
-	if err2 != nil {
-		log.Fatal(err2)
-		return false
-	}
-	return true
+	defer response.Body.Close()
+
+	return response.StatusCode < 400
 }
 
 // Delete Bucket Record via Server HTTP API
 func deleteBucket(ownerid int, id int) bool {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	url := fmt.Sprintf("%s/bucket/%d", ROOT_URL, id)
-	request, err := http.NewRequest("DELETE", url, nil)
+	response, err := client.Do(newRequest("DELETE", fmt.Sprintf("/bucket/%d", id), nil))
 	if err != nil {
 		log.Fatal(err)
 		return false
 	}
-	_, err2 := client.Do(request)
-	if err2 != nil {
-		log.Fatal(err2)
-		return false
-	}
-	return true
+	defer response.Body.Close()
+
+	return response.StatusCode < 400
 }
 
 // Delete Line Item/Expense Entry via Server HTTP API
 func deleteLineItem(ownerid int, id int) bool {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	url := fmt.Sprintf("%s/lineitem/%d", ROOT_URL, id)
-	request, err := http.NewRequest("DELETE", url, nil)
+	response, err := client.Do(newRequest("DELETE", fmt.Sprintf("/lineitem/%d", id), nil))
 	if err != nil {
 		log.Fatal(err)
 		return false
 	}
-	_, err2 := client.Do(request)
-	if err2 != nil {
-		log.Fatal(err2)
+	defer response.Body.Close()
+
+	return response.StatusCode < 400
+}
+
+// Retrieve the budget progress of a Bucket via Server HTTP API
+func getBucketStatus(id int) BucketStatus {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	response, err := client.Do(newRequest("GET", fmt.Sprintf("/buckets/%d/status?periods=1", id), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var status BucketStatus
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		log.Fatal(err)
+	}
+
+	return status
+}
+
+// Retrieve Transfers via Server HTTP API
+func getTransfers() []Transfer {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	response, err := client.Do(newRequest("GET", fmt.Sprintf("/transfers?limit=%d", PAGE_SIZE), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var transfers []Transfer
+	if err := json.NewDecoder(response.Body).Decode(&transfers); err != nil {
+		log.Fatal(err)
+	}
+
+	return transfers
+}
+
+// Create Transfer via Server HTTP API
+func createTransfer(title string, occurredOn string, amount Money, fromBank int, toBank int) bool {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	body := fmt.Sprintf("{\"title\": \"%s\", \"occurred_on\": \"%s\", \"amount\": %s, \"from_bank\": %d, \"to_bank\": %d}", title, occurredOn, amount, fromBank, toBank)
+	payload := bytes.NewBuffer([]byte(body))
+
+	response, err := client.Do(newRequest("POST", "/transfers", payload))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	return response.StatusCode < 400
+}
+
+// Delete Transfer, and both of its line items, via Server HTTP API
+func deleteTransfer(id int) bool {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	response, err := client.Do(newRequest("DELETE", fmt.Sprintf("/transfer/%d", id), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	return response.StatusCode < 400
+}
+
+// Get Goals, with their progress, via Server HTTP API
+func getGoals() []Goal {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	response, err := client.Do(newRequest("GET", fmt.Sprintf("/goals?limit=%d", PAGE_SIZE), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var goals []Goal
+	if err := json.NewDecoder(response.Body).Decode(&goals); err != nil {
+		log.Fatal(err)
+	}
+
+	return goals
+}
+
+// Create Goal via Server HTTP API
+func createGoal(goal Goal) bool {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	body, _ := json.Marshal(goal)
+
+	response, err := client.Do(newRequest("POST", "/goals", bytes.NewBuffer(body)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	return response.StatusCode < 400
+}
+
+// Update Goal via Server HTTP API
+func updateGoal(id int, goal Goal) bool {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	body, _ := json.Marshal(goal)
+
+	response, err := client.Do(newRequest("PUT", fmt.Sprintf("/goal/%d", id), bytes.NewBuffer(body)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	return response.StatusCode < 400
+}
+
+// Delete Goal via Server HTTP API
+func deleteGoal(id int) bool {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	response, err := client.Do(newRequest("DELETE", fmt.Sprintf("/goal/%d", id), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	return response.StatusCode < 400
+}
+
+// Check a Line Item for likely duplicates before creating it, via Server HTTP API
+// Returns the existing Line Items with the same bank and amount, a nearby date and a similar title
+func checkDuplicate(title string, occurredOn string, amount Money, bank int) []DuplicatePair {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	body, _ := json.Marshal(LineItem{Title: title, OccurredOn: occurredOn, Amount: amount, Bank: bank})
+
+	response, err := client.Do(newRequest("POST", "/duplicates/check", bytes.NewBuffer(body)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var duplicates []DuplicatePair
+	if response.StatusCode >= 400 {
+		return duplicates
+	}
+	if err := json.NewDecoder(response.Body).Decode(&duplicates); err != nil {
+		log.Fatal(err)
+	}
+	return duplicates
+}
+
+// Retrieve the Import Profiles of a Bank via Server HTTP API
+func getImportProfiles(bank int) []ImportProfile {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	response, err := client.Do(newRequest("GET", fmt.Sprintf("/importprofiles?bank=%d&limit=%d", bank, PAGE_SIZE), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var profiles []ImportProfile
+	if response.StatusCode >= 400 {
+		return profiles
+	}
+	if err := json.NewDecoder(response.Body).Decode(&profiles); err != nil {
+		log.Fatal(err)
+	}
+
+	return profiles
+}
+
+// Create Import Profile via Server HTTP API
+// Returns the id of the new profile
+func createImportProfile(profile ImportProfile) (int, bool) {
+	client := http.Client{Timeout: time.Duration(1) * time.Second}
+	body, _ := json.Marshal(profile)
+
+	response, err := client.Do(newRequest("POST", "/importprofiles", bytes.NewBuffer(body)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return 0, false
+	}
+	if err := json.NewDecoder(response.Body).Decode(&profile); err != nil {
+		log.Fatal(err)
+	}
+	return profile.Id, true
+}
+
+// Import a statement file via Server HTTP API, to one of the /import endpoints
+// Rows that could not be read are returned in the result, nothing is imported then
+func importFile(endpoint string, statement []byte) (ImportResult, bool) {
+	client := http.Client{Timeout: time.Duration(30) * time.Second}
+	request := newRequest("POST", endpoint, bytes.NewBuffer(statement))
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	response, err := client.Do(request)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var result ImportResult
+	if response.StatusCode >= 400 && response.StatusCode != http.StatusUnprocessableEntity {
+		return result, false
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		log.Fatal(err)
+	}
+	return result, true
+}
+
+// Get a report via Server HTTP API, decoding it into report
+func getReport(path string, query url.Values, report interface{}) bool {
+	client := http.Client{Timeout: time.Duration(10) * time.Second}
+	response, err := client.Do(newRequest("GET", path+"?"+query.Encode(), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(response.Body)
+		fmt.Println("Report failed. " + strings.TrimSpace(string(message)))
 		return false
 	}
+	if err := json.NewDecoder(response.Body).Decode(report); err != nil {
+		log.Fatal(err)
+	}
 	return true
 }
 
+// Download an export via Server HTTP API, writing it to a file as it arrives
+func downloadExport(query string, path string) error {
+	client := http.Client{Timeout: time.Duration(5) * time.Minute}
+	response, err := client.Do(newRequest("GET", "/export?"+query, nil))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(response.Body)
+		return errors.New(strings.TrimSpace(string(message)))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, response.Body); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
 // Create User Account via Server HTTP API
 func createUser(username string, name string, pin int) bool {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
@@ -661,12 +1876,12 @@ func createUser(username string, name string, pin int) bool {
 }
 
 // Create Bank Account via Server HTTP API
-func createBank(name string, ownerid int) bool {
+func createBank(name string, currency string, ownerid int) bool {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	body := fmt.Sprintf("{\"name\": \"%s\", \"ownerid\": %d}", name, ownerid)
+	body := fmt.Sprintf("{\"name\": \"%s\", \"currency\": \"%s\", \"ownerid\": %d}", name, currency, ownerid)
 	payload := bytes.NewBuffer([]byte(body))
 
-	response, err := client.Post(ROOT_URL+"/banks", "application/json", payload)
+	response, err := client.Do(newRequest("POST", "/banks", payload))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -676,12 +1891,13 @@ func createBank(name string, ownerid int) bool {
 }
 
 // Create Bucket via Server HTTP API
-func createBucket(name string, ownerid int) bool {
+func createBucket(name string, budget *Budget, ownerid int) bool {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	body := fmt.Sprintf("{\"name\": \"%s\", \"ownerid\": %d}", name, ownerid)
+	budgetJSON, _ := json.Marshal(budget)
+	body := fmt.Sprintf("{\"name\": \"%s\", \"budget\": %s, \"ownerid\": %d}", name, budgetJSON, ownerid)
 	payload := bytes.NewBuffer([]byte(body))
 
-	response, err := client.Post(ROOT_URL+"/buckets", "application/json", payload)
+	response, err := client.Do(newRequest("POST", "/buckets", payload))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -691,11 +1907,11 @@ func createBucket(name string, ownerid int) bool {
 }
 
 // Create Line Item/Expense Entry via Server HTTP API
-func createLineItem(title string, description string, amount float64, bucket int, bank int, ownerid int) bool {
+func createLineItem(title string, description string, occurredOn string, amount Money, bucket int, bank int, ownerid int) bool {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
 
 	body := ""
-	body += fmt.Sprintf("\"title\": \"%s\", \"description\": \"%s\", \"amount\": %f,", title, description, amount)
+	body += fmt.Sprintf("\"title\": \"%s\", \"description\": \"%s\", \"occurred_on\": \"%s\", \"amount\": %s,", title, description, occurredOn, amount)
 	if bucket == 0 {
 		body += "\"bucket\": null,"
 	} else {
@@ -709,7 +1925,7 @@ func createLineItem(title string, description string, amount float64, bucket int
 	body = "{" + body + fmt.Sprintf("\"ownerid\": %d}", ownerid)
 	payload := bytes.NewBuffer([]byte(body))
 
-	response, err := client.Post(ROOT_URL+"/lineitems", "application/json", payload)
+	response, err := client.Do(newRequest("POST", "/lineitems", payload))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -724,13 +1940,10 @@ func updateBank(id int, name string, ownerid int) bool {
 	body := fmt.Sprintf("{\"name\": \"%s\", \"ownerid\": %d}", name, ownerid)
 	payload := bytes.NewBuffer([]byte(body))
 
-	request, err := http.NewRequest("PUT", ROOT_URL+"/bank/"+fmt.Sprint(id), payload)
-	if err != nil {
-		log.Fatal(err)
-	}
+	request := newRequest("PUT", "/bank/"+fmt.Sprint(id), payload)
 
-	response, err2 := client.Do(request)
-	if err2 != nil {
+	response, err := client.Do(request)
+	if err != nil {
 		log.Fatal(err)
 	}
 	defer response.Body.Close()
@@ -739,19 +1952,18 @@ func updateBank(id int, name string, ownerid int) bool {
 }
 
 // Update Bucket via Server HTTP API
-func updateBucket(id int, name string, ownerid int) bool {
+// The budget is sent along unchanged, as the server replaces it on update
+func updateBucket(id int, name string, budget *Budget, ownerid int) bool {
 	client := http.Client{Timeout: time.Duration(1) * time.Second}
-	body := fmt.Sprintf("{\"name\": \"%s\", \"ownerid\": %d}", name, ownerid)
+	budgetJSON, _ := json.Marshal(budget)
+	body := fmt.Sprintf("{\"name\": \"%s\", \"budget\": %s, \"ownerid\": %d}", name, budgetJSON, ownerid)
 	payload := bytes.NewBuffer([]byte(body))
 
-	request, err := http.NewRequest("PUT", ROOT_URL+"/bucket/"+fmt.Sprint(id), payload)
+	request := newRequest("PUT", "/bucket/"+fmt.Sprint(id), payload)
+	response, err := client.Do(request)
 	if err != nil {
 		log.Fatal(err)
 	}
-	response, err2 := client.Do(request)
-	if err2 != nil {
-		log.Fatal(err)
-	}
 
 	defer response.Body.Close()
 
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Types of bank accounts
+const (
+	ACCOUNT_CHECKING = "checking"
+	ACCOUNT_SAVINGS  = "savings" // earns interest by its interest tiers
+	ACCOUNT_CREDIT   = "credit"  // credit card, a liability
+	ACCOUNT_LOAN     = "loan"    // a liability
+)
+
+// Title of the line items that post interest
+const INTEREST_TITLE = "Interest"
+
+// Annual Rate, in percent, on the whole balance of a savings account once it reaches MinBalance
+type InterestTier struct {
+	MinBalance Money   `json:"min_balance"`
+	Rate       float64 `json:"rate"`
+}
+
+// Interest of a savings account for one month, accrued daily on the balance at the end of each
+// day from From to To and posted on To. Balance is the balance before From; Accrued is the
+// interest up to today of the current month.
+type InterestPeriod struct {
+	Month    string `json:"month"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Balance  Money  `json:"balance"`
+	Accrued  Money  `json:"accrued"`
+	Interest Money  `json:"interest"`
+}
+
+// Response of /bank/{id}/interest/preview
+type InterestPreview struct {
+	Bank    int              `json:"bank"`
+	Tiers   []InterestTier   `json:"tiers"`
+	Periods []InterestPeriod `json:"periods"`
+}
+
+// checkAccountType validates an account type, checking by default.
+func checkAccountType(accountType string) (string, error) {
+	switch accountType {
+	case "":
+		return ACCOUNT_CHECKING, nil
+	case ACCOUNT_CHECKING, ACCOUNT_SAVINGS, ACCOUNT_CREDIT, ACCOUNT_LOAN:
+		return accountType, nil
+	}
+	return "", fmt.Errorf("invalid account_type %q, expected checking, savings, credit or loan", accountType)
+}
+
+// checkTiers validates interest tiers and sorts them by their minimum balance.
+func checkTiers(tiers []InterestTier) error {
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinBalance < tiers[j].MinBalance })
+	for i, tier := range tiers {
+		if tier.Rate < 0 || tier.Rate >= 100 {
+			return fmt.Errorf("invalid rate %v, expected a percentage from 0 to below 100", tier.Rate)
+		}
+		if i > 0 && tier.MinBalance == tiers[i-1].MinBalance {
+			return fmt.Errorf("two tiers with min_balance %s", tier.MinBalance)
+		}
+	}
+	return nil
+}
+
+// monthStart returns the first day of the month of date.
+func monthStart(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// accrue returns the interest, in cents, accrued from from to to (inclusive) on balance, the
+// balance before from, with the changes by date applied at the end of their day.
+func accrue(tiers []InterestTier, balance Money, changes map[string]Money, from time.Time, to time.Time) float64 {
+	rates := rateTiers(tiers)
+	interest := 0.0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		balance += changes[day.Format(DATE_LAYOUT)]
+		interest += dailyInterest(float64(balance), tierRate(rates, float64(balance)))
+	}
+	return interest
+}
+
+// projectInterest returns the interest of months months from the month of from, starting at
+// from, on balance, the balance before from. The interest of each month is posted on its last
+// day, so it earns interest from the next month on. Accrued counts the days up to now.
+func projectInterest(tiers []InterestTier, balance Money, changes map[string]Money, from time.Time, months int, now time.Time) []InterestPeriod {
+	var periods []InterestPeriod
+	for i := 0; i < months; i++ {
+		to := monthStart(from).AddDate(0, 1, -1)
+		period := InterestPeriod{
+			Month:    from.Format("2006-01"),
+			From:     from.Format(DATE_LAYOUT),
+			To:       to.Format(DATE_LAYOUT),
+			Balance:  balance,
+			Interest: Money(math.Round(accrue(tiers, balance, changes, from, to))),
+		}
+		if !now.Before(from) {
+			accruedTo := now
+			if accruedTo.After(to) {
+				accruedTo = to
+			}
+			period.Accrued = Money(math.Round(accrue(tiers, balance, changes, from, accruedTo)))
+		}
+		periods = append(periods, period)
+
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			balance += changes[day.Format(DATE_LAYOUT)]
+		}
+		balance += period.Interest
+		from = to.AddDate(0, 0, 1)
+	}
+	return periods
+}
+
+// readTiers returns the interest tiers of a bank account, sorted by their minimum balance.
+func readTiers(q queryRower, bank int) ([]InterestTier, error) {
+	rows, err := q.Query("SELECT min_balance, rate FROM public.interesttier WHERE bank=$1 ORDER BY min_balance;", bank)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tiers := []InterestTier{}
+	for rows.Next() {
+		var tier InterestTier
+		if err := rows.Scan(&tier.MinBalance, &tier.Rate); err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, rows.Err()
+}
+
+// dailyChanges returns the sum of the line items of a bank account per day from from to to.
+func dailyChanges(q queryRower, bank int, from time.Time, to time.Time) (map[string]Money, error) {
+	rows, err := q.Query(
+		`SELECT to_char(occurred_on, 'YYYY-MM-DD'), sum(amount) FROM public.lineitem
+		WHERE bank=$1 AND occurred_on >= $2 AND occurred_on <= $3 GROUP BY 1;`,
+		bank,
+		from.Format(DATE_LAYOUT),
+		to.Format(DATE_LAYOUT),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := map[string]Money{}
+	for rows.Next() {
+		var date string
+		var amount Money
+		if err := rows.Scan(&date, &amount); err != nil {
+			return nil, err
+		}
+		changes[date] = amount
+	}
+	return changes, rows.Err()
+}
+
+// postDueInterest posts the interest of the months that ended on every savings account.
+// Interest missed while the server was down is posted too.
+func postDueInterest() error {
+	rows, err := db.Query("SELECT id FROM public.bankaccount WHERE account_type=$1 AND interest_start IS NOT NULL;", ACCOUNT_SAVINGS)
+	if err != nil {
+		return err
+	}
+	var due []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, id)
+	}
+	rows.Close()
+
+	for _, id := range due {
+		if err := postInterest(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postInterest posts the interest of every month of a savings account from its interest start
+// up to the month before the current one, as a line item on the last day of the month.
+// The bank account row is locked, so concurrent runs skip it, and the posting of each month is
+// recorded first, so a month already posted is never posted again.
+func postInterest(bank int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owner int
+	var start string
+	err = tx.QueryRow(
+		"SELECT ownerid, to_char(interest_start, 'YYYY-MM-DD') FROM public.bankaccount WHERE id=$1 AND account_type=$2 AND interest_start IS NOT NULL FOR UPDATE SKIP LOCKED;",
+		bank,
+		ACCOUNT_SAVINGS,
+	).Scan(&owner, &start)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tiers, err := readTiers(tx, bank)
+	if err != nil {
+		return err
+	}
+
+	from, _ := parseDate(start)
+	now, _ := parseDate(today())
+	posted := 0
+	for ; from.Before(monthStart(now)); from = monthStart(from).AddDate(0, 1, 0) {
+		to := monthStart(from).AddDate(0, 1, -1)
+		result, err := tx.Exec(
+			"INSERT INTO public.interestposting (bank, period, amount) VALUES($1, $2, 0) ON CONFLICT (bank, period) DO NOTHING;",
+			bank,
+			monthStart(from).Format(DATE_LAYOUT),
+		)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+
+		// The balance includes the interest posted for the months before
+		balance, err := bankBalance(tx, bank, from.AddDate(0, 0, -1).Format(DATE_LAYOUT))
+		if err != nil {
+			return err
+		}
+		changes, err := dailyChanges(tx, bank, from, to)
+		if err != nil {
+			return err
+		}
+		interest := Money(math.Round(accrue(tiers, balance, changes, from, to)))
+		if interest == 0 {
+			continue
+		}
+
+		var lineitem int
+		err = tx.QueryRow(
+			"INSERT INTO public.lineitem (title, description, amount, bank, ownerid, occurred_on) VALUES($1, $2, $3, $4, $5, $6) RETURNING id;",
+			INTEREST_TITLE,
+			"Interest for "+from.Format("2006-01"),
+			interest,
+			bank,
+			owner,
+			to.Format(DATE_LAYOUT),
+		).Scan(&lineitem)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"UPDATE public.interestposting SET amount=$1, lineitem=$2 WHERE bank=$3 AND period=$4;",
+			interest,
+			lineitem,
+			bank,
+			monthStart(from).Format(DATE_LAYOUT),
+		)
+		if err != nil {
+			return err
+		}
+		posted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if posted > 0 {
+		InfoLogger.Printf("Posted %d months of interest to bank account %d.", posted, bank)
+	}
+	return nil
+}
+
+// Interest tiers of a savings account (GET), or replace them (PUT with a list of tiers)
+// Interest accrues from the day an account without tiers gets them; no tiers stop it.
+func bankInterestProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	bank, err := readBank(owner, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Bank Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		InfoLogger.Println("Interest Tiers retrieved.")
+	case "PUT":
+		var tiers []InterestTier
+		if err := json.NewDecoder(r.Body).Decode(&tiers); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := checkTiers(tiers); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if bank.AccountType != ACCOUNT_SAVINGS {
+			http.Error(w, "Interest accrues on savings accounts only.", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer tx.Rollback()
+
+		var start interface{}
+		if len(tiers) > 0 {
+			start = today()
+		}
+		_, err = tx.Exec("UPDATE public.bankaccount SET interest_start=CASE WHEN $1::date IS NULL THEN NULL ELSE coalesce(interest_start, $1::date) END WHERE id=$2;", start, id)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM public.interesttier WHERE bank=$1;", id)
+		}
+		for _, tier := range tiers {
+			if err != nil {
+				break
+			}
+			_, err = tx.Exec("INSERT INTO public.interesttier (bank, min_balance, rate) VALUES($1, $2, $3);", id, tier.MinBalance, tier.Rate)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Interest Tiers Updated.")
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	tiers, err := readTiers(db, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	if err := json.NewEncoder(w).Encode(tiers); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Projected interest of a savings account for the current month and the months (3) after it,
+// counting the line items already dated then and the interest of each month once posted
+func bankInterestPreviewProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	months, err := parseMonths(r.URL.Query().Get("months"), "months", DEFAULT_FORECAST_MONTHS)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bank, err := readBank(owner, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Bank Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	if bank.AccountType != ACCOUNT_SAVINGS {
+		http.Error(w, "Interest accrues on savings accounts only.", http.StatusBadRequest)
+		return
+	}
+
+	now, _ := parseDate(today())
+	from := monthStart(now)
+	var start string
+	db.QueryRow("SELECT coalesce(to_char(interest_start, 'YYYY-MM-DD'), '') FROM public.bankaccount WHERE id=$1;", id).Scan(&start)
+	if date, err := parseDate(start); err == nil && date.After(from) {
+		from = date
+	}
+
+	preview := InterestPreview{Bank: id}
+	preview.Tiers, err = readTiers(db, id)
+	var balance Money
+	if err == nil {
+		balance, err = bankBalance(db, id, from.AddDate(0, 0, -1).Format(DATE_LAYOUT))
+	}
+	var changes map[string]Money
+	if err == nil {
+		changes, err = dailyChanges(db, id, from, monthStart(now).AddDate(0, months, -1))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	preview.Periods = projectInterest(preview.Tiers, balance, changes, from, months, now)
+	InfoLogger.Println("Interest Preview computed.")
+
+	if err := json.NewEncoder(w).Encode(preview); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckAccountType(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		valid bool
+	}{
+		{
+			name:  "Default type",
+			value: "",
+			want:  ACCOUNT_CHECKING,
+			valid: true,
+		},
+		{
+			name:  "Savings",
+			value: "savings",
+			want:  ACCOUNT_SAVINGS,
+			valid: true,
+		},
+		{
+			name:  "Credit",
+			value: "credit",
+			want:  ACCOUNT_CREDIT,
+			valid: true,
+		},
+		{
+			name:  "Loan",
+			value: "loan",
+			want:  ACCOUNT_LOAN,
+			valid: true,
+		},
+		{
+			name:  "Upper case",
+			value: "Savings",
+			want:  "",
+			valid: false,
+		},
+		{
+			name:  "Unknown type",
+			value: "brokerage",
+			want:  "",
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkAccountType(tt.value)
+			if (err == nil) != tt.valid || got != tt.want {
+				t.Errorf("checkAccountType(%q) = %q, %v, want %q, valid %v", tt.value, got, err, tt.want, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCheckTiers(t *testing.T) {
+	tiers := []InterestTier{{MinBalance: 500000, Rate: 2.475}, {MinBalance: 0, Rate: 0.5}, {MinBalance: 100000, Rate: 1.621}}
+	if err := checkTiers(tiers); err != nil {
+		t.Fatalf("checkTiers error = %v", err)
+	}
+	want := []InterestTier{{MinBalance: 0, Rate: 0.5}, {MinBalance: 100000, Rate: 1.621}, {MinBalance: 500000, Rate: 2.475}}
+	if !reflect.DeepEqual(tiers, want) {
+		t.Errorf("checkTiers sorted = %v, want %v", tiers, want)
+	}
+
+	if err := checkTiers([]InterestTier{{MinBalance: 0, Rate: 100}}); err == nil {
+		t.Errorf("checkTiers accepted a rate of 100%%")
+	}
+	if err := checkTiers([]InterestTier{{MinBalance: 0, Rate: 1}, {MinBalance: 0, Rate: 2}}); err == nil {
+		t.Errorf("checkTiers accepted two tiers with the same minimum balance")
+	}
+}
+
+func TestAccrue(t *testing.T) {
+	from, _ := parseDate("2021-03-01")
+	to, _ := parseDate("2021-03-03")
+	changes := map[string]Money{"2021-03-02": 100000}
+
+	tests := []struct {
+		name  string
+		tiers []InterestTier
+		want  float64
+	}{
+		{
+			name:  "Single tier",
+			tiers: []InterestTier{{MinBalance: 0, Rate: 3.65}},
+			want:  50,
+		},
+		{
+			name:  "Reaching a tier",
+			tiers: []InterestTier{{MinBalance: 0, Rate: 0}, {MinBalance: 150000, Rate: 3.65}},
+			want:  40,
+		},
+		{
+			name:  "No tiers",
+			tiers: nil,
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accrue(tt.tiers, 100000, changes, from, to); !floatingPointEquals(got, tt.want) {
+				t.Errorf("accrue = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectInterest(t *testing.T) {
+	tiers := []InterestTier{{MinBalance: 0, Rate: 3.65}}
+	from, _ := parseDate("2021-03-15")
+	now, _ := parseDate("2021-03-20")
+	changes := map[string]Money{"2021-04-10": -50000}
+
+	want := []InterestPeriod{
+		{Month: "2021-03", From: "2021-03-15", To: "2021-03-31", Balance: 100000, Accrued: 60, Interest: 170},
+		{Month: "2021-04", From: "2021-04-01", To: "2021-04-30", Balance: 100170, Interest: 196},
+	}
+	if got := projectInterest(tiers, 100000, changes, from, 2, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("projectInterest = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Actions recorded in the audit log
+const (
+	AUDIT_RECONCILE = "reconcile" // a reconciliation finished, locking its line items
+	AUDIT_UNLOCK    = "unlock"    // the line items of a finished reconciliation were unlocked
+)
+
+// An entry of the audit log: an action on an entity, with details such as the reason given
+type AuditEntry struct {
+	Id        int       `json:"id"`
+	Action    string    `json:"action"`
+	Entity    string    `json:"entity"`
+	EntityId  int       `json:"entity_id"`
+	Detail    string    `json:"detail"`
+	Owner     int       `json:"ownerid"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const AUDIT_COLUMNS = "id, action, entity, entity_id, detail, ownerid, created_at"
+
+// Fields /audit can be sorted by
+var AUDIT_SORT_FIELDS = map[string]string{
+	"id":         "id",
+	"created_at": "created_at",
+}
+
+func scanAuditEntry(row rowScanner) (AuditEntry, error) {
+	var entry AuditEntry
+	err := row.Scan(&entry.Id, &entry.Action, &entry.Entity, &entry.EntityId, &entry.Detail, &entry.Owner, &entry.CreatedAt)
+	return entry, err
+}
+
+// writeAudit records an action in the audit log, inside tx so it is only kept if the action is.
+func writeAudit(tx *sql.Tx, owner int, action string, entity string, id int, detail string) error {
+	_, err := tx.Exec(
+		"INSERT INTO public.auditlog (action, entity, entity_id, detail, ownerid) VALUES($1, $2, $3, $4, $5);",
+		action,
+		entity,
+		id,
+		detail,
+		owner,
+	)
+	return err
+}
+
+// List the audit log of the user, newest first (optionally action and entity)
+func auditProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	query := r.URL.Query()
+	options, err := parseListOptions(query, AUDIT_SORT_FIELDS, "created_at")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.Get("order") == "" {
+		options.Desc = true
+	}
+
+	var f filter
+	f.add("ownerid=?", owner)
+	if action := query.Get("action"); action != "" {
+		f.add("action=?", action)
+	}
+	if entity := query.Get("entity"); entity != "" {
+		f.add("entity=?", entity)
+	}
+
+	rows, total, err := queryPage("auditlog", AUDIT_COLUMNS, f, options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		checkError(err)
+
+		entries = append(entries, entry)
+	}
+	InfoLogger.Println("Audit Log retrieved.")
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
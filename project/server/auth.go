@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ACCESS_TOKEN_TTL  = 15 * time.Minute
+	REFRESH_TOKEN_TTL = 7 * 24 * time.Hour
+)
+
+// Claims carried inside a signed access token
+type TokenClaims struct {
+	User    int   `json:"sub"`
+	Session int   `json:"sid"`
+	Expires int64 `json:"exp"`
+}
+
+// Response of /authorize and /refresh
+type SessionToken struct {
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresAt    time.Time   `json:"expires_at"`
+	User         UserAccount `json:"user"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+var tokenSecret []byte
+
+// loadTokenSecret sets the secret used to sign access tokens.
+// TOKEN_SECRET must be shared by every server instance. Without it, a random
+// secret is used and sessions do not survive a restart.
+func loadTokenSecret(secret string) {
+	if secret != "" {
+		tokenSecret = []byte(secret)
+		return
+	}
+	tokenSecret = make([]byte, 32)
+	if _, err := rand.Read(tokenSecret); err != nil {
+		ErrorLogger.Fatal(err)
+	}
+	WarningLogger.Println("TOKEN_SECRET not set. Using a random secret, sessions will not survive a restart.")
+}
+
+// signToken encodes the claims and signs them with the server secret.
+// The token has the form base64(claims).base64(signature).
+func signToken(claims TokenClaims) string {
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write([]byte(encoded))
+	signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return encoded + "." + signature
+}
+
+// verifyToken checks the signature and expiry of a token and returns its claims.
+func verifyToken(token string) (TokenClaims, error) {
+	var claims TokenClaims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return claims, errors.New("malformed token")
+	}
+
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write([]byte(parts[0]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return claims, errors.New("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, errors.New("malformed token")
+	}
+
+	if time.Now().Unix() >= claims.Expires {
+		return claims, errors.New("token expired")
+	}
+
+	return claims, nil
+}
+
+// bearerToken returns the token of the Authorization: Bearer header, if any.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// newRefreshToken returns a random refresh token and the hash stored for it.
+// Only the hash is kept in the database.
+func newRefreshToken() (string, string) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		ErrorLogger.Fatal(err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashRefreshToken(token)
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueSession opens a new session for the user and returns its tokens.
+func issueSession(db *sql.DB, user UserAccount) (SessionToken, error) {
+	refresh, refreshHash := newRefreshToken()
+
+	var sessionId int
+	err := db.QueryRow(
+		"INSERT INTO public.session (userid, refresh_hash, expires_at) VALUES($1, $2, $3) RETURNING id;",
+		user.Id,
+		refreshHash,
+		time.Now().Add(REFRESH_TOKEN_TTL),
+	).Scan(&sessionId)
+	if err != nil {
+		return SessionToken{}, err
+	}
+
+	expires := time.Now().Add(ACCESS_TOKEN_TTL)
+	return SessionToken{
+		Token:        signToken(TokenClaims{User: user.Id, Session: sessionId, Expires: expires.Unix()}),
+		RefreshToken: refresh,
+		ExpiresAt:    expires,
+		User:         user,
+	}, nil
+}
+
+// authenticate works out which user account is making the request.
+// Callers identify themselves with the bearer token issued by /authorize.
+// The token must carry a valid signature, not be expired, and belong to a session that was not revoked.
+// Returns the id of the user account, and false if the token is missing or invalid.
+func authenticate(r *http.Request) (int, bool) {
+	claims, err := verifyToken(bearerToken(r))
+	if err != nil {
+		return 0, false
+	}
+
+	id, err := sessionUser(db, claims)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		}
+		return 0, false
+	}
+
+	return id, true
+}
+
+// sessionUser returns the user account of the session in the claims.
+// Returns sql.ErrNoRows if the session was revoked or expired.
+func sessionUser(db *sql.DB, claims TokenClaims) (int, error) {
+	var id int
+	err := db.QueryRow(
+		"SELECT userid FROM public.session WHERE id=$1 AND userid=$2 AND revoked_at IS NULL AND expires_at > now();",
+		claims.Session,
+		claims.User,
+	).Scan(&id)
+	return id, err
+}
+
+// Exchange a refresh token for a new access token.
+// The refresh token is rotated: the old one can not be used again.
+func refresh(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "POST":
+		var request RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		session, err := rotateSession(db, request.RefreshToken)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			WarningLogger.Println("Invalid or revoked refresh token. Ignoring request...")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		InfoLogger.Println("Session refreshed.")
+
+		if err := json.NewEncoder(w).Encode(session); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring request...")
+		return
+	}
+}
+
+// Revoke the session of the bearer token.
+// Both the access token and the refresh token stop working immediately.
+func logout(owner int, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		claims, _ := verifyToken(bearerToken(r))
+		if err := revokeSession(db, claims.Session, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Session revoked.")
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring request...")
+		return
+	}
+}
+
+// rotateSession replaces the refresh token of its session and issues a new access token.
+// Returns sql.ErrNoRows if the refresh token is unknown, was already used, or its session was revoked or expired.
+func rotateSession(db *sql.DB, refreshToken string) (SessionToken, error) {
+	refresh, refreshHash := newRefreshToken()
+
+	var session SessionToken
+	var sessionId int
+	err := db.QueryRow(
+		`UPDATE public.session s SET refresh_hash=$1
+		FROM public.useraccount u
+		WHERE s.userid = u.id AND s.refresh_hash=$2 AND s.revoked_at IS NULL AND s.expires_at > now()
+		RETURNING s.id, u.id, u.username, u."name", u.created_at, u.updated_at;`,
+		refreshHash,
+		hashRefreshToken(refreshToken),
+	).Scan(&sessionId, &session.User.Id, &session.User.Username, &session.User.Name, &session.User.CreatedAt, &session.User.UpdatedAt)
+	if err != nil {
+		return session, err
+	}
+
+	session.ExpiresAt = time.Now().Add(ACCESS_TOKEN_TTL)
+	session.Token = signToken(TokenClaims{User: session.User.Id, Session: sessionId, Expires: session.ExpiresAt.Unix()})
+	session.RefreshToken = refresh
+	return session, nil
+}
+
+// revokeSession ends a session of owner, so neither of its tokens can be used again.
+func revokeSession(db *sql.DB, session int, owner int) error {
+	_, err := db.Exec("UPDATE public.session SET revoked_at=now() WHERE id=$1 AND userid=$2;", session, owner)
+	return err
+}
+
+// ownsRecord reports whether the record with the given id in table belongs to owner.
+// table must be one of the fixed entity table names, never user input.
+func ownsRecord(db *sql.DB, table string, id int, owner int) bool {
+	var found int
+	err := db.QueryRow("SELECT id FROM public."+table+" WHERE id=$1 AND ownerid=$2;", id, owner).Scan(&found)
+	return err == nil
+}
+
+// lineitemRefsOwned reports whether the Bucket and Bank a line item points to belong to owner.
+// A zero Bucket or Bank means the line item is not linked to one.
+func lineitemRefsOwned(db *sql.DB, lineitem LineItem, owner int) bool {
+	if lineitem.Bucket != 0 && !ownsRecord(db, "bucket", lineitem.Bucket, owner) {
+		return false
+	}
+	if lineitem.Bank != 0 && !ownsRecord(db, "bankaccount", lineitem.Bank, owner) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyToken(t *testing.T) {
+	defer func(secret []byte) { tokenSecret = secret }(tokenSecret)
+	tokenSecret = []byte("test-secret")
+
+	expires := time.Now().Add(time.Minute).Unix()
+	valid := signToken(TokenClaims{User: 1, Session: 2, Expires: expires})
+	parts := strings.Split(valid, ".")
+
+	forged, _ := json.Marshal(TokenClaims{User: 9, Session: 2, Expires: expires})
+	notJSON := base64.RawURLEncoding.EncodeToString([]byte("not json"))
+
+	tokenSecret = []byte("other-secret")
+	otherSecret := signToken(TokenClaims{User: 1, Session: 2, Expires: expires})
+	tokenSecret = []byte("test-secret")
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{
+			name:  "Valid token",
+			token: valid,
+			want:  "",
+		},
+		{
+			name:  "Tampered signature",
+			token: parts[0] + "." + strings.Repeat("A", len(parts[1])),
+			want:  "invalid token signature",
+		},
+		{
+			name:  "Tampered payload",
+			token: base64.RawURLEncoding.EncodeToString(forged) + "." + parts[1],
+			want:  "invalid token signature",
+		},
+		{
+			name:  "Signed with another secret",
+			token: otherSecret,
+			want:  "invalid token signature",
+		},
+		{
+			name:  "Expired token",
+			token: signToken(TokenClaims{User: 1, Session: 2, Expires: time.Now().Add(-time.Second).Unix()}),
+			want:  "token expired",
+		},
+		{
+			name:  "Empty token",
+			token: "",
+			want:  "malformed token",
+		},
+		{
+			name:  "Missing signature",
+			token: parts[0],
+			want:  "malformed token",
+		},
+		{
+			name:  "Too many parts",
+			token: valid + "." + parts[1],
+			want:  "malformed token",
+		},
+		{
+			name:  "Signature not base64",
+			token: parts[0] + ".***",
+			want:  "invalid token signature",
+		},
+		{
+			name:  "Signed payload not JSON",
+			token: signedPayload(notJSON),
+			want:  "malformed token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifyToken(tt.token)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("verifyToken error = %v, want none", err)
+				}
+				if claims.User != 1 || claims.Session != 2 || claims.Expires != expires {
+					t.Errorf("verifyToken claims = %+v, want user 1 and session 2", claims)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("verifyToken error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// signedPayload signs an encoded payload with the server secret, as signToken does.
+func signedPayload(encoded string) string {
+	mac := hmac.New(sha256.New, tokenSecret)
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sessionDriver is a database/sql driver keeping the sessions of user 1 in memory,
+// for the queries of rotateSession, revokeSession and sessionUser.
+type sessionDriver struct {
+	sessions map[int64]*fakeSession
+}
+
+type fakeSession struct {
+	refreshHash string
+	revoked     bool
+	expires     time.Time
+}
+
+func (d *sessionDriver) Open(name string) (driver.Conn, error) { return sessionConn{d}, nil }
+
+type sessionConn struct{ d *sessionDriver }
+
+func (c sessionConn) Prepare(query string) (driver.Stmt, error) {
+	return sessionStmt{c.d, query}, nil
+}
+func (c sessionConn) Close() error              { return nil }
+func (c sessionConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type sessionStmt struct {
+	d     *sessionDriver
+	query string
+}
+
+func (s sessionStmt) Close() error  { return nil }
+func (s sessionStmt) NumInput() int { return -1 }
+
+// Exec revokes a session, for revokeSession.
+func (s sessionStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if session, ok := s.d.sessions[args[0].(int64)]; ok && args[1].(int64) == 1 {
+		session.revoked = true
+		return driver.RowsAffected(1), nil
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// Query rotates the refresh token of a session, for rotateSession, or looks up the user of a session, for sessionUser.
+func (s sessionStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows := &sessionRows{}
+	if strings.HasPrefix(strings.TrimSpace(s.query), "UPDATE") {
+		rows.columns = []string{"id", "id", "username", "name", "created_at", "updated_at"}
+		for id, session := range s.d.sessions {
+			if session.refreshHash == args[1].(string) && !session.revoked && session.expires.After(time.Now()) {
+				session.refreshHash = args[0].(string)
+				rows.rows = [][]driver.Value{{id, int64(1), "jdoe", "John Doe", time.Time{}, time.Time{}}}
+			}
+		}
+		return rows, nil
+	}
+
+	rows.columns = []string{"userid"}
+	if session, ok := s.d.sessions[args[0].(int64)]; ok && args[1].(int64) == 1 && !session.revoked && session.expires.After(time.Now()) {
+		rows.rows = [][]driver.Value{{int64(1)}}
+	}
+	return rows, nil
+}
+
+type sessionRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *sessionRows) Columns() []string { return r.columns }
+func (r *sessionRows) Close() error      { return nil }
+
+func (r *sessionRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+type sessionConnector struct{ d *sessionDriver }
+
+func (c sessionConnector) Connect(context.Context) (driver.Conn, error) { return sessionConn{c.d}, nil }
+func (c sessionConnector) Driver() driver.Driver                        { return c.d }
+
+// openSessions returns a database with sessions of user 1 in memory, one for every refresh token given.
+func openSessions(refreshTokens ...string) *sql.DB {
+	store := &sessionDriver{sessions: map[int64]*fakeSession{}}
+	for i, token := range refreshTokens {
+		store.sessions[int64(i+1)] = &fakeSession{refreshHash: hashRefreshToken(token), expires: time.Now().Add(REFRESH_TOKEN_TTL)}
+	}
+	return sql.OpenDB(sessionConnector{store})
+}
+
+func TestRotateSession(t *testing.T) {
+	defer func(secret []byte) { tokenSecret = secret }(tokenSecret)
+	tokenSecret = []byte("test-secret")
+	db := openSessions("first-token")
+	defer db.Close()
+
+	rotated, err := rotateSession(db, "first-token")
+	if err != nil {
+		t.Fatalf("rotateSession error = %v, want none", err)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == "first-token" {
+		t.Errorf("refresh token = %q, want a new one", rotated.RefreshToken)
+	}
+	claims, err := verifyToken(rotated.Token)
+	if err != nil || claims.User != 1 || claims.Session != 1 {
+		t.Errorf("access token claims = %+v, error %v, want user 1 and session 1", claims, err)
+	}
+
+	tests := []struct {
+		name         string
+		refreshToken string
+		want         error
+	}{
+		{
+			name:         "Reused refresh token",
+			refreshToken: "first-token",
+			want:         sql.ErrNoRows,
+		},
+		{
+			name:         "Unknown refresh token",
+			refreshToken: "unknown-token",
+			want:         sql.ErrNoRows,
+		},
+		{
+			name:         "Rotated refresh token",
+			refreshToken: rotated.RefreshToken,
+			want:         nil,
+		},
+		{
+			name:         "Rotated refresh token used twice",
+			refreshToken: rotated.RefreshToken,
+			want:         sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rotateSession(db, tt.refreshToken); err != tt.want {
+				t.Errorf("rotateSession error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{
+			name:   "Malformed body",
+			method: "POST",
+			body:   "{",
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:   "Other method",
+			method: "GET",
+			want:   http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			refresh(recorder, httptest.NewRequest(tt.method, "/refresh", strings.NewReader(tt.body)))
+			if recorder.Code != tt.want {
+				t.Errorf("refresh status = %d, want %d", recorder.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	db := openSessions("first-token", "second-token")
+	defer db.Close()
+
+	if _, err := sessionUser(db, TokenClaims{User: 1, Session: 1}); err != nil {
+		t.Fatalf("sessionUser before revoking error = %v, want none", err)
+	}
+	if err := revokeSession(db, 1, 1); err != nil {
+		t.Fatalf("revokeSession error = %v, want none", err)
+	}
+
+	if _, err := sessionUser(db, TokenClaims{User: 1, Session: 1}); err != sql.ErrNoRows {
+		t.Errorf("sessionUser of a revoked session error = %v, want %v", err, sql.ErrNoRows)
+	}
+	if _, err := rotateSession(db, "first-token"); err != sql.ErrNoRows {
+		t.Errorf("rotateSession of a revoked session error = %v, want %v", err, sql.ErrNoRows)
+	}
+	if id, err := sessionUser(db, TokenClaims{User: 1, Session: 2}); err != nil || id != 1 {
+		t.Errorf("sessionUser of another session = %d, %v, want 1 and no error", id, err)
+	}
+	if _, err := rotateSession(db, "second-token"); err != nil {
+		t.Errorf("rotateSession of another session error = %v, want none", err)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Line items of a bank account that count towards its balance today, less the ones before
+// its opening date, which the opening balance already holds. Selected from public.bankaccount.
+// The rule of balanceOn, for today.
+const BANK_BALANCE = "(SELECT coalesce(sum(amount) FILTER (WHERE occurred_on <= current_date), 0) - " +
+	"coalesce(sum(amount) FILTER (WHERE occurred_on < bankaccount.opening_date), 0) " +
+	"FROM public.lineitem WHERE lineitem.bank = bankaccount.id)"
+
+// Fields /bank/{id}/lineitems can be sorted by; a running balance only reads in date order
+var BANK_LINEITEM_SORT_FIELDS = map[string]string{
+	"occurred_on": "occurred_on",
+}
+
+// Response of /bank/{id}/balance: the balance at the end of Date
+type BankBalance struct {
+	Bank    BankAccount `json:"bank"`
+	Date    string      `json:"date"`
+	Balance Money       `json:"balance"`
+}
+
+// A line item of /bank/{id}/lineitems, with the balance of the bank account after it
+type BankLineItem struct {
+	LineItem
+	Balance Money `json:"balance"`
+}
+
+// readBank returns a bank account of owner, sql.ErrNoRows if there is none.
+func readBank(owner int, id int) (BankAccount, error) {
+	return scanBankAccount(db.QueryRow("SELECT "+BANK_COLUMNS+" FROM public.bankaccount WHERE id=$1 AND ownerid=$2;", id, owner))
+}
+
+// balanceOn returns the balance of a bank account at the end of date, from the sums of its line items by day.
+// Line items before the opening date are held by the opening balance, so for a date before the
+// opening date the line items between the two are taken off it.
+func balanceOn(bank BankAccount, changes map[string]Money, date string) Money {
+	balance := bank.OpeningBalance
+	for day, amount := range changes {
+		if day <= date {
+			balance += amount
+		}
+		if bank.OpeningDate != "" && day < bank.OpeningDate {
+			balance -= amount
+		}
+	}
+	return balance
+}
+
+// runningBalances returns the balance of a bank account after each of its line items, by line item id.
+// Line items are applied in date order, by id within a day. A line item before the opening date
+// shows the balance the opening balance implies for it.
+func runningBalances(bank BankAccount, lineitems []LineItem) map[int]Money {
+	sorted := append([]LineItem{}, lineitems...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].OccurredOn != sorted[j].OccurredOn {
+			return sorted[i].OccurredOn < sorted[j].OccurredOn
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+
+	balance := bank.OpeningBalance
+	for _, lineitem := range sorted {
+		if bank.OpeningDate != "" && lineitem.OccurredOn < bank.OpeningDate {
+			balance -= lineitem.Amount
+		}
+	}
+	balances := map[int]Money{}
+	for _, lineitem := range sorted {
+		balance += lineitem.Amount
+		balances[lineitem.Id] = balance
+	}
+	return balances
+}
+
+// bankBalance returns the balance of a bank account at the end of date.
+func bankBalance(q queryRower, id int, date string) (Money, error) {
+	var bank BankAccount
+	err := q.QueryRow(
+		"SELECT opening_balance, coalesce(to_char(opening_date, 'YYYY-MM-DD'), '') FROM public.bankaccount WHERE id=$1;",
+		id,
+	).Scan(&bank.OpeningBalance, &bank.OpeningDate)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only line items up to the date, or before the opening date, change the balance
+	rows, err := q.Query(
+		`SELECT to_char(l.occurred_on, 'YYYY-MM-DD'), sum(l.amount) FROM public.lineitem l
+		JOIN public.bankaccount b ON b.id = l.bank
+		WHERE l.bank = $1 AND (l.occurred_on <= $2 OR l.occurred_on < b.opening_date)
+		GROUP BY 1;`,
+		id,
+		date,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	changes := map[string]Money{}
+	for rows.Next() {
+		var day string
+		var amount Money
+		if err := rows.Scan(&day, &amount); err != nil {
+			return 0, err
+		}
+		changes[day] = amount
+	}
+	return balanceOn(bank, changes, date), rows.Err()
+}
+
+// bankAmounts returns the id, date and amount of every line item of a bank account.
+func bankAmounts(q queryRower, id int) ([]LineItem, error) {
+	rows, err := q.Query("SELECT id, to_char(occurred_on, 'YYYY-MM-DD'), amount FROM public.lineitem WHERE bank=$1;", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lineitems []LineItem
+	for rows.Next() {
+		var lineitem LineItem
+		if err := rows.Scan(&lineitem.Id, &lineitem.OccurredOn, &lineitem.Amount); err != nil {
+			return nil, err
+		}
+		lineitems = append(lineitems, lineitem)
+	}
+	return lineitems, rows.Err()
+}
+
+// Balance of a bank account at the end of a day (?date=, today by default)
+// Line items after the date are left out; for a date before the opening date, the line items
+// between it and the opening date are taken off the opening balance.
+func bankBalanceProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		date := r.URL.Query().Get("date")
+		if date == "" {
+			date = today()
+		} else if _, err := parseDate(date); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bank, err := readBank(owner, id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bank Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		balance := BankBalance{Bank: bank, Date: date}
+		balance.Balance, err = bankBalance(db, id, date)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Bank Balance retrieved.")
+
+		if err := json.NewEncoder(w).Encode(balance); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+// Line items of a bank account with the running balance after each (optionally from/to dates)
+// Listed in date order, order=desc for the newest first; paged like /lineitems.
+func bankLineItemsProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		options, err := parseListOptions(r.URL.Query(), BANK_LINEITEM_SORT_FIELDS, "occurred_on")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		dates, err := parseDateRange(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bank, err := readBank(owner, id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bank Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		// The running balance counts every line item of the bank, not only the ones listed
+		amounts, err := bankAmounts(db, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		balances := runningBalances(bank, amounts)
+
+		var f filter
+		f.add("bank=?", id)
+		f.add("ownerid=?", owner)
+		if dates.From != "" {
+			f.add("occurred_on >= ?", dates.From)
+		}
+		if dates.To != "" {
+			f.add("occurred_on <= ?", dates.To)
+		}
+
+		rows, total, err := queryPage("lineitem", LINEITEM_COLUMNS, f, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
+
+		lineitems := []BankLineItem{}
+		for rows.Next() {
+			var lineitem BankLineItem
+			lineitem.LineItem, err = scanLineItem(rows)
+			checkError(err)
+			lineitem.Balance = balances[lineitem.Id]
+
+			lineitems = append(lineitems, lineitem)
+		}
+		InfoLogger.Println("Bank Line Items retrieved.")
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if err := json.NewEncoder(w).Encode(lineitems); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
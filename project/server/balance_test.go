@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBalanceOn(t *testing.T) {
+	opened := BankAccount{Id: 1, Name: "Checking", Currency: "USD", OpeningBalance: 100000, OpeningDate: "2021-03-01"}
+
+	tests := []struct {
+		name    string
+		bank    BankAccount
+		changes map[string]Money
+		date    string
+		want    Money
+	}{
+		{
+			name:    "Opening balance only",
+			bank:    opened,
+			changes: map[string]Money{},
+			date:    "2021-03-31",
+			want:    100000,
+		},
+		{
+			name:    "Line item before the opening date",
+			bank:    opened,
+			changes: map[string]Money{"2021-02-27": -2000},
+			date:    "2021-03-31",
+			want:    100000,
+		},
+		{
+			name:    "Line item on the opening date",
+			bank:    opened,
+			changes: map[string]Money{"2021-03-01": -5000},
+			date:    "2021-03-31",
+			want:    95000,
+		},
+		{
+			name:    "Line item on the date",
+			bank:    opened,
+			changes: map[string]Money{"2021-03-05": 20000, "2021-03-31": -1000},
+			date:    "2021-03-31",
+			want:    119000,
+		},
+		{
+			name:    "Line item after the date",
+			bank:    opened,
+			changes: map[string]Money{"2021-03-05": 20000, "2021-04-01": -1000},
+			date:    "2021-03-31",
+			want:    120000,
+		},
+		{
+			name:    "Date before the opening date",
+			bank:    opened,
+			changes: map[string]Money{"2021-02-20": -3000, "2021-02-27": -2000, "2021-03-01": -5000},
+			date:    "2021-02-25",
+			want:    102000,
+		},
+		{
+			name:    "Without opening date",
+			bank:    BankAccount{Id: 2, Name: "Cash", Currency: "USD"},
+			changes: map[string]Money{"2021-02-27": -2000, "2021-03-05": 20000},
+			date:    "2021-03-31",
+			want:    18000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := balanceOn(tt.bank, tt.changes, tt.date); got != tt.want {
+				t.Errorf("balanceOn(%s) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunningBalances(t *testing.T) {
+	opened := BankAccount{Id: 1, Name: "Checking", Currency: "USD", OpeningBalance: 100000, OpeningDate: "2021-03-01"}
+
+	tests := []struct {
+		name      string
+		bank      BankAccount
+		lineitems []LineItem
+		want      map[int]Money
+	}{
+		{
+			name: "Date order",
+			bank: opened,
+			lineitems: []LineItem{
+				{Id: 3, Amount: 20000, OccurredOn: "2021-03-05"},
+				{Id: 1, Amount: -5000, OccurredOn: "2021-03-02"},
+			},
+			want: map[int]Money{1: 95000, 3: 115000},
+		},
+		{
+			name: "Same day by id",
+			bank: opened,
+			lineitems: []LineItem{
+				{Id: 7, Amount: -1000, OccurredOn: "2021-03-02"},
+				{Id: 4, Amount: -2000, OccurredOn: "2021-03-02"},
+			},
+			want: map[int]Money{4: 98000, 7: 97000},
+		},
+		{
+			name: "Before the opening date",
+			bank: opened,
+			lineitems: []LineItem{
+				{Id: 5, Amount: -5000, OccurredOn: "2021-03-01"},
+				{Id: 2, Amount: -2000, OccurredOn: "2021-02-27"},
+			},
+			want: map[int]Money{2: 100000, 5: 95000},
+		},
+		{
+			name: "Without opening date",
+			bank: BankAccount{Id: 2, Name: "Cash", Currency: "USD"},
+			lineitems: []LineItem{
+				{Id: 1, Amount: 1000, OccurredOn: "2021-01-01"},
+				{Id: 2, Amount: 500, OccurredOn: "2020-12-31"},
+			},
+			want: map[int]Money{1: 1500, 2: 500},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runningBalances(tt.bank, tt.lineitems); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("runningBalances = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
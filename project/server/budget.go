@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Budget periods
+const (
+	PERIOD_MONTHLY = "monthly" // calendar months, or months starting on the day of Start
+	PERIOD_WEEKLY  = "weekly"  // weeks starting on Monday, or on the weekday of Start
+	PERIOD_CUSTOM  = "custom"  // periods of Days days, counted from Start
+)
+
+// Number of periods /buckets/{id}/status reports by default, and at most
+const (
+	DEFAULT_STATUS_PERIODS = 6
+	MAX_STATUS_PERIODS     = 36
+)
+
+// Amount a bucket may spend per period
+type Budget struct {
+	Amount Money  `json:"amount" bson:"amount"`
+	Period string `json:"period" bson:"period"`
+	Start  string `json:"start,omitempty" bson:"start"`
+	Days   int    `json:"days,omitempty" bson:"days"`
+}
+
+// A span of dates, from Start up to but not including End
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Spending of a bucket in one budget period
+// End is the last day of the period. Spent is the sum of the expenses (less refunds)
+// of the line items linked to the bucket, transfers excluded.
+type PeriodStatus struct {
+	Start       string  `json:"start"`
+	End         string  `json:"end"`
+	Budget      Money   `json:"budget"`
+	Spent       Money   `json:"spent"`
+	Remaining   Money   `json:"remaining"`
+	PercentUsed float64 `json:"percent_used"`
+	Overspent   bool    `json:"overspent"`
+}
+
+// Response of /buckets/{id}/status: the current period and the ones before it, newest first
+type BucketStatus struct {
+	Bucket  Bucket         `json:"bucket"`
+	Current PeriodStatus   `json:"current"`
+	Past    []PeriodStatus `json:"past"`
+}
+
+// checkBudget validates a budget and fills in its defaults.
+func checkBudget(budget *Budget) error {
+	if budget.Amount < 0 {
+		return errors.New("budget amount must not be negative")
+	}
+	if budget.Period == "" {
+		budget.Period = PERIOD_MONTHLY
+	}
+	if budget.Start != "" {
+		if _, err := parseDate(budget.Start); err != nil {
+			return err
+		}
+	}
+
+	switch budget.Period {
+	case PERIOD_MONTHLY, PERIOD_WEEKLY:
+		budget.Days = 0
+	case PERIOD_CUSTOM:
+		if budget.Start == "" || budget.Days < 1 {
+			return errors.New("a custom budget period needs a start date and a number of days")
+		}
+	default:
+		return fmt.Errorf("invalid budget period %q, expected monthly, weekly or custom", budget.Period)
+	}
+	return nil
+}
+
+// budgetColumns returns the values of the budget columns of a bucket, all NULL without a budget.
+func budgetColumns(budget *Budget) []interface{} {
+	if budget == nil {
+		return []interface{}{nil, nil, nil, nil}
+	}
+	return []interface{}{budget.Amount, budget.Period, nullDate(budget.Start), nullInt(budget.Days)}
+}
+
+// nullInt returns nil for 0, so it is stored as NULL.
+func nullInt(value int) interface{} {
+	if value == 0 {
+		return nil
+	}
+	return value
+}
+
+// nullString returns nil for an empty string, so it is stored as NULL.
+func nullString(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// monthDay returns the given day of a month, or the last day of the month if it is shorter.
+func monthDay(year int, month time.Month, day int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// periodOf returns the budget period containing date.
+// The budget must have passed checkBudget.
+func (budget Budget) periodOf(date time.Time) Period {
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	start, _ := parseDate(budget.Start)
+
+	switch budget.Period {
+	case PERIOD_WEEKLY:
+		anchor := time.Monday
+		if budget.Start != "" {
+			anchor = start.Weekday()
+		}
+		back := (int(date.Weekday()) - int(anchor) + 7) % 7
+		begin := date.AddDate(0, 0, -back)
+		return Period{Start: begin, End: begin.AddDate(0, 0, 7)}
+
+	case PERIOD_CUSTOM:
+		days := int(date.Sub(start).Hours() / 24)
+		n := days / budget.Days
+		if days < 0 && days%budget.Days != 0 {
+			n--
+		}
+		begin := start.AddDate(0, 0, n*budget.Days)
+		return Period{Start: begin, End: begin.AddDate(0, 0, budget.Days)}
+
+	default:
+		day := 1
+		if budget.Start != "" {
+			day = start.Day()
+		}
+		begin := monthDay(date.Year(), date.Month(), day)
+		if date.Before(begin) {
+			begin = monthDay(date.Year(), date.Month()-1, day)
+		}
+		return Period{Start: begin, End: monthDay(begin.Year(), begin.Month()+1, day)}
+	}
+}
+
+// periods returns the n periods up to and including the one containing date, newest first.
+func (budget Budget) periods(date time.Time, n int) []Period {
+	var periods []Period
+	period := budget.periodOf(date)
+	for i := 0; i < n; i++ {
+		periods = append(periods, period)
+		period = budget.periodOf(period.Start.AddDate(0, 0, -1))
+	}
+	return periods
+}
+
+// periodStatus compares the spending of a period to the budget amount.
+func periodStatus(period Period, budget Money, spent Money) PeriodStatus {
+	status := PeriodStatus{
+		Start:     period.Start.Format(DATE_LAYOUT),
+		End:       period.End.AddDate(0, 0, -1).Format(DATE_LAYOUT),
+		Budget:    budget,
+		Spent:     spent,
+		Remaining: budget - spent,
+		Overspent: spent > budget,
+	}
+	if budget > 0 {
+		status.PercentUsed = math.Round(float64(spent)*1000/float64(budget)) / 10
+	}
+	return status
+}
+
+// bucketSpending returns the spending of a bucket per day between from and to (exclusive).
+// Expenses are negative line items, so spending is the negated sum. Transfers are left out.
+func bucketSpending(owner int, bucket int, from time.Time, to time.Time) (map[string]Money, error) {
+	rows, err := db.Query(
+		`SELECT to_char(occurred_on, 'YYYY-MM-DD'), -sum(amount) FROM public.lineitem
+		WHERE ownerid=$1 AND bucket=$2 AND transfer IS NULL AND occurred_on >= $3::date AND occurred_on < $4::date
+		GROUP BY occurred_on;`,
+		owner,
+		bucket,
+		from.Format(DATE_LAYOUT),
+		to.Format(DATE_LAYOUT),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	spending := map[string]Money{}
+	for rows.Next() {
+		var day string
+		var spent Money
+		if err := rows.Scan(&day, &spent); err != nil {
+			return nil, err
+		}
+		spending[day] = spent
+	}
+	return spending, rows.Err()
+}
+
+// Spending of a bucket against its budget, for the current and past periods
+// Buckets without a budget report their spending per calendar month, against a budget of 0.
+func bucketStatusProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		count := DEFAULT_STATUS_PERIODS
+		if value := r.URL.Query().Get("periods"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > MAX_STATUS_PERIODS {
+				http.Error(w, fmt.Sprintf("invalid periods %q, expected 1 to %d", value, MAX_STATUS_PERIODS), http.StatusBadRequest)
+				return
+			}
+			count = n
+		}
+
+		bucket, err := scanBucket(db.QueryRow("SELECT "+BUCKET_COLUMNS+" FROM public.bucket WHERE id=$1 AND ownerid=$2;", id, owner))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bucket Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		budget := Budget{Period: PERIOD_MONTHLY}
+		if bucket.Budget != nil {
+			budget = *bucket.Budget
+		}
+
+		now, _ := parseDate(today())
+		periods := budget.periods(now, count)
+		spending, err := bucketSpending(owner, id, periods[len(periods)-1].Start, periods[0].End)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		status := BucketStatus{Bucket: bucket}
+		for i, period := range periods {
+			var spent Money
+			for day := period.Start; day.Before(period.End); day = day.AddDate(0, 0, 1) {
+				spent += spending[day.Format(DATE_LAYOUT)]
+			}
+
+			if i == 0 {
+				status.Current = periodStatus(period, budget.Amount, spent)
+			} else {
+				status.Past = append(status.Past, periodStatus(period, budget.Amount, spent))
+			}
+		}
+		InfoLogger.Println("Bucket Budget Status retrieved.")
+
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import "testing"
+
+func TestCheckBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget Budget
+		valid  bool
+	}{
+		{
+			name:   "Monthly",
+			budget: Budget{Amount: 40000, Period: PERIOD_MONTHLY},
+			valid:  true,
+		},
+		{
+			name:   "Default period",
+			budget: Budget{Amount: 40000},
+			valid:  true,
+		},
+		{
+			name:   "Weekly anchored",
+			budget: Budget{Amount: 5000, Period: PERIOD_WEEKLY, Start: "2021-03-05"},
+			valid:  true,
+		},
+		{
+			name:   "Custom",
+			budget: Budget{Amount: 5000, Period: PERIOD_CUSTOM, Start: "2021-03-05", Days: 14},
+			valid:  true,
+		},
+		{
+			name:   "Custom without start",
+			budget: Budget{Amount: 5000, Period: PERIOD_CUSTOM, Days: 14},
+			valid:  false,
+		},
+		{
+			name:   "Custom without days",
+			budget: Budget{Amount: 5000, Period: PERIOD_CUSTOM, Start: "2021-03-05"},
+			valid:  false,
+		},
+		{
+			name:   "Negative amount",
+			budget: Budget{Amount: -1, Period: PERIOD_MONTHLY},
+			valid:  false,
+		},
+		{
+			name:   "Unknown period",
+			budget: Budget{Amount: 1, Period: "yearly"},
+			valid:  false,
+		},
+		{
+			name:   "Invalid start",
+			budget: Budget{Amount: 1, Period: PERIOD_WEEKLY, Start: "next monday"},
+			valid:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := tt.budget
+			err := checkBudget(&budget)
+			if (err == nil) != tt.valid {
+				t.Errorf("checkBudget error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestBudgetPeriodOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget Budget
+		date   string
+		start  string
+		end    string
+	}{
+		{
+			name:   "Calendar month",
+			budget: Budget{Period: PERIOD_MONTHLY},
+			date:   "2021-03-15",
+			start:  "2021-03-01",
+			end:    "2021-04-01",
+		},
+		{
+			name:   "First of month",
+			budget: Budget{Period: PERIOD_MONTHLY},
+			date:   "2021-03-01",
+			start:  "2021-03-01",
+			end:    "2021-04-01",
+		},
+		{
+			name:   "December",
+			budget: Budget{Period: PERIOD_MONTHLY},
+			date:   "2021-12-31",
+			start:  "2021-12-01",
+			end:    "2022-01-01",
+		},
+		{
+			name:   "Monthly from the 25th",
+			budget: Budget{Period: PERIOD_MONTHLY, Start: "2020-01-25"},
+			date:   "2021-03-10",
+			start:  "2021-02-25",
+			end:    "2021-03-25",
+		},
+		{
+			name:   "Monthly on the 25th",
+			budget: Budget{Period: PERIOD_MONTHLY, Start: "2020-01-25"},
+			date:   "2021-03-25",
+			start:  "2021-03-25",
+			end:    "2021-04-25",
+		},
+		{
+			name:   "Monthly from the 31st",
+			budget: Budget{Period: PERIOD_MONTHLY, Start: "2021-01-31"},
+			date:   "2021-02-28",
+			start:  "2021-02-28",
+			end:    "2021-03-31",
+		},
+		{
+			name:   "Monthly from the 31st in march",
+			budget: Budget{Period: PERIOD_MONTHLY, Start: "2021-01-31"},
+			date:   "2021-03-30",
+			start:  "2021-02-28",
+			end:    "2021-03-31",
+		},
+		{
+			name:   "Week from monday",
+			budget: Budget{Period: PERIOD_WEEKLY},
+			date:   "2021-03-17",
+			start:  "2021-03-15",
+			end:    "2021-03-22",
+		},
+		{
+			name:   "Sunday",
+			budget: Budget{Period: PERIOD_WEEKLY},
+			date:   "2021-03-21",
+			start:  "2021-03-15",
+			end:    "2021-03-22",
+		},
+		{
+			name:   "Week from friday",
+			budget: Budget{Period: PERIOD_WEEKLY, Start: "2021-01-01"},
+			date:   "2021-03-17",
+			start:  "2021-03-12",
+			end:    "2021-03-19",
+		},
+		{
+			name:   "Custom",
+			budget: Budget{Period: PERIOD_CUSTOM, Start: "2021-03-01", Days: 14},
+			date:   "2021-03-20",
+			start:  "2021-03-15",
+			end:    "2021-03-29",
+		},
+		{
+			name:   "Custom start",
+			budget: Budget{Period: PERIOD_CUSTOM, Start: "2021-03-01", Days: 14},
+			date:   "2021-03-01",
+			start:  "2021-03-01",
+			end:    "2021-03-15",
+		},
+		{
+			name:   "Custom before start",
+			budget: Budget{Period: PERIOD_CUSTOM, Start: "2021-03-01", Days: 14},
+			date:   "2021-02-20",
+			start:  "2021-02-15",
+			end:    "2021-03-01",
+		},
+		{
+			name:   "Custom day before start",
+			budget: Budget{Period: PERIOD_CUSTOM, Start: "2021-03-01", Days: 14},
+			date:   "2021-02-28",
+			start:  "2021-02-15",
+			end:    "2021-03-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, _ := parseDate(tt.date)
+			period := tt.budget.periodOf(date)
+			start, end := period.Start.Format(DATE_LAYOUT), period.End.Format(DATE_LAYOUT)
+			if start != tt.start || end != tt.end {
+				t.Errorf("periodOf(%s) = %s to %s, want %s to %s", tt.date, start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestBudgetPeriods(t *testing.T) {
+	date, _ := parseDate("2021-03-15")
+	periods := Budget{Period: PERIOD_MONTHLY}.periods(date, 3)
+
+	want := []string{"2021-03-01", "2021-02-01", "2021-01-01"}
+	if len(periods) != len(want) {
+		t.Fatalf("periods() returned %d periods, want %d", len(periods), len(want))
+	}
+	for i, period := range periods {
+		if got := period.Start.Format(DATE_LAYOUT); got != want[i] {
+			t.Errorf("periods()[%d] starts %s, want %s", i, got, want[i])
+		}
+		if i > 0 && !period.End.Equal(periods[i-1].Start) {
+			t.Errorf("periods()[%d] ends %s, want %s", i, period.End.Format(DATE_LAYOUT), periods[i-1].Start.Format(DATE_LAYOUT))
+		}
+	}
+}
+
+func TestPeriodStatus(t *testing.T) {
+	start, _ := parseDate("2021-03-01")
+	end, _ := parseDate("2021-04-01")
+	period := Period{Start: start, End: end}
+
+	tests := []struct {
+		name      string
+		budget    Money
+		spent     Money
+		remaining Money
+		percent   float64
+		overspent bool
+	}{
+		{
+			name:      "Under budget",
+			budget:    40000,
+			spent:     10000,
+			remaining: 30000,
+			percent:   25,
+			overspent: false,
+		},
+		{
+			name:      "Exactly spent",
+			budget:    40000,
+			spent:     40000,
+			remaining: 0,
+			percent:   100,
+			overspent: false,
+		},
+		{
+			name:      "Overspent",
+			budget:    40000,
+			spent:     45050,
+			remaining: -5050,
+			percent:   112.6,
+			overspent: true,
+		},
+		{
+			name:      "Percent rounded",
+			budget:    30000,
+			spent:     10000,
+			remaining: 20000,
+			percent:   33.3,
+			overspent: false,
+		},
+		{
+			name:      "Refunds",
+			budget:    40000,
+			spent:     -2000,
+			remaining: 42000,
+			percent:   -5,
+			overspent: false,
+		},
+		{
+			name:      "Without budget",
+			budget:    0,
+			spent:     1500,
+			remaining: -1500,
+			percent:   0,
+			overspent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := periodStatus(period, tt.budget, tt.spent)
+			if status.Start != "2021-03-01" || status.End != "2021-03-31" {
+				t.Errorf("periodStatus covers %s to %s, want 2021-03-01 to 2021-03-31", status.Start, status.End)
+			}
+			if status.Remaining != tt.remaining || status.PercentUsed != tt.percent || status.Overspent != tt.overspent {
+				t.Errorf("periodStatus(%s, %s) = remaining %s, %v%%, overspent %v, want %s, %v%%, %v",
+					tt.budget, tt.spent, status.Remaining, status.PercentUsed, status.Overspent,
+					tt.remaining, tt.percent, tt.overspent)
+			}
+		})
+	}
+}
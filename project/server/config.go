@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server settings
+// Loaded from environment variables, optionally backed by a config file
+// of NAME=value lines using the same names (see loadConfig).
+type Config struct {
+	ListenAddr string
+
+	DBHost     string
+	DBPort     int
+	DBUser     string
+	DBPassword string
+	DBName     string
+	DBSSLMode  string
+
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnMaxIdleTime time.Duration
+	DBConnectTimeout  time.Duration // how long startup waits for the database to answer
+	MigrateOnStart    bool          // apply pending schema migrations before serving
+
+	HTTPReadTimeout  time.Duration
+	HTTPWriteTimeout time.Duration
+	HTTPIdleTimeout  time.Duration
+
+	LogFile string // "-" logs to stderr
+
+	SchedulerInterval time.Duration // how often the scheduler runs, 0 disables it
+
+	TokenSecret string
+	Lockout     LockoutConfig
+}
+
+func defaultConfig() Config {
+	return Config{
+		ListenAddr: ":9000",
+
+		DBHost:    "db",
+		DBPort:    5432,
+		DBUser:    "admin",
+		DBName:    "goproject",
+		DBSSLMode: "disable",
+
+		DBMaxOpenConns:    20,
+		DBMaxIdleConns:    5,
+		DBConnMaxLifetime: 30 * time.Minute,
+		DBConnMaxIdleTime: 5 * time.Minute,
+		DBConnectTimeout:  30 * time.Second,
+		MigrateOnStart:    true,
+
+		HTTPReadTimeout:  10 * time.Second,
+		HTTPWriteTimeout: 30 * time.Second,
+		HTTPIdleTimeout:  2 * time.Minute,
+
+		LogFile: "logs.txt",
+
+		SchedulerInterval: time.Hour,
+
+		Lockout: defaultLockoutConfig(),
+	}
+}
+
+// settings looks up configuration values: environment variables first, then the config file.
+type settings struct {
+	file map[string]string
+}
+
+func (s settings) lookup(names ...string) (string, bool) {
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+	}
+	for _, name := range names {
+		if value, ok := s.file[name]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func (s settings) str(target *string, names ...string) {
+	if value, ok := s.lookup(names...); ok {
+		*target = value
+	}
+}
+
+func (s settings) int(target *int, errs *[]string, names ...string) {
+	if value, ok := s.lookup(names...); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: %q is not a number", names[0], value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (s settings) bool(target *bool, errs *[]string, names ...string) {
+	if value, ok := s.lookup(names...); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: %q is not true or false", names[0], value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (s settings) duration(target *time.Duration, errs *[]string, names ...string) {
+	if value, ok := s.lookup(names...); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s: %q is not a duration", names[0], value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+// readConfigFile parses a file of NAME=value lines. Blank lines and lines starting with # are skipped.
+func readConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		i := strings.Index(text, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value", path, line)
+		}
+		values[strings.TrimSpace(text[:i])] = strings.Trim(strings.TrimSpace(text[i+1:]), `"`)
+	}
+	return values, scanner.Err()
+}
+
+// loadConfig builds the configuration from the defaults, the config file at path (if not empty)
+// and the environment, in increasing order of precedence, and validates it.
+func loadConfig(path string) (Config, error) {
+	config := defaultConfig()
+	s := settings{}
+
+	if path != "" {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return config, err
+		}
+		s.file = file
+	}
+
+	var errs []string
+
+	s.str(&config.ListenAddr, "LISTEN_ADDR")
+
+	// pg_host is the name docker-compose has always used
+	s.str(&config.DBHost, "PG_HOST", "pg_host")
+	s.int(&config.DBPort, &errs, "PG_PORT")
+	s.str(&config.DBUser, "PG_USER")
+	s.str(&config.DBPassword, "PG_PASSWORD")
+	s.str(&config.DBName, "PG_DATABASE")
+	s.str(&config.DBSSLMode, "PG_SSLMODE")
+
+	s.int(&config.DBMaxOpenConns, &errs, "DB_MAX_OPEN_CONNS")
+	s.int(&config.DBMaxIdleConns, &errs, "DB_MAX_IDLE_CONNS")
+	s.duration(&config.DBConnMaxLifetime, &errs, "DB_CONN_MAX_LIFETIME")
+	s.duration(&config.DBConnMaxIdleTime, &errs, "DB_CONN_MAX_IDLE_TIME")
+	s.duration(&config.DBConnectTimeout, &errs, "DB_CONNECT_TIMEOUT")
+	s.bool(&config.MigrateOnStart, &errs, "MIGRATE_ON_START")
+
+	s.duration(&config.HTTPReadTimeout, &errs, "HTTP_READ_TIMEOUT")
+	s.duration(&config.HTTPWriteTimeout, &errs, "HTTP_WRITE_TIMEOUT")
+	s.duration(&config.HTTPIdleTimeout, &errs, "HTTP_IDLE_TIMEOUT")
+
+	s.str(&config.LogFile, "LOG_FILE")
+	s.str(&config.TokenSecret, "TOKEN_SECRET")
+	s.duration(&config.SchedulerInterval, &errs, "SCHEDULER_INTERVAL")
+
+	s.int(&config.Lockout.FreeAttempts, &errs, "LOGIN_FREE_ATTEMPTS")
+	s.duration(&config.Lockout.BaseDelay, &errs, "LOGIN_BASE_DELAY")
+	s.duration(&config.Lockout.MaxDelay, &errs, "LOGIN_MAX_DELAY")
+	s.int(&config.Lockout.LockoutAfter, &errs, "LOGIN_LOCKOUT_AFTER")
+	s.duration(&config.Lockout.LockoutDuration, &errs, "LOGIN_LOCKOUT_DURATION")
+	s.duration(&config.Lockout.Window, &errs, "LOGIN_WINDOW")
+
+	errs = append(errs, config.validate()...)
+	if len(errs) > 0 {
+		return config, errors.New("invalid configuration: " + strings.Join(errs, "; "))
+	}
+	return config, nil
+}
+
+// validate returns a message for every setting that is out of range.
+func (c Config) validate() []string {
+	var errs []string
+	if c.ListenAddr == "" {
+		errs = append(errs, "LISTEN_ADDR must not be empty")
+	}
+	if c.DBHost == "" {
+		errs = append(errs, "PG_HOST must not be empty")
+	}
+	if c.DBPort < 1 || c.DBPort > 65535 {
+		errs = append(errs, fmt.Sprintf("PG_PORT %d is not a valid port", c.DBPort))
+	}
+	if c.DBUser == "" {
+		errs = append(errs, "PG_USER must not be empty")
+	}
+	if c.DBName == "" {
+		errs = append(errs, "PG_DATABASE must not be empty")
+	}
+	if c.DBMaxOpenConns < 0 || c.DBMaxIdleConns < 0 {
+		errs = append(errs, "DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative")
+	}
+	if c.DBMaxOpenConns > 0 && c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, "DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS")
+	}
+	for name, d := range map[string]time.Duration{
+		"DB_CONN_MAX_LIFETIME":   c.DBConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME":  c.DBConnMaxIdleTime,
+		"DB_CONNECT_TIMEOUT":     c.DBConnectTimeout,
+		"HTTP_READ_TIMEOUT":      c.HTTPReadTimeout,
+		"HTTP_WRITE_TIMEOUT":     c.HTTPWriteTimeout,
+		"HTTP_IDLE_TIMEOUT":      c.HTTPIdleTimeout,
+		"SCHEDULER_INTERVAL":     c.SchedulerInterval,
+		"LOGIN_BASE_DELAY":       c.Lockout.BaseDelay,
+		"LOGIN_MAX_DELAY":        c.Lockout.MaxDelay,
+		"LOGIN_LOCKOUT_DURATION": c.Lockout.LockoutDuration,
+		"LOGIN_WINDOW":           c.Lockout.Window,
+	} {
+		if d < 0 {
+			errs = append(errs, name+" must not be negative")
+		}
+	}
+	if c.Lockout.FreeAttempts < 0 || c.Lockout.LockoutAfter < 0 {
+		errs = append(errs, "LOGIN_FREE_ATTEMPTS and LOGIN_LOCKOUT_AFTER must not be negative")
+	}
+	return errs
+}
+
+// DSN returns the PostgreSQL connection string.
+// Every value is quoted, so a password may contain spaces, quotes or backslashes.
+func (c Config) DSN() string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		dsnValue(c.DBHost), dsnValue(strconv.Itoa(c.DBPort)), dsnValue(c.DBUser), dsnValue(c.DBPassword), dsnValue(c.DBName), dsnValue(c.DBSSLMode),
+	)
+}
+
+// dsnValue single-quotes a connection string value, escaping ' and \ as libpq requires.
+func dsnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// setupLogging points the loggers to the configured destination.
+func setupLogging(config Config) error {
+	var out io.Writer = os.Stderr
+	if config.LogFile != "-" {
+		file, err := os.OpenFile(config.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			return err
+		}
+		out = file
+	}
+
+	InfoLogger = log.New(out, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	WarningLogger = log.New(out, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
+	ErrorLogger = log.New(out, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	return nil
+}
+
+// openDatabase opens the connection pool shared by all requests.
+// Waits up to DBConnectTimeout for the database to answer, so a server
+// started next to its database does not fail while it is still booting.
+func openDatabase(config Config) (*sql.DB, error) {
+	pool, err := sql.Open("postgres", config.DSN())
+	if err != nil {
+		return nil, err
+	}
+
+	pool.SetMaxOpenConns(config.DBMaxOpenConns)
+	pool.SetMaxIdleConns(config.DBMaxIdleConns)
+	pool.SetConnMaxLifetime(config.DBConnMaxLifetime)
+	pool.SetConnMaxIdleTime(config.DBConnMaxIdleTime)
+
+	deadline := time.Now().Add(config.DBConnectTimeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = pool.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return pool, nil
+		}
+		if time.Now().After(deadline) {
+			pool.Close()
+			return nil, fmt.Errorf("database %s:%d not reachable: %w", config.DBHost, config.DBPort, err)
+		}
+		WarningLogger.Println("Database not reachable yet, retrying... " + err.Error())
+		time.Sleep(time.Second)
+	}
+}
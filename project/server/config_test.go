@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "server.env")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+# database
+PG_HOST=filehost
+PG_PORT=6543
+DB_MAX_OPEN_CONNS=50
+LISTEN_ADDR=":8080"
+`)
+	t.Setenv("PG_HOST", "envhost")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "1h")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.DBHost != "envhost" {
+		t.Errorf("DBHost = %q, want the environment to win over the file", config.DBHost)
+	}
+	if config.DBPort != 6543 {
+		t.Errorf("DBPort = %d, want 6543 from the file", config.DBPort)
+	}
+	if config.DBMaxOpenConns != 50 {
+		t.Errorf("DBMaxOpenConns = %d, want 50 from the file", config.DBMaxOpenConns)
+	}
+	if config.ListenAddr != ":8080" {
+		t.Errorf("ListenAddr = %q, want \":8080\" from the file", config.ListenAddr)
+	}
+	if config.DBConnMaxLifetime != time.Hour {
+		t.Errorf("DBConnMaxLifetime = %v, want 1h from the environment", config.DBConnMaxLifetime)
+	}
+	if config.DBName != "goproject" {
+		t.Errorf("DBName = %q, want the default", config.DBName)
+	}
+}
+
+func TestLoadConfigLegacyHostVariable(t *testing.T) {
+	t.Setenv("pg_host", "golangproject_postgres")
+
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.DBHost != "golangproject_postgres" {
+		t.Errorf("DBHost = %q, want the value of pg_host", config.DBHost)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		message string
+	}{
+		{
+			name:    "Port out of range",
+			env:     map[string]string{"PG_PORT": "70000"},
+			message: "PG_PORT",
+		},
+		{
+			name:    "Port not a number",
+			env:     map[string]string{"PG_PORT": "postgres"},
+			message: "PG_PORT",
+		},
+		{
+			name:    "Bad duration",
+			env:     map[string]string{"HTTP_READ_TIMEOUT": "ten seconds"},
+			message: "HTTP_READ_TIMEOUT",
+		},
+		{
+			name:    "More idle than open connections",
+			env:     map[string]string{"DB_MAX_OPEN_CONNS": "2", "DB_MAX_IDLE_CONNS": "5"},
+			message: "DB_MAX_IDLE_CONNS",
+		},
+		{
+			name:    "Negative scheduler interval",
+			env:     map[string]string{"SCHEDULER_INTERVAL": "-1m"},
+			message: "SCHEDULER_INTERVAL",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			_, err := loadConfig("")
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("loadConfig() error = %v, want an error about %s", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestConfigDSN(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{
+			name:     "Plain password",
+			password: "admin",
+			want:     `host='db' port='5432' user='admin' password='admin' dbname='goproject' sslmode='disable'`,
+		},
+		{
+			name:     "Password with a space",
+			password: "correct horse",
+			want:     `host='db' port='5432' user='admin' password='correct horse' dbname='goproject' sslmode='disable'`,
+		},
+		{
+			name:     "Password with a quote and a backslash",
+			password: `it's\secret`,
+			want:     `host='db' port='5432' user='admin' password='it\'s\\secret' dbname='goproject' sslmode='disable'`,
+		},
+		{
+			name:     "Empty password",
+			password: "",
+			want:     `host='db' port='5432' user='admin' password='' dbname='goproject' sslmode='disable'`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{DBHost: "db", DBPort: 5432, DBUser: "admin", DBPassword: tt.password, DBName: "goproject", DBSSLMode: "disable"}
+			if got := config.DSN(); got != tt.want {
+				t.Errorf("DSN() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Layout of calendar dates in requests and responses, e.g. 2021-03-31
+const DATE_LAYOUT = "2006-01-02"
+
+// parseDate checks that value is a calendar date in DATE_LAYOUT.
+func parseDate(value string) (time.Time, error) {
+	date, err := time.Parse(DATE_LAYOUT, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return date, nil
+}
+
+// today returns the current date in DATE_LAYOUT.
+func today() string {
+	return time.Now().Format(DATE_LAYOUT)
+}
+
+// DateRange is an inclusive range of dates. An empty bound leaves that side open.
+type DateRange struct {
+	From string
+	To   string
+}
+
+// parseDateRange reads the from and to query parameters.
+func parseDateRange(query url.Values) (DateRange, error) {
+	dates := DateRange{From: query.Get("from"), To: query.Get("to")}
+
+	var from, to time.Time
+	var err error
+	if dates.From != "" {
+		if from, err = parseDate(dates.From); err != nil {
+			return dates, err
+		}
+	}
+	if dates.To != "" {
+		if to, err = parseDate(dates.To); err != nil {
+			return dates, err
+		}
+	}
+	if dates.From != "" && dates.To != "" && to.Before(from) {
+		return dates, fmt.Errorf("from %s is after to %s", dates.From, dates.To)
+	}
+	return dates, nil
+}
+
+// nullDate returns the date for a query parameter, nil for an open bound.
+func nullDate(date string) interface{} {
+	if date == "" {
+		return nil
+	}
+	return date
+}
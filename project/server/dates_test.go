@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{
+			name:  "Valid date",
+			value: "2021-03-31",
+			valid: true,
+		},
+		{
+			name:  "Leap day",
+			value: "2020-02-29",
+			valid: true,
+		},
+		{
+			name:  "Leap day in a common year",
+			value: "2021-02-29",
+			valid: false,
+		},
+		{
+			name:  "Invalid month",
+			value: "2021-13-01",
+			valid: false,
+		},
+		{
+			name:  "Day first",
+			value: "31/03/2021",
+			valid: false,
+		},
+		{
+			name:  "Without leading zeros",
+			value: "2021-3-31",
+			valid: false,
+		},
+		{
+			name:  "Empty",
+			value: "",
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseDate(tt.value)
+			if (err == nil) != tt.valid {
+				t.Errorf("parseDate(%q) error = %v, want valid %v", tt.value, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  DateRange
+		valid bool
+	}{
+		{
+			name:  "No range",
+			query: "",
+			want:  DateRange{},
+			valid: true,
+		},
+		{
+			name:  "From only",
+			query: "from=2021-01-01",
+			want:  DateRange{From: "2021-01-01"},
+			valid: true,
+		},
+		{
+			name:  "To only",
+			query: "to=2021-01-31",
+			want:  DateRange{To: "2021-01-31"},
+			valid: true,
+		},
+		{
+			name:  "From and to",
+			query: "from=2021-01-01&to=2021-01-31",
+			want:  DateRange{From: "2021-01-01", To: "2021-01-31"},
+			valid: true,
+		},
+		{
+			name:  "Single day",
+			query: "from=2021-01-31&to=2021-01-31",
+			want:  DateRange{From: "2021-01-31", To: "2021-01-31"},
+			valid: true,
+		},
+		{
+			name:  "From after to",
+			query: "from=2021-02-01&to=2021-01-31",
+			want:  DateRange{},
+			valid: false,
+		},
+		{
+			name:  "Invalid from",
+			query: "from=yesterday",
+			want:  DateRange{},
+			valid: false,
+		},
+		{
+			name:  "Invalid to",
+			query: "to=2021-01-32",
+			want:  DateRange{},
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := parseDateRange(query)
+			if (err == nil) != tt.valid {
+				t.Errorf("parseDateRange(%q) error = %v, want valid %v", tt.query, err, tt.valid)
+				return
+			}
+			if tt.valid && got != tt.want {
+				t.Errorf("parseDateRange(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,682 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Longest term of a debt, and most installments a schedule runs to, in months
+const (
+	MAX_DEBT_TERM    = 600
+	MAX_INSTALLMENTS = 1200
+)
+
+// Loan or mortgage: Principal repaid with interest at Rate (annual, in percent) in Term monthly
+// payments on PaymentDay, the first in the month after StartDate. Payments are line items linked
+// to the debt, paid from Bank and filed under Bucket when created through the debt.
+// Payment is the scheduled monthly payment; Balance is what is left of the principal after the
+// payments made, and PayoffDate when it is repaid paying Payment from NextPayment on.
+type Debt struct {
+	Id            int       `json:"id"`
+	Name          string    `json:"name"`
+	Principal     Money     `json:"principal"`
+	Rate          float64   `json:"rate"`
+	Term          int       `json:"term"`
+	PaymentDay    int       `json:"payment_day"`
+	StartDate     string    `json:"start_date"`
+	Bank          int       `json:"bank"`
+	Bucket        int       `json:"bucket"`
+	Payment       Money     `json:"payment"`
+	Balance       Money     `json:"balance"`
+	PrincipalPaid Money     `json:"principal_paid"`
+	InterestPaid  Money     `json:"interest_paid"`
+	NextPayment   string    `json:"next_payment,omitempty"`
+	PayoffDate    string    `json:"payoff_date,omitempty"`
+	Owner         int       `json:"ownerid"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// A payment of a debt: a line item, split into the interest accrued since the payment before it
+// and the principal it repays. Balance is the principal left after it.
+type DebtPayment struct {
+	LineItem  int    `json:"lineitem"`
+	Date      string `json:"date"`
+	Amount    Money  `json:"amount"`
+	Interest  Money  `json:"interest"`
+	Principal Money  `json:"principal"`
+	Balance   Money  `json:"balance"`
+}
+
+// Response of /debt/{id}/payments
+type DebtDetail struct {
+	Debt
+	Payments []DebtPayment `json:"payments"`
+}
+
+// Request of POST /debt/{id}/payments: links LineItem as a payment, or without one creates a line
+// item paying Amount (the scheduled payment by default) on OccurredOn (today by default)
+type DebtPaymentRequest struct {
+	LineItem   int    `json:"lineitem"`
+	Amount     Money  `json:"amount"`
+	OccurredOn string `json:"occurred_on"`
+}
+
+// One scheduled payment of an amortization schedule
+type Installment struct {
+	Number    int    `json:"number"`
+	Date      string `json:"date"`
+	Payment   Money  `json:"payment"`
+	Interest  Money  `json:"interest"`
+	Principal Money  `json:"principal"`
+	Balance   Money  `json:"balance"`
+}
+
+// Response of /debt/{id}/schedule: the full schedule of the debt from its start
+type DebtSchedule struct {
+	Payment       Money         `json:"payment"`
+	TotalInterest Money         `json:"total_interest"`
+	Installments  []Installment `json:"installments"`
+}
+
+// Response of /debt/{id}/payoff: repaying the balance left paying Extra on top of every payment,
+// against paying the scheduled payment only
+type DebtPayoff struct {
+	Balance       Money         `json:"balance"`
+	Payment       Money         `json:"payment"`
+	Extra         Money         `json:"extra"`
+	Months        int           `json:"months"`
+	PayoffDate    string        `json:"payoff_date"`
+	TotalInterest Money         `json:"total_interest"`
+	MonthsSaved   int           `json:"months_saved"`
+	InterestSaved Money         `json:"interest_saved"`
+	Installments  []Installment `json:"installments"`
+}
+
+const DEBT_COLUMNS = "id, \"name\", principal, rate, term_months, payment_day, to_char(start_date, 'YYYY-MM-DD'), " +
+	"coalesce(bank, 0), coalesce(bucket, 0), ownerid, created_at, updated_at"
+
+// Fields /debts can be sorted by
+var DEBT_SORT_FIELDS = map[string]string{
+	"id":         "id",
+	"name":       "\"name\"",
+	"start_date": "start_date",
+	"created_at": "created_at",
+}
+
+var errInterestNotCovered = errors.New("the payment does not cover the interest")
+
+func scanDebt(row rowScanner) (Debt, error) {
+	var debt Debt
+	err := row.Scan(
+		&debt.Id,
+		&debt.Name,
+		&debt.Principal,
+		&debt.Rate,
+		&debt.Term,
+		&debt.PaymentDay,
+		&debt.StartDate,
+		&debt.Bank,
+		&debt.Bucket,
+		&debt.Owner,
+		&debt.CreatedAt,
+		&debt.UpdatedAt,
+	)
+	return debt, err
+}
+
+// checkDebt validates a debt request.
+func checkDebt(debt Debt) error {
+	if debt.Name == "" {
+		return errors.New("name is required")
+	}
+	if debt.Principal <= 0 {
+		return errors.New("principal must be positive")
+	}
+	if debt.Rate < 0 || debt.Rate >= 100 {
+		return errors.New("rate must be a percentage from 0 to below 100")
+	}
+	if debt.Term < 1 || debt.Term > MAX_DEBT_TERM {
+		return fmt.Errorf("term must be 1 to %d months", MAX_DEBT_TERM)
+	}
+	if debt.PaymentDay < 1 || debt.PaymentDay > 31 {
+		return errors.New("payment_day must be between 1 and 31")
+	}
+	_, err := parseDate(debt.StartDate)
+	return err
+}
+
+// paymentDate returns the date of the n-th scheduled payment, counted from 1.
+func (debt Debt) paymentDate(n int) time.Time {
+	start, _ := parseDate(debt.StartDate)
+	return monthDay(start.Year(), start.Month()+time.Month(n), debt.PaymentDay)
+}
+
+// scheduledPayment returns the monthly payment that repays the debt over its term, rounded up
+// to the cent so the last payment is the smaller one.
+func (debt Debt) scheduledPayment() Money {
+	return Money(math.Ceil(monthlyPayment(float64(debt.Principal), debt.Rate, debt.Term) - 1e-6))
+}
+
+// amortize schedules the payments of payment a month that repay balance, from first on, the
+// interest of each month rounded to the cent. The last payment is what is left.
+func amortize(balance Money, annualRate float64, payment Money, first time.Time, day int) ([]Installment, error) {
+	var installments []Installment
+	for n := 1; balance > 0; n++ {
+		if n > MAX_INSTALLMENTS {
+			return nil, fmt.Errorf("the debt is not repaid within %d payments", MAX_INSTALLMENTS)
+		}
+		interest := Money(math.Round(monthlyInterest(float64(balance), annualRate)))
+		if payment <= interest {
+			return nil, errInterestNotCovered
+		}
+		paid := payment
+		if balance+interest < paid {
+			paid = balance + interest
+		}
+		balance -= paid - interest
+		installments = append(installments, Installment{
+			Number:    n,
+			Date:      monthDay(first.Year(), first.Month()+time.Month(n-1), day).Format(DATE_LAYOUT),
+			Payment:   paid,
+			Interest:  interest,
+			Principal: paid - interest,
+			Balance:   balance,
+		})
+	}
+	return installments, nil
+}
+
+// totalInterest returns the interest paid over a schedule.
+func totalInterest(installments []Installment) Money {
+	var total Money
+	for _, installment := range installments {
+		total += installment.Interest
+	}
+	return total
+}
+
+// apply splits payments, in date order, into interest and principal and fills in the balance of
+// the debt and its projected payoff as of now. Every payment pays the interest accrued daily on
+// the balance since the payment before it, or since the start date; a payment short of it adds
+// the rest to the balance, one beyond the balance repays the balance only.
+func (debt *Debt) apply(payments []DebtPayment, now time.Time) {
+	debt.Payment = debt.scheduledPayment()
+	debt.Balance, debt.PrincipalPaid, debt.InterestPaid = debt.Principal, 0, 0
+	since, _ := parseDate(debt.StartDate)
+	for i := range payments {
+		payment := &payments[i]
+		days := 0.0
+		if date, err := parseDate(payment.Date); err == nil {
+			if date.After(since) {
+				days = date.Sub(since).Hours() / 24
+				since = date
+			}
+		}
+		payment.Interest = Money(math.Round(dailyInterest(float64(debt.Balance), debt.Rate) * days))
+		payment.Principal = payment.Amount - payment.Interest
+		if payment.Principal > debt.Balance {
+			payment.Principal = debt.Balance
+		}
+		debt.Balance -= payment.Principal
+		debt.PrincipalPaid += payment.Principal
+		debt.InterestPaid += payment.Interest
+		payment.Balance = debt.Balance
+	}
+
+	debt.NextPayment, debt.PayoffDate = "", ""
+	if debt.Balance <= 0 {
+		if len(payments) > 0 {
+			debt.PayoffDate = payments[len(payments)-1].Date
+		}
+		return
+	}
+
+	// The next scheduled date after today and after the last payment
+	after := now
+	if len(payments) > 0 {
+		if last, err := parseDate(payments[len(payments)-1].Date); err == nil && last.After(after) {
+			after = last
+		}
+	}
+	n := 1
+	for !debt.paymentDate(n).After(after) {
+		n++
+	}
+	next := debt.paymentDate(n)
+	debt.NextPayment = next.Format(DATE_LAYOUT)
+
+	if installments, err := amortize(debt.Balance, debt.Rate, debt.Payment, next, debt.PaymentDay); err == nil {
+		debt.PayoffDate = installments[len(installments)-1].Date
+	}
+}
+
+// readDebt returns a debt of owner with its payments applied, sql.ErrNoRows if there is none.
+func readDebt(owner int, id int) (Debt, []DebtPayment, error) {
+	debt, err := scanDebt(db.QueryRow("SELECT "+DEBT_COLUMNS+" FROM public.debt WHERE id=$1 AND ownerid=$2;", id, owner))
+	if err != nil {
+		return debt, nil, err
+	}
+	payments, err := debtPayments(&debt)
+	return debt, payments, err
+}
+
+// debtPayments returns the payments of a debt in date order, and applies them to it.
+func debtPayments(debt *Debt) ([]DebtPayment, error) {
+	rows, err := db.Query("SELECT id, to_char(occurred_on, 'YYYY-MM-DD'), -amount FROM public.lineitem WHERE debt=$1 ORDER BY occurred_on, id;", debt.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []DebtPayment{}
+	for rows.Next() {
+		var payment DebtPayment
+		if err := rows.Scan(&payment.LineItem, &payment.Date, &payment.Amount); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now, _ := parseDate(today())
+	debt.apply(payments, now)
+	return payments, nil
+}
+
+// readDebtRequest decodes and validates a debt request.
+func readDebtRequest(r *http.Request, owner int) (Debt, int, error) {
+	var request Debt
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return request, http.StatusBadRequest, err
+	}
+	if err := checkDebt(request); err != nil {
+		return request, http.StatusBadRequest, err
+	}
+	if !lineitemRefsOwned(db, LineItem{Bucket: request.Bucket, Bank: request.Bank}, owner) {
+		return request, http.StatusBadRequest, errors.New("Bucket or Bank not found.")
+	}
+	return request, 0, nil
+}
+
+// Create and list debts, with their balances
+func debtProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "POST":
+		request, status, err := readDebtRequest(r, owner)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		var id int
+		err = db.QueryRow(
+			`INSERT INTO public.debt ("name", principal, rate, term_months, payment_day, start_date, bank, bucket, ownerid)
+			VALUES($1, $2, $3, $4, $5, $6::date, $7, $8, $9) RETURNING id;`,
+			request.Name,
+			request.Principal,
+			request.Rate,
+			request.Term,
+			request.PaymentDay,
+			request.StartDate,
+			nullInt(request.Bank),
+			nullInt(request.Bucket),
+			owner,
+		).Scan(&id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("New Debt created.")
+
+		debt, _, err := readDebt(owner, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(debt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	case "GET":
+		options, err := parseListOptions(r.URL.Query(), DEBT_SORT_FIELDS, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var f filter
+		f.add("ownerid=?", owner)
+		rows, total, err := queryPage("debt", DEBT_COLUMNS, f, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		debts := []Debt{}
+		for rows.Next() {
+			debt, err := scanDebt(rows)
+			checkError(err)
+
+			debts = append(debts, debt)
+		}
+		rows.Close()
+
+		for i := range debts {
+			if _, err := debtPayments(&debts[i]); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				ErrorLogger.Println("Internal Error Occured. " + err.Error())
+				return
+			}
+		}
+		InfoLogger.Println("Debts retrieved.")
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if err := json.NewEncoder(w).Encode(debts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+// Read, change or delete a debt
+// Deleting a debt keeps its payments as plain line items.
+func debtProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	current, _, err := readDebt(owner, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Debt Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		InfoLogger.Println("Debt Information retrieved.")
+	case "PUT":
+		request, status, err := readDebtRequest(r, owner)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		_, err = db.Exec(
+			`UPDATE public.debt SET "name"=$1, principal=$2, rate=$3, term_months=$4, payment_day=$5, start_date=$6::date, bank=$7, bucket=$8
+			WHERE id=$9 AND ownerid=$10;`,
+			request.Name,
+			request.Principal,
+			request.Rate,
+			request.Term,
+			request.PaymentDay,
+			request.StartDate,
+			nullInt(request.Bank),
+			nullInt(request.Bucket),
+			id,
+			owner,
+		)
+		if err == nil {
+			current, _, err = readDebt(owner, id)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Debt Information Updated.")
+	case "DELETE":
+		if _, err := db.Exec("DELETE FROM public.debt WHERE id=$1 AND ownerid=$2;", id, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Debt Information deleted.")
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(current); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Full amortization schedule of a debt, from its first payment, paying the scheduled payment
+func debtScheduleProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	debt, _, err := readDebt(owner, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Debt Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	schedule := DebtSchedule{Payment: debt.Payment}
+	schedule.Installments, err = amortize(debt.Principal, debt.Rate, debt.Payment, debt.paymentDate(1), debt.PaymentDay)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	schedule.TotalInterest = totalInterest(schedule.Installments)
+	InfoLogger.Println("Debt Schedule computed.")
+
+	if err := json.NewEncoder(w).Encode(schedule); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Payoff projection of the balance left of a debt, paying extra (0.00) on top of every payment
+// from the next payment on, compared to paying the scheduled payment only
+func debtPayoffProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	var extra Money
+	if value := r.URL.Query().Get("extra"); value != "" {
+		var err error
+		if extra, err = ParseMoney(value); err != nil || extra < 0 {
+			http.Error(w, fmt.Sprintf("invalid extra %q, expected an amount of at least 0", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	debt, _, err := readDebt(owner, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Debt Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	payoff := DebtPayoff{Balance: debt.Balance, Payment: debt.Payment, Extra: extra, Installments: []Installment{}}
+	if debt.Balance > 0 {
+		next, _ := parseDate(debt.NextPayment)
+		scheduled, err := amortize(debt.Balance, debt.Rate, debt.Payment, next, debt.PaymentDay)
+		if err == nil {
+			payoff.Installments, err = amortize(debt.Balance, debt.Rate, debt.Payment+extra, next, debt.PaymentDay)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		payoff.Months = len(payoff.Installments)
+		payoff.PayoffDate = payoff.Installments[payoff.Months-1].Date
+		payoff.TotalInterest = totalInterest(payoff.Installments)
+		payoff.MonthsSaved = len(scheduled) - payoff.Months
+		payoff.InterestSaved = totalInterest(scheduled) - payoff.TotalInterest
+	}
+	InfoLogger.Println("Debt Payoff projected.")
+
+	if err := json.NewEncoder(w).Encode(payoff); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Payments of a debt split into interest and principal (GET); record a payment (POST), linking
+// a line item or creating one; or stop counting line item ?lineitem= as a payment (DELETE)
+func debtPaymentProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	debt, _, err := readDebt(owner, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Debt Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		var request DebtPaymentRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if request.LineItem != 0 {
+			var amount Money
+			var linked int
+			err := db.QueryRow("SELECT amount, coalesce(debt, 0) FROM public.lineitem WHERE id=$1 AND ownerid=$2;", request.LineItem, owner).Scan(&amount, &linked)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Line Item not found.", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				ErrorLogger.Println("Internal Error Occured. " + err.Error())
+				return
+			}
+			if amount >= 0 {
+				http.Error(w, "a payment must be an expense", http.StatusBadRequest)
+				return
+			}
+			if linked != 0 && linked != id {
+				http.Error(w, "Line Item is already a payment of debt "+strconv.Itoa(linked)+".", http.StatusConflict)
+				return
+			}
+			_, err = db.Exec("UPDATE public.lineitem SET debt=$1 WHERE id=$2 AND ownerid=$3;", id, request.LineItem, owner)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				ErrorLogger.Println("Internal Error Occured. " + err.Error())
+				return
+			}
+		} else {
+			if request.Amount == 0 {
+				request.Amount = debt.Payment
+			}
+			if request.Amount < 0 {
+				http.Error(w, "amount must be positive", http.StatusBadRequest)
+				return
+			}
+			if request.OccurredOn == "" {
+				request.OccurredOn = today()
+			} else if _, err := parseDate(request.OccurredOn); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			_, err = db.Exec(
+				"INSERT INTO public.lineitem (title, description, amount, bucket, bank, ownerid, occurred_on, debt) VALUES($1, '', $2, $3, $4, $5, $6, $7);",
+				debt.Name+" payment",
+				-request.Amount,
+				debt.Bucket,
+				debt.Bank,
+				owner,
+				request.OccurredOn,
+				id,
+			)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				ErrorLogger.Println("Internal Error Occured. " + err.Error())
+				return
+			}
+		}
+		InfoLogger.Println("Debt Payment recorded.")
+	case "DELETE":
+		lineitem, err := strconv.Atoi(r.URL.Query().Get("lineitem"))
+		if err != nil {
+			http.Error(w, "lineitem is required", http.StatusBadRequest)
+			return
+		}
+		// The line item itself is kept
+		if _, err := db.Exec("UPDATE public.lineitem SET debt=NULL WHERE id=$1 AND debt=$2 AND ownerid=$3;", lineitem, id, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Debt Payment removed.")
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	detail := DebtDetail{Debt: debt}
+	if detail.Payments, err = debtPayments(&detail.Debt); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
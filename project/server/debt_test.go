@@ -0,0 +1,172 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckDebt(t *testing.T) {
+	valid := Debt{Name: "Car", Principal: 2000000, Rate: 4.5, Term: 60, PaymentDay: 15, StartDate: "2021-01-10"}
+
+	tests := []struct {
+		name   string
+		change func(d *Debt)
+		valid  bool
+	}{
+		{
+			name:   "Valid",
+			change: func(d *Debt) {},
+			valid:  true,
+		},
+		{
+			name:   "No interest",
+			change: func(d *Debt) { d.Rate = 0 },
+			valid:  true,
+		},
+		{
+			name:   "No name",
+			change: func(d *Debt) { d.Name = "" },
+			valid:  false,
+		},
+		{
+			name:   "No principal",
+			change: func(d *Debt) { d.Principal = 0 },
+			valid:  false,
+		},
+		{
+			name:   "Negative rate",
+			change: func(d *Debt) { d.Rate = -1 },
+			valid:  false,
+		},
+		{
+			name:   "No term",
+			change: func(d *Debt) { d.Term = 0 },
+			valid:  false,
+		},
+		{
+			name:   "Long term",
+			change: func(d *Debt) { d.Term = MAX_DEBT_TERM + 1 },
+			valid:  false,
+		},
+		{
+			name:   "Payment day out of range",
+			change: func(d *Debt) { d.PaymentDay = 32 },
+			valid:  false,
+		},
+		{
+			name:   "Invalid start",
+			change: func(d *Debt) { d.StartDate = "10/01/2021" },
+			valid:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			debt := valid
+			tt.change(&debt)
+			if err := checkDebt(debt); (err == nil) != tt.valid {
+				t.Errorf("checkDebt error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestAmortize(t *testing.T) {
+	first, _ := parseDate("2021-02-15")
+	installments, err := amortize(100000, 12, 8885, first, 15)
+	if err != nil {
+		t.Fatalf("amortize error = %v", err)
+	}
+	if len(installments) != 12 {
+		t.Fatalf("amortize = %d installments, want 12", len(installments))
+	}
+
+	want := []Installment{
+		{Number: 1, Date: "2021-02-15", Payment: 8885, Interest: 1000, Principal: 7885, Balance: 92115},
+		{Number: 12, Date: "2022-01-15", Payment: 8884, Interest: 88, Principal: 8796, Balance: 0},
+	}
+	if got := []Installment{installments[0], installments[11]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("amortize first and last = %v, want %v", got, want)
+	}
+	if total := totalInterest(installments); total != 6619 {
+		t.Errorf("totalInterest = %s, want 66.19", total)
+	}
+
+	extra, _ := amortize(100000, 12, 10885, first, 15)
+	if len(extra) != 10 || totalInterest(extra) != 5431 {
+		t.Errorf("amortize with extra = %d installments, %s interest, want 10, 54.31", len(extra), totalInterest(extra))
+	}
+
+	if _, err := amortize(100000, 12, 1000, first, 15); err != errInterestNotCovered {
+		t.Errorf("amortize paying the interest only error = %v, want %v", err, errInterestNotCovered)
+	}
+}
+
+func TestDebtApply(t *testing.T) {
+	now, _ := parseDate("2021-03-20")
+
+	tests := []struct {
+		name          string
+		payments      []DebtPayment
+		want          []DebtPayment
+		balance       Money
+		principalPaid Money
+		interestPaid  Money
+		nextPayment   string
+		payoffDate    string
+	}{
+		{
+			name:          "Interest accrued since the start date and the payment before",
+			payments:      []DebtPayment{{LineItem: 1, Date: "2021-02-15", Amount: 8885}, {LineItem: 2, Date: "2021-03-15", Amount: 5000}},
+			want:          []DebtPayment{{LineItem: 1, Date: "2021-02-15", Amount: 8885, Interest: 1184, Principal: 7701, Balance: 92299}, {LineItem: 2, Date: "2021-03-15", Amount: 5000, Interest: 850, Principal: 4150, Balance: 88149}},
+			balance:       88149,
+			principalPaid: 11851,
+			interestPaid:  2034,
+			nextPayment:   "2021-04-15",
+			payoffDate:    "2022-02-15",
+		},
+		{
+			name: "Extra payment in the same month",
+			payments: []DebtPayment{
+				{LineItem: 1, Date: "2021-02-15", Amount: 8885},
+				{LineItem: 2, Date: "2021-03-15", Amount: 5000},
+				{LineItem: 3, Date: "2021-03-25", Amount: 3000},
+			},
+			want: []DebtPayment{
+				{LineItem: 1, Date: "2021-02-15", Amount: 8885, Interest: 1184, Principal: 7701, Balance: 92299},
+				{LineItem: 2, Date: "2021-03-15", Amount: 5000, Interest: 850, Principal: 4150, Balance: 88149},
+				{LineItem: 3, Date: "2021-03-25", Amount: 3000, Interest: 290, Principal: 2710, Balance: 85439},
+			},
+			balance:       85439,
+			principalPaid: 14561,
+			interestPaid:  2324,
+			nextPayment:   "2021-04-15",
+			payoffDate:    "2022-02-15",
+		},
+		{
+			name:          "Paid off",
+			payments:      []DebtPayment{{LineItem: 3, Date: "2021-02-15", Amount: 200000}},
+			want:          []DebtPayment{{LineItem: 3, Date: "2021-02-15", Amount: 200000, Interest: 1184, Principal: 100000, Balance: 0}},
+			principalPaid: 100000,
+			interestPaid:  1184,
+			payoffDate:    "2021-02-15",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			debt := Debt{Principal: 100000, Rate: 12, Term: 12, PaymentDay: 15, StartDate: "2021-01-10"}
+			debt.apply(tt.payments, now)
+			if !reflect.DeepEqual(tt.payments, tt.want) {
+				t.Errorf("apply payments = %v, want %v", tt.payments, tt.want)
+			}
+			if debt.Payment != 8885 || debt.Balance != tt.balance || debt.PrincipalPaid != tt.principalPaid || debt.InterestPaid != tt.interestPaid {
+				t.Errorf("apply = payment %s, balance %s, principal paid %s, interest paid %s, want 88.85, %s, %s, %s",
+					debt.Payment, debt.Balance, debt.PrincipalPaid, debt.InterestPaid, tt.balance, tt.principalPaid, tt.interestPaid)
+			}
+			if debt.NextPayment != tt.nextPayment || debt.PayoffDate != tt.payoffDate {
+				t.Errorf("apply = next payment %q, payoff %q, want %q, %q", debt.NextPayment, debt.PayoffDate, tt.nextPayment, tt.payoffDate)
+			}
+		})
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Two line items are likely duplicates when they are on the same bank account, have the
+// same amount, occurred at most DUPLICATE_WINDOW_DAYS apart and have similar titles.
+const (
+	DUPLICATE_WINDOW_DAYS    = 3
+	DUPLICATE_MIN_SIMILARITY = 0.5
+)
+
+// Actions of a duplicate review
+const (
+	REVIEW_MERGE         = "merge"
+	REVIEW_NOT_DUPLICATE = "not_duplicate"
+)
+
+// A pair of line items that are likely the same transaction
+// Score ranks the pairs, from 0 to 1: similar titles on the same day score highest.
+type DuplicatePair struct {
+	First      LineItem `json:"first"`
+	Second     LineItem `json:"second"`
+	Similarity float64  `json:"similarity"`
+	DaysApart  int      `json:"days_apart"`
+	Score      float64  `json:"score"`
+}
+
+// Decision on a pair of line items
+// merge keeps First and deletes Second, not_duplicate stops reporting the pair.
+type DuplicateReview struct {
+	First  int    `json:"first"`
+	Second int    `json:"second"`
+	Action string `json:"action"`
+}
+
+// normalizeTitle lowercases a title and keeps only its letters and digits, one space between words.
+func normalizeTitle(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// bigrams returns the pairs of adjacent characters of every word.
+func bigrams(text string) map[string]int {
+	pairs := map[string]int{}
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		if len(runes) == 1 {
+			pairs[word]++
+		}
+		for i := 0; i+1 < len(runes); i++ {
+			pairs[string(runes[i:i+2])]++
+		}
+	}
+	return pairs
+}
+
+// titleSimilarity compares two titles from 0 (nothing in common) to 1 (the same once normalized),
+// with the Sørensen–Dice coefficient of their character pairs. A title that starts with the
+// other one, such as "AMAZON MKTPLACE PMTS" and "Amazon", counts as similar too.
+func titleSimilarity(a string, b string) float64 {
+	a, b = normalizeTitle(a), normalizeTitle(b)
+	if a == b {
+		return 1
+	}
+	if a == "" || b == "" {
+		return 0
+	}
+
+	pairsA, pairsB := bigrams(a), bigrams(b)
+	total, shared := 0, 0
+	for pair, n := range pairsA {
+		total += n
+		if m := pairsB[pair]; m < n {
+			shared += m
+		} else {
+			shared += n
+		}
+	}
+	for _, n := range pairsB {
+		total += n
+	}
+	similarity := 2 * float64(shared) / float64(total)
+
+	shorter, longer := a, b
+	if len(shorter) > len(longer) {
+		shorter, longer = longer, shorter
+	}
+	if len(shorter) >= 4 && strings.HasPrefix(longer, shorter) && similarity < 0.8 {
+		similarity = 0.8
+	}
+	return similarity
+}
+
+// daysApart returns the number of days between two dates in DATE_LAYOUT.
+func daysApart(a string, b string) int {
+	dateA, _ := parseDate(a)
+	dateB, _ := parseDate(b)
+	days := int(dateA.Sub(dateB).Hours() / 24)
+	if days < 0 {
+		return -days
+	}
+	return days
+}
+
+// matchDuplicate reports whether two line items are likely the same transaction.
+// Line items of transfers are never duplicates, and neither are two imported
+// line items with different transaction ids: the bank listed them separately.
+func matchDuplicate(a LineItem, b LineItem) (DuplicatePair, bool) {
+	pair := DuplicatePair{First: a, Second: b}
+	if a.Bank != b.Bank || a.Amount != b.Amount || a.Transfer != 0 || b.Transfer != 0 {
+		return pair, false
+	}
+	if a.FitId != "" && b.FitId != "" && a.FitId != b.FitId {
+		return pair, false
+	}
+
+	pair.DaysApart = daysApart(a.OccurredOn, b.OccurredOn)
+	if pair.DaysApart > DUPLICATE_WINDOW_DAYS {
+		return pair, false
+	}
+	pair.Similarity = titleSimilarity(a.Title, b.Title)
+	if pair.Similarity < DUPLICATE_MIN_SIMILARITY {
+		return pair, false
+	}
+
+	pair.Score = pair.Similarity * (1 - float64(pair.DaysApart)/float64(DUPLICATE_WINDOW_DAYS+1))
+	return pair, true
+}
+
+// pairKey identifies a pair of line items, whatever their order.
+func pairKey(a int, b int) [2]int {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int{a, b}
+}
+
+// findDuplicates returns the likely duplicates among line items, best matches first.
+// Pairs in dismissed, marked as not duplicates before, are left out. Line items are
+// compared only with those on the same bank, with the same amount, within the date window.
+func findDuplicates(lineitems []LineItem, dismissed map[[2]int]bool) []DuplicatePair {
+	sorted := make([]LineItem, len(lineitems))
+	copy(sorted, lineitems)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Bank != sorted[j].Bank {
+			return sorted[i].Bank < sorted[j].Bank
+		}
+		if sorted[i].Amount != sorted[j].Amount {
+			return sorted[i].Amount < sorted[j].Amount
+		}
+		if sorted[i].OccurredOn != sorted[j].OccurredOn {
+			return sorted[i].OccurredOn < sorted[j].OccurredOn
+		}
+		return sorted[i].Id < sorted[j].Id
+	})
+
+	pairs := []DuplicatePair{}
+	for i, a := range sorted {
+		for _, b := range sorted[i+1:] {
+			if b.Bank != a.Bank || b.Amount != a.Amount || daysApart(a.OccurredOn, b.OccurredOn) > DUPLICATE_WINDOW_DAYS {
+				break
+			}
+			if dismissed[pairKey(a.Id, b.Id)] {
+				continue
+			}
+			if pair, ok := matchDuplicate(a, b); ok {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Score > pairs[j].Score
+	})
+	return pairs
+}
+
+// dismissedPairs returns the pairs of line items the user marked as not duplicates.
+func dismissedPairs(owner int) (map[[2]int]bool, error) {
+	rows, err := db.Query("SELECT lineitem, other FROM public.duplicatedismissal WHERE ownerid=$1;", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dismissed := map[[2]int]bool{}
+	for rows.Next() {
+		var a, b int
+		if err := rows.Scan(&a, &b); err != nil {
+			return nil, err
+		}
+		dismissed[pairKey(a, b)] = true
+	}
+	return dismissed, rows.Err()
+}
+
+// candidateLineItems returns the line items of a user that may duplicate each other in a date range,
+// widened by the duplicate window so pairs across its bounds are found too.
+func candidateLineItems(owner int, dates DateRange) ([]LineItem, error) {
+	var f filter
+	f.add("ownerid=?", owner)
+	f.add("transfer IS NULL")
+	if dates.From != "" {
+		f.add("occurred_on >= ?::date - ?::int", dates.From, DUPLICATE_WINDOW_DAYS)
+	}
+	if dates.To != "" {
+		f.add("occurred_on <= ?::date + ?::int", dates.To, DUPLICATE_WINDOW_DAYS)
+	}
+
+	rows, err := db.Query("SELECT "+LINEITEM_COLUMNS+" FROM public.lineitem"+f.where()+";", f.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lineitems []LineItem
+	for rows.Next() {
+		lineitem, err := scanLineItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		lineitems = append(lineitems, lineitem)
+	}
+	return lineitems, rows.Err()
+}
+
+// inRange reports whether a pair has a line item within the date range.
+func (pair DuplicatePair) inRange(dates DateRange) bool {
+	for _, date := range []string{pair.First.OccurredOn, pair.Second.OccurredOn} {
+		if (dates.From == "" || date >= dates.From) && (dates.To == "" || date <= dates.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// List the likely duplicates among the line items of the user (optionally ?from= and ?to=)
+func duplicateProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "GET":
+		dates, err := parseDateRange(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		lineitems, err := candidateLineItems(owner, dates)
+		if err == nil {
+			var dismissed map[[2]int]bool
+			dismissed, err = dismissedPairs(owner)
+			if err == nil {
+				pairs := []DuplicatePair{}
+				for _, pair := range findDuplicates(lineitems, dismissed) {
+					if pair.inRange(dates) {
+						pairs = append(pairs, pair)
+					}
+				}
+				InfoLogger.Println("Duplicate Line Items retrieved.")
+				err = json.NewEncoder(w).Encode(pairs)
+			}
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+// Check a line item that is about to be created (POST, the line item as body)
+// Returns the existing line items it likely duplicates, so clients can warn before creating it.
+func duplicateCheckProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	var request LineItem
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.OccurredOn == "" {
+		request.OccurredOn = today()
+	}
+	if _, err := parseDate(request.OccurredOn); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Id, request.Transfer = 0, 0
+
+	rows, err := db.Query(
+		"SELECT "+LINEITEM_COLUMNS+" FROM public.lineitem WHERE ownerid=$1 AND coalesce(bank, 0)=$2 AND amount=$3 AND transfer IS NULL "+
+			"AND occurred_on BETWEEN $4::date - $5::int AND $4::date + $5::int ORDER BY occurred_on, id;",
+		owner,
+		request.Bank,
+		request.Amount,
+		request.OccurredOn,
+		DUPLICATE_WINDOW_DAYS,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	defer rows.Close()
+
+	pairs := []DuplicatePair{}
+	for rows.Next() {
+		lineitem, err := scanLineItem(rows)
+		checkError(err)
+
+		if pair, ok := matchDuplicate(request, lineitem); ok {
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Score > pairs[j].Score
+	})
+	InfoLogger.Println("Line Item checked for duplicates.")
+
+	if err := json.NewEncoder(w).Encode(pairs); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+var errNotMergeable = errors.New("Only line items on the same bank account with the same amount, not part of a transfer, can be merged.")
+
+var errFitIdsDiffer = errors.New("Both line items were imported, with different transaction ids. Merging would lose one of them, and importing its statement again would bring the duplicate back.")
+
+// checkMergeable reports why two line items can not be merged, nil if they can.
+func checkMergeable(keep LineItem, remove LineItem) error {
+	if keep.Bank != remove.Bank || keep.Amount != remove.Amount || keep.Transfer != 0 || remove.Transfer != 0 {
+		return errNotMergeable
+	}
+	if keep.FitId != "" && remove.FitId != "" && keep.FitId != remove.FitId {
+		return errFitIdsDiffer
+	}
+	return nil
+}
+
+// mergeLineItems keeps the first line item and deletes the second, in one transaction.
+// What the kept line item is missing (description, bucket, transaction id) is taken from the
+// deleted one, and allocations from the deleted line item move to the kept one. Keeping the
+// transaction id means importing the statement again does not bring the duplicate back.
+func mergeLineItems(owner int, keep LineItem, remove LineItem) (LineItem, error) {
+	if err := checkMergeable(keep, remove); err != nil {
+		return keep, err
+	}
+	if keep.Reconciliation != 0 || remove.Reconciliation != 0 {
+		return keep, errReconciled
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return keep, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE public.allocation SET lineitem=$1 WHERE lineitem=$2 AND ownerid=$3;", keep.Id, remove.Id, owner); err != nil {
+		return keep, err
+	}
+	// Deleted first, so its transaction id is free for the kept line item
+	if _, err := tx.Exec("DELETE FROM public.lineitem WHERE id=$1 AND ownerid=$2;", remove.Id, owner); err != nil {
+		return keep, err
+	}
+
+	if keep.Description == "" {
+		keep.Description = remove.Description
+	}
+	if keep.Bucket == 0 {
+		keep.Bucket = remove.Bucket
+	}
+	if keep.FitId == "" {
+		keep.FitId = remove.FitId
+	}
+	merged, err := scanLineItem(tx.QueryRow(
+		"UPDATE public.lineitem SET description=$1, bucket=$2, fitid=$3 WHERE id=$4 AND ownerid=$5 RETURNING "+LINEITEM_COLUMNS+";",
+		keep.Description,
+		keep.Bucket,
+		nullString(keep.FitId),
+		keep.Id,
+		owner,
+	))
+	if err != nil {
+		return keep, err
+	}
+	return merged, tx.Commit()
+}
+
+// Review a pair of line items: merge them, or mark them as not duplicates
+// Responds with the kept line item of a merge, and the pair otherwise.
+func duplicateReviewProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	var request DuplicateReview
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.First == request.Second {
+		http.Error(w, "first and second must be two different line items", http.StatusBadRequest)
+		return
+	}
+
+	var pair [2]LineItem
+	for i, id := range []int{request.First, request.Second} {
+		var err error
+		pair[i], err = scanLineItem(db.QueryRow("SELECT "+LINEITEM_COLUMNS+" FROM public.lineitem WHERE id=$1 AND ownerid=$2;", id, owner))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Line Item Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	}
+
+	var response interface{}
+	switch request.Action {
+	case REVIEW_MERGE:
+		merged, err := mergeLineItems(owner, pair[0], pair[1])
+		if err == errNotMergeable || err == errFitIdsDiffer || err == errReconciled {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Duplicate Line Items merged.")
+		response = merged
+	case REVIEW_NOT_DUPLICATE:
+		key := pairKey(request.First, request.Second)
+		_, err := db.Exec("INSERT INTO public.duplicatedismissal (lineitem, other, ownerid) VALUES($1, $2, $3) ON CONFLICT DO NOTHING;", key[0], key[1], owner)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Line Items marked as not duplicates.")
+		response = pair
+	default:
+		http.Error(w, "invalid action "+request.Action+", expected merge or not_duplicate", http.StatusBadRequest)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
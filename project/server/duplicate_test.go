@@ -0,0 +1,219 @@
+package main
+
+import "testing"
+
+func TestTitleSimilarity(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       string
+		b       string
+		similar bool
+	}{
+		{
+			name:    "Different case",
+			a:       "Coffee",
+			b:       "coffee",
+			similar: true,
+		},
+		{
+			name:    "Ampersand spelled out",
+			a:       "Smith & Sons Grocery",
+			b:       "SMITH AND SONS GROCERY",
+			similar: true,
+		},
+		{
+			name:    "Prefix of the title",
+			a:       "AMAZON MKTPLACE PMTS",
+			b:       "Amazon",
+			similar: true,
+		},
+		{
+			name:    "Punctuation and reference",
+			a:       "Netflix.com",
+			b:       "NETFLIX COM 866-579",
+			similar: true,
+		},
+		{
+			name:    "Common stem",
+			a:       "Groceries",
+			b:       "Grocery store",
+			similar: true,
+		},
+		{
+			name:    "Different words",
+			a:       "Rent",
+			b:       "Salary",
+			similar: false,
+		},
+		{
+			name:    "Same first letter",
+			a:       "Coffee",
+			b:       "Cinema",
+			similar: false,
+		},
+		{
+			name:    "Empty title",
+			a:       "",
+			b:       "Coffee",
+			similar: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			similarity := titleSimilarity(tt.a, tt.b)
+			if (similarity >= DUPLICATE_MIN_SIMILARITY) != tt.similar {
+				t.Errorf("titleSimilarity(%q, %q) = %.2f, want similar %v", tt.a, tt.b, similarity, tt.similar)
+			}
+			if other := titleSimilarity(tt.b, tt.a); other != similarity {
+				t.Errorf("titleSimilarity(%q, %q) = %.2f, but %.2f the other way round", tt.a, tt.b, similarity, other)
+			}
+		})
+	}
+}
+
+func TestMatchDuplicate(t *testing.T) {
+	manual := LineItem{Id: 1, Title: "Groceries", Amount: -4510, Bank: 1, OccurredOn: "2021-03-02"}
+	tests := []struct {
+		name      string
+		other     LineItem
+		duplicate bool
+	}{
+		{
+			name:      "Imported a day later",
+			other:     LineItem{Id: 2, Title: "GROCERIES SMITH", Amount: -4510, Bank: 1, OccurredOn: "2021-03-03", FitId: "77"},
+			duplicate: true,
+		},
+		{
+			name:      "Same day",
+			other:     LineItem{Id: 2, Title: "Groceries", Amount: -4510, Bank: 1, OccurredOn: "2021-03-02"},
+			duplicate: true,
+		},
+		{
+			name:      "Three days",
+			other:     LineItem{Id: 2, Title: "Groceries", Amount: -4510, Bank: 1, OccurredOn: "2021-02-27"},
+			duplicate: true,
+		},
+		{
+			name:      "Four days",
+			other:     LineItem{Id: 2, Title: "Groceries", Amount: -4510, Bank: 1, OccurredOn: "2021-03-06"},
+			duplicate: false,
+		},
+		{
+			name:      "Other bank",
+			other:     LineItem{Id: 2, Title: "Groceries", Amount: -4510, Bank: 2, OccurredOn: "2021-03-02"},
+			duplicate: false,
+		},
+		{
+			name:      "Other amount",
+			other:     LineItem{Id: 2, Title: "Groceries", Amount: -4511, Bank: 1, OccurredOn: "2021-03-02"},
+			duplicate: false,
+		},
+		{
+			name:      "Other title",
+			other:     LineItem{Id: 2, Title: "Pharmacy", Amount: -4510, Bank: 1, OccurredOn: "2021-03-02"},
+			duplicate: false,
+		},
+		{
+			name:      "Transfer",
+			other:     LineItem{Id: 2, Title: "Groceries", Amount: -4510, Bank: 1, OccurredOn: "2021-03-02", Transfer: 5},
+			duplicate: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := matchDuplicate(manual, tt.other); ok != tt.duplicate {
+				t.Errorf("matchDuplicate = %v, want %v", ok, tt.duplicate)
+			}
+		})
+	}
+
+	// Two transactions the bank listed separately are not duplicates
+	a := LineItem{Id: 3, Title: "Coffee", Amount: -350, Bank: 1, OccurredOn: "2021-03-07", FitId: "100"}
+	b := LineItem{Id: 4, Title: "Coffee", Amount: -350, Bank: 1, OccurredOn: "2021-03-07", FitId: "101"}
+	if _, ok := matchDuplicate(a, b); ok {
+		t.Error("line items with different transaction ids matched as duplicates")
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	lineitems := []LineItem{
+		{Id: 1, Title: "Groceries", Amount: -4510, Bank: 1, OccurredOn: "2021-03-02"},
+		{Id: 2, Title: "Rent", Amount: -120000, Bank: 1, OccurredOn: "2021-03-01"},
+		{Id: 3, Title: "Smith Groceries", Amount: -4510, Bank: 1, OccurredOn: "2021-03-04", FitId: "9"},
+		{Id: 4, Title: "RENT MARCH", Amount: -120000, Bank: 1, OccurredOn: "2021-03-01", FitId: "8"},
+		{Id: 5, Title: "Groceries", Amount: -4510, Bank: 1, OccurredOn: "2021-03-20"},
+		{Id: 6, Title: "Coffee", Amount: -350, Bank: 1, OccurredOn: "2021-03-07"},
+		{Id: 7, Title: "Coffee", Amount: -350, Bank: 1, OccurredOn: "2021-03-07"},
+	}
+
+	pairs := findDuplicates(lineitems, map[[2]int]bool{pairKey(7, 6): true})
+	var got [][2]int
+	for _, pair := range pairs {
+		got = append(got, pairKey(pair.First.Id, pair.Second.Id))
+	}
+	want := [][2]int{{2, 4}, {1, 3}}
+	if len(got) != len(want) {
+		t.Fatalf("findDuplicates = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("pair %d = %v, want %v (best match first)", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCheckMergeable(t *testing.T) {
+	tests := []struct {
+		name   string
+		keep   LineItem
+		remove LineItem
+		want   error
+	}{
+		{
+			name:   "Typed in and imported",
+			keep:   LineItem{Id: 1, Amount: -4510, Bank: 1},
+			remove: LineItem{Id: 2, Amount: -4510, Bank: 1, FitId: "9"},
+			want:   nil,
+		},
+		{
+			name:   "Kept line item imported",
+			keep:   LineItem{Id: 1, Amount: -4510, Bank: 1, FitId: "9"},
+			remove: LineItem{Id: 2, Amount: -4510, Bank: 1},
+			want:   nil,
+		},
+		{
+			name:   "Imported from different statements",
+			keep:   LineItem{Id: 1, Amount: -4510, Bank: 1, FitId: "9"},
+			remove: LineItem{Id: 2, Amount: -4510, Bank: 1, FitId: "12"},
+			want:   errFitIdsDiffer,
+		},
+		{
+			name:   "Different banks",
+			keep:   LineItem{Id: 1, Amount: -4510, Bank: 1},
+			remove: LineItem{Id: 2, Amount: -4510, Bank: 2},
+			want:   errNotMergeable,
+		},
+		{
+			name:   "Different amounts",
+			keep:   LineItem{Id: 1, Amount: -4510, Bank: 1},
+			remove: LineItem{Id: 2, Amount: -4500, Bank: 1},
+			want:   errNotMergeable,
+		},
+		{
+			name:   "Part of a transfer",
+			keep:   LineItem{Id: 1, Amount: -4510, Bank: 1},
+			remove: LineItem{Id: 2, Amount: -4510, Bank: 1, Transfer: 3},
+			want:   errNotMergeable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkMergeable(tt.keep, tt.remove); err != tt.want {
+				t.Errorf("checkMergeable error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Envelope periods are calendar months, written YYYY-MM
+const MONTH_LAYOUT = "2006-01"
+
+// Income assigned to a bucket (envelope) for a month.
+// LineItem optionally names the income line item the money comes from.
+// A negative amount moves money out of the envelope again.
+type Allocation struct {
+	Id        int       `json:"id" bson:"id"`
+	Bucket    int       `json:"bucket" bson:"bucket"`
+	Period    string    `json:"period" bson:"period"`
+	Amount    Money     `json:"amount" bson:"amount"`
+	LineItem  int       `json:"lineitem" bson:"lineitem"`
+	Note      string    `json:"note" bson:"note"`
+	Owner     int       `json:"ownerid" bson:"ownerid"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Balance of one bucket in a month: what was carried in from the month before,
+// plus what was allocated, less what was spent.
+type Envelope struct {
+	Bucket    int    `json:"bucket"`
+	Name      string `json:"name"`
+	CarriedIn Money  `json:"carried_in"`
+	Allocated Money  `json:"allocated"`
+	Spent     Money  `json:"spent"`
+	Available Money  `json:"available"`
+}
+
+// Response of /envelopes
+// Income is the income received up to the end of the month, Allocated all income
+// allocated up to and including the month; the difference is still available to assign.
+type EnvelopeSummary struct {
+	Period            string     `json:"period"`
+	Income            Money      `json:"income"`
+	Allocated         Money      `json:"allocated"`
+	AvailableToAssign Money      `json:"available_to_assign"`
+	ClosedAt          *time.Time `json:"closed_at"`
+	Envelopes         []Envelope `json:"envelopes"`
+}
+
+// Request of /envelopes/close
+type EnvelopeClose struct {
+	Period string `json:"period"`
+}
+
+const ALLOCATION_COLUMNS = "id, bucket, to_char(period, 'YYYY-MM'), amount, coalesce(lineitem, 0), note, ownerid, created_at, updated_at"
+
+var ALLOCATION_SORT_FIELDS = map[string]string{
+	"id":         "id",
+	"period":     "period",
+	"amount":     "amount",
+	"created_at": "created_at",
+}
+
+func scanAllocation(row rowScanner) (Allocation, error) {
+	var allocation Allocation
+	err := row.Scan(
+		&allocation.Id,
+		&allocation.Bucket,
+		&allocation.Period,
+		&allocation.Amount,
+		&allocation.LineItem,
+		&allocation.Note,
+		&allocation.Owner,
+		&allocation.CreatedAt,
+		&allocation.UpdatedAt,
+	)
+	return allocation, err
+}
+
+// parseMonth returns the first day of a YYYY-MM month.
+func parseMonth(value string) (time.Time, error) {
+	month, err := time.Parse(MONTH_LAYOUT, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q, expected YYYY-MM", value)
+	}
+	return month, nil
+}
+
+// currentMonth returns the current month in MONTH_LAYOUT.
+func currentMonth() string {
+	return time.Now().Format(MONTH_LAYOUT)
+}
+
+// envelopes works out the balance of every bucket from the amounts carried in, allocated and spent, by bucket id.
+func envelopes(buckets []Bucket, carried map[int]Money, allocated map[int]Money, spent map[int]Money) []Envelope {
+	list := []Envelope{}
+	for _, bucket := range buckets {
+		envelope := Envelope{
+			Bucket:    bucket.Id,
+			Name:      bucket.Name,
+			CarriedIn: carried[bucket.Id],
+			Allocated: allocated[bucket.Id],
+			Spent:     spent[bucket.Id],
+		}
+		envelope.Available = envelope.CarriedIn + envelope.Allocated - envelope.Spent
+		list = append(list, envelope)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Bucket < list[j].Bucket
+	})
+	return list
+}
+
+// sumsByBucket runs a query returning (bucket, amount) rows.
+func sumsByBucket(query string, args ...interface{}) (map[int]Money, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sums := map[int]Money{}
+	for rows.Next() {
+		var bucket int
+		var amount Money
+		if err := rows.Scan(&bucket, &amount); err != nil {
+			return nil, err
+		}
+		sums[bucket] = amount
+	}
+	return sums, rows.Err()
+}
+
+// envelopeSummary computes the envelopes of a month and the income available to assign.
+func envelopeSummary(owner int, month time.Time) (EnvelopeSummary, error) {
+	start := month.Format(DATE_LAYOUT)
+	end := month.AddDate(0, 1, 0).Format(DATE_LAYOUT)
+	summary := EnvelopeSummary{Period: month.Format(MONTH_LAYOUT)}
+
+	rows, err := db.Query("SELECT "+BUCKET_COLUMNS+" FROM public.bucket WHERE ownerid=$1;", owner)
+	if err != nil {
+		return summary, err
+	}
+	var buckets []Bucket
+	for rows.Next() {
+		bucket, err := scanBucket(rows)
+		if err != nil {
+			rows.Close()
+			return summary, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	rows.Close()
+
+	carried, err := sumsByBucket("SELECT bucket, amount FROM public.rollover WHERE ownerid=$1 AND period=$2::date;", owner, start)
+	if err != nil {
+		return summary, err
+	}
+	allocated, err := sumsByBucket("SELECT bucket, sum(amount) FROM public.allocation WHERE ownerid=$1 AND period=$2::date GROUP BY bucket;", owner, start)
+	if err != nil {
+		return summary, err
+	}
+	spent, err := sumsByBucket(
+		`SELECT bucket, -sum(amount) FROM public.lineitem
+		WHERE ownerid=$1 AND coalesce(bucket, 0) <> 0 AND transfer IS NULL AND occurred_on >= $2::date AND occurred_on < $3::date
+		GROUP BY bucket;`,
+		owner, start, end,
+	)
+	if err != nil {
+		return summary, err
+	}
+	summary.Envelopes = envelopes(buckets, carried, allocated, spent)
+
+	// Income is what is not linked to a bucket; income linked to a bucket is a refund of its spending
+	err = db.QueryRow(
+		`SELECT coalesce(sum(amount), 0) FROM public.lineitem
+		WHERE ownerid=$1 AND amount > 0 AND coalesce(bucket, 0) = 0 AND transfer IS NULL AND occurred_on < $2::date;`,
+		owner, end,
+	).Scan(&summary.Income)
+	if err != nil {
+		return summary, err
+	}
+	err = db.QueryRow("SELECT coalesce(sum(amount), 0) FROM public.allocation WHERE ownerid=$1 AND period <= $2::date;", owner, start).Scan(&summary.Allocated)
+	if err != nil {
+		return summary, err
+	}
+	summary.AvailableToAssign = summary.Income - summary.Allocated
+
+	var closedAt time.Time
+	err = db.QueryRow("SELECT closed_at FROM public.envelopeclose WHERE ownerid=$1 AND period=$2::date;", owner, start).Scan(&closedAt)
+	if err == nil {
+		summary.ClosedAt = &closedAt
+	} else if err != sql.ErrNoRows {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// closeMonth records the balance of every envelope as the amount carried into the next month.
+// Closing a month again recomputes its rollovers, e.g. after late line items were added.
+func closeMonth(owner int, month time.Time) (EnvelopeSummary, error) {
+	summary, err := envelopeSummary(owner, month)
+	if err != nil {
+		return summary, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback()
+
+	next := month.AddDate(0, 1, 0).Format(DATE_LAYOUT)
+	if _, err := tx.Exec("DELETE FROM public.rollover WHERE ownerid=$1 AND period=$2::date;", owner, next); err != nil {
+		return summary, err
+	}
+	for _, envelope := range summary.Envelopes {
+		if envelope.Available == 0 {
+			continue
+		}
+		_, err := tx.Exec(
+			"INSERT INTO public.rollover (bucket, period, amount, ownerid) VALUES($1, $2::date, $3, $4);",
+			envelope.Bucket, next, envelope.Available, owner,
+		)
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	var closedAt time.Time
+	err = tx.QueryRow(
+		`INSERT INTO public.envelopeclose (ownerid, period) VALUES($1, $2::date)
+		ON CONFLICT (ownerid, period) DO UPDATE SET closed_at=now() RETURNING closed_at;`,
+		owner, month.Format(DATE_LAYOUT),
+	).Scan(&closedAt)
+	if err != nil {
+		return summary, err
+	}
+	summary.ClosedAt = &closedAt
+
+	return summary, tx.Commit()
+}
+
+// validateAllocation checks an allocation request.
+// The bucket must belong to owner. An allocation from a line item needs an income line item
+// of owner, and all allocations from it together can not exceed its amount.
+func validateAllocation(allocation *Allocation, owner int) error {
+	if _, err := parseMonth(allocation.Period); err != nil {
+		return err
+	}
+	if allocation.Amount == 0 {
+		return errors.New("amount must not be zero")
+	}
+	if !ownsRecord(db, "bucket", allocation.Bucket, owner) {
+		return errors.New("bucket not found")
+	}
+	if allocation.LineItem == 0 {
+		return nil
+	}
+
+	var income, allocated Money
+	err := db.QueryRow(
+		`SELECT l.amount, coalesce((SELECT sum(a.amount) FROM public.allocation a WHERE a.lineitem = l.id AND a.id <> $3), 0)
+		FROM public.lineitem l WHERE l.id=$1 AND l.ownerid=$2 AND l.amount > 0 AND l.transfer IS NULL;`,
+		allocation.LineItem, owner, allocation.Id,
+	).Scan(&income, &allocated)
+	if err == sql.ErrNoRows {
+		return errors.New("income line item not found")
+	}
+	if err != nil {
+		return err
+	}
+	if allocated+allocation.Amount > income {
+		return fmt.Errorf("only %s of the line item is left to allocate", income-allocated)
+	}
+	return nil
+}
+
+func allocationProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "POST":
+		var request Allocation
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Period == "" {
+			request.Period = currentMonth()
+		}
+		request.Id = 0
+		if err := validateAllocation(&request, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		allocation, err := scanAllocation(db.QueryRow(
+			"INSERT INTO public.allocation (bucket, period, amount, lineitem, note, ownerid) VALUES($1, $2::date, $3, $4, $5, $6) RETURNING "+ALLOCATION_COLUMNS+";",
+			request.Bucket,
+			request.Period+"-01",
+			request.Amount,
+			nullInt(request.LineItem),
+			request.Note,
+			owner,
+		))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("New Allocation created.")
+
+		if err := json.NewEncoder(w).Encode(allocation); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	case "GET":
+		options, err := parseListOptions(r.URL.Query(), ALLOCATION_SORT_FIELDS, "period")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var f filter
+		f.add("ownerid=?", owner)
+		if value := r.URL.Query().Get("period"); value != "" {
+			month, err := parseMonth(value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f.add("period=?::date", month.Format(DATE_LAYOUT))
+		}
+		if value := r.URL.Query().Get("bucket"); value != "" {
+			bucket, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid bucket %q", value), http.StatusBadRequest)
+				return
+			}
+			f.add("bucket=?", bucket)
+		}
+
+		rows, total, err := queryPage("allocation", ALLOCATION_COLUMNS, f, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
+
+		var allocations []Allocation
+		for rows.Next() {
+			allocation, err := scanAllocation(rows)
+			checkError(err)
+
+			allocations = append(allocations, allocation)
+		}
+		InfoLogger.Println("Allocations retrieved.")
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if err := json.NewEncoder(w).Encode(allocations); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+func allocationProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var allocation Allocation
+	var err error
+	switch r.Method {
+	case "GET":
+		allocation, err = scanAllocation(db.QueryRow("SELECT "+ALLOCATION_COLUMNS+" FROM public.allocation WHERE id=$1 AND ownerid=$2;", id, owner))
+	case "PUT":
+		var request Allocation
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Id = id
+		if err := validateAllocation(&request, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		allocation, err = scanAllocation(db.QueryRow(
+			"UPDATE public.allocation SET bucket=$1, period=$2::date, amount=$3, lineitem=$4, note=$5 WHERE id=$6 AND ownerid=$7 RETURNING "+ALLOCATION_COLUMNS+";",
+			request.Bucket,
+			request.Period+"-01",
+			request.Amount,
+			nullInt(request.LineItem),
+			request.Note,
+			id,
+			owner,
+		))
+	case "DELETE":
+		allocation, err = scanAllocation(db.QueryRow("DELETE FROM public.allocation WHERE id=$1 AND ownerid=$2 RETURNING "+ALLOCATION_COLUMNS+";", id, owner))
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Allocation Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	InfoLogger.Println("Allocation " + r.Method + " processed.")
+
+	if err := json.NewEncoder(w).Encode(allocation); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Envelopes of a month (?period=YYYY-MM, the current month by default) and the income available to assign
+func envelopeProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "GET":
+		period := r.URL.Query().Get("period")
+		if period == "" {
+			period = currentMonth()
+		}
+		month, err := parseMonth(period)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		summary, err := envelopeSummary(owner, month)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Envelopes retrieved.")
+
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+// Close a month, rolling the balance of every envelope into the next month
+func envelopeCloseProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "POST":
+		var request EnvelopeClose
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		month, err := parseMonth(request.Period)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Period >= currentMonth() {
+			http.Error(w, "Only past months can be closed.", http.StatusBadRequest)
+			return
+		}
+
+		summary, err := closeMonth(owner, month)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Envelope period " + request.Period + " closed.")
+
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
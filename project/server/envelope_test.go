@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMonth(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		valid bool
+	}{
+		{
+			name:  "Month",
+			value: "2021-03",
+			want:  "2021-03-01",
+			valid: true,
+		},
+		{
+			name:  "December",
+			value: "2021-12",
+			want:  "2021-12-01",
+			valid: true,
+		},
+		{
+			name:  "Invalid month",
+			value: "2021-13",
+			want:  "",
+			valid: false,
+		},
+		{
+			name:  "Without leading zero",
+			value: "2021-3",
+			want:  "",
+			valid: false,
+		},
+		{
+			name:  "Date",
+			value: "2021-03-01",
+			want:  "",
+			valid: false,
+		},
+		{
+			name:  "Empty",
+			value: "",
+			want:  "",
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			month, err := parseMonth(tt.value)
+			if (err == nil) != tt.valid {
+				t.Errorf("parseMonth(%q) error = %v, want valid %v", tt.value, err, tt.valid)
+				return
+			}
+			if tt.valid && month.Format(DATE_LAYOUT) != tt.want {
+				t.Errorf("parseMonth(%q) = %s, want %s", tt.value, month.Format(DATE_LAYOUT), tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvelopes(t *testing.T) {
+	buckets := []Bucket{
+		{Id: 3, Name: "Rent"},
+		{Id: 1, Name: "Groceries"},
+		{Id: 2, Name: "Fun"},
+	}
+	carried := map[int]Money{1: 5000, 2: -1500}
+	allocated := map[int]Money{1: 40000, 2: 10000, 3: 120000}
+	spent := map[int]Money{1: 38000, 2: 12000, 3: 120000, 4: 999}
+
+	want := []Envelope{
+		{Bucket: 1, Name: "Groceries", CarriedIn: 5000, Allocated: 40000, Spent: 38000, Available: 7000},
+		{Bucket: 2, Name: "Fun", CarriedIn: -1500, Allocated: 10000, Spent: 12000, Available: -3500},
+		{Bucket: 3, Name: "Rent", CarriedIn: 0, Allocated: 120000, Spent: 120000, Available: 0},
+	}
+
+	got := envelopes(buckets, carried, allocated, spent)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("envelopes() = %+v, want %+v", got, want)
+	}
+
+	if got := envelopes(nil, carried, allocated, spent); got == nil || len(got) != 0 {
+		t.Errorf("envelopes() without buckets = %#v, want an empty list", got)
+	}
+}
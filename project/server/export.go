@@ -0,0 +1,1322 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of /export
+const (
+	EXPORT_JSON   = "json"
+	EXPORT_CSV    = "csv"
+	EXPORT_LEDGER = "ledger"
+)
+
+// Version of the JSON export document, checked when it is imported again
+const EXPORT_VERSION = 6
+
+// Largest JSON export accepted by /import/json
+const MAX_RESTORE_SIZE = 100 << 20
+
+// JSON export of the finances of a user
+// Line items and transfers are limited to the date range, if one was given; everything else is
+// included. Every record keeps its id, so line items refer to their bank, bucket, transfer and
+// reconciliation within the document. A reference to a line item outside the date range is left out.
+// LineItems must stay the last field, writeJSONExport streams them at the end of the document.
+type Export struct {
+	Version          int                `json:"version"`
+	ExportedAt       time.Time          `json:"exported_at"`
+	From             string             `json:"from,omitempty"`
+	To               string             `json:"to,omitempty"`
+	User             UserAccount        `json:"user"`
+	Banks            []BankAccount      `json:"banks"`
+	Buckets          []Bucket           `json:"buckets"`
+	Transfers        []Transfer         `json:"transfers"`
+	Reconciliations  []Reconciliation   `json:"reconciliations"`
+	Allocations      []Allocation       `json:"allocations"`
+	Rollovers        []ExportRollover   `json:"rollovers"`
+	ClosedMonths     []ExportClose      `json:"closed_months"`
+	ImportProfiles   []ImportProfile    `json:"import_profiles"`
+	Dismissals       []ExportDismissal  `json:"dismissals"`
+	Recurring        []Recurring        `json:"recurring"`
+	RecurringSkips   []ExportSkip       `json:"recurring_skips"`
+	RecurringLinks   []ExportOccurrence `json:"recurring_links"`
+	Goals            []Goal             `json:"goals"`
+	Debts            []Debt             `json:"debts"`
+	DebtPayments     []ExportPayment    `json:"debt_payments"`
+	Interest         []ExportInterest   `json:"interest"`
+	InterestPostings []ExportPosting    `json:"interest_postings"`
+	LineItems        []LineItem         `json:"lineitems"`
+}
+
+// Balance an envelope carried into a month (YYYY-MM)
+type ExportRollover struct {
+	Bucket int    `json:"bucket"`
+	Period string `json:"period"`
+	Amount Money  `json:"amount"`
+}
+
+// Month (YYYY-MM) of the envelopes that was closed
+type ExportClose struct {
+	Period   string    `json:"period"`
+	ClosedAt time.Time `json:"closed_at"`
+}
+
+// Pair of line items marked as not duplicates
+type ExportDismissal struct {
+	LineItem  int       `json:"lineitem"`
+	Other     int       `json:"other"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Occurrence of a recurring line item that is not to be created
+type ExportSkip struct {
+	Recurring int    `json:"recurring"`
+	OccursOn  string `json:"occurs_on"`
+}
+
+// Line item created from a recurring line item, for the occurrence on OccursOn
+type ExportOccurrence struct {
+	LineItem  int    `json:"lineitem"`
+	Recurring int    `json:"recurring"`
+	OccursOn  string `json:"occurs_on"`
+}
+
+// Line item that pays a debt
+type ExportPayment struct {
+	LineItem int `json:"lineitem"`
+	Debt     int `json:"debt"`
+}
+
+// Interest tiers of a savings account and the day interest accrues from
+type ExportInterest struct {
+	Bank  int            `json:"bank"`
+	Start string         `json:"start"`
+	Tiers []InterestTier `json:"tiers"`
+}
+
+// Interest posted to a bank for a month (YYYY-MM), so it is not posted again
+type ExportPosting struct {
+	Bank      int       `json:"bank"`
+	Period    string    `json:"period"`
+	Amount    Money     `json:"amount"`
+	LineItem  int       `json:"lineitem"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Number of records created by /import/json
+type RestoreResult struct {
+	Banks           int `json:"banks"`
+	Buckets         int `json:"buckets"`
+	Transfers       int `json:"transfers"`
+	Reconciliations int `json:"reconciliations"`
+	Allocations     int `json:"allocations"`
+	ImportProfiles  int `json:"import_profiles"`
+	Recurring       int `json:"recurring"`
+	Goals           int `json:"goals"`
+	Debts           int `json:"debts"`
+	LineItems       int `json:"lineitems"`
+}
+
+// exportBanks returns all bank accounts of a user, by id.
+func exportBanks(owner int) ([]BankAccount, error) {
+	rows, err := db.Query("SELECT "+BANK_COLUMNS+" FROM public.bankaccount WHERE ownerid=$1 ORDER BY id;", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	banks := []BankAccount{}
+	for rows.Next() {
+		bank, err := scanBankAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		banks = append(banks, bank)
+	}
+	return banks, rows.Err()
+}
+
+// exportBuckets returns all buckets of a user, by id.
+func exportBuckets(owner int) ([]Bucket, error) {
+	rows, err := db.Query("SELECT "+BUCKET_COLUMNS+" FROM public.bucket WHERE ownerid=$1 ORDER BY id;", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []Bucket{}
+	for rows.Next() {
+		bucket, err := scanBucket(rows)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+// exportTransfers returns the transfers of a user in a date range, by date.
+func exportTransfers(owner int, dates DateRange) ([]Transfer, error) {
+	var f filter
+	f.add("ownerid=?", owner)
+	f.add("occurred_on BETWEEN coalesce(?::date, '-infinity') AND coalesce(?::date, 'infinity')", nullDate(dates.From), nullDate(dates.To))
+
+	rows, err := db.Query("SELECT "+TRANSFER_COLUMNS+" FROM public.transfer"+f.where()+" ORDER BY occurred_on, id;", f.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := []Transfer{}
+	for rows.Next() {
+		transfer, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+// exportReconciliations returns all reconciliations of a user, by id.
+func exportReconciliations(owner int) ([]Reconciliation, error) {
+	rows, err := db.Query("SELECT "+RECONCILIATION_COLUMNS+" FROM public.reconciliation WHERE ownerid=$1 ORDER BY id;", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reconciliations := []Reconciliation{}
+	for rows.Next() {
+		reconciliation, err := scanReconciliation(rows)
+		if err != nil {
+			return nil, err
+		}
+		reconciliations = append(reconciliations, reconciliation)
+	}
+	return reconciliations, rows.Err()
+}
+
+// Line items of the owner ($1) in the date range ($2 to $3) of an export, for references to them
+const EXPORTED_LINEITEMS = "SELECT id FROM public.lineitem WHERE ownerid=$1 AND occurred_on BETWEEN coalesce($2::date, '-infinity') AND coalesce($3::date, 'infinity')"
+
+// exportAllocations returns all envelope allocations of a user, by id.
+// The line item an allocation comes from is left out if it is not in the date range.
+func exportAllocations(owner int, dates DateRange) ([]Allocation, error) {
+	rows, err := db.Query(
+		"SELECT id, bucket, to_char(period, 'YYYY-MM'), amount, CASE WHEN lineitem IN ("+EXPORTED_LINEITEMS+") THEN lineitem ELSE 0 END, "+
+			"note, ownerid, created_at, updated_at FROM public.allocation WHERE ownerid=$1 ORDER BY id;",
+		owner, nullDate(dates.From), nullDate(dates.To),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allocations := []Allocation{}
+	for rows.Next() {
+		allocation, err := scanAllocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, allocation)
+	}
+	return allocations, rows.Err()
+}
+
+// exportEnvelopeMonths returns the rollovers and closed months of the envelopes of a user, by month.
+func exportEnvelopeMonths(owner int) ([]ExportRollover, []ExportClose, error) {
+	rows, err := db.Query("SELECT bucket, to_char(period, 'YYYY-MM'), amount FROM public.rollover WHERE ownerid=$1 ORDER BY period, bucket;", owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	rollovers := []ExportRollover{}
+	for rows.Next() {
+		var rollover ExportRollover
+		if err := rows.Scan(&rollover.Bucket, &rollover.Period, &rollover.Amount); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		rollovers = append(rollovers, rollover)
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT to_char(period, 'YYYY-MM'), closed_at FROM public.envelopeclose WHERE ownerid=$1 ORDER BY period;", owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	closed := []ExportClose{}
+	for rows.Next() {
+		var month ExportClose
+		if err := rows.Scan(&month.Period, &month.ClosedAt); err != nil {
+			return nil, nil, err
+		}
+		closed = append(closed, month)
+	}
+	return rollovers, closed, rows.Err()
+}
+
+// exportImportProfiles returns all import profiles of a user, by id.
+func exportImportProfiles(owner int) ([]ImportProfile, error) {
+	rows, err := db.Query("SELECT "+IMPORT_PROFILE_COLUMNS+" FROM public.importprofile WHERE ownerid=$1 ORDER BY id;", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []ImportProfile{}
+	for rows.Next() {
+		profile, err := scanImportProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, rows.Err()
+}
+
+// exportDismissals returns the pairs of line items of a user marked as not duplicates, both in the date range.
+func exportDismissals(owner int, dates DateRange) ([]ExportDismissal, error) {
+	rows, err := db.Query(
+		"SELECT lineitem, other, created_at FROM public.duplicatedismissal WHERE ownerid=$1 AND lineitem IN ("+EXPORTED_LINEITEMS+
+			") AND other IN ("+EXPORTED_LINEITEMS+") ORDER BY lineitem, other;",
+		owner, nullDate(dates.From), nullDate(dates.To),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dismissals := []ExportDismissal{}
+	for rows.Next() {
+		var dismissal ExportDismissal
+		if err := rows.Scan(&dismissal.LineItem, &dismissal.Other, &dismissal.CreatedAt); err != nil {
+			return nil, err
+		}
+		dismissals = append(dismissals, dismissal)
+	}
+	return dismissals, rows.Err()
+}
+
+// exportRecurring returns all recurring line items of a user by id, with their skipped occurrences
+// and the line items in the date range created from them.
+func exportRecurring(owner int, dates DateRange) ([]Recurring, []ExportSkip, []ExportOccurrence, error) {
+	rows, err := db.Query("SELECT "+RECURRING_COLUMNS+" FROM public.recurring WHERE ownerid=$1 ORDER BY id;", owner)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	recurring := []Recurring{}
+	for rows.Next() {
+		template, err := scanRecurring(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, nil, err
+		}
+		recurring = append(recurring, template)
+	}
+	rows.Close()
+
+	rows, err = db.Query(
+		`SELECT s.recurring, to_char(s.occurs_on, 'YYYY-MM-DD') FROM public.recurringskip s
+		JOIN public.recurring r ON r.id = s.recurring WHERE r.ownerid=$1 ORDER BY s.recurring, s.occurs_on;`,
+		owner,
+	)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	skips := []ExportSkip{}
+	for rows.Next() {
+		var skip ExportSkip
+		if err := rows.Scan(&skip.Recurring, &skip.OccursOn); err != nil {
+			rows.Close()
+			return nil, nil, nil, err
+		}
+		skips = append(skips, skip)
+	}
+	rows.Close()
+
+	rows, err = db.Query(
+		"SELECT id, recurring, to_char(recurring_on, 'YYYY-MM-DD') FROM public.lineitem WHERE recurring IS NOT NULL AND recurring_on IS NOT NULL AND id IN ("+
+			EXPORTED_LINEITEMS+") ORDER BY id;",
+		owner, nullDate(dates.From), nullDate(dates.To),
+	)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	links := []ExportOccurrence{}
+	for rows.Next() {
+		var link ExportOccurrence
+		if err := rows.Scan(&link.LineItem, &link.Recurring, &link.OccursOn); err != nil {
+			return nil, nil, nil, err
+		}
+		links = append(links, link)
+	}
+	return recurring, skips, links, rows.Err()
+}
+
+// exportGoals returns all savings goals of a user, by id.
+func exportGoals(owner int) ([]Goal, error) {
+	rows, err := db.Query("SELECT "+GOAL_COLUMNS+" FROM public.goal WHERE ownerid=$1 ORDER BY id;", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []Goal{}
+	for rows.Next() {
+		goal, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+	return goals, rows.Err()
+}
+
+// exportDebts returns all debts of a user by id, with the line items in the date range that pay them.
+func exportDebts(owner int, dates DateRange) ([]Debt, []ExportPayment, error) {
+	rows, err := db.Query("SELECT "+DEBT_COLUMNS+" FROM public.debt WHERE ownerid=$1 ORDER BY id;", owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	debts := []Debt{}
+	for rows.Next() {
+		debt, err := scanDebt(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		debts = append(debts, debt)
+	}
+	rows.Close()
+
+	rows, err = db.Query(
+		"SELECT id, debt FROM public.lineitem WHERE debt IS NOT NULL AND id IN ("+EXPORTED_LINEITEMS+") ORDER BY id;",
+		owner, nullDate(dates.From), nullDate(dates.To),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	payments := []ExportPayment{}
+	for rows.Next() {
+		var payment ExportPayment
+		if err := rows.Scan(&payment.LineItem, &payment.Debt); err != nil {
+			return nil, nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return debts, payments, rows.Err()
+}
+
+// exportInterest returns the interest tiers of the savings accounts of a user and all interest posted to them, by bank.
+// The line item of a posting is left out if it is not in the date range.
+func exportInterest(owner int, dates DateRange) ([]ExportInterest, []ExportPosting, error) {
+	rows, err := db.Query(
+		"SELECT id, to_char(interest_start, 'YYYY-MM-DD') FROM public.bankaccount WHERE ownerid=$1 AND interest_start IS NOT NULL ORDER BY id;",
+		owner,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	interest := []ExportInterest{}
+	for rows.Next() {
+		var account ExportInterest
+		if err := rows.Scan(&account.Bank, &account.Start); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		interest = append(interest, account)
+	}
+	rows.Close()
+	for i := range interest {
+		if interest[i].Tiers, err = readTiers(db, interest[i].Bank); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	rows, err = db.Query(
+		`SELECT p.bank, to_char(p.period, 'YYYY-MM'), p.amount, CASE WHEN p.lineitem IN (`+EXPORTED_LINEITEMS+`) THEN p.lineitem ELSE 0 END, p.created_at
+		FROM public.interestposting p JOIN public.bankaccount b ON b.id = p.bank WHERE b.ownerid=$1 ORDER BY p.bank, p.period;`,
+		owner, nullDate(dates.From), nullDate(dates.To),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	postings := []ExportPosting{}
+	for rows.Next() {
+		var posting ExportPosting
+		if err := rows.Scan(&posting.Bank, &posting.Period, &posting.Amount, &posting.LineItem, &posting.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		postings = append(postings, posting)
+	}
+	return interest, postings, rows.Err()
+}
+
+// exportLineItems selects the line items of a user in a date range, by date. The caller must close the rows.
+// Line items are read one at a time while the export is written, so they are never all held in memory.
+func exportLineItems(owner int, dates DateRange) (*sql.Rows, error) {
+	var f filter
+	f.add("ownerid=?", owner)
+	f.add("occurred_on BETWEEN coalesce(?::date, '-infinity') AND coalesce(?::date, 'infinity')", nullDate(dates.From), nullDate(dates.To))
+	return db.Query("SELECT "+LINEITEM_COLUMNS+" FROM public.lineitem"+f.where()+" ORDER BY occurred_on, id;", f.args...)
+}
+
+// writeJSONExport streams the JSON export document.
+func writeJSONExport(w io.Writer, owner int, dates DateRange) error {
+	var header Export
+	var err error
+	header.Version = EXPORT_VERSION
+	header.ExportedAt = time.Now().UTC()
+	header.From, header.To = dates.From, dates.To
+	if header.User, err = scanUser(db.QueryRow("SELECT "+USER_COLUMNS+" FROM public.useraccount WHERE id=$1;", owner)); err != nil {
+		return err
+	}
+	if header.Banks, err = exportBanks(owner); err != nil {
+		return err
+	}
+	if header.Buckets, err = exportBuckets(owner); err != nil {
+		return err
+	}
+	if header.Transfers, err = exportTransfers(owner, dates); err != nil {
+		return err
+	}
+	if header.Reconciliations, err = exportReconciliations(owner); err != nil {
+		return err
+	}
+	if header.Allocations, err = exportAllocations(owner, dates); err != nil {
+		return err
+	}
+	if header.Rollovers, header.ClosedMonths, err = exportEnvelopeMonths(owner); err != nil {
+		return err
+	}
+	if header.ImportProfiles, err = exportImportProfiles(owner); err != nil {
+		return err
+	}
+	if header.Dismissals, err = exportDismissals(owner, dates); err != nil {
+		return err
+	}
+	if header.Recurring, header.RecurringSkips, header.RecurringLinks, err = exportRecurring(owner, dates); err != nil {
+		return err
+	}
+	if header.Goals, err = exportGoals(owner); err != nil {
+		return err
+	}
+	if header.Debts, header.DebtPayments, err = exportDebts(owner, dates); err != nil {
+		return err
+	}
+	if header.Interest, header.InterestPostings, err = exportInterest(owner, dates); err != nil {
+		return err
+	}
+
+	// Everything but the line items is encoded at once; the document is closed after streaming them
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimSuffix(string(encoded), `,"lineitems":null}`)
+	if _, err := io.WriteString(w, prefix+`,"lineitems":[`); err != nil {
+		return err
+	}
+
+	rows, err := exportLineItems(owner, dates)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for n := 0; rows.Next(); n++ {
+		lineitem, err := scanLineItem(rows)
+		if err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(lineitem)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			io.WriteString(w, ",")
+		}
+		if _, err := w.Write(encoded); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// writeCSVExport streams one table as CSV: lineitems (with the names of their bank and bucket), banks or buckets.
+func writeCSVExport(w io.Writer, owner int, dates DateRange, table string) error {
+	writer := csv.NewWriter(w)
+	banks, err := exportBanks(owner)
+	if err != nil {
+		return err
+	}
+	buckets, err := exportBuckets(owner)
+	if err != nil {
+		return err
+	}
+
+	switch table {
+	case "banks":
+		writer.Write([]string{"id", "name", "currency", "account_type", "opening_balance", "opening_date", "balance", "created_at"})
+		for _, bank := range banks {
+			writer.Write([]string{
+				strconv.Itoa(bank.Id),
+				bank.Name,
+				bank.Currency,
+				bank.AccountType,
+				bank.OpeningBalance.String(),
+				bank.OpeningDate,
+				bank.Balance.String(),
+				bank.CreatedAt.Format(time.RFC3339),
+			})
+		}
+	case "buckets":
+		writer.Write([]string{"id", "name", "budget", "budget_period", "budget_start", "budget_days", "created_at"})
+		for _, bucket := range buckets {
+			budget := []string{"", "", "", ""}
+			if bucket.Budget != nil {
+				budget = []string{bucket.Budget.Amount.String(), bucket.Budget.Period, bucket.Budget.Start, strconv.Itoa(bucket.Budget.Days)}
+			}
+			writer.Write(append(append([]string{strconv.Itoa(bucket.Id), bucket.Name}, budget...), bucket.CreatedAt.Format(time.RFC3339)))
+		}
+	default:
+		bankById := map[int]BankAccount{}
+		for _, bank := range banks {
+			bankById[bank.Id] = bank
+		}
+		bucketNames := map[int]string{}
+		for _, bucket := range buckets {
+			bucketNames[bucket.Id] = bucket.Name
+		}
+
+		rows, err := exportLineItems(owner, dates)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		writer.Write([]string{"id", "occurred_on", "title", "description", "amount", "currency", "bank_id", "bank", "bucket_id", "bucket", "transfer", "fitid"})
+		for rows.Next() {
+			lineitem, err := scanLineItem(rows)
+			if err != nil {
+				return err
+			}
+			currency := DEFAULT_CURRENCY
+			if bank, ok := bankById[lineitem.Bank]; ok {
+				currency = bank.Currency
+			}
+			writer.Write([]string{
+				strconv.Itoa(lineitem.Id),
+				lineitem.OccurredOn,
+				lineitem.Title,
+				lineitem.Description,
+				lineitem.Amount.String(),
+				currency,
+				optionalId(lineitem.Bank),
+				bankById[lineitem.Bank].Name,
+				optionalId(lineitem.Bucket),
+				bucketNames[lineitem.Bucket],
+				optionalId(lineitem.Transfer),
+				lineitem.FitId,
+			})
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// optionalId formats a reference, empty for 0.
+func optionalId(id int) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(id)
+}
+
+// ledgerName turns a bank or bucket name into a part of a ledger account name.
+// Colons separate account levels and two spaces end the account name, so neither is kept.
+func ledgerName(name string) string {
+	name = strings.Join(strings.Fields(strings.ReplaceAll(name, ":", "-")), " ")
+	if name == "" {
+		return "Unnamed"
+	}
+	return name
+}
+
+// Names of the accounts of a ledger export, with the currency of each bank account
+type ledgerAccounts struct {
+	banks     map[int]BankAccount
+	buckets   map[int]Bucket
+	transfers map[int]Transfer
+}
+
+func (accounts ledgerAccounts) bank(id int) (string, string) {
+	bank, ok := accounts.banks[id]
+	if !ok {
+		return "Assets:Cash", DEFAULT_CURRENCY
+	}
+	return "Assets:Banks:" + ledgerName(bank.Name), bank.Currency
+}
+
+// ledgerEntry formats a line item as a ledger/hledger journal transaction, with both postings written out.
+// Expenses are posted to Expenses:<bucket>, income to Income:<bucket>, Unassigned without a bucket.
+// Cleared and reconciled line items are marked cleared (*).
+// A transfer is written once, for its debit line item; false is returned for its credit line item.
+func (accounts ledgerAccounts) ledgerEntry(lineitem LineItem) (string, bool) {
+	var entry strings.Builder
+	asset, currency := accounts.bank(lineitem.Bank)
+
+	payee := strings.Join(strings.Fields(lineitem.Title), " ")
+	mark := ""
+	if lineitem.Status == STATUS_CLEARED || lineitem.Status == STATUS_RECONCILED {
+		mark = "* "
+	}
+	fmt.Fprintf(&entry, "%s %s%s  ; id:%d\n", lineitem.OccurredOn, mark, payee, lineitem.Id)
+	if description := strings.Join(strings.Fields(lineitem.Description), " "); description != "" {
+		fmt.Fprintf(&entry, "    ; %s\n", description)
+	}
+
+	var counter string
+	if lineitem.Transfer != 0 {
+		transfer, ok := accounts.transfers[lineitem.Transfer]
+		if lineitem.Amount > 0 && ok {
+			return "", false
+		}
+		counter, _ = accounts.bank(transfer.ToBank)
+		if !ok {
+			counter = "Assets:Transfers"
+		}
+	} else {
+		bucket := "Unassigned"
+		if b, ok := accounts.buckets[lineitem.Bucket]; ok {
+			bucket = ledgerName(b.Name)
+		}
+		if lineitem.Amount < 0 {
+			counter = "Expenses:" + bucket
+		} else {
+			counter = "Income:" + bucket
+		}
+	}
+
+	fmt.Fprintf(&entry, "    %s  %s %s\n", counter, (-lineitem.Amount).String(), currency)
+	fmt.Fprintf(&entry, "    %s  %s %s\n\n", asset, lineitem.Amount.String(), currency)
+	return entry.String(), true
+}
+
+// writeLedgerExport streams the line items as a ledger/hledger journal.
+func writeLedgerExport(w io.Writer, owner int, dates DateRange) error {
+	accounts := ledgerAccounts{banks: map[int]BankAccount{}, buckets: map[int]Bucket{}, transfers: map[int]Transfer{}}
+	banks, err := exportBanks(owner)
+	if err != nil {
+		return err
+	}
+	for _, bank := range banks {
+		accounts.banks[bank.Id] = bank
+	}
+	buckets, err := exportBuckets(owner)
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		accounts.buckets[bucket.Id] = bucket
+	}
+	transfers, err := exportTransfers(owner, dates)
+	if err != nil {
+		return err
+	}
+	for _, transfer := range transfers {
+		accounts.transfers[transfer.Id] = transfer
+	}
+
+	fmt.Fprintf(w, "; Exported on %s\n\n", today())
+	rows, err := exportLineItems(owner, dates)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		lineitem, err := scanLineItem(rows)
+		if err != nil {
+			return err
+		}
+		if entry, ok := accounts.ledgerEntry(lineitem); ok {
+			if _, err := io.WriteString(w, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// Export the finances of the user (?format=json, csv or ledger, and optionally from/to dates)
+// CSV exports one table, chosen with ?table=lineitems (default), banks or buckets.
+// The export is streamed: an error after the first bytes can only be logged.
+func exportProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	query := r.URL.Query()
+	dates, err := parseDateRange(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = EXPORT_JSON
+	}
+	table := query.Get("table")
+	var contentType, extension string
+	switch format {
+	case EXPORT_JSON:
+		contentType, extension = "application/json", "json"
+	case EXPORT_CSV:
+		contentType, extension = "text/csv; charset=utf-8", "csv"
+		switch table {
+		case "", "lineitems", "banks", "buckets":
+		default:
+			http.Error(w, fmt.Sprintf("invalid table %q, expected lineitems, banks or buckets", table), http.StatusBadRequest)
+			return
+		}
+	case EXPORT_LEDGER:
+		contentType, extension = "text/plain; charset=utf-8", "journal"
+	default:
+		http.Error(w, fmt.Sprintf("invalid format %q, expected json, csv or ledger", format), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"monefy-%s.%s\"", today(), extension))
+
+	switch format {
+	case EXPORT_JSON:
+		err = writeJSONExport(w, owner, dates)
+	case EXPORT_CSV:
+		err = writeCSVExport(w, owner, dates, table)
+	case EXPORT_LEDGER:
+		err = writeLedgerExport(w, owner, dates)
+	}
+	if err != nil {
+		ErrorLogger.Println("Internal Error Occured. Export incomplete. " + err.Error())
+		return
+	}
+	InfoLogger.Println("Finances exported as " + format + ".")
+}
+
+// checkExport validates a JSON export before it is imported.
+// Every reference must point to a record of the document.
+func checkExport(export *Export) error {
+	// Older documents just lack the records added since
+	if export.Version < 1 || export.Version > EXPORT_VERSION {
+		return fmt.Errorf("unsupported export version %d, expected 1 to %d", export.Version, EXPORT_VERSION)
+	}
+
+	banks := map[int]bool{0: true}
+	for i := range export.Banks {
+		currency, err := normalizeCurrency(export.Banks[i].Currency)
+		if err != nil {
+			return err
+		}
+		export.Banks[i].Currency = currency
+		if export.Banks[i].AccountType, err = checkAccountType(export.Banks[i].AccountType); err != nil {
+			return fmt.Errorf("bank %d: %w", export.Banks[i].Id, err)
+		}
+		if export.Banks[i].OpeningDate != "" {
+			if _, err := parseDate(export.Banks[i].OpeningDate); err != nil {
+				return fmt.Errorf("bank %d: %w", export.Banks[i].Id, err)
+			}
+		}
+		banks[export.Banks[i].Id] = true
+	}
+	buckets := map[int]bool{0: true}
+	for _, bucket := range export.Buckets {
+		if bucket.Budget != nil {
+			if err := checkBudget(bucket.Budget); err != nil {
+				return fmt.Errorf("bucket %d: %w", bucket.Id, err)
+			}
+		}
+		buckets[bucket.Id] = true
+	}
+	transfers := map[int]bool{0: true}
+	for _, transfer := range export.Transfers {
+		if !banks[transfer.FromBank] || !banks[transfer.ToBank] || transfer.FromBank == 0 || transfer.ToBank == 0 {
+			return fmt.Errorf("transfer %d refers to a bank that is not in the export", transfer.Id)
+		}
+		if _, err := parseDate(transfer.OccurredOn); err != nil {
+			return fmt.Errorf("transfer %d: %w", transfer.Id, err)
+		}
+		transfers[transfer.Id] = true
+	}
+	reconciliations := map[int]bool{0: true}
+	open := map[int]bool{}
+	for _, reconciliation := range export.Reconciliations {
+		if !banks[reconciliation.Bank] || reconciliation.Bank == 0 {
+			return fmt.Errorf("reconciliation %d refers to a bank that is not in the export", reconciliation.Id)
+		}
+		if _, err := parseDate(reconciliation.StatementDate); err != nil {
+			return fmt.Errorf("reconciliation %d: %w", reconciliation.Id, err)
+		}
+		switch reconciliation.Status {
+		case RECONCILIATION_OPEN:
+			if open[reconciliation.Bank] {
+				return fmt.Errorf("reconciliation %d: bank %d has more than one open reconciliation", reconciliation.Id, reconciliation.Bank)
+			}
+			open[reconciliation.Bank] = true
+		case RECONCILIATION_FINISHED:
+		default:
+			return fmt.Errorf("reconciliation %d: invalid status %q", reconciliation.Id, reconciliation.Status)
+		}
+		reconciliations[reconciliation.Id] = true
+	}
+	lineitems := map[int]bool{0: true}
+	for _, lineitem := range export.LineItems {
+		if !banks[lineitem.Bank] || !buckets[lineitem.Bucket] || !transfers[lineitem.Transfer] || !reconciliations[lineitem.Reconciliation] {
+			return fmt.Errorf("line item %d refers to a bank, bucket, transfer or reconciliation that is not in the export", lineitem.Id)
+		}
+		if _, err := parseDate(lineitem.OccurredOn); err != nil {
+			return fmt.Errorf("line item %d: %w", lineitem.Id, err)
+		}
+		lineitems[lineitem.Id] = true
+	}
+
+	for _, allocation := range export.Allocations {
+		if !buckets[allocation.Bucket] || allocation.Bucket == 0 || !lineitems[allocation.LineItem] {
+			return fmt.Errorf("allocation %d refers to a bucket or line item that is not in the export", allocation.Id)
+		}
+		if _, err := parseMonth(allocation.Period); err != nil {
+			return fmt.Errorf("allocation %d: %w", allocation.Id, err)
+		}
+	}
+	for _, rollover := range export.Rollovers {
+		if !buckets[rollover.Bucket] || rollover.Bucket == 0 {
+			return fmt.Errorf("rollover of %s refers to a bucket that is not in the export", rollover.Period)
+		}
+		if _, err := parseMonth(rollover.Period); err != nil {
+			return fmt.Errorf("rollover of bucket %d: %w", rollover.Bucket, err)
+		}
+	}
+	for _, month := range export.ClosedMonths {
+		if _, err := parseMonth(month.Period); err != nil {
+			return fmt.Errorf("closed month: %w", err)
+		}
+	}
+	for i := range export.ImportProfiles {
+		profile := &export.ImportProfiles[i]
+		if !banks[profile.Bank] {
+			return fmt.Errorf("import profile %d refers to a bank that is not in the export", profile.Id)
+		}
+		if err := checkImportProfile(profile); err != nil {
+			return fmt.Errorf("import profile %d: %w", profile.Id, err)
+		}
+	}
+	for _, dismissal := range export.Dismissals {
+		if !lineitems[dismissal.LineItem] || !lineitems[dismissal.Other] || dismissal.LineItem == 0 || dismissal.Other == 0 || dismissal.LineItem == dismissal.Other {
+			return fmt.Errorf("dismissal of %d and %d refers to a line item that is not in the export", dismissal.LineItem, dismissal.Other)
+		}
+	}
+
+	recurring := map[int]bool{}
+	for i := range export.Recurring {
+		template := &export.Recurring[i]
+		if !banks[template.Bank] || !buckets[template.Bucket] {
+			return fmt.Errorf("recurring line item %d refers to a bank or bucket that is not in the export", template.Id)
+		}
+		if err := checkRecurring(template); err != nil {
+			return fmt.Errorf("recurring line item %d: %w", template.Id, err)
+		}
+		if template.NextDate != "" {
+			if _, err := parseDate(template.NextDate); err != nil {
+				return fmt.Errorf("recurring line item %d: %w", template.Id, err)
+			}
+		}
+		recurring[template.Id] = true
+	}
+	for _, skip := range export.RecurringSkips {
+		if !recurring[skip.Recurring] {
+			return fmt.Errorf("skipped occurrence on %s refers to a recurring line item that is not in the export", skip.OccursOn)
+		}
+		if _, err := parseDate(skip.OccursOn); err != nil {
+			return fmt.Errorf("skipped occurrence of %d: %w", skip.Recurring, err)
+		}
+	}
+	occurrences := map[ExportSkip]bool{}
+	for _, link := range export.RecurringLinks {
+		if !recurring[link.Recurring] || !lineitems[link.LineItem] || link.LineItem == 0 {
+			return fmt.Errorf("occurrence on %s refers to a recurring line item or line item that is not in the export", link.OccursOn)
+		}
+		if _, err := parseDate(link.OccursOn); err != nil {
+			return fmt.Errorf("occurrence of %d: %w", link.Recurring, err)
+		}
+		occurrence := ExportSkip{Recurring: link.Recurring, OccursOn: link.OccursOn}
+		if occurrences[occurrence] {
+			return fmt.Errorf("recurring line item %d has more than one line item on %s", link.Recurring, link.OccursOn)
+		}
+		occurrences[occurrence] = true
+	}
+
+	for i := range export.Goals {
+		goal := &export.Goals[i]
+		if !banks[goal.Bank] || !buckets[goal.Bucket] {
+			return fmt.Errorf("goal %d refers to a bank or bucket that is not in the export", goal.Id)
+		}
+		if err := checkGoal(goal); err != nil {
+			return fmt.Errorf("goal %d: %w", goal.Id, err)
+		}
+	}
+
+	debts := map[int]bool{}
+	for _, debt := range export.Debts {
+		if !banks[debt.Bank] || !buckets[debt.Bucket] {
+			return fmt.Errorf("debt %d refers to a bank or bucket that is not in the export", debt.Id)
+		}
+		if err := checkDebt(debt); err != nil {
+			return fmt.Errorf("debt %d: %w", debt.Id, err)
+		}
+		debts[debt.Id] = true
+	}
+	paid := map[int]bool{}
+	for _, payment := range export.DebtPayments {
+		if !debts[payment.Debt] || !lineitems[payment.LineItem] || payment.LineItem == 0 {
+			return fmt.Errorf("payment of debt %d refers to a debt or line item that is not in the export", payment.Debt)
+		}
+		if paid[payment.LineItem] {
+			return fmt.Errorf("line item %d pays more than one debt", payment.LineItem)
+		}
+		paid[payment.LineItem] = true
+	}
+
+	interest := map[int]bool{}
+	for _, account := range export.Interest {
+		if !banks[account.Bank] || account.Bank == 0 || interest[account.Bank] {
+			return fmt.Errorf("interest of bank %d refers to a bank that is not in the export, or more than once", account.Bank)
+		}
+		if _, err := parseDate(account.Start); err != nil {
+			return fmt.Errorf("interest of bank %d: %w", account.Bank, err)
+		}
+		if err := checkTiers(account.Tiers); err != nil {
+			return fmt.Errorf("interest of bank %d: %w", account.Bank, err)
+		}
+		interest[account.Bank] = true
+	}
+	for _, posting := range export.InterestPostings {
+		if !banks[posting.Bank] || posting.Bank == 0 || !lineitems[posting.LineItem] {
+			return fmt.Errorf("interest posting of %s refers to a bank or line item that is not in the export", posting.Period)
+		}
+		if _, err := parseMonth(posting.Period); err != nil {
+			return fmt.Errorf("interest posting of bank %d: %w", posting.Bank, err)
+		}
+	}
+	return nil
+}
+
+// createdAt returns the timestamp of an exported record, now if it has none.
+func createdAt(t time.Time) interface{} {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+// restoreExport creates the records of a JSON export for owner, in one transaction.
+// The records get new ids; their references are mapped to them.
+func restoreExport(export Export, owner int) (RestoreResult, error) {
+	var result RestoreResult
+	tx, err := db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	banks := map[int]int{}
+	for _, bank := range export.Banks {
+		var id int
+		err := tx.QueryRow(
+			"INSERT INTO public.bankaccount (\"name\", ownerid, currency, account_type, opening_balance, opening_date, created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;",
+			bank.Name, owner, bank.Currency, bank.AccountType, bank.OpeningBalance, nullDate(bank.OpeningDate), createdAt(bank.CreatedAt), createdAt(bank.UpdatedAt),
+		).Scan(&id)
+		if err != nil {
+			return result, err
+		}
+		banks[bank.Id] = id
+	}
+
+	buckets := map[int]int{}
+	for _, bucket := range export.Buckets {
+		var id int
+		err := tx.QueryRow(
+			"INSERT INTO public.bucket (\"name\", ownerid, budget, budget_period, budget_start, budget_days, created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;",
+			append(append([]interface{}{bucket.Name, owner}, budgetColumns(bucket.Budget)...), createdAt(bucket.CreatedAt), createdAt(bucket.UpdatedAt))...,
+		).Scan(&id)
+		if err != nil {
+			return result, err
+		}
+		buckets[bucket.Id] = id
+	}
+
+	transfers := map[int]int{}
+	for _, transfer := range export.Transfers {
+		var id int
+		err := tx.QueryRow(
+			`INSERT INTO public.transfer (title, description, amount, from_bank, to_bank, occurred_on, ownerid, created_at, updated_at)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;`,
+			transfer.Title, transfer.Description, transfer.Amount, banks[transfer.FromBank], banks[transfer.ToBank], transfer.OccurredOn, owner,
+			createdAt(transfer.CreatedAt), createdAt(transfer.UpdatedAt),
+		).Scan(&id)
+		if err != nil {
+			return result, err
+		}
+		transfers[transfer.Id] = id
+	}
+
+	reconciliations := map[int]int{}
+	for _, reconciliation := range export.Reconciliations {
+		var id int
+		err := tx.QueryRow(
+			`INSERT INTO public.reconciliation (bank, statement_date, ending_balance, status, finished_at, ownerid, created_at, updated_at)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;`,
+			banks[reconciliation.Bank], reconciliation.StatementDate, reconciliation.EndingBalance, reconciliation.Status, reconciliation.FinishedAt, owner,
+			createdAt(reconciliation.CreatedAt), createdAt(reconciliation.UpdatedAt),
+		).Scan(&id)
+		if err != nil {
+			return result, err
+		}
+		reconciliations[reconciliation.Id] = id
+	}
+
+	lineitems := map[int]int{}
+	for _, lineitem := range export.LineItems {
+		var id int
+		err := tx.QueryRow(
+			`INSERT INTO public.lineitem (title, description, amount, bucket, bank, ownerid, occurred_on, transfer, fitid, cleared, reconciliation, created_at, updated_at)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id;`,
+			lineitem.Title, lineitem.Description, lineitem.Amount, buckets[lineitem.Bucket], banks[lineitem.Bank], owner, lineitem.OccurredOn,
+			nullInt(transfers[lineitem.Transfer]), nullString(lineitem.FitId), lineitem.Status == STATUS_CLEARED || lineitem.Status == STATUS_RECONCILED,
+			nullInt(reconciliations[lineitem.Reconciliation]), createdAt(lineitem.CreatedAt), createdAt(lineitem.UpdatedAt),
+		).Scan(&id)
+		if err != nil {
+			return result, err
+		}
+		lineitems[lineitem.Id] = id
+	}
+
+	for _, allocation := range export.Allocations {
+		_, err := tx.Exec(
+			`INSERT INTO public.allocation (bucket, period, amount, lineitem, note, ownerid, created_at, updated_at)
+			VALUES($1, $2::date, $3, $4, $5, $6, $7, $8);`,
+			buckets[allocation.Bucket], allocation.Period+"-01", allocation.Amount, nullInt(lineitems[allocation.LineItem]), allocation.Note, owner,
+			createdAt(allocation.CreatedAt), createdAt(allocation.UpdatedAt),
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+	for _, rollover := range export.Rollovers {
+		_, err := tx.Exec(
+			"INSERT INTO public.rollover (bucket, period, amount, ownerid) VALUES($1, $2::date, $3, $4) ON CONFLICT (bucket, period) DO NOTHING;",
+			buckets[rollover.Bucket], rollover.Period+"-01", rollover.Amount, owner,
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+	for _, month := range export.ClosedMonths {
+		_, err := tx.Exec(
+			"INSERT INTO public.envelopeclose (ownerid, period, closed_at) VALUES($1, $2::date, $3) ON CONFLICT (ownerid, period) DO NOTHING;",
+			owner, month.Period+"-01", createdAt(month.ClosedAt),
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for _, profile := range export.ImportProfiles {
+		_, err := tx.Exec(
+			`INSERT INTO public.importprofile ("name", bank, delimiter, has_header, date_column, description_column, amount_column, debit_column, credit_column,
+			sign, date_format, decimal_separator, ownerid, created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15);`,
+			profile.Name, banks[profile.Bank], profile.Delimiter, profile.HasHeader, profile.DateColumn, profile.DescriptionColumn, profile.AmountColumn,
+			profile.DebitColumn, profile.CreditColumn, profile.Sign, profile.DateFormat, profile.DecimalSeparator, owner,
+			createdAt(profile.CreatedAt), createdAt(profile.UpdatedAt),
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for _, dismissal := range export.Dismissals {
+		key := pairKey(lineitems[dismissal.LineItem], lineitems[dismissal.Other])
+		_, err := tx.Exec(
+			"INSERT INTO public.duplicatedismissal (lineitem, other, ownerid, created_at) VALUES($1, $2, $3, $4) ON CONFLICT DO NOTHING;",
+			key[0], key[1], owner, createdAt(dismissal.CreatedAt),
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	recurring := map[int]int{}
+	for _, template := range export.Recurring {
+		var id int
+		err := tx.QueryRow(
+			`INSERT INTO public.recurring (title, description, amount, bucket, bank, frequency, repeat_interval, day_of_month, start_date, end_date, next_date, ownerid,
+			created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9::date, $10::date, $11::date, $12, $13, $14) RETURNING id;`,
+			template.Title, template.Description, template.Amount, nullInt(buckets[template.Bucket]), nullInt(banks[template.Bank]), template.Frequency,
+			template.Interval, nullInt(template.DayOfMonth), template.Start, nullDate(template.End), nullDate(template.NextDate), owner,
+			createdAt(template.CreatedAt), createdAt(template.UpdatedAt),
+		).Scan(&id)
+		if err != nil {
+			return result, err
+		}
+		recurring[template.Id] = id
+	}
+	for _, skip := range export.RecurringSkips {
+		_, err := tx.Exec(
+			"INSERT INTO public.recurringskip (recurring, occurs_on) VALUES($1, $2::date) ON CONFLICT DO NOTHING;",
+			recurring[skip.Recurring], skip.OccursOn,
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+	for _, link := range export.RecurringLinks {
+		_, err := tx.Exec(
+			"UPDATE public.lineitem SET recurring=$1, recurring_on=$2::date WHERE id=$3;",
+			recurring[link.Recurring], link.OccursOn, lineitems[link.LineItem],
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for _, goal := range export.Goals {
+		_, err := tx.Exec(
+			`INSERT INTO public.goal ("name", target_amount, target_date, start_date, bucket, bank, ownerid, created_at, updated_at)
+			VALUES($1, $2, $3::date, $4::date, $5, $6, $7, $8, $9);`,
+			goal.Name, goal.TargetAmount, goal.TargetDate, goal.StartDate, nullInt(buckets[goal.Bucket]), nullInt(banks[goal.Bank]), owner,
+			createdAt(goal.CreatedAt), createdAt(goal.UpdatedAt),
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	debts := map[int]int{}
+	for _, debt := range export.Debts {
+		var id int
+		err := tx.QueryRow(
+			`INSERT INTO public.debt ("name", principal, rate, term_months, payment_day, start_date, bank, bucket, ownerid, created_at, updated_at)
+			VALUES($1, $2, $3, $4, $5, $6::date, $7, $8, $9, $10, $11) RETURNING id;`,
+			debt.Name, debt.Principal, debt.Rate, debt.Term, debt.PaymentDay, debt.StartDate, nullInt(banks[debt.Bank]), nullInt(buckets[debt.Bucket]), owner,
+			createdAt(debt.CreatedAt), createdAt(debt.UpdatedAt),
+		).Scan(&id)
+		if err != nil {
+			return result, err
+		}
+		debts[debt.Id] = id
+	}
+	for _, payment := range export.DebtPayments {
+		if _, err := tx.Exec("UPDATE public.lineitem SET debt=$1 WHERE id=$2;", debts[payment.Debt], lineitems[payment.LineItem]); err != nil {
+			return result, err
+		}
+	}
+
+	for _, account := range export.Interest {
+		_, err := tx.Exec("UPDATE public.bankaccount SET interest_start=$1::date WHERE id=$2;", account.Start, banks[account.Bank])
+		if err != nil {
+			return result, err
+		}
+		for _, tier := range account.Tiers {
+			_, err := tx.Exec("INSERT INTO public.interesttier (bank, min_balance, rate) VALUES($1, $2, $3);", banks[account.Bank], tier.MinBalance, tier.Rate)
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+	for _, posting := range export.InterestPostings {
+		_, err := tx.Exec(
+			"INSERT INTO public.interestposting (bank, period, amount, lineitem, created_at) VALUES($1, $2::date, $3, $4, $5) ON CONFLICT (bank, period) DO NOTHING;",
+			banks[posting.Bank], posting.Period+"-01", posting.Amount, nullInt(lineitems[posting.LineItem]), createdAt(posting.CreatedAt),
+		)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result = RestoreResult{
+		Banks:           len(banks),
+		Buckets:         len(buckets),
+		Transfers:       len(transfers),
+		Reconciliations: len(reconciliations),
+		Allocations:     len(export.Allocations),
+		ImportProfiles:  len(export.ImportProfiles),
+		Recurring:       len(recurring),
+		Goals:           len(export.Goals),
+		Debts:           len(debts),
+		LineItems:       len(export.LineItems),
+	}
+	return result, tx.Commit()
+}
+
+// Import a JSON export (POST /import/json, the document as body)
+// Creates all its records for the user, next to the existing ones.
+func importJSONProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	var export Export
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_RESTORE_SIZE)).Decode(&export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkExport(&export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := restoreExport(export, owner)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	InfoLogger.Printf("Imported an export of %d Line Items.", result.LineItems)
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import "testing"
+
+func TestLedgerName(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket string
+		want   string
+	}{
+		{
+			name:   "Plain name",
+			bucket: "Groceries",
+			want:   "Groceries",
+		},
+		{
+			name:   "Double space",
+			bucket: "Eating  out",
+			want:   "Eating out",
+		},
+		{
+			name:   "Account separator",
+			bucket: "Bank: Savings",
+			want:   "Bank- Savings",
+		},
+		{
+			name:   "Surrounding whitespace",
+			bucket: " Trips\t2021 ",
+			want:   "Trips 2021",
+		},
+		{
+			name:   "Empty",
+			bucket: "",
+			want:   "Unnamed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ledgerName(tt.bucket); got != tt.want {
+				t.Errorf("ledgerName(%q) = %q, want %q", tt.bucket, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLedgerEntry(t *testing.T) {
+	accounts := ledgerAccounts{
+		banks: map[int]BankAccount{
+			1: {Id: 1, Name: "Checking", Currency: "USD"},
+			2: {Id: 2, Name: "Savings", Currency: "USD"},
+		},
+		buckets:   map[int]Bucket{3: {Id: 3, Name: "Food: Groceries"}},
+		transfers: map[int]Transfer{4: {Id: 4, FromBank: 1, ToBank: 2, Amount: 10000}},
+	}
+
+	tests := []struct {
+		name     string
+		lineitem LineItem
+		want     string
+	}{
+		{
+			name:     "Expense",
+			lineitem: LineItem{Id: 10, Title: "Groceries", Description: "weekly\nshopping", Amount: -4510, Bucket: 3, Bank: 1, OccurredOn: "2021-03-02"},
+			want:     "2021-03-02 Groceries  ; id:10\n    ; weekly shopping\n    Expenses:Food- Groceries  45.10 USD\n    Assets:Banks:Checking  -45.10 USD\n\n",
+		},
+		{
+			name:     "Income without bucket",
+			lineitem: LineItem{Id: 11, Title: "Salary", Amount: 250000, Bank: 1, OccurredOn: "2021-03-01"},
+			want:     "2021-03-01 Salary  ; id:11\n    Income:Unassigned  -2500.00 USD\n    Assets:Banks:Checking  2500.00 USD\n\n",
+		},
+		{
+			name:     "Cleared",
+			lineitem: LineItem{Id: 15, Title: "Rent", Amount: -120000, Bank: 1, OccurredOn: "2021-03-01", Status: STATUS_RECONCILED},
+			want:     "2021-03-01 * Rent  ; id:15\n    Expenses:Unassigned  1200.00 USD\n    Assets:Banks:Checking  -1200.00 USD\n\n",
+		},
+		{
+			name:     "Cash",
+			lineitem: LineItem{Id: 12, Title: "Coffee", Amount: -350, Bucket: 3, OccurredOn: "2021-03-03"},
+			want:     "2021-03-03 Coffee  ; id:12\n    Expenses:Food- Groceries  3.50 USD\n    Assets:Cash  -3.50 USD\n\n",
+		},
+		{
+			name:     "Transfer debit",
+			lineitem: LineItem{Id: 13, Title: "Saving", Amount: -10000, Bank: 1, OccurredOn: "2021-03-04", Transfer: 4},
+			want:     "2021-03-04 Saving  ; id:13\n    Assets:Banks:Savings  100.00 USD\n    Assets:Banks:Checking  -100.00 USD\n\n",
+		},
+		{
+			name:     "Transfer credit",
+			lineitem: LineItem{Id: 14, Title: "Saving", Amount: 10000, Bank: 2, OccurredOn: "2021-03-04", Transfer: 4},
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, ok := accounts.ledgerEntry(tt.lineitem)
+			if ok != (tt.want != "") || entry != tt.want {
+				t.Errorf("ledgerEntry = %q, %v, want %q", entry, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExport(t *testing.T) {
+	valid := func() Export {
+		return Export{
+			Version:   EXPORT_VERSION,
+			Banks:     []BankAccount{{Id: 1, Name: "Checking", Currency: "usd"}, {Id: 2, Name: "Savings", Currency: "USD"}},
+			Buckets:   []Bucket{{Id: 3, Name: "Groceries"}},
+			Transfers: []Transfer{{Id: 4, Amount: 100, FromBank: 1, ToBank: 2, OccurredOn: "2021-03-04"}},
+			LineItems: []LineItem{
+				{Id: 10, Title: "Groceries", Amount: -4510, Bucket: 3, Bank: 1, OccurredOn: "2021-03-02"},
+				{Id: 11, Title: "Cash", Amount: -350, OccurredOn: "2021-03-03"},
+				{Id: 12, Title: "Saving", Amount: -100, Bank: 1, OccurredOn: "2021-03-04", Transfer: 4},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(e *Export)
+		valid  bool
+	}{
+		{
+			name:   "Valid",
+			change: func(e *Export) {},
+			valid:  true,
+		},
+		{
+			name:   "Newer version",
+			change: func(e *Export) { e.Version = EXPORT_VERSION + 1 },
+			valid:  false,
+		},
+		{
+			name:   "First version",
+			change: func(e *Export) { e.Version = 1 },
+			valid:  true,
+		},
+		{
+			name:   "Invalid currency",
+			change: func(e *Export) { e.Banks[0].Currency = "dollars" },
+			valid:  false,
+		},
+		{
+			name:   "Opening balance",
+			change: func(e *Export) { e.Banks[0].OpeningBalance, e.Banks[0].OpeningDate = 10000, "2021-01-01" },
+			valid:  true,
+		},
+		{
+			name:   "Invalid opening date",
+			change: func(e *Export) { e.Banks[0].OpeningDate = "01/01/2021" },
+			valid:  false,
+		},
+		{
+			name:   "Unknown bank",
+			change: func(e *Export) { e.LineItems[0].Bank = 9 },
+			valid:  false,
+		},
+		{
+			name:   "Unknown bucket",
+			change: func(e *Export) { e.LineItems[0].Bucket = 9 },
+			valid:  false,
+		},
+		{
+			name:   "Unknown transfer",
+			change: func(e *Export) { e.LineItems[2].Transfer = 9 },
+			valid:  false,
+		},
+		{
+			name:   "Transfer without bank",
+			change: func(e *Export) { e.Transfers[0].ToBank = 0 },
+			valid:  false,
+		},
+		{
+			name:   "Invalid date",
+			change: func(e *Export) { e.LineItems[1].OccurredOn = "2021-02-30" },
+			valid:  false,
+		},
+		{
+			name: "Reconciled",
+			change: func(e *Export) {
+				e.Reconciliations = []Reconciliation{{Id: 5, Bank: 1, StatementDate: "2021-03-31", Status: RECONCILIATION_FINISHED}}
+				e.LineItems[0].Reconciliation = 5
+			},
+			valid: true,
+		},
+		{
+			name:   "Unknown reconciliation",
+			change: func(e *Export) { e.LineItems[0].Reconciliation = 9 },
+			valid:  false,
+		},
+		{
+			name: "Two open reconciliations",
+			change: func(e *Export) {
+				e.Reconciliations = []Reconciliation{
+					{Id: 5, Bank: 1, StatementDate: "2021-02-28", Status: RECONCILIATION_OPEN},
+					{Id: 6, Bank: 1, StatementDate: "2021-03-31", Status: RECONCILIATION_OPEN},
+				}
+			},
+			valid: false,
+		},
+		{
+			name:   "Invalid budget",
+			change: func(e *Export) { e.Buckets[0].Budget = &Budget{Amount: 100, Period: "fortnight"} },
+			valid:  false,
+		},
+		{
+			name: "Allocation",
+			change: func(e *Export) {
+				e.Allocations = []Allocation{{Id: 20, Bucket: 3, Period: "2021-03", Amount: 5000, LineItem: 10}}
+			},
+			valid: true,
+		},
+		{
+			name:   "Allocation without line item",
+			change: func(e *Export) { e.Allocations = []Allocation{{Id: 20, Bucket: 3, Period: "2021-03", Amount: 5000}} },
+			valid:  true,
+		},
+		{
+			name:   "Allocation of unknown bucket",
+			change: func(e *Export) { e.Allocations = []Allocation{{Id: 20, Bucket: 9, Period: "2021-03", Amount: 5000}} },
+			valid:  false,
+		},
+		{
+			name: "Allocation of unknown line item",
+			change: func(e *Export) {
+				e.Allocations = []Allocation{{Id: 20, Bucket: 3, Period: "2021-03", Amount: 5000, LineItem: 99}}
+			},
+			valid: false,
+		},
+		{
+			name:   "Allocation with invalid period",
+			change: func(e *Export) { e.Allocations = []Allocation{{Id: 20, Bucket: 3, Period: "2021-13", Amount: 5000}} },
+			valid:  false,
+		},
+		{
+			name:   "Rollover",
+			change: func(e *Export) { e.Rollovers = []ExportRollover{{Bucket: 3, Period: "2021-04", Amount: 250}} },
+			valid:  true,
+		},
+		{
+			name:   "Rollover of unknown bucket",
+			change: func(e *Export) { e.Rollovers = []ExportRollover{{Bucket: 9, Period: "2021-04", Amount: 250}} },
+			valid:  false,
+		},
+		{
+			name:   "Closed month with invalid period",
+			change: func(e *Export) { e.ClosedMonths = []ExportClose{{Period: "March"}} },
+			valid:  false,
+		},
+		{
+			name: "Import profile",
+			change: func(e *Export) {
+				e.ImportProfiles = []ImportProfile{{Id: 30, Name: "Bank CSV", Bank: 1, HasHeader: true, DateColumn: "Date", DescriptionColumn: "Text", AmountColumn: "Amount", Sign: "negative_expenses"}}
+			},
+			valid: true,
+		},
+		{
+			name: "Import profile of unknown bank",
+			change: func(e *Export) {
+				e.ImportProfiles = []ImportProfile{{Id: 30, Name: "Bank CSV", Bank: 9, HasHeader: true, DateColumn: "Date", DescriptionColumn: "Text", AmountColumn: "Amount", Sign: "negative_expenses"}}
+			},
+			valid: false,
+		},
+		{
+			name:   "Dismissal",
+			change: func(e *Export) { e.Dismissals = []ExportDismissal{{LineItem: 10, Other: 11}} },
+			valid:  true,
+		},
+		{
+			name:   "Dismissal of unknown line item",
+			change: func(e *Export) { e.Dismissals = []ExportDismissal{{LineItem: 10, Other: 99}} },
+			valid:  false,
+		},
+		{
+			name:   "Dismissal of one line item",
+			change: func(e *Export) { e.Dismissals = []ExportDismissal{{LineItem: 10, Other: 10}} },
+			valid:  false,
+		},
+		{
+			name: "Recurring",
+			change: func(e *Export) {
+				e.Recurring = []Recurring{{Id: 40, Title: "Rent", Amount: -90000, Bank: 1, Frequency: FREQUENCY_MONTHLY, Start: "2021-01-01", NextDate: "2021-04-01"}}
+				e.RecurringSkips = []ExportSkip{{Recurring: 40, OccursOn: "2021-02-01"}}
+				e.RecurringLinks = []ExportOccurrence{{LineItem: 10, Recurring: 40, OccursOn: "2021-03-01"}}
+			},
+			valid: true,
+		},
+		{
+			name: "Recurring of unknown bank",
+			change: func(e *Export) {
+				e.Recurring = []Recurring{{Id: 40, Title: "Rent", Amount: -90000, Bank: 9, Frequency: FREQUENCY_MONTHLY, Start: "2021-01-01"}}
+			},
+			valid: false,
+		},
+		{
+			name: "Recurring with invalid frequency",
+			change: func(e *Export) {
+				e.Recurring = []Recurring{{Id: 40, Title: "Rent", Amount: -90000, Frequency: "yearly", Start: "2021-01-01"}}
+			},
+			valid: false,
+		},
+		{
+			name:   "Skip of unknown recurring",
+			change: func(e *Export) { e.RecurringSkips = []ExportSkip{{Recurring: 40, OccursOn: "2021-02-01"}} },
+			valid:  false,
+		},
+		{
+			name: "Occurrence of unknown line item",
+			change: func(e *Export) {
+				e.Recurring = []Recurring{{Id: 40, Title: "Rent", Amount: -90000, Frequency: FREQUENCY_MONTHLY, Start: "2021-01-01"}}
+				e.RecurringLinks = []ExportOccurrence{{LineItem: 99, Recurring: 40, OccursOn: "2021-03-01"}}
+			},
+			valid: false,
+		},
+		{
+			name: "Goal",
+			change: func(e *Export) {
+				e.Goals = []Goal{{Id: 50, Name: "Holiday", TargetAmount: 200000, StartDate: "2021-01-01", TargetDate: "2021-12-31", Bucket: 3}}
+			},
+			valid: true,
+		},
+		{
+			name: "Goal of unknown bank",
+			change: func(e *Export) {
+				e.Goals = []Goal{{Id: 50, Name: "Holiday", TargetAmount: 200000, StartDate: "2021-01-01", TargetDate: "2021-12-31", Bank: 9}}
+			},
+			valid: false,
+		},
+		{
+			name: "Goal without target",
+			change: func(e *Export) {
+				e.Goals = []Goal{{Id: 50, Name: "Holiday", StartDate: "2021-01-01", TargetDate: "2021-12-31", Bucket: 3}}
+			},
+			valid: false,
+		},
+		{
+			name: "Debt",
+			change: func(e *Export) {
+				e.Debts = []Debt{{Id: 60, Name: "Car", Principal: 1000000, Rate: 4.5, Term: 48, PaymentDay: 15, StartDate: "2021-01-10", Bank: 1}}
+				e.DebtPayments = []ExportPayment{{LineItem: 10, Debt: 60}}
+			},
+			valid: true,
+		},
+		{
+			name: "Debt with invalid term",
+			change: func(e *Export) {
+				e.Debts = []Debt{{Id: 60, Name: "Car", Principal: 1000000, Rate: 4.5, PaymentDay: 15, StartDate: "2021-01-10"}}
+			},
+			valid: false,
+		},
+		{
+			name:   "Payment of unknown debt",
+			change: func(e *Export) { e.DebtPayments = []ExportPayment{{LineItem: 10, Debt: 60}} },
+			valid:  false,
+		},
+		{
+			name: "Line item paying two debts",
+			change: func(e *Export) {
+				e.Debts = []Debt{
+					{Id: 60, Name: "Car", Principal: 1000000, Rate: 4.5, Term: 48, PaymentDay: 15, StartDate: "2021-01-10"},
+					{Id: 61, Name: "Loan", Principal: 500000, Rate: 6, Term: 24, PaymentDay: 1, StartDate: "2021-01-10"},
+				}
+				e.DebtPayments = []ExportPayment{{LineItem: 10, Debt: 60}, {LineItem: 10, Debt: 61}}
+			},
+			valid: false,
+		},
+		{
+			name: "Interest",
+			change: func(e *Export) {
+				e.Interest = []ExportInterest{{Bank: 2, Start: "2021-01-01", Tiers: []InterestTier{{MinBalance: 100000, Rate: 1.5}, {Rate: 0.5}}}}
+				e.InterestPostings = []ExportPosting{{Bank: 2, Period: "2021-01", Amount: 12, LineItem: 11}, {Bank: 2, Period: "2021-02", Amount: 11}}
+			},
+			valid: true,
+		},
+		{
+			name: "Interest of unknown bank",
+			change: func(e *Export) {
+				e.Interest = []ExportInterest{{Bank: 9, Start: "2021-01-01", Tiers: []InterestTier{{Rate: 0.5}}}}
+			},
+			valid: false,
+		},
+		{
+			name: "Interest of one bank twice",
+			change: func(e *Export) {
+				e.Interest = []ExportInterest{{Bank: 2, Start: "2021-01-01", Tiers: []InterestTier{{Rate: 0.5}}}, {Bank: 2, Start: "2021-02-01", Tiers: []InterestTier{{Rate: 1}}}}
+			},
+			valid: false,
+		},
+		{
+			name: "Interest with invalid rate",
+			change: func(e *Export) {
+				e.Interest = []ExportInterest{{Bank: 2, Start: "2021-01-01", Tiers: []InterestTier{{Rate: 100}}}}
+			},
+			valid: false,
+		},
+		{
+			name: "Interest posting of unknown line item",
+			change: func(e *Export) {
+				e.InterestPostings = []ExportPosting{{Bank: 2, Period: "2021-01", Amount: 12, LineItem: 99}}
+			},
+			valid: false,
+		},
+		{
+			name:   "Interest posting with invalid period",
+			change: func(e *Export) { e.InterestPostings = []ExportPosting{{Bank: 2, Period: "2021-01-01", Amount: 12}} },
+			valid:  false,
+		},
+		{
+			name: "Two line items of one occurrence",
+			change: func(e *Export) {
+				e.Recurring = []Recurring{{Id: 40, Title: "Rent", Amount: -90000, Frequency: FREQUENCY_MONTHLY, Start: "2021-01-01"}}
+				e.RecurringLinks = []ExportOccurrence{{LineItem: 10, Recurring: 40, OccursOn: "2021-03-01"}, {LineItem: 11, Recurring: 40, OccursOn: "2021-03-01"}}
+			},
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export := valid()
+			tt.change(&export)
+			err := checkExport(&export)
+			if (err == nil) != tt.valid {
+				t.Errorf("checkExport error = %v, want valid %v", err, tt.valid)
+			}
+			if err == nil && export.Banks[0].Currency != "USD" {
+				t.Errorf("currency not normalized, got %q", export.Banks[0].Currency)
+			}
+		})
+	}
+}
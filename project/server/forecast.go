@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Number of months /forecast projects, and of months of history it averages spending over,
+// by default and at most
+const (
+	DEFAULT_FORECAST_MONTHS = 3
+	DEFAULT_HISTORY_MONTHS  = 3
+	MAX_FORECAST_MONTHS     = 24
+)
+
+// Projected balance of a bank account at the end of Date. Known is the sum of the line items
+// dated that day and the occurrences of recurring line items on it.
+type ForecastDay struct {
+	Date     string `json:"date"`
+	Known    Money  `json:"known"`
+	Balance  Money  `json:"balance"`
+	Negative bool   `json:"negative"`
+}
+
+// Average spending of a bucket (0 for line items without one) on a bank account, over the history
+type BucketAverage struct {
+	Bucket  int    `json:"bucket"`
+	Name    string `json:"name"`
+	Spent   Money  `json:"spent"`
+	Monthly Money  `json:"monthly"`
+}
+
+// Response of /forecast, one per bank account: the balance today, the projected balance of
+// every day after it, and the first day it is projected to go negative, if any
+type Forecast struct {
+	Bank          int             `json:"bank"`
+	Name          string          `json:"name"`
+	Currency      string          `json:"currency"`
+	Balance       Money           `json:"balance"`
+	Lowest        ForecastDay     `json:"lowest"`
+	FirstNegative string          `json:"first_negative,omitempty"`
+	Spending      []BucketAverage `json:"spending"`
+	Days          []ForecastDay   `json:"days"`
+}
+
+// parseMonths reads a number of months query parameter, def if it is not given.
+func parseMonths(value string, name string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > MAX_FORECAST_MONTHS {
+		return 0, fmt.Errorf("invalid %s %q, expected 1 to %d", name, value, MAX_FORECAST_MONTHS)
+	}
+	return n, nil
+}
+
+// addRecurring adds the occurrences of a recurring line item from from up to and including to
+// to amounts by date, leaving out the skipped ones and the ones created already.
+func addRecurring(amounts map[string]Money, recurring Recurring, skipped map[string]bool, from time.Time, to time.Time) {
+	next, err := parseDate(recurring.NextDate)
+	if err != nil {
+		return
+	}
+	if next.After(from) {
+		from = next
+	}
+	for _, date := range recurring.schedule().between(from, to) {
+		if !skipped[date.Format(DATE_LAYOUT)] {
+			amounts[date.Format(DATE_LAYOUT)] += recurring.Amount
+		}
+	}
+}
+
+// projectBalance projects balance over the days days from from: the known amounts on their
+// dates, and daily, the average change per day, spread evenly.
+func projectBalance(balance Money, from time.Time, days int, known map[string]Money, daily float64) []ForecastDay {
+	projection := make([]ForecastDay, 0, days)
+	var knownTotal Money
+	for i := 0; i < days; i++ {
+		date := from.AddDate(0, 0, i).Format(DATE_LAYOUT)
+		knownTotal += known[date]
+		projected := balance + knownTotal + Money(math.Round(daily*float64(i+1)))
+		projection = append(projection, ForecastDay{Date: date, Known: known[date], Balance: projected, Negative: projected < 0})
+	}
+	return projection
+}
+
+// summarize fills in the lowest and the first negative day of a forecast.
+func (forecast *Forecast) summarize() {
+	forecast.Lowest = ForecastDay{Date: today(), Balance: forecast.Balance, Negative: forecast.Balance < 0}
+	for _, day := range forecast.Days {
+		if day.Balance < forecast.Lowest.Balance {
+			forecast.Lowest = day
+		}
+		if day.Negative && forecast.FirstNegative == "" {
+			forecast.FirstNegative = day.Date
+		}
+	}
+}
+
+// bucketAverages returns the spending of a bank account per bucket from from to to, the line
+// items of transfers and recurring line items left out, as the forecast adds those on their dates.
+func bucketAverages(owner int, bank int, from time.Time, to time.Time) ([]BucketAverage, error) {
+	rows, err := db.Query(
+		`SELECT coalesce(l.bucket, 0), coalesce(k.name, ''), sum(l.amount) FROM public.lineitem l
+		LEFT JOIN public.bucket k ON k.id = l.bucket
+		WHERE l.ownerid = $1 AND l.bank = $2 AND l.amount < 0 AND l.transfer IS NULL AND l.recurring IS NULL
+		AND l.occurred_on >= $3 AND l.occurred_on <= $4
+		GROUP BY 1, 2 ORDER BY 3, 1;`,
+		owner,
+		bank,
+		from.Format(DATE_LAYOUT),
+		to.Format(DATE_LAYOUT),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	averages := []BucketAverage{}
+	for rows.Next() {
+		var average BucketAverage
+		if err := rows.Scan(&average.Bucket, &average.Name, &average.Spent); err != nil {
+			return nil, err
+		}
+		averages = append(averages, average)
+	}
+	return averages, rows.Err()
+}
+
+// knownAmounts returns the amounts per bank account and date known from from to to: the line
+// items dated then, and the occurrences of the recurring line items of the bank accounts.
+func knownAmounts(owner int, from time.Time, to time.Time) (map[int]map[string]Money, error) {
+	known := map[int]map[string]Money{}
+	add := func(bank int) map[string]Money {
+		if known[bank] == nil {
+			known[bank] = map[string]Money{}
+		}
+		return known[bank]
+	}
+
+	rows, err := db.Query(
+		`SELECT bank, to_char(occurred_on, 'YYYY-MM-DD'), sum(amount) FROM public.lineitem
+		WHERE ownerid = $1 AND bank IS NOT NULL AND occurred_on >= $2 AND occurred_on <= $3 GROUP BY 1, 2;`,
+		owner,
+		from.Format(DATE_LAYOUT),
+		to.Format(DATE_LAYOUT),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var bank int
+		var date string
+		var amount Money
+		if err := rows.Scan(&bank, &date, &amount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		add(bank)[date] += amount
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT "+RECURRING_COLUMNS+" FROM public.recurring WHERE ownerid = $1 AND bank IS NOT NULL AND next_date IS NOT NULL;", owner)
+	if err != nil {
+		return nil, err
+	}
+	var templates []Recurring
+	for rows.Next() {
+		recurring, err := scanRecurring(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		templates = append(templates, recurring)
+	}
+	rows.Close()
+
+	for _, recurring := range templates {
+		skipped, err := skippedDates(db, recurring.Id)
+		if err != nil {
+			return nil, err
+		}
+		addRecurring(add(recurring.Bank), recurring, skipped, from, to)
+	}
+	return known, nil
+}
+
+// Projected balance of every bank account of the user (or ?bank=) per day for the next
+// months (3) months: the line items already dated then, the occurrences of recurring line items,
+// and the spending per bucket averaged over the last history (3) months.
+func forecastProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	query := r.URL.Query()
+	months, err := parseMonths(query.Get("months"), "months", DEFAULT_FORECAST_MONTHS)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	history, err := parseMonths(query.Get("history"), "history", DEFAULT_HISTORY_MONTHS)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var f filter
+	f.add("ownerid=?", owner)
+	if value := query.Get("bank"); value != "" {
+		bank, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid bank %q", value), http.StatusBadRequest)
+			return
+		}
+		if !ownsRecord(db, "bankaccount", bank, owner) {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bank Information Empty/Not Found.")
+			return
+		}
+		f.add("id=?", bank)
+	}
+
+	rows, err := db.Query("SELECT "+BANK_COLUMNS+" FROM public.bankaccount"+f.where()+" ORDER BY id;", f.args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	var banks []BankAccount
+	for rows.Next() {
+		bank, err := scanBankAccount(rows)
+		checkError(err)
+
+		banks = append(banks, bank)
+	}
+	rows.Close()
+
+	now, _ := parseDate(today())
+	from, to := now.AddDate(0, 0, 1), now.AddDate(0, months, 0)
+	known, err := knownAmounts(owner, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	forecasts := []Forecast{}
+	for _, bank := range banks {
+		forecast := Forecast{Bank: bank.Id, Name: bank.Name, Currency: bank.Currency}
+		if forecast.Balance, err = bankBalance(db, bank.Id, today()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		// Average over the history, or the days since the opening date if it is shorter
+		start := now.AddDate(0, -history, 0).AddDate(0, 0, 1)
+		if opening, err := parseDate(bank.OpeningDate); err == nil && opening.After(start) {
+			start = opening
+		}
+		days := int(now.Sub(start).Hours()/24) + 1
+
+		var daily float64
+		forecast.Spending = []BucketAverage{}
+		if days > 0 {
+			if forecast.Spending, err = bucketAverages(owner, bank.Id, start, now); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				ErrorLogger.Println("Internal Error Occured. " + err.Error())
+				return
+			}
+			for i, average := range forecast.Spending {
+				daily += float64(average.Spent) / float64(days)
+				forecast.Spending[i].Monthly = Money(math.Round(float64(average.Spent) / float64(days) * 365 / 12))
+			}
+		}
+
+		forecast.Days = projectBalance(forecast.Balance, from, int(to.Sub(now).Hours()/24), known[bank.Id], daily)
+		forecast.summarize()
+		forecasts = append(forecasts, forecast)
+	}
+	InfoLogger.Println("Forecast computed.")
+
+	if err := json.NewEncoder(w).Encode(forecasts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMonths(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int
+		valid bool
+	}{
+		{
+			name:  "Default months",
+			value: "",
+			want:  DEFAULT_FORECAST_MONTHS,
+			valid: true,
+		},
+		{
+			name:  "One month",
+			value: "1",
+			want:  1,
+			valid: true,
+		},
+		{
+			name:  "Maximum months",
+			value: "24",
+			want:  24,
+			valid: true,
+		},
+		{
+			name:  "Zero months",
+			value: "0",
+			want:  0,
+			valid: false,
+		},
+		{
+			name:  "Above maximum",
+			value: "25",
+			want:  0,
+			valid: false,
+		},
+		{
+			name:  "Not a number",
+			value: "three",
+			want:  0,
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMonths(tt.value, "months", DEFAULT_FORECAST_MONTHS)
+			if (err == nil) != tt.valid || got != tt.want {
+				t.Errorf("parseMonths(%q) = %d, %v, want %d, valid %v", tt.value, got, err, tt.want, tt.valid)
+			}
+		})
+	}
+}
+
+func TestAddRecurring(t *testing.T) {
+	rent := Recurring{Amount: -120000, Frequency: FREQUENCY_MONTHLY, Interval: 1, DayOfMonth: 1, Start: "2021-01-01", NextDate: "2021-04-01"}
+	from, _ := parseDate("2021-03-16")
+	to, _ := parseDate("2021-06-15")
+
+	tests := []struct {
+		name      string
+		recurring Recurring
+		skipped   map[string]bool
+		want      map[string]Money
+	}{
+		{
+			name:      "Monthly",
+			recurring: rent,
+			skipped:   nil,
+			want:      map[string]Money{"2021-04-01": -120000, "2021-05-01": -120000, "2021-06-01": -120000},
+		},
+		{
+			name:      "Skipped",
+			recurring: rent,
+			skipped:   map[string]bool{"2021-05-01": true},
+			want:      map[string]Money{"2021-04-01": -120000, "2021-06-01": -120000},
+		},
+		{
+			name:      "Ends",
+			recurring: Recurring{Amount: -5000, Frequency: FREQUENCY_WEEKLY, Interval: 2, Start: "2021-03-01", End: "2021-04-12", NextDate: "2021-03-29"},
+			skipped:   nil,
+			want:      map[string]Money{"2021-03-29": -5000, "2021-04-12": -5000},
+		},
+		{
+			name:      "Ended",
+			recurring: Recurring{Amount: -5000, Frequency: FREQUENCY_DAILY, Interval: 1, Start: "2021-03-01", End: "2021-03-10"},
+			skipped:   nil,
+			want:      map[string]Money{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]Money{}
+			addRecurring(got, tt.recurring, tt.skipped, from, to)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("addRecurring = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectBalance(t *testing.T) {
+	from, _ := parseDate("2021-03-30")
+	known := map[string]Money{"2021-04-01": -120000, "2021-04-02": 250000}
+
+	want := []ForecastDay{
+		{Date: "2021-03-30", Balance: 99000},
+		{Date: "2021-03-31", Balance: 98000},
+		{Date: "2021-04-01", Known: -120000, Balance: -23000, Negative: true},
+		{Date: "2021-04-02", Known: 250000, Balance: 226000},
+	}
+	got := projectBalance(100000, from, 4, known, -1000)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("projectBalance = %v, want %v", got, want)
+	}
+
+	forecast := Forecast{Balance: 100000, Days: got}
+	forecast.summarize()
+	if forecast.Lowest != want[2] || forecast.FirstNegative != "2021-04-01" {
+		t.Errorf("summarize: lowest %v, first negative %q, want %v, 2021-04-01", forecast.Lowest, forecast.FirstNegative, want[2])
+	}
+}
@@ -2,4 +2,9 @@ module server
 
 go 1.17
 
-require github.com/lib/pq v1.10.4 // indirect
+require (
+	github.com/lib/pq v1.10.4
+	interest v0.0.0-00010101000000-000000000000
+)
+
+replace interest => ../../exercism/interest-is-interesting
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Status of a savings goal
+const (
+	GOAL_ACHIEVED = "achieved" // the target amount is saved
+	GOAL_ON_TRACK = "on_track" // saved at least the share of the target the time elapsed asks for
+	GOAL_BEHIND   = "behind"   // saved less, or the target date passed
+)
+
+// Savings goal: TargetAmount saved by TargetDate, in a Bucket or a Bank account (one of them, the other 0)
+// Saved is the balance of the bank account, or what was put into the bucket since StartDate:
+// the line items of the bucket, an expense counting as money saved. Expected is the share of
+// the target due by today, saving evenly from StartDate; Monthly is what is left to save per
+// month until TargetDate.
+type Goal struct {
+	Id           int       `json:"id"`
+	Name         string    `json:"name"`
+	TargetAmount Money     `json:"target_amount"`
+	TargetDate   string    `json:"target_date"`
+	StartDate    string    `json:"start_date"`
+	Bucket       int       `json:"bucket"`
+	Bank         int       `json:"bank"`
+	Saved        Money     `json:"saved"`
+	Remaining    Money     `json:"remaining"`
+	Progress     float64   `json:"progress"`
+	Expected     Money     `json:"expected"`
+	Monthly      Money     `json:"monthly"`
+	Status       string    `json:"status"`
+	Owner        int       `json:"ownerid"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Amount saved towards a goal up to today, selected from public.goal
+const GOAL_SAVED = "CASE WHEN goal.bank IS NOT NULL THEN " +
+	"(SELECT opening_balance + " + BANK_BALANCE + " FROM public.bankaccount WHERE bankaccount.id = goal.bank) ELSE " +
+	"(SELECT -coalesce(sum(amount), 0) FROM public.lineitem WHERE lineitem.bucket = goal.bucket " +
+	"AND occurred_on >= goal.start_date AND occurred_on <= current_date) END"
+
+const GOAL_COLUMNS = "id, \"name\", target_amount, to_char(target_date, 'YYYY-MM-DD'), to_char(start_date, 'YYYY-MM-DD'), " +
+	"coalesce(bucket, 0), coalesce(bank, 0), " + GOAL_SAVED + ", ownerid, created_at, updated_at"
+
+// Fields /goals can be sorted by
+var GOAL_SORT_FIELDS = map[string]string{
+	"id":          "id",
+	"name":        "\"name\"",
+	"target_date": "target_date",
+	"created_at":  "created_at",
+}
+
+func scanGoal(row rowScanner) (Goal, error) {
+	var goal Goal
+	err := row.Scan(
+		&goal.Id,
+		&goal.Name,
+		&goal.TargetAmount,
+		&goal.TargetDate,
+		&goal.StartDate,
+		&goal.Bucket,
+		&goal.Bank,
+		&goal.Saved,
+		&goal.Owner,
+		&goal.CreatedAt,
+		&goal.UpdatedAt,
+	)
+	if err == nil {
+		now, _ := parseDate(today())
+		goal.track(now)
+	}
+	return goal, err
+}
+
+// checkGoal validates a goal request and fills in its start date.
+func checkGoal(goal *Goal) error {
+	if goal.Name == "" {
+		return errors.New("name is required")
+	}
+	if goal.TargetAmount <= 0 {
+		return errors.New("target_amount must be positive")
+	}
+	if (goal.Bucket == 0) == (goal.Bank == 0) {
+		return errors.New("a goal needs either a bucket or a bank")
+	}
+	if goal.StartDate == "" {
+		goal.StartDate = today()
+	}
+	start, err := parseDate(goal.StartDate)
+	if err != nil {
+		return err
+	}
+	target, err := parseDate(goal.TargetDate)
+	if err != nil {
+		return err
+	}
+	if !target.After(start) {
+		return errors.New("target_date must be after start_date")
+	}
+	return nil
+}
+
+// monthsLeft returns the whole months from now to target, at least 1.
+func monthsLeft(now time.Time, target time.Time) int {
+	months := (target.Year()-now.Year())*12 + int(target.Month()-now.Month())
+	if target.Day() < now.Day() {
+		months--
+	}
+	if months < 1 {
+		return 1
+	}
+	return months
+}
+
+// track computes the progress of a goal from Saved as of now.
+func (goal *Goal) track(now time.Time) {
+	start, _ := parseDate(goal.StartDate)
+	target, _ := parseDate(goal.TargetDate)
+
+	goal.Remaining = goal.TargetAmount - goal.Saved
+	if goal.Remaining < 0 {
+		goal.Remaining = 0
+	}
+	goal.Progress = math.Round(float64(goal.Saved)/float64(goal.TargetAmount)*1000) / 10
+
+	goal.Expected = goal.TargetAmount
+	if now.Before(target) {
+		elapsed := now.Sub(start).Hours()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		goal.Expected = Money(math.Round(float64(goal.TargetAmount) * elapsed / target.Sub(start).Hours()))
+	}
+
+	// Round up, so saving Monthly every month reaches the target
+	months := Money(monthsLeft(now, target))
+	goal.Monthly = (goal.Remaining + months - 1) / months
+
+	switch {
+	case goal.Remaining == 0:
+		goal.Status = GOAL_ACHIEVED
+	case !now.Before(target) || goal.Saved < goal.Expected:
+		goal.Status = GOAL_BEHIND
+	default:
+		goal.Status = GOAL_ON_TRACK
+	}
+}
+
+// readGoal decodes and validates a goal request.
+func readGoal(r *http.Request, owner int) (Goal, int, error) {
+	var request Goal
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return request, http.StatusBadRequest, err
+	}
+	if err := checkGoal(&request); err != nil {
+		return request, http.StatusBadRequest, err
+	}
+	if !lineitemRefsOwned(db, LineItem{Bucket: request.Bucket, Bank: request.Bank}, owner) {
+		return request, http.StatusBadRequest, errors.New("Bucket or Bank not found.")
+	}
+	return request, 0, nil
+}
+
+// Create and list savings goals, with their progress
+func goalProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "POST":
+		request, status, err := readGoal(r, owner)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		var id int
+		err = db.QueryRow(
+			`INSERT INTO public.goal ("name", target_amount, target_date, start_date, bucket, bank, ownerid)
+			VALUES($1, $2, $3::date, $4::date, $5, $6, $7) RETURNING id;`,
+			request.Name,
+			request.TargetAmount,
+			request.TargetDate,
+			request.StartDate,
+			nullInt(request.Bucket),
+			nullInt(request.Bank),
+			owner,
+		).Scan(&id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("New Goal created.")
+
+		goal, err := scanGoal(db.QueryRow("SELECT "+GOAL_COLUMNS+" FROM public.goal WHERE id=$1;", id))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(goal); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	case "GET":
+		options, err := parseListOptions(r.URL.Query(), GOAL_SORT_FIELDS, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var f filter
+		f.add("ownerid=?", owner)
+		rows, total, err := queryPage("goal", GOAL_COLUMNS, f, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
+
+		goals := []Goal{}
+		for rows.Next() {
+			goal, err := scanGoal(rows)
+			checkError(err)
+
+			goals = append(goals, goal)
+		}
+		InfoLogger.Println("Goals retrieved.")
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if err := json.NewEncoder(w).Encode(goals); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+// Read, change or delete a savings goal
+func goalProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	current, err := scanGoal(db.QueryRow("SELECT "+GOAL_COLUMNS+" FROM public.goal WHERE id=$1 AND ownerid=$2;", id, owner))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Goal Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		InfoLogger.Println("Goal Information retrieved.")
+	case "PUT":
+		request, status, err := readGoal(r, owner)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		_, err = db.Exec(
+			`UPDATE public.goal SET "name"=$1, target_amount=$2, target_date=$3::date, start_date=$4::date, bucket=$5, bank=$6
+			WHERE id=$7 AND ownerid=$8;`,
+			request.Name,
+			request.TargetAmount,
+			request.TargetDate,
+			request.StartDate,
+			nullInt(request.Bucket),
+			nullInt(request.Bank),
+			id,
+			owner,
+		)
+		if err == nil {
+			current, err = scanGoal(db.QueryRow("SELECT "+GOAL_COLUMNS+" FROM public.goal WHERE id=$1;", id))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Goal Information Updated.")
+	case "DELETE":
+		if _, err := db.Exec("DELETE FROM public.goal WHERE id=$1 AND ownerid=$2;", id, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Goal Information deleted.")
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(current); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
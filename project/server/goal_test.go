@@ -0,0 +1,188 @@
+package main
+
+import "testing"
+
+func TestCheckGoal(t *testing.T) {
+	tests := []struct {
+		name  string
+		goal  Goal
+		valid bool
+	}{
+		{
+			name:  "Bucket",
+			goal:  Goal{Name: "Trip", TargetAmount: 200000, TargetDate: "2021-12-31", StartDate: "2021-01-01", Bucket: 3},
+			valid: true,
+		},
+		{
+			name:  "Bank",
+			goal:  Goal{Name: "Emergency fund", TargetAmount: 1000000, TargetDate: "2022-06-30", StartDate: "2021-01-01", Bank: 1},
+			valid: true,
+		},
+		{
+			name:  "No name",
+			goal:  Goal{TargetAmount: 200000, TargetDate: "2021-12-31", StartDate: "2021-01-01", Bucket: 3},
+			valid: false,
+		},
+		{
+			name:  "No target",
+			goal:  Goal{Name: "Trip", TargetDate: "2021-12-31", StartDate: "2021-01-01", Bucket: 3},
+			valid: false,
+		},
+		{
+			name:  "Bucket and bank",
+			goal:  Goal{Name: "Trip", TargetAmount: 200000, TargetDate: "2021-12-31", StartDate: "2021-01-01", Bucket: 3, Bank: 1},
+			valid: false,
+		},
+		{
+			name:  "Neither",
+			goal:  Goal{Name: "Trip", TargetAmount: 200000, TargetDate: "2021-12-31", StartDate: "2021-01-01"},
+			valid: false,
+		},
+		{
+			name:  "Invalid date",
+			goal:  Goal{Name: "Trip", TargetAmount: 200000, TargetDate: "31/12/2021", StartDate: "2021-01-01", Bucket: 3},
+			valid: false,
+		},
+		{
+			name:  "Target before start",
+			goal:  Goal{Name: "Trip", TargetAmount: 200000, TargetDate: "2020-12-31", StartDate: "2021-01-01", Bucket: 3},
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkGoal(&tt.goal); (err == nil) != tt.valid {
+				t.Errorf("checkGoal error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestMonthsLeft(t *testing.T) {
+	tests := []struct {
+		name   string
+		now    string
+		target string
+		want   int
+	}{
+		{
+			name:   "Whole months",
+			now:    "2021-03-15",
+			target: "2021-06-15",
+			want:   3,
+		},
+		{
+			name:   "Day before a whole month",
+			now:    "2021-03-15",
+			target: "2021-06-14",
+			want:   2,
+		},
+		{
+			name:   "Months of the next year",
+			now:    "2021-03-15",
+			target: "2022-03-31",
+			want:   12,
+		},
+		{
+			name:   "Less than a month",
+			now:    "2021-03-15",
+			target: "2021-03-31",
+			want:   1,
+		},
+		{
+			name:   "Target passed",
+			now:    "2021-03-15",
+			target: "2021-01-31",
+			want:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, _ := parseDate(tt.now)
+			target, _ := parseDate(tt.target)
+			if got := monthsLeft(now, target); got != tt.want {
+				t.Errorf("monthsLeft(%s, %s) = %d, want %d", tt.now, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoalTrack(t *testing.T) {
+	tests := []struct {
+		name     string
+		saved    Money
+		now      string
+		expected Money
+		monthly  Money
+		progress float64
+		status   string
+	}{
+		{
+			name:     "On track",
+			saved:    60000,
+			now:      "2021-04-01",
+			expected: 59669,
+			monthly:  20000,
+			progress: 50,
+			status:   GOAL_ON_TRACK,
+		},
+		{
+			name:     "Ahead",
+			saved:    90000,
+			now:      "2021-04-01",
+			expected: 59669,
+			monthly:  10000,
+			progress: 75,
+			status:   GOAL_ON_TRACK,
+		},
+		{
+			name:     "Behind",
+			saved:    30000,
+			now:      "2021-04-01",
+			expected: 59669,
+			monthly:  30000,
+			progress: 25,
+			status:   GOAL_BEHIND,
+		},
+		{
+			name:     "Not started",
+			saved:    0,
+			now:      "2020-12-15",
+			expected: 0,
+			monthly:  20000,
+			progress: 0,
+			status:   GOAL_ON_TRACK,
+		},
+		{
+			name:     "Achieved",
+			saved:    125000,
+			now:      "2021-04-01",
+			expected: 59669,
+			monthly:  0,
+			progress: 104.2,
+			status:   GOAL_ACHIEVED,
+		},
+		{
+			name:     "Missed",
+			saved:    100000,
+			now:      "2021-07-15",
+			expected: 120000,
+			monthly:  20000,
+			progress: 83.3,
+			status:   GOAL_BEHIND,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goal := Goal{TargetAmount: 120000, StartDate: "2021-01-01", TargetDate: "2021-07-01", Saved: tt.saved}
+			now, _ := parseDate(tt.now)
+			goal.track(now)
+			if goal.Expected != tt.expected || goal.Monthly != tt.monthly || goal.Progress != tt.progress || goal.Status != tt.status {
+				t.Errorf("track = expected %s, monthly %s, progress %v, %s, want %s, %s, %v, %s", goal.Expected, goal.Monthly, goal.Progress, goal.Status, tt.expected, tt.monthly, tt.progress, tt.status)
+			}
+		})
+	}
+}
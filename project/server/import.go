@@ -0,0 +1,768 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Sign conventions of a statement
+const (
+	SIGN_NEGATIVE_EXPENSES = "negative_expenses" // one amount column, expenses are negative (as stored)
+	SIGN_POSITIVE_EXPENSES = "positive_expenses" // one amount column, expenses are positive
+	SIGN_DEBIT_CREDIT      = "debit_credit"      // expenses in the debit column, income in the credit column
+)
+
+// Largest statement accepted by an import
+const MAX_IMPORT_SIZE = 10 << 20
+
+// How the columns of a bank's CSV statement map to line items
+// Columns are named by their header, or by their position counted from 1.
+type ImportProfile struct {
+	Id                int       `json:"id" bson:"id"`
+	Name              string    `json:"name" bson:"name"`
+	Bank              int       `json:"bank" bson:"bank"`
+	Delimiter         string    `json:"delimiter" bson:"delimiter"`
+	HasHeader         bool      `json:"has_header" bson:"has_header"`
+	DateColumn        string    `json:"date_column" bson:"date_column"`
+	DescriptionColumn string    `json:"description_column" bson:"description_column"`
+	AmountColumn      string    `json:"amount_column" bson:"amount_column"`
+	DebitColumn       string    `json:"debit_column" bson:"debit_column"`
+	CreditColumn      string    `json:"credit_column" bson:"credit_column"`
+	Sign              string    `json:"sign" bson:"sign"`
+	DateFormat        string    `json:"date_format" bson:"date_format"`
+	DecimalSeparator  string    `json:"decimal_separator" bson:"decimal_separator"`
+	Owner             int       `json:"ownerid" bson:"ownerid"`
+	CreatedAt         time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// A row of a statement that could not be imported
+// Row is the line number in the file, counted from 1.
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Response of an import
+// Line items are only created if no row failed. In a dry run Created and LineItems
+// tell what would be created.
+type ImportResult struct {
+	Rows       int              `json:"rows"`
+	Created    int              `json:"created"`
+	Duplicates int              `json:"duplicates"` // transactions imported before, skipped
+	DryRun     bool             `json:"dry_run"`
+	Errors     []ImportRowError `json:"errors"`
+	LineItems  []LineItem       `json:"lineitems"`
+}
+
+const IMPORT_PROFILE_COLUMNS = "id, \"name\", bank, delimiter, has_header, date_column, description_column, amount_column, debit_column, credit_column, " +
+	"sign, date_format, decimal_separator, ownerid, created_at, updated_at"
+
+var IMPORT_PROFILE_SORT_FIELDS = map[string]string{
+	"id":         "id",
+	"name":       "\"name\"",
+	"created_at": "created_at",
+}
+
+func scanImportProfile(row rowScanner) (ImportProfile, error) {
+	var profile ImportProfile
+	err := row.Scan(
+		&profile.Id,
+		&profile.Name,
+		&profile.Bank,
+		&profile.Delimiter,
+		&profile.HasHeader,
+		&profile.DateColumn,
+		&profile.DescriptionColumn,
+		&profile.AmountColumn,
+		&profile.DebitColumn,
+		&profile.CreditColumn,
+		&profile.Sign,
+		&profile.DateFormat,
+		&profile.DecimalSeparator,
+		&profile.Owner,
+		&profile.CreatedAt,
+		&profile.UpdatedAt,
+	)
+	return profile, err
+}
+
+var dateFormatPattern = regexp.MustCompile(`^(YYYY|YY|MM|DD|[-/. ])+$`)
+
+// dateLayout turns a date format such as DD/MM/YYYY into a time layout.
+// Days and months may be written with or without a leading zero.
+func dateLayout(format string) (string, error) {
+	if !dateFormatPattern.MatchString(format) || !strings.Contains(format, "YY") ||
+		strings.Count(format, "MM") != 1 || strings.Count(format, "DD") != 1 || strings.Count(format, "YY") > 2 {
+		return "", fmt.Errorf("invalid date format %q, expected a format such as YYYY-MM-DD or DD/MM/YYYY", format)
+	}
+	return strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "1", "DD", "2").Replace(format), nil
+}
+
+// checkImportProfile validates a profile and fills in its defaults.
+func checkImportProfile(profile *ImportProfile) error {
+	if profile.Name == "" {
+		return errors.New("name is required")
+	}
+	if profile.Bank == 0 {
+		return errors.New("bank is required")
+	}
+
+	if profile.Delimiter == "" {
+		profile.Delimiter = ","
+	}
+	if delimiter, size := utf8.DecodeRuneInString(profile.Delimiter); size != len(profile.Delimiter) ||
+		delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == utf8.RuneError {
+		return fmt.Errorf("invalid delimiter %q, expected a single character", profile.Delimiter)
+	}
+
+	if profile.DateFormat == "" {
+		profile.DateFormat = "YYYY-MM-DD"
+	}
+	if _, err := dateLayout(profile.DateFormat); err != nil {
+		return err
+	}
+
+	switch profile.DecimalSeparator {
+	case "":
+		profile.DecimalSeparator = "."
+	case ".", ",":
+	default:
+		return fmt.Errorf("invalid decimal_separator %q, expected . or ,", profile.DecimalSeparator)
+	}
+
+	if profile.DateColumn == "" || profile.DescriptionColumn == "" {
+		return errors.New("date_column and description_column are required")
+	}
+	switch profile.Sign {
+	case "":
+		profile.Sign = SIGN_NEGATIVE_EXPENSES
+		fallthrough
+	case SIGN_NEGATIVE_EXPENSES, SIGN_POSITIVE_EXPENSES:
+		if profile.AmountColumn == "" {
+			return errors.New("amount_column is required")
+		}
+	case SIGN_DEBIT_CREDIT:
+		if profile.DebitColumn == "" || profile.CreditColumn == "" {
+			return errors.New("debit_column and credit_column are required with the debit_credit sign")
+		}
+	default:
+		return fmt.Errorf("invalid sign %q, expected negative_expenses, positive_expenses or debit_credit", profile.Sign)
+	}
+
+	if !profile.HasHeader {
+		for _, column := range []string{profile.DateColumn, profile.DescriptionColumn, profile.AmountColumn, profile.DebitColumn, profile.CreditColumn} {
+			if n, err := strconv.Atoi(column); column != "" && (err != nil || n < 1) {
+				return fmt.Errorf("column %q must be a position counted from 1, the statement has no header", column)
+			}
+		}
+	}
+	return nil
+}
+
+// columnIndex finds a column of the profile by its header or its position.
+func columnIndex(column string, header []string) (int, error) {
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(column); err == nil && n >= 1 {
+		return n - 1, nil
+	}
+	return 0, fmt.Errorf("column %q not found in the header", column)
+}
+
+// parseStatementAmount parses an amount as written in a statement: with the decimal separator
+// of the profile, optional thousands separators, and negative amounts written as -12.34,
+// 12.34- or (12.34). An empty amount is zero.
+func parseStatementAmount(value string, decimalSeparator string) (Money, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	} else if strings.HasSuffix(value, "-") {
+		negative = true
+		value = value[:len(value)-1]
+	}
+
+	thousands := ","
+	if decimalSeparator == "," {
+		thousands = "."
+	}
+	value = strings.NewReplacer(thousands, "", " ", "", "\u00a0", "", "'", "").Replace(value)
+	value = strings.Replace(value, decimalSeparator, ".", 1)
+
+	amount, err := ParseMoney(value)
+	if err != nil {
+		return 0, err
+	}
+	if negative {
+		if amount < 0 {
+			return 0, errInvalidMoney
+		}
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// parseStatement reads the line items of a CSV statement with the given profile.
+// Every row that can not be read is reported with its line number; the error is only set
+// if the statement as a whole can not be read, for example when a column is missing.
+func parseStatement(profile ImportProfile, statement io.Reader) ([]LineItem, []ImportRowError, error) {
+	layout, err := dateLayout(profile.DateFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := csv.NewReader(statement)
+	reader.Comma, _ = utf8.DecodeRuneInString(profile.Delimiter)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var header []string
+	if profile.HasHeader {
+		header, err = reader.Read()
+		if err == io.EOF {
+			return nil, nil, errors.New("the statement is empty")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(header) > 0 {
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+		}
+	}
+
+	names := []string{profile.DateColumn, profile.DescriptionColumn}
+	if profile.Sign == SIGN_DEBIT_CREDIT {
+		names = append(names, profile.DebitColumn, profile.CreditColumn)
+	} else {
+		names = append(names, profile.AmountColumn)
+	}
+	columns := make([]int, len(names))
+	for i, name := range names {
+		if columns[i], err = columnIndex(name, header); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var lineitems []LineItem
+	var rowErrors []ImportRowError
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if parseErr, ok := err.(*csv.ParseError); ok {
+			rowErrors = append(rowErrors, ImportRowError{Row: parseErr.StartLine, Error: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		row, _ := reader.FieldPos(0)
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		lineitem, err := statementLineItem(profile, layout, columns, record)
+		if err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: row, Error: err.Error()})
+			continue
+		}
+		lineitems = append(lineitems, lineitem)
+	}
+	return lineitems, rowErrors, nil
+}
+
+// statementLineItem builds the line item of one statement row.
+// columns holds the date, description and amount (or debit and credit) column indexes.
+func statementLineItem(profile ImportProfile, layout string, columns []int, record []string) (LineItem, error) {
+	field := func(i int) (string, error) {
+		if columns[i] >= len(record) {
+			return "", fmt.Errorf("expected at least %d columns, found %d", columns[i]+1, len(record))
+		}
+		return strings.TrimSpace(record[columns[i]]), nil
+	}
+
+	lineitem := LineItem{Bank: profile.Bank}
+
+	value, err := field(0)
+	if err != nil {
+		return lineitem, err
+	}
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		return lineitem, fmt.Errorf("invalid date %q, expected %s", value, profile.DateFormat)
+	}
+	lineitem.OccurredOn = date.Format(DATE_LAYOUT)
+
+	if lineitem.Title, err = field(1); err != nil {
+		return lineitem, err
+	}
+	if lineitem.Title == "" {
+		return lineitem, errors.New("description is empty")
+	}
+
+	amounts := make([]Money, len(columns)-2)
+	for i := range amounts {
+		if value, err = field(i + 2); err != nil {
+			return lineitem, err
+		}
+		if amounts[i], err = parseStatementAmount(value, profile.DecimalSeparator); err != nil {
+			return lineitem, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+
+	switch profile.Sign {
+	case SIGN_POSITIVE_EXPENSES:
+		lineitem.Amount = -amounts[0]
+	case SIGN_DEBIT_CREDIT:
+		lineitem.Amount = amounts[1].Abs() - amounts[0].Abs()
+	default:
+		lineitem.Amount = amounts[0]
+	}
+	if lineitem.Amount == 0 {
+		return lineitem, errors.New("amount is zero")
+	}
+	return lineitem, nil
+}
+
+// insertLineItems creates the line items of an import in a single transaction.
+// Line items with a transaction id that is already known for the bank account are skipped.
+func insertLineItems(lineitems []LineItem, owner int) ([]LineItem, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(
+		`INSERT INTO public.lineitem (title, description, amount, bucket, bank, ownerid, occurred_on, fitid) VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (bank, fitid) DO NOTHING RETURNING ` + LINEITEM_COLUMNS + ";",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var created []LineItem
+	for _, lineitem := range lineitems {
+		lineitem, err := scanLineItem(stmt.QueryRow(
+			lineitem.Title,
+			lineitem.Description,
+			lineitem.Amount,
+			lineitem.Bucket,
+			lineitem.Bank,
+			owner,
+			lineitem.OccurredOn,
+			nullString(lineitem.FitId),
+		))
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, lineitem)
+	}
+	return created, tx.Commit()
+}
+
+// Create and list the import profiles of the user (?bank= lists the profiles of one bank account)
+func importProfileProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "POST":
+		var request ImportProfile
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := checkImportProfile(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !ownsRecord(db, "bankaccount", request.Bank, owner) {
+			http.Error(w, "Bank not found.", http.StatusBadRequest)
+			return
+		}
+
+		profile, err := scanImportProfile(db.QueryRow(
+			`INSERT INTO public.importprofile ("name", bank, delimiter, has_header, date_column, description_column, amount_column, debit_column, credit_column,
+			sign, date_format, decimal_separator, ownerid) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING `+IMPORT_PROFILE_COLUMNS+";",
+			request.Name,
+			request.Bank,
+			request.Delimiter,
+			request.HasHeader,
+			request.DateColumn,
+			request.DescriptionColumn,
+			request.AmountColumn,
+			request.DebitColumn,
+			request.CreditColumn,
+			request.Sign,
+			request.DateFormat,
+			request.DecimalSeparator,
+			owner,
+		))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("New Import Profile Created.")
+
+		if err := json.NewEncoder(w).Encode(profile); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	case "GET":
+		options, err := parseListOptions(r.URL.Query(), IMPORT_PROFILE_SORT_FIELDS, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		f := nameFilter(owner, r.URL.Query())
+		if value := r.URL.Query().Get("bank"); value != "" {
+			bank, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid bank %q", value), http.StatusBadRequest)
+				return
+			}
+			f.add("bank=?", bank)
+		}
+
+		rows, total, err := queryPage("importprofile", IMPORT_PROFILE_COLUMNS, f, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
+
+		var profiles []ImportProfile
+		for rows.Next() {
+			profile, err := scanImportProfile(rows)
+			checkError(err)
+
+			profiles = append(profiles, profile)
+		}
+		InfoLogger.Println("Import Profile Information Retrieved.")
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if err := json.NewEncoder(w).Encode(profiles); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+func importProfileProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var profile ImportProfile
+	var err error
+	switch r.Method {
+	case "GET":
+		profile, err = scanImportProfile(db.QueryRow("SELECT "+IMPORT_PROFILE_COLUMNS+" FROM public.importprofile WHERE id=$1 AND ownerid=$2;", id, owner))
+	case "PUT":
+		var request ImportProfile
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := checkImportProfile(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !ownsRecord(db, "bankaccount", request.Bank, owner) {
+			http.Error(w, "Bank not found.", http.StatusBadRequest)
+			return
+		}
+
+		profile, err = scanImportProfile(db.QueryRow(
+			`UPDATE public.importprofile SET "name"=$1, bank=$2, delimiter=$3, has_header=$4, date_column=$5, description_column=$6, amount_column=$7,
+			debit_column=$8, credit_column=$9, sign=$10, date_format=$11, decimal_separator=$12 WHERE id=$13 AND ownerid=$14 RETURNING `+IMPORT_PROFILE_COLUMNS+";",
+			request.Name,
+			request.Bank,
+			request.Delimiter,
+			request.HasHeader,
+			request.DateColumn,
+			request.DescriptionColumn,
+			request.AmountColumn,
+			request.DebitColumn,
+			request.CreditColumn,
+			request.Sign,
+			request.DateFormat,
+			request.DecimalSeparator,
+			id,
+			owner,
+		))
+	case "DELETE":
+		profile, err = scanImportProfile(db.QueryRow("DELETE FROM public.importprofile WHERE id=$1 AND ownerid=$2 RETURNING "+IMPORT_PROFILE_COLUMNS+";", id, owner))
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Import Profile Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	InfoLogger.Println("Import Profile Information processed.")
+
+	if err := json.NewEncoder(w).Encode(profile); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Import a CSV statement into the bank account of a profile (POST /import/csv?profile=1, the CSV as body)
+func importCSVProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("profile"))
+	if err != nil {
+		http.Error(w, "profile is required", http.StatusBadRequest)
+		return
+	}
+	profile, err := scanImportProfile(db.QueryRow("SELECT "+IMPORT_PROFILE_COLUMNS+" FROM public.importprofile WHERE id=$1 AND ownerid=$2;", id, owner))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Import Profile Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	lineitems, rowErrors, err := parseStatement(profile, http.MaxBytesReader(w, r.Body, MAX_IMPORT_SIZE))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	importStatement(owner, profile.Bank, Statement{LineItems: lineitems, Errors: rowErrors}, w, r)
+}
+
+// Import an OFX statement into a bank account (POST /import/ofx?bank=1, the file as body)
+func importOFXProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	bank, ok := importBank(owner, w, r)
+	if !ok {
+		return
+	}
+	statement, err := parseOFX(http.MaxBytesReader(w, r.Body, MAX_IMPORT_SIZE))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if statement.Currency != "" && statement.Currency != bank.Currency {
+		http.Error(w, fmt.Sprintf("The statement is in %s, the bank account in %s.", statement.Currency, bank.Currency), http.StatusBadRequest)
+		return
+	}
+	importStatement(owner, bank.Id, statement, w, r)
+}
+
+// Import a QIF file into a bank account (POST /import/qif?bank=1, the file as body)
+// Dates are read as month/day/year, as Quicken writes them, unless day_first=true.
+func importQIFProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	dayFirst, err := queryBool(r, "day_first")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bank, ok := importBank(owner, w, r)
+	if !ok {
+		return
+	}
+	statement, err := parseQIF(http.MaxBytesReader(w, r.Body, MAX_IMPORT_SIZE), dayFirst)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	importStatement(owner, bank.Id, statement, w, r)
+}
+
+// queryBool reads an optional true/false query parameter.
+func queryBool(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q, expected true or false", name, value)
+	}
+	return parsed, nil
+}
+
+// importBank looks up the bank account of the ?bank= parameter, writing the error response if there is none.
+func importBank(owner int, w http.ResponseWriter, r *http.Request) (BankAccount, bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get("bank"))
+	if err != nil {
+		http.Error(w, "bank is required", http.StatusBadRequest)
+		return BankAccount{}, false
+	}
+	bank, err := scanBankAccount(db.QueryRow("SELECT "+BANK_COLUMNS+" FROM public.bankaccount WHERE id=$1 AND ownerid=$2;", id, owner))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Bank Information Empty/Not Found.")
+		return bank, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return bank, false
+	}
+	return bank, true
+}
+
+// knownFitIds returns the transaction ids already imported into a bank account.
+func knownFitIds(bank int) (map[string]bool, error) {
+	rows, err := db.Query("SELECT fitid FROM public.lineitem WHERE bank=$1 AND fitid IS NOT NULL;", bank)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := map[string]bool{}
+	for rows.Next() {
+		var fitid string
+		if err := rows.Scan(&fitid); err != nil {
+			return nil, err
+		}
+		known[fitid] = true
+	}
+	return known, rows.Err()
+}
+
+// splitDuplicates separates the line items whose transaction id was already imported,
+// or appears earlier in the same statement, from the new ones.
+func splitDuplicates(lineitems []LineItem, known map[string]bool) ([]LineItem, int) {
+	seen := map[string]bool{}
+	fresh := []LineItem{}
+	duplicates := 0
+	for _, lineitem := range lineitems {
+		if lineitem.FitId != "" && (known[lineitem.FitId] || seen[lineitem.FitId]) {
+			duplicates++
+			continue
+		}
+		seen[lineitem.FitId] = true
+		fresh = append(fresh, lineitem)
+	}
+	return fresh, duplicates
+}
+
+// importStatement creates the line items of a statement in a bank account and writes the ImportResult.
+// The line items are created together, and only if every row could be read; otherwise nothing
+// is created and the rows that failed are reported, so the import can simply be repeated.
+// Transactions imported before are skipped. With ?dry_run=true nothing is created, the
+// response lists the line items that would be.
+func importStatement(owner int, bank int, statement Statement, w http.ResponseWriter, r *http.Request) {
+	dryRun, err := queryBool(r, "dry_run")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	known, err := knownFitIds(bank)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	for i := range statement.LineItems {
+		statement.LineItems[i].Bank = bank
+		statement.LineItems[i].Owner = owner
+	}
+	fresh, duplicates := splitDuplicates(statement.LineItems, known)
+
+	result := ImportResult{
+		Rows:       len(statement.LineItems) + len(statement.Errors),
+		Duplicates: duplicates,
+		DryRun:     dryRun,
+		Errors:     []ImportRowError{},
+		LineItems:  []LineItem{},
+	}
+	status := http.StatusOK
+	if len(statement.Errors) > 0 {
+		status = http.StatusUnprocessableEntity
+		result.Errors = statement.Errors
+		WarningLogger.Printf("Import rejected, %d rows could not be read.", len(statement.Errors))
+	}
+
+	if dryRun {
+		result.Created = len(fresh)
+		result.LineItems = fresh
+		InfoLogger.Println("Import previewed.")
+	} else if status == http.StatusOK && len(fresh) > 0 {
+		result.LineItems, err = insertLineItems(fresh, owner)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		// Line items imported concurrently are skipped as well
+		result.Created = len(result.LineItems)
+		result.Duplicates += len(fresh) - result.Created
+		InfoLogger.Printf("Imported %d Line Items.", result.Created)
+	}
+
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
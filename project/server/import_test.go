@@ -0,0 +1,380 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDateLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		value  string
+		date   string
+	}{
+		{
+			name:   "ISO date",
+			format: "YYYY-MM-DD",
+			value:  "2021-03-05",
+			date:   "2021-03-05",
+		},
+		{
+			name:   "Day first",
+			format: "DD/MM/YYYY",
+			value:  "05/03/2021",
+			date:   "2021-03-05",
+		},
+		{
+			name:   "Month first without leading zeros",
+			format: "MM/DD/YYYY",
+			value:  "3/5/2021",
+			date:   "2021-03-05",
+		},
+		{
+			name:   "Two digit year",
+			format: "DD.MM.YY",
+			value:  "05.03.21",
+			date:   "2021-03-05",
+		},
+		{
+			name:   "Without separators",
+			format: "YYYYMMDD",
+			value:  "20210305",
+			date:   "2021-03-05",
+		},
+		{
+			name:   "Format without year",
+			format: "DD/MM",
+			value:  "",
+			date:   "",
+		},
+		{
+			name:   "Month name",
+			format: "MMM DD YYYY",
+			value:  "",
+			date:   "",
+		},
+		{
+			name:   "Go layout",
+			format: "2006-01-02",
+			value:  "",
+			date:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, err := dateLayout(tt.format)
+			if tt.date == "" {
+				if err == nil {
+					t.Errorf("dateLayout(%q) = %q, want an error", tt.format, layout)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("dateLayout(%q) error = %v", tt.format, err)
+				return
+			}
+			parsed, err := time.Parse(layout, tt.value)
+			if err != nil || parsed.Format(DATE_LAYOUT) != tt.date {
+				t.Errorf("%s: parsed %q as %v (%v), want %s", tt.format, tt.value, parsed, err, tt.date)
+			}
+		})
+	}
+}
+
+func TestParseStatementAmount(t *testing.T) {
+	tests := []struct {
+		name             string
+		value            string
+		decimalSeparator string
+		amount           Money
+		valid            bool
+	}{
+		{
+			name:             "Negative",
+			value:            "-12.34",
+			decimalSeparator: ".",
+			amount:           -1234,
+			valid:            true,
+		},
+		{
+			name:             "Thousands separator",
+			value:            "1,234.50",
+			decimalSeparator: ".",
+			amount:           123450,
+			valid:            true,
+		},
+		{
+			name:             "Decimal comma with thousands separator",
+			value:            "1.234,50",
+			decimalSeparator: ",",
+			amount:           123450,
+			valid:            true,
+		},
+		{
+			name:             "Decimal comma",
+			value:            "-4,5",
+			decimalSeparator: ",",
+			amount:           -450,
+			valid:            true,
+		},
+		{
+			name:             "Trailing minus",
+			value:            "12.34-",
+			decimalSeparator: ".",
+			amount:           -1234,
+			valid:            true,
+		},
+		{
+			name:             "Parentheses",
+			value:            "(12.34)",
+			decimalSeparator: ".",
+			amount:           -1234,
+			valid:            true,
+		},
+		{
+			name:             "Space as thousands separator",
+			value:            "1 234,00",
+			decimalSeparator: ",",
+			amount:           123400,
+			valid:            true,
+		},
+		{
+			name:             "Empty",
+			value:            "",
+			decimalSeparator: ".",
+			amount:           0,
+			valid:            true,
+		},
+		{
+			name:             "Three decimals",
+			value:            "12.345",
+			decimalSeparator: ".",
+			amount:           0,
+			valid:            false,
+		},
+		{
+			name:             "Parentheses and minus",
+			value:            "(-12.34)",
+			decimalSeparator: ".",
+			amount:           0,
+			valid:            false,
+		},
+		{
+			name:             "Currency code",
+			value:            "EUR 12",
+			decimalSeparator: ".",
+			amount:           0,
+			valid:            false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, err := parseStatementAmount(tt.value, tt.decimalSeparator)
+			if (err == nil) != tt.valid || amount != tt.amount {
+				t.Errorf("parseStatementAmount(%q, %q) = %v, %v, want %v valid %v", tt.value, tt.decimalSeparator, amount, err, tt.amount, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCheckImportProfile(t *testing.T) {
+	base := ImportProfile{Name: "Checking", Bank: 1, HasHeader: true, DateColumn: "Date", DescriptionColumn: "Payee", AmountColumn: "Amount"}
+	tests := []struct {
+		name   string
+		change func(*ImportProfile)
+		valid  bool
+	}{
+		{
+			name:   "Defaults",
+			change: func(p *ImportProfile) {},
+			valid:  true,
+		},
+		{
+			name:   "Debit and credit",
+			change: func(p *ImportProfile) { p.Sign = SIGN_DEBIT_CREDIT; p.DebitColumn = "Out"; p.CreditColumn = "In" },
+			valid:  true,
+		},
+		{
+			name: "Positions without header",
+			change: func(p *ImportProfile) {
+				p.HasHeader = false
+				p.DateColumn, p.DescriptionColumn, p.AmountColumn = "1", "2", "3"
+			},
+			valid: true,
+		},
+		{
+			name:   "Semicolon",
+			change: func(p *ImportProfile) { p.Delimiter = ";"; p.DecimalSeparator = "," },
+			valid:  true,
+		},
+		{
+			name:   "No bank",
+			change: func(p *ImportProfile) { p.Bank = 0 },
+			valid:  false,
+		},
+		{
+			name:   "No amount column",
+			change: func(p *ImportProfile) { p.AmountColumn = "" },
+			valid:  false,
+		},
+		{
+			name:   "Debit without credit",
+			change: func(p *ImportProfile) { p.Sign = SIGN_DEBIT_CREDIT; p.DebitColumn = "Out" },
+			valid:  false,
+		},
+		{
+			name:   "Unknown sign",
+			change: func(p *ImportProfile) { p.Sign = "inverted" },
+			valid:  false,
+		},
+		{
+			name:   "Names without header",
+			change: func(p *ImportProfile) { p.HasHeader = false },
+			valid:  false,
+		},
+		{
+			name:   "Long delimiter",
+			change: func(p *ImportProfile) { p.Delimiter = ";;" },
+			valid:  false,
+		},
+		{
+			name:   "Decimal separator",
+			change: func(p *ImportProfile) { p.DecimalSeparator = "'" },
+			valid:  false,
+		},
+		{
+			name:   "Date format",
+			change: func(p *ImportProfile) { p.DateFormat = "%d/%m/%Y" },
+			valid:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := base
+			tt.change(&profile)
+			err := checkImportProfile(&profile)
+			if (err == nil) != tt.valid {
+				t.Errorf("checkImportProfile error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	profile := ImportProfile{Bank: 7, Delimiter: ";", HasHeader: true, DateColumn: "Booking date", DescriptionColumn: "Text",
+		AmountColumn: "Amount", Sign: SIGN_NEGATIVE_EXPENSES, DateFormat: "DD.MM.YYYY", DecimalSeparator: ","}
+	statement := "\ufeffBooking date;Text;Amount\n" +
+		"01.03.2021;Salary;2.500,00\n" +
+		"02.03.2021;\"Rent; March\";-1.200,00\n" +
+		"\n" +
+		"31.02.2021;Groceries;-45,10\n" +
+		"04.03.2021;Coffee;abc\n" +
+		"05.03.2021;Refund\n"
+
+	lineitems, rowErrors, err := parseStatement(profile, strings.NewReader(statement))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []LineItem{
+		{Title: "Salary", Amount: 250000, Bank: 7, OccurredOn: "2021-03-01"},
+		{Title: "Rent; March", Amount: -120000, Bank: 7, OccurredOn: "2021-03-02"},
+	}
+	if len(lineitems) != len(want) {
+		t.Fatalf("parseStatement returned %d line items, want %d: %v", len(lineitems), len(want), lineitems)
+	}
+	for i := range want {
+		if lineitems[i] != want[i] {
+			t.Errorf("line item %d = %+v, want %+v", i, lineitems[i], want[i])
+		}
+	}
+
+	rows := []int{5, 6, 7}
+	if len(rowErrors) != len(rows) {
+		t.Fatalf("parseStatement reported %v, want errors on rows %v", rowErrors, rows)
+	}
+	for i, row := range rows {
+		if rowErrors[i].Row != row {
+			t.Errorf("error %d on row %d, want row %d", i, rowErrors[i].Row, row)
+		}
+	}
+}
+
+func TestParseStatementSignConventions(t *testing.T) {
+	tests := []struct {
+		name      string
+		profile   ImportProfile
+		statement string
+		amounts   []Money
+	}{
+		{
+			name:      "Positive expenses",
+			profile:   ImportProfile{DateColumn: "1", DescriptionColumn: "2", AmountColumn: "3", Sign: SIGN_POSITIVE_EXPENSES},
+			statement: "2021-03-01,Coffee,3.50\n2021-03-02,Refund,-10.00\n",
+			amounts:   []Money{-350, 1000},
+		},
+		{
+			name:      "Debit and credit",
+			profile:   ImportProfile{HasHeader: true, DateColumn: "date", DescriptionColumn: "memo", DebitColumn: "debit", CreditColumn: "credit", Sign: SIGN_DEBIT_CREDIT},
+			statement: "Date,Memo,Debit,Credit\n2021-03-01,Coffee,3.50,\n2021-03-02,Salary,,2500.00\n",
+			amounts:   []Money{-350, 250000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := tt.profile
+			profile.Name, profile.Bank = tt.name, 1
+			if err := checkImportProfile(&profile); err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			lineitems, rowErrors, err := parseStatement(profile, strings.NewReader(tt.statement))
+			if err != nil || len(rowErrors) > 0 {
+				t.Fatalf("parseStatement errors %v %v", err, rowErrors)
+			}
+			if len(lineitems) != len(tt.amounts) {
+				t.Fatalf("%d line items, want %d", len(lineitems), len(tt.amounts))
+			}
+			for i, amount := range tt.amounts {
+				if lineitems[i].Amount != amount {
+					t.Errorf("amount %d = %v, want %v", i, lineitems[i].Amount, amount)
+				}
+			}
+		})
+	}
+}
+
+func TestParseStatementMissingColumn(t *testing.T) {
+	profile := ImportProfile{HasHeader: true, DateColumn: "Date", DescriptionColumn: "Payee", AmountColumn: "Amount", DateFormat: "YYYY-MM-DD", Delimiter: ","}
+	if _, _, err := parseStatement(profile, strings.NewReader("Date,Memo,Amount\n")); err == nil {
+		t.Error("parseStatement accepted a statement without the Payee column")
+	}
+}
+
+func TestSplitDuplicates(t *testing.T) {
+	lineitems := []LineItem{
+		{Title: "Salary", FitId: "1"},
+		{Title: "Rent", FitId: "2"},
+		{Title: "Rent again", FitId: "2"},
+		{Title: "Coffee"},
+		{Title: "Coffee"},
+	}
+
+	fresh, duplicates := splitDuplicates(lineitems, map[string]bool{"1": true})
+	if duplicates != 2 {
+		t.Errorf("duplicates = %d, want 2", duplicates)
+	}
+	var titles []string
+	for _, lineitem := range fresh {
+		titles = append(titles, lineitem.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Rent,Coffee,Coffee" {
+		t.Errorf("fresh line items = %s, want Rent,Coffee,Coffee", got)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "interest"
+
+// Interest math on balances as float64 amounts, shared with the interest-is-interesting exercise.
+// Callers round the results to Money.
+var (
+	monthlyRate     = interest.MonthlyRate
+	monthlyInterest = interest.MonthlyInterest
+	monthlyPayment  = interest.MonthlyPayment
+	dailyInterest   = interest.DailyInterest
+	tierRate        = interest.TierRate
+)
+
+// rateTiers returns the interest tiers of a bank, with their minimum balances in cents, for tierRate.
+func rateTiers(tiers []InterestTier) []interest.Tier {
+	rates := make([]interest.Tier, len(tiers))
+	for i, tier := range tiers {
+		rates[i] = interest.Tier{MinBalance: float64(tier.MinBalance), Rate: tier.Rate}
+	}
+	return rates
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+const floatEqualityThreshold = 1e-5
+
+func floatingPointEquals(got, want float64) bool {
+	absoluteDifferenceBelowTreshold := math.Abs(got-want) <= floatEqualityThreshold
+	relativeDifferenceBelowTreshold := math.Abs(got-want)/(math.Abs(got)+math.Abs(want)) <= floatEqualityThreshold
+	return absoluteDifferenceBelowTreshold || relativeDifferenceBelowTreshold
+}
+
+func TestRateTiers(t *testing.T) {
+	rates := rateTiers([]InterestTier{{MinBalance: 0, Rate: 0.5}, {MinBalance: 100000, Rate: 1.621}})
+
+	tests := []struct {
+		name    string
+		balance float64
+		want    float64
+	}{
+		{
+			name:    "Below the second tier",
+			balance: 99999,
+			want:    0.5,
+		},
+		{
+			name:    "Second tier in cents",
+			balance: 100000,
+			want:    1.621,
+		},
+		{
+			name:    "Negative balance",
+			balance: -1,
+			want:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tierRate(rates, tt.balance); !floatingPointEquals(got, tt.want) {
+				t.Errorf("tierRate(%f) = %f, want %f", tt.balance, got, tt.want)
+			}
+		})
+	}
+}
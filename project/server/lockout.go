@@ -0,0 +1,228 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Number of keys after which expired records are swept on every new failure
+const MAX_TRACKED_KEYS = 10000
+
+// Limits applied to failed /authorize attempts
+type LockoutConfig struct {
+	FreeAttempts    int           // failures allowed before any delay is applied
+	BaseDelay       time.Duration // delay after the first delayed failure, doubled on every further failure
+	MaxDelay        time.Duration // upper bound of the delay
+	LockoutAfter    int           // failures after which the key is locked out
+	LockoutDuration time.Duration // how long a lockout lasts
+	Window          time.Duration // failures are forgotten after this long without a new one
+}
+
+func defaultLockoutConfig() LockoutConfig {
+	return LockoutConfig{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+}
+
+// AttemptLimiter tracks failed sign-in attempts per key, a username or a client IP.
+type AttemptLimiter interface {
+	// Wait returns how long the key must wait before its next attempt, 0 if it may try now.
+	Wait(key string) time.Duration
+	// Failure records a failed attempt. Returns true if this failure locked the key out.
+	Failure(key string) bool
+	// Reserve counts an attempt as failed before it is checked, so that concurrent attempts
+	// cannot all get past Wait. Returns how long the key must wait instead, 0 if the attempt
+	// was reserved, and true if the reserved attempt locked the key out.
+	Reserve(key string) (time.Duration, bool)
+	// Release takes back a reserved attempt that did not fail.
+	Release(key string)
+	// Success forgets the failures of the key.
+	Success(key string)
+}
+
+type attemptRecord struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// In-memory AttemptLimiter
+// Counters are local to the server process and reset on restart.
+type MemoryLimiter struct {
+	config  LockoutConfig
+	now     func() time.Time
+	mu      sync.Mutex
+	records map[string]*attemptRecord
+}
+
+func NewMemoryLimiter(config LockoutConfig) *MemoryLimiter {
+	return &MemoryLimiter{
+		config:  config,
+		now:     time.Now,
+		records: map[string]*attemptRecord{},
+	}
+}
+
+// record returns the live record of key, dropping it if it expired.
+// Must be called with the lock held.
+func (l *MemoryLimiter) record(key string) *attemptRecord {
+	rec, ok := l.records[key]
+	if !ok {
+		return nil
+	}
+
+	now := l.now()
+	if !rec.lockedUntil.IsZero() {
+		if now.Before(rec.lockedUntil) {
+			return rec
+		}
+		// Lockout served, start over
+		delete(l.records, key)
+		return nil
+	}
+	if now.Sub(rec.lastFailure) >= l.config.Window {
+		delete(l.records, key)
+		return nil
+	}
+	return rec
+}
+
+// delay is the backoff applied after the given number of failures.
+func (l *MemoryLimiter) delay(failures int) time.Duration {
+	if failures <= l.config.FreeAttempts {
+		return 0
+	}
+	delay := l.config.BaseDelay
+	for i := l.config.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= l.config.MaxDelay {
+			return l.config.MaxDelay
+		}
+	}
+	if delay > l.config.MaxDelay {
+		return l.config.MaxDelay
+	}
+	return delay
+}
+
+func (l *MemoryLimiter) Wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.wait(key)
+}
+
+// wait is Wait, called with the lock held.
+func (l *MemoryLimiter) wait(key string) time.Duration {
+	rec := l.record(key)
+	if rec == nil {
+		return 0
+	}
+
+	now := l.now()
+	if !rec.lockedUntil.IsZero() {
+		return rec.lockedUntil.Sub(now)
+	}
+	if wait := rec.lastFailure.Add(l.delay(rec.failures)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (l *MemoryLimiter) Failure(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.failure(key)
+}
+
+// failure is Failure, called with the lock held.
+func (l *MemoryLimiter) failure(key string) bool {
+	// Keep the map from growing without bound under a spray of usernames
+	if len(l.records) >= MAX_TRACKED_KEYS {
+		for other := range l.records {
+			l.record(other)
+		}
+	}
+
+	rec := l.record(key)
+	if rec == nil {
+		rec = &attemptRecord{}
+		l.records[key] = rec
+	}
+	if !rec.lockedUntil.IsZero() {
+		return false
+	}
+
+	now := l.now()
+	rec.failures++
+	rec.lastFailure = now
+
+	if l.config.LockoutAfter > 0 && rec.failures >= l.config.LockoutAfter {
+		rec.lockedUntil = now.Add(l.config.LockoutDuration)
+		return true
+	}
+	return false
+}
+
+func (l *MemoryLimiter) Reserve(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if wait := l.wait(key); wait > 0 {
+		return wait, false
+	}
+	return 0, l.failure(key)
+}
+
+func (l *MemoryLimiter) Release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec := l.record(key)
+	if rec == nil {
+		return
+	}
+	rec.failures--
+	if rec.failures <= 0 {
+		delete(l.records, key)
+		return
+	}
+	// The released attempt may be the one that locked the key out
+	if rec.failures < l.config.LockoutAfter {
+		rec.lockedUntil = time.Time{}
+	}
+}
+
+func (l *MemoryLimiter) Success(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.records, key)
+}
+
+// clientIP returns the address of the client connection, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfter formats a wait as the whole number of seconds of a Retry-After header.
+func retryAfter(wait time.Duration) string {
+	seconds := int(wait / time.Second)
+	if wait%time.Second != 0 {
+		seconds++
+	}
+	return strconv.Itoa(seconds)
+}
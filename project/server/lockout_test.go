@@ -0,0 +1,283 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for MemoryLimiter
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestLimiter() (*MemoryLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := NewMemoryLimiter(LockoutConfig{
+		FreeAttempts:    2,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockoutAfter:    8,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	})
+	limiter.now = clock.Now
+	return limiter, clock
+}
+
+func TestMemoryLimiterBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{
+			name:     "No failures",
+			failures: 0,
+			want:     0,
+		},
+		{
+			name:     "Failures within free attempts",
+			failures: 2,
+			want:     0,
+		},
+		{
+			name:     "First delayed failure",
+			failures: 3,
+			want:     time.Second,
+		},
+		{
+			name:     "Delay doubles",
+			failures: 4,
+			want:     2 * time.Second,
+		},
+		{
+			name:     "Delay doubles again",
+			failures: 5,
+			want:     4 * time.Second,
+		},
+		{
+			name:     "Delay capped at maximum",
+			failures: 7,
+			want:     10 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, _ := newTestLimiter()
+			for i := 0; i < tt.failures; i++ {
+				limiter.Failure("user:alice")
+			}
+			if got := limiter.Wait("user:alice"); got != tt.want {
+				t.Errorf("Wait() after %d failures = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterWaitElapses(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	for i := 0; i < 4; i++ {
+		limiter.Failure("user:alice")
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	if got, want := limiter.Wait("user:alice"), 500*time.Millisecond; got != want {
+		t.Errorf("Wait() = %v, want %v", got, want)
+	}
+
+	clock.Advance(time.Second)
+	if got := limiter.Wait("user:alice"); got != 0 {
+		t.Errorf("Wait() after delay elapsed = %v, want 0", got)
+	}
+}
+
+func TestMemoryLimiterLockout(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	for i := 1; i < 8; i++ {
+		if limiter.Failure("ip:10.0.0.1") {
+			t.Fatalf("Failure() locked out after %d failures, want lockout after 8", i)
+		}
+	}
+	if !limiter.Failure("ip:10.0.0.1") {
+		t.Fatal("Failure() did not report the lockout on the 8th failure")
+	}
+	if limiter.Failure("ip:10.0.0.1") {
+		t.Error("Failure() reported the lockout again while already locked out")
+	}
+
+	if got, want := limiter.Wait("ip:10.0.0.1"), 15*time.Minute; got != want {
+		t.Errorf("Wait() while locked out = %v, want %v", got, want)
+	}
+
+	clock.Advance(15 * time.Minute)
+	if got := limiter.Wait("ip:10.0.0.1"); got != 0 {
+		t.Errorf("Wait() after lockout = %v, want 0", got)
+	}
+	if limiter.Failure("ip:10.0.0.1") {
+		t.Error("Failure() after lockout did not start counting over")
+	}
+}
+
+func TestMemoryLimiterKeysAreIndependent(t *testing.T) {
+	limiter, _ := newTestLimiter()
+	for i := 0; i < 5; i++ {
+		limiter.Failure("user:alice")
+	}
+	if got := limiter.Wait("user:bob"); got != 0 {
+		t.Errorf("Wait() for another key = %v, want 0", got)
+	}
+}
+
+func TestMemoryLimiterSuccessResets(t *testing.T) {
+	limiter, _ := newTestLimiter()
+	for i := 0; i < 5; i++ {
+		limiter.Failure("user:alice")
+	}
+	limiter.Success("user:alice")
+	if got := limiter.Wait("user:alice"); got != 0 {
+		t.Errorf("Wait() after success = %v, want 0", got)
+	}
+}
+
+func TestMemoryLimiterWindowForgets(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	for i := 0; i < 5; i++ {
+		limiter.Failure("user:alice")
+	}
+	clock.Advance(time.Hour)
+	limiter.Failure("user:alice")
+	if got := limiter.Wait("user:alice"); got != 0 {
+		t.Errorf("Wait() for a single failure after the window = %v, want 0", got)
+	}
+}
+
+func TestMemoryLimiterConcurrentReserve(t *testing.T) {
+	limiter, _ := newTestLimiter()
+
+	// Failed attempts in parallel, none of them done before the others are reserved
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	reserved := make(chan bool, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			wait, _ := limiter.Reserve("user:alice")
+			reserved <- wait == 0
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(reserved)
+
+	count := 0
+	for ok := range reserved {
+		if ok {
+			count++
+		}
+	}
+	if count != 3 {
+		t.Errorf("Reserve() let %d parallel attempts through, want 3", count)
+	}
+	if got := limiter.Wait("user:alice"); got != time.Second {
+		t.Errorf("Wait() after the parallel attempts = %v, want %v", got, time.Second)
+	}
+}
+
+func TestMemoryLimiterReserveLockout(t *testing.T) {
+	limiter, clock := newTestLimiter()
+	for i := 1; i < 8; i++ {
+		clock.Advance(time.Minute)
+		if _, locked := limiter.Reserve("ip:10.0.0.1"); locked {
+			t.Fatalf("Reserve() locked out after %d attempts, want lockout after 8", i)
+		}
+	}
+	clock.Advance(time.Minute)
+	if _, locked := limiter.Reserve("ip:10.0.0.1"); !locked {
+		t.Fatal("Reserve() did not report the lockout on the 8th attempt")
+	}
+	if got, want := limiter.Wait("ip:10.0.0.1"), 15*time.Minute; got != want {
+		t.Errorf("Wait() while locked out = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryLimiterRelease(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{
+			name:     "Only attempt",
+			failures: 0,
+			want:     0,
+		},
+		{
+			name:     "After delayed failures",
+			failures: 3,
+			want:     time.Second,
+		},
+		{
+			name:     "Attempt that locked out",
+			failures: 7,
+			want:     10 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, clock := newTestLimiter()
+			for i := 0; i < tt.failures; i++ {
+				limiter.Failure("user:alice")
+			}
+			clock.Advance(time.Minute)
+			if wait, _ := limiter.Reserve("user:alice"); wait != 0 {
+				t.Fatalf("Reserve() wait = %v, want 0", wait)
+			}
+			limiter.Release("user:alice")
+			if got := limiter.Wait("user:alice"); got != tt.want {
+				t.Errorf("Wait() after releasing = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		wait time.Duration
+		want string
+	}{
+		{
+			name: "Whole seconds",
+			wait: 4 * time.Second,
+			want: "4",
+		},
+		{
+			name: "Rounded up",
+			wait: 1500 * time.Millisecond,
+			want: "2",
+		},
+		{
+			name: "Below a second",
+			wait: time.Millisecond,
+			want: "1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.wait); got != tt.want {
+				t.Errorf("retryAfter(%v) = %q, want %q", tt.wait, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,83 +3,163 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// The PIN is never part of a UserAccount, so it can not leak into a response
 type UserAccount struct {
-	Id       int    `json:"id" bson:"id"`
-	Username string `json:"username" bson:"username"`
-	Name     string `json:"name" bson:"name"`
-	Pin      int    `json:"pin" bson:"pin"`
+	Id        int       `json:"id" bson:"id"`
+	Username  string    `json:"username" bson:"username"`
+	Name      string    `json:"name" bson:"name"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
 }
 
+// Payload for creating a user account
+type UserAccountRequest struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Pin      int    `json:"pin"`
+}
+
+// Payload for changing the PIN of a user account
+type PinChange struct {
+	OldPin int `json:"old_pin"`
+	NewPin int `json:"new_pin"`
+}
+
+// Currency is the ISO 4217 code of the amounts recorded against the account.
+// OpeningBalance is the balance at the start of OpeningDate; line items before that date are part of it.
+// Balance is computed: the opening balance plus the line items up to today.
 type BankAccount struct {
-	Id    int    `json:"id" bson:"id"`
-	Name  string `json:"name" bson:"name"`
-	Owner int    `json:"ownerid" bson:"ownerid"`
+	Id             int       `json:"id" bson:"id"`
+	Name           string    `json:"name" bson:"name"`
+	Owner          int       `json:"ownerid" bson:"ownerid"`
+	Currency       string    `json:"currency" bson:"currency"`
+	AccountType    string    `json:"account_type" bson:"account_type"`
+	OpeningBalance Money     `json:"opening_balance" bson:"opening_balance"`
+	OpeningDate    string    `json:"opening_date,omitempty" bson:"opening_date"`
+	Balance        Money     `json:"balance" bson:"balance"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" bson:"updated_at"`
 }
 
+// Budget is null for a bucket without a budget
 type Bucket struct {
-	Id    int    `json:"id" bson:"id"`
-	Name  string `json:"name" bson:"name"`
-	Owner int    `json:"ownerid" bson:"ownerid"`
+	Id        int       `json:"id" bson:"id"`
+	Name      string    `json:"name" bson:"name"`
+	Owner     int       `json:"ownerid" bson:"ownerid"`
+	Budget    *Budget   `json:"budget" bson:"budget"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
 }
 
+// Amount is negative for an expense and positive for income, in the currency of the Bank.
+// OccurredOn is the date the expense or income took place (YYYY-MM-DD),
+// CreatedAt and UpdatedAt when the entry was recorded and last changed.
+// Transfer is the id of the Transfer the line item is one side of, 0 for regular line items.
+// Status is uncleared, cleared once it appeared on a statement, or reconciled: locked by Reconciliation.
 type LineItem struct {
-	Id          int     `json:"id" bson:"id"`
-	Title       string  `json:"title" bson:"title"`
-	Description string  `json:"description" bson:"description"`
-	Amount      float64 `json:"amount" bson:"amount"`
-	Bucket      int     `json:"bucket" bson:"bucket"`
-	Bank        int     `json:"bank" bson:"bank"`
-	Owner       int     `json:"ownerid" bson:"ownerid"`
+	Id             int       `json:"id" bson:"id"`
+	Title          string    `json:"title" bson:"title"`
+	Description    string    `json:"description" bson:"description"`
+	Amount         Money     `json:"amount" bson:"amount"`
+	Bucket         int       `json:"bucket" bson:"bucket"`
+	Bank           int       `json:"bank" bson:"bank"`
+	Owner          int       `json:"ownerid" bson:"ownerid"`
+	OccurredOn     string    `json:"occurred_on" bson:"occurred_on"`
+	Transfer       int       `json:"transfer" bson:"transfer"`
+	FitId          string    `json:"fitid,omitempty" bson:"fitid"`
+	Status         string    `json:"status" bson:"status"`
+	Reconciliation int       `json:"reconciliation,omitempty" bson:"reconciliation"`
+	CreatedAt      time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" bson:"updated_at"`
 }
 
-const (
-	DB_USER     = "admin"
-	DB_PASSWORD = "admin"
-	DB_NAME     = "goproject"
-)
-
+// Loggers write to stderr until setupLogging points them to the configured destination
 var (
-	WarningLogger *log.Logger
-	InfoLogger    *log.Logger
-	ErrorLogger   *log.Logger
+	WarningLogger = log.New(os.Stderr, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
+	InfoLogger    = log.New(os.Stderr, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
+	ErrorLogger   = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
 )
 
-func db_init() *sql.DB {
-	conn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", "db", 5432, DB_USER, DB_PASSWORD, DB_NAME)
-	db, err := sql.Open("postgres", conn)
+// Connection pool shared by all requests
+var db *sql.DB
+
+// Failed /authorize attempts, per username and per client IP
+var loginLimiter AttemptLimiter
+
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a file of NAME=value settings")
+	flag.Parse()
 
+	config, err := loadConfig(*configFile)
 	if err != nil {
-		log.Fatal("Failed to connect to the database.")
+		log.Fatal(err)
+	}
+	if err := setupLogging(config); err != nil {
+		log.Fatal(err)
 	}
 
-	fmt.Println("Connected to Database!")
-
-	return db
-}
+	InfoLogger.Println("Starting the application...")
+	loadTokenSecret(config.TokenSecret)
+	loginLimiter = NewMemoryLimiter(config.Lockout)
 
-func init() {
-	file, err := os.OpenFile("logs.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	db, err = openDatabase(config)
 	if err != nil {
+		ErrorLogger.Println(err.Error())
 		log.Fatal(err)
 	}
+	defer db.Close()
+	InfoLogger.Println("Connected to Database!")
+
+	// server migrate [up | down [steps] | status]
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrateCommand(db, flag.Args()[1:]); err != nil {
+			ErrorLogger.Println(err.Error())
+			log.Fatal(err)
+		}
+		return
+	} else if flag.NArg() > 0 {
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
 
-	InfoLogger = log.New(file, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	WarningLogger = log.New(file, "WARNING: ", log.Ldate|log.Ltime|log.Lshortfile)
-	ErrorLogger = log.New(file, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-}
+	if config.MigrateOnStart {
+		if err := runMigrateCommand(db, []string{"up"}); err != nil {
+			ErrorLogger.Println(err.Error())
+			log.Fatal(err)
+		}
+	}
 
-func main() {
-	InfoLogger.Println("Starting the application...")
-	http.ListenAndServe(":9000", handler())
+	if err := hashLegacyPins(db); err != nil {
+		ErrorLogger.Println("Failed to hash existing PINs. " + err.Error())
+	}
+
+	if config.SchedulerInterval > 0 {
+		go runScheduler(config.SchedulerInterval)
+	}
+
+	server := &http.Server{
+		Addr:         config.ListenAddr,
+		Handler:      handler(),
+		ReadTimeout:  config.HTTPReadTimeout,
+		WriteTimeout: config.HTTPWriteTimeout,
+		IdleTimeout:  config.HTTPIdleTimeout,
+	}
+	InfoLogger.Println("Handler Listening at " + config.ListenAddr + " ...")
+	if err := server.ListenAndServe(); err != nil {
+		ErrorLogger.Println(err.Error())
+		log.Fatal(err)
+	}
 }
 
 func checkError(err error) {
@@ -88,53 +168,173 @@ func checkError(err error) {
 	}
 }
 
+// isForeignKeyViolation reports whether err is Postgres refusing to delete a row still referenced.
+func isForeignKeyViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23503"
+}
+
 func handler() http.HandlerFunc {
-	InfoLogger.Println("Handler Listening at :9000 ...")
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Public endpoints: signing in, refreshing a session and creating a new user account
+		if r.URL.Path == "/authorize" {
+			authorize(w, r)
+			return
+		} else if r.URL.Path == "/refresh" {
+			refresh(w, r)
+			return
+		} else if r.URL.Path == "/users" && r.Method == "POST" {
+			userProcess(0, w, r)
+			return
+		}
+
+		// Every other endpoint is scoped to the user making the request
+		owner, ok := authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer realm=\"monefy\"")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			WarningLogger.Println("Unauthenticated request to " + r.URL.Path + ". Ignoring request...")
+			return
+		}
+
 		var id int
-		if r.URL.Path == "/users" {
-			userProcess(w, r)
+		if r.URL.Path == "/logout" {
+			logout(owner, w, r)
+		} else if r.URL.Path == "/users" {
+			userProcess(owner, w, r)
 		} else if r.URL.Path == "/banks" {
-			bankProcess(w, r)
+			bankProcess(owner, w, r)
 		} else if r.URL.Path == "/buckets" {
-			bucketProcess(w, r)
+			bucketProcess(owner, w, r)
 		} else if r.URL.Path == "/lineitems" {
-			lineitemProcess(w, r)
-		} else if r.URL.Path == "/authorize" {
-			authorize(w, r)
+			lineitemProcess(owner, w, r)
+		} else if r.URL.Path == "/transfers" {
+			transferProcess(owner, w, r)
+		} else if r.URL.Path == "/allocations" {
+			allocationProcess(owner, w, r)
+		} else if r.URL.Path == "/envelopes" {
+			envelopeProcess(owner, w, r)
+		} else if r.URL.Path == "/envelopes/close" {
+			envelopeCloseProcess(owner, w, r)
+		} else if r.URL.Path == "/recurring" {
+			recurringProcess(owner, w, r)
+		} else if r.URL.Path == "/importprofiles" {
+			importProfileProcess(owner, w, r)
+		} else if r.URL.Path == "/import/csv" {
+			importCSVProcess(owner, w, r)
+		} else if r.URL.Path == "/import/ofx" {
+			importOFXProcess(owner, w, r)
+		} else if r.URL.Path == "/import/qif" {
+			importQIFProcess(owner, w, r)
+		} else if r.URL.Path == "/import/json" {
+			importJSONProcess(owner, w, r)
+		} else if r.URL.Path == "/duplicates" {
+			duplicateProcess(owner, w, r)
+		} else if r.URL.Path == "/duplicates/check" {
+			duplicateCheckProcess(owner, w, r)
+		} else if r.URL.Path == "/duplicates/review" {
+			duplicateReviewProcess(owner, w, r)
+		} else if r.URL.Path == "/export" {
+			exportProcess(owner, w, r)
+		} else if r.URL.Path == "/reconciliations" {
+			reconciliationProcess(owner, w, r)
+		} else if r.URL.Path == "/audit" {
+			auditProcess(owner, w, r)
+		} else if r.URL.Path == "/reports/income-expense" || r.URL.Path == "/reports/buckets" || r.URL.Path == "/reports/payees" ||
+			r.URL.Path == "/reports/cashflow" || r.URL.Path == "/reports/compare" {
+			reportProcess(owner, w, r)
+		} else if r.URL.Path == "/forecast" {
+			forecastProcess(owner, w, r)
+		} else if r.URL.Path == "/networth" {
+			netWorthProcess(owner, w, r)
+		} else if r.URL.Path == "/networth/history" {
+			netWorthHistoryProcess(owner, w, r)
+		} else if r.URL.Path == "/networth/rebuild" {
+			netWorthRebuildProcess(owner, w, r)
+		} else if r.URL.Path == "/goals" {
+			goalProcess(owner, w, r)
+		} else if r.URL.Path == "/debts" {
+			debtProcess(owner, w, r)
+		} else if matchId(r.URL.Path, "/user/%d/pin", &id) {
+			userPinProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/buckets/%d/status", &id) || matchId(r.URL.Path, "/bucket/%d/status", &id) {
+			bucketStatusProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/banks/%d/balance", &id) || matchId(r.URL.Path, "/bank/%d/balance", &id) {
+			bankBalanceProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/banks/%d/interest", &id) || matchId(r.URL.Path, "/bank/%d/interest", &id) {
+			bankInterestProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/banks/%d/interest/preview", &id) || matchId(r.URL.Path, "/bank/%d/interest/preview", &id) {
+			bankInterestPreviewProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/banks/%d/lineitems", &id) || matchId(r.URL.Path, "/bank/%d/lineitems", &id) {
+			bankLineItemsProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/lineitem/%d/status", &id) {
+			lineitemStatusProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/reconciliation/%d/finish", &id) {
+			reconciliationFinishProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/reconciliation/%d/unlock", &id) {
+			reconciliationUnlockProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/recurring/%d/preview", &id) {
+			recurringPreviewProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/recurring/%d/skip", &id) {
+			recurringSkipProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/debt/%d/schedule", &id) {
+			debtScheduleProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/debt/%d/payoff", &id) {
+			debtPayoffProcess(owner, id, w, r)
+		} else if matchId(r.URL.Path, "/debt/%d/payments", &id) {
+			debtPaymentProcess(owner, id, w, r)
 		} else if n, _ := fmt.Sscanf(r.URL.Path, "/user/%d", &id); n == 1 {
-			userProcessId(id, w, r)
+			userProcessId(owner, id, w, r)
 		} else if n, _ := fmt.Sscanf(r.URL.Path, "/bank/%d", &id); n == 1 {
-			bankProcessId(id, w, r)
+			bankProcessId(owner, id, w, r)
 		} else if n, _ := fmt.Sscanf(r.URL.Path, "/bucket/%d", &id); n == 1 {
-			bucketProcessId(id, w, r)
+			bucketProcessId(owner, id, w, r)
 		} else if n, _ := fmt.Sscanf(r.URL.Path, "/lineitem/%d", &id); n == 1 {
-			lineitemProcessId(id, w, r)
+			lineitemProcessId(owner, id, w, r)
+		} else if n, _ := fmt.Sscanf(r.URL.Path, "/transfer/%d", &id); n == 1 {
+			transferProcessId(owner, id, w, r)
+		} else if n, _ := fmt.Sscanf(r.URL.Path, "/allocation/%d", &id); n == 1 {
+			allocationProcessId(owner, id, w, r)
+		} else if n, _ := fmt.Sscanf(r.URL.Path, "/recurring/%d", &id); n == 1 {
+			recurringProcessId(owner, id, w, r)
+		} else if n, _ := fmt.Sscanf(r.URL.Path, "/importprofile/%d", &id); n == 1 {
+			importProfileProcessId(owner, id, w, r)
+		} else if n, _ := fmt.Sscanf(r.URL.Path, "/reconciliation/%d", &id); n == 1 {
+			reconciliationProcessId(owner, id, w, r)
+		} else if n, _ := fmt.Sscanf(r.URL.Path, "/goal/%d", &id); n == 1 {
+			goalProcessId(owner, id, w, r)
+		} else if n, _ := fmt.Sscanf(r.URL.Path, "/debt/%d", &id); n == 1 {
+			debtProcessId(owner, id, w, r)
 		}
 	}
 }
 
-func userProcess(w http.ResponseWriter, r *http.Request) {
+// matchId reports whether path matches pattern, a path with a single %d, and stores the id.
+// The whole path must match, so "/user/%d/pin" does not match "/user/1".
+func matchId(path string, pattern string, id *int) bool {
+	if _, err := fmt.Sscanf(path, pattern, id); err != nil {
+		return false
+	}
+	return fmt.Sprintf(pattern, *id) == path
+}
+
+func userProcess(owner int, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	switch r.Method {
 	case "POST":
-		db := db_init()
-		defer db.Close()
-
-		var user UserAccount
-		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		var request UserAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		var newUserId int
-		err := db.QueryRow(
-			"INSERT INTO public.useraccount (username, \"name\", pin) VALUES($1, $2, $3) RETURNING id;",
-			user.Username,
-			user.Name,
-			user.Pin,
-		).Scan(&newUserId)
+		user, err := scanUser(db.QueryRow(
+			"INSERT INTO public.useraccount (username, \"name\", pin_hash) VALUES($1, $2, $3) RETURNING "+USER_COLUMNS+";",
+			request.Username,
+			request.Name,
+			hashPin(request.Pin),
+		))
 
 		InfoLogger.Println("New User Created.")
 
@@ -153,8 +353,6 @@ func userProcess(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		user.Id = newUserId
-
 		if err := json.NewEncoder(w).Encode(user); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
@@ -162,27 +360,20 @@ func userProcess(w http.ResponseWriter, r *http.Request) {
 		}
 
 	case "GET":
-		db := db_init()
-		defer db.Close()
-
-		rows, err := db.Query("SELECT id, username, \"name\", pin FROM public.useraccount;")
-
-		checkError(err)
+		rows, err := db.Query("SELECT "+USER_COLUMNS+" FROM public.useraccount WHERE id=$1;", owner)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
 
 		var users []UserAccount
 		for rows.Next() {
-			var id, pin int
-			var username, name string
-
-			err = rows.Scan(&id, &username, &name, &pin)
+			user, err := scanUser(rows)
 			checkError(err)
 
-			users = append(users, UserAccount{
-				Id:       id,
-				Username: username,
-				Name:     name,
-				Pin:      pin,
-			})
+			users = append(users, user)
 		}
 		InfoLogger.Println("Retrieved User Account List.")
 		if err := json.NewEncoder(w).Encode(users); err != nil {
@@ -202,31 +393,32 @@ func userProcess(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func userProcessId(id int, w http.ResponseWriter, r *http.Request) {
+func userProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	switch r.Method {
-	case "GET":
-		db := db_init()
-		defer db.Close()
 
-		rows, err := db.Query("SELECT id, username, \"name\", pin FROM public.useraccount WHERE id=$1;", id)
+	// Users can only see and manage their own account
+	if id != owner {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		WarningLogger.Println("Access to another user account denied. Ignoring request...")
+		return
+	}
 
-		checkError(err)
+	switch r.Method {
+	case "GET":
+		rows, err := db.Query("SELECT "+USER_COLUMNS+" FROM public.useraccount WHERE id=$1;", id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
 
 		var users []UserAccount
 		for rows.Next() {
-			var id, pin int
-			var username, name string
-
-			err = rows.Scan(&id, &username, &name, &pin)
+			user, err := scanUser(rows)
 			checkError(err)
 
-			users = append(users, UserAccount{
-				Id:       id,
-				Username: username,
-				Name:     name,
-				Pin:      pin,
-			})
+			users = append(users, user)
 		}
 		InfoLogger.Println("Retrieved Information on specific user.")
 		if users == nil || len(users) < 1 {
@@ -245,28 +437,24 @@ func userProcessId(id int, w http.ResponseWriter, r *http.Request) {
 		WarningLogger.Println("Invalid Operation Requested. Ignoring request...")
 		return
 	case "PUT":
-		db := db_init()
-		defer db.Close()
-
-		var user UserAccount
-		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		var request UserAccount
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
 		}
 
-		var updatedId int
-		err := db.QueryRow(
-			"UPDATE public.useraccount SET username=$1, \"name\"=$2, pin=$3 WHERE id=$4 RETURNING id;",
-			user.Username,
-			user.Name,
-			user.Pin,
+		user, err := scanUser(db.QueryRow(
+			"UPDATE public.useraccount SET username=$1, \"name\"=$2 WHERE id=$3 RETURNING "+USER_COLUMNS+";",
+			request.Username,
+			request.Name,
 			id,
-		).Scan(&updatedId)
-
-		user.Id = id
-
-		checkError(err)
+		))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
 		InfoLogger.Println("Updated Information of a specific user.")
 
 		if err := json.NewEncoder(w).Encode(user); err != nil {
@@ -275,16 +463,7 @@ func userProcessId(id int, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	case "DELETE":
-		db := db_init()
-		defer db.Close()
-
-		var user UserAccount
-		err := db.QueryRow("DELETE FROM public.useraccount where id = $1 RETURNING id, username, \"name\", pin;", id).Scan(
-			&user.Id,
-			&user.Username,
-			&user.Name,
-			&user.Pin,
-		)
+		user, err := scanUser(db.QueryRow("DELETE FROM public.useraccount where id = $1 RETURNING "+USER_COLUMNS+";", id))
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -301,61 +480,80 @@ func userProcessId(id int, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func bankProcess(w http.ResponseWriter, r *http.Request) {
+func bankProcess(owner int, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case "POST":
-		db := db_init()
-		defer db.Close()
-
-		var bank BankAccount
-		if err := json.NewDecoder(r.Body).Decode(&bank); err != nil {
+		var request BankAccount
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
 		}
 
-		var newBankId int
-		err := db.QueryRow(
-			"INSERT INTO public.bankaccount (\"name\", ownerid) VALUES($1, $2) RETURNING id;",
-			bank.Name,
-			bank.Owner,
-		).Scan(&newBankId)
+		currency, err := normalizeCurrency(request.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		accountType, err := checkAccountType(request.AccountType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.OpeningDate != "" {
+			if _, err := parseDate(request.OpeningDate); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
-		checkError(err)
+		bank, err := scanBankAccount(db.QueryRow(
+			"INSERT INTO public.bankaccount (\"name\", ownerid, currency, account_type, opening_balance, opening_date) VALUES($1, $2, $3, $4, $5, $6) RETURNING "+BANK_COLUMNS+";",
+			request.Name,
+			owner,
+			currency,
+			accountType,
+			request.OpeningBalance,
+			nullDate(request.OpeningDate),
+		))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
 		InfoLogger.Println("New Bank Created.")
 
-		bank.Id = newBankId
-
 		if err := json.NewEncoder(w).Encode(bank); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
 		}
 	case "GET":
-		db := db_init()
-		defer db.Close()
-
-		rows, err := db.Query("SELECT id, \"name\", ownerid FROM public.bankaccount;")
+		options, err := parseListOptions(r.URL.Query(), BANK_SORT_FIELDS, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		checkError(err)
+		rows, total, err := queryPage("bankaccount", BANK_COLUMNS, nameFilter(owner, r.URL.Query()), options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
 
-		var accounts []BankAccount
+		var banks []BankAccount
 		for rows.Next() {
-			var id, owner int
-			var name string
-
-			err = rows.Scan(&id, &name, &owner)
+			bank, err := scanBankAccount(rows)
 			checkError(err)
 
-			accounts = append(accounts, BankAccount{
-				Id:    id,
-				Name:  name,
-				Owner: owner,
-			})
+			banks = append(banks, bank)
 		}
 		InfoLogger.Println("Bank Information Retrieved.")
-		if err := json.NewEncoder(w).Encode(accounts); err != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if err := json.NewEncoder(w).Encode(banks); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
@@ -371,30 +569,24 @@ func bankProcess(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func bankProcessId(id int, w http.ResponseWriter, r *http.Request) {
+func bankProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case "GET":
-		db := db_init()
-		defer db.Close()
-
-		rows, err := db.Query("SELECT id, \"name\", ownerid FROM public.bankaccount WHERE id=$1;", id)
-
-		checkError(err)
+		rows, err := db.Query("SELECT "+BANK_COLUMNS+" FROM public.bankaccount WHERE id=$1 AND ownerid=$2;", id, owner)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
 
 		var banks []BankAccount
 		for rows.Next() {
-			var id, ownerid int
-			var name string
-
-			err = rows.Scan(&id, &name, &ownerid)
+			bank, err := scanBankAccount(rows)
 			checkError(err)
 
-			banks = append(banks, BankAccount{
-				Id:    id,
-				Name:  name,
-				Owner: ownerid,
-			})
+			banks = append(banks, bank)
 		}
 		InfoLogger.Println("Bank Information Retrieved.")
 		if banks == nil || len(banks) < 1 {
@@ -413,25 +605,94 @@ func bankProcessId(id int, w http.ResponseWriter, r *http.Request) {
 		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
 		return
 	case "PUT":
-		db := db_init()
-		defer db.Close()
-
-		var bank BankAccount
-		if err := json.NewDecoder(r.Body).Decode(&bank); err != nil {
+		var request BankAccount
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		var updatedId int
-		err := db.QueryRow(
-			"UPDATE public.bankaccount SET \"name\"=$1 WHERE id=$2 RETURNING id;",
-			bank.Name,
-			id,
-		).Scan(&updatedId)
+		// An empty currency keeps the currency the account already has
+		var currency interface{}
+		if request.Currency != "" {
+			code, err := normalizeCurrency(request.Currency)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			currency = code
+
+			// The amounts of the line items are in the currency of the account
+			var current string
+			var used bool
+			err = db.QueryRow(
+				"SELECT currency, EXISTS (SELECT 1 FROM public.lineitem WHERE bank=$1) FROM public.bankaccount WHERE id=$1 AND ownerid=$2;",
+				id,
+				owner,
+			).Scan(&current, &used)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Not Found!", http.StatusNotFound)
+				ErrorLogger.Println("Bank Information Empty/Not Found.")
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				ErrorLogger.Println("Internal Error Occured. " + err.Error())
+				return
+			}
+			if code != current && used {
+				http.Error(w, "Currency can not be changed, the bank already has line items.", http.StatusConflict)
+				WarningLogger.Println("Bank currency change rejected, the bank has line items.")
+				return
+			}
+		}
 
-		checkError(err)
+		// An empty account type keeps the type the account already has; interest stops accruing
+		// on an account that is no longer a savings account
+		var accountType interface{}
+		if request.AccountType != "" {
+			code, err := checkAccountType(request.AccountType)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			accountType = code
+		}
 
-		bank.Id = id
+		// An empty opening date keeps the opening balance and date the account already has
+		var openingBalance interface{}
+		if request.OpeningDate != "" {
+			if _, err := parseDate(request.OpeningDate); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			openingBalance = request.OpeningBalance
+		}
+
+		bank, err := scanBankAccount(db.QueryRow(
+			`UPDATE public.bankaccount SET "name"=$1, currency=coalesce($2, currency),
+			opening_balance=coalesce($3, opening_balance), opening_date=coalesce($4, opening_date),
+			account_type=coalesce($7, account_type),
+			interest_start=CASE WHEN coalesce($7, account_type) = 'savings' THEN interest_start END
+			WHERE id=$5 AND ownerid=$6 RETURNING `+BANK_COLUMNS+";",
+			request.Name,
+			currency,
+			openingBalance,
+			nullDate(request.OpeningDate),
+			id,
+			owner,
+			accountType,
+		))
+
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bank Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
 		InfoLogger.Println("Bank Information Updated.")
 
 		if err := json.NewEncoder(w).Encode(bank); err != nil {
@@ -440,16 +701,35 @@ func bankProcessId(id int, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	case "DELETE":
-		db := db_init()
-		defer db.Close()
+		if !ownsRecord(db, "bankaccount", id, owner) {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bank Information Empty/Not Found.")
+			return
+		}
+		uses, err := bankReferences(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		if uses != "" {
+			http.Error(w, "Bank is still used by "+uses+", delete them first.", http.StatusConflict)
+			WarningLogger.Println("Bank deletion rejected, the bank is still in use.")
+			return
+		}
 
-		var bank BankAccount
-		err := db.QueryRow("DELETE FROM public.bankaccount where id = $1 RETURNING id,\"name\", ownerid;", id).Scan(
-			&bank.Id,
-			&bank.Name,
-			&bank.Owner,
-		)
+		bank, err := scanBankAccount(db.QueryRow("DELETE FROM public.bankaccount where id = $1 AND ownerid = $2 RETURNING "+BANK_COLUMNS+";", id, owner))
 
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bank Information Empty/Not Found.")
+			return
+		}
+		if isForeignKeyViolation(err) {
+			http.Error(w, "Bank is still in use, delete what refers to it first.", http.StatusConflict)
+			WarningLogger.Println("Bank deletion rejected, the bank is still in use.")
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
@@ -465,60 +745,133 @@ func bankProcessId(id int, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func bucketProcess(w http.ResponseWriter, r *http.Request) {
+// bankReferences lists what still refers to a bank account, as "12 line items, 2 transfers", empty if nothing does.
+// Line items have no foreign key to their bank, so deleting it would silently leave them pointing at nothing,
+// its import profiles, reconciliations, goals and interest tiers would be deleted with it, and its debts unlinked.
+func bankReferences(id int) (string, error) {
+	var lineitems, transfers, recurring, profiles, reconciliations, goals, debts, tiers int
+	err := db.QueryRow(
+		`SELECT (SELECT count(*) FROM public.lineitem WHERE bank = $1),
+		(SELECT count(*) FROM public.transfer WHERE from_bank = $1 OR to_bank = $1),
+		(SELECT count(*) FROM public.recurring WHERE bank = $1),
+		(SELECT count(*) FROM public.importprofile WHERE bank = $1),
+		(SELECT count(*) FROM public.reconciliation WHERE bank = $1),
+		(SELECT count(*) FROM public.goal WHERE bank = $1),
+		(SELECT count(*) FROM public.debt WHERE bank = $1),
+		(SELECT count(*) FROM public.interesttier WHERE bank = $1);`,
+		id,
+	).Scan(&lineitems, &transfers, &recurring, &profiles, &reconciliations, &goals, &debts, &tiers)
+	if err != nil {
+		return "", err
+	}
+
+	var uses references
+	uses.count(lineitems, "line item", "line items")
+	uses.count(transfers, "transfer", "transfers")
+	uses.count(recurring, "recurring template", "recurring templates")
+	uses.count(profiles, "import profile", "import profiles")
+	uses.count(reconciliations, "reconciliation", "reconciliations")
+	uses.count(goals, "goal", "goals")
+	uses.count(debts, "debt", "debts")
+	uses.count(tiers, "interest tier", "interest tiers")
+	return uses.String(), nil
+}
+
+// bucketReferences lists what still refers to a bucket, like bankReferences.
+func bucketReferences(id int) (string, error) {
+	var lineitems, recurring, goals, debts int
+	err := db.QueryRow(
+		`SELECT (SELECT count(*) FROM public.lineitem WHERE bucket = $1),
+		(SELECT count(*) FROM public.recurring WHERE bucket = $1),
+		(SELECT count(*) FROM public.goal WHERE bucket = $1),
+		(SELECT count(*) FROM public.debt WHERE bucket = $1);`,
+		id,
+	).Scan(&lineitems, &recurring, &goals, &debts)
+	if err != nil {
+		return "", err
+	}
+
+	var uses references
+	uses.count(lineitems, "line item", "line items")
+	uses.count(recurring, "recurring template", "recurring templates")
+	uses.count(goals, "goal", "goals")
+	uses.count(debts, "debt", "debts")
+	return uses.String(), nil
+}
+
+// Counts of the records referring to another one, for the message refusing to delete it
+type references []string
+
+func (r *references) count(n int, one string, many string) {
+	if n == 1 {
+		*r = append(*r, "1 "+one)
+	} else if n > 1 {
+		*r = append(*r, strconv.Itoa(n)+" "+many)
+	}
+}
+
+func (r references) String() string {
+	return strings.Join(r, ", ")
+}
+
+func bucketProcess(owner int, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case "POST":
-		db := db_init()
-		defer db.Close()
-
-		var bucket Bucket
-		if err := json.NewDecoder(r.Body).Decode(&bucket); err != nil {
+		var request Bucket
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
 		}
 
-		var newBucketId int
-		err := db.QueryRow(
-			"INSERT INTO public.bucket (\"name\", ownerid) VALUES($1, $2) RETURNING id;",
-			bucket.Name,
-			bucket.Owner,
-		).Scan(&newBucketId)
+		if request.Budget != nil {
+			if err := checkBudget(request.Budget); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
 
-		checkError(err)
+		bucket, err := scanBucket(db.QueryRow(
+			"INSERT INTO public.bucket (\"name\", ownerid, budget, budget_period, budget_start, budget_days) VALUES($1, $2, $3, $4, $5, $6) RETURNING "+BUCKET_COLUMNS+";",
+			append([]interface{}{request.Name, owner}, budgetColumns(request.Budget)...)...,
+		))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
 		InfoLogger.Println("New Bucket Created.")
 
-		bucket.Id = newBucketId
-
 		if err := json.NewEncoder(w).Encode(bucket); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
 		}
 	case "GET":
-		db := db_init()
-		defer db.Close()
-
-		rows, err := db.Query("SELECT id, \"name\", ownerid FROM public.bucket;")
+		options, err := parseListOptions(r.URL.Query(), BUCKET_SORT_FIELDS, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		checkError(err)
+		rows, total, err := queryPage("bucket", BUCKET_COLUMNS, nameFilter(owner, r.URL.Query()), options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
 
 		var buckets []Bucket
 		for rows.Next() {
-			var id, owner int
-			var name string
-
-			err = rows.Scan(&id, &name, &owner)
+			bucket, err := scanBucket(rows)
 			checkError(err)
 
-			buckets = append(buckets, Bucket{
-				Id:    id,
-				Name:  name,
-				Owner: owner,
-			})
+			buckets = append(buckets, bucket)
 		}
 		InfoLogger.Println("Bucket Information retrieved.")
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
 		if err := json.NewEncoder(w).Encode(buckets); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
@@ -535,30 +888,24 @@ func bucketProcess(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func bucketProcessId(id int, w http.ResponseWriter, r *http.Request) {
+func bucketProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case "GET":
-		db := db_init()
-		defer db.Close()
-
-		rows, err := db.Query("SELECT id, \"name\", ownerid FROM public.bucket WHERE id=$1;", id)
-
-		checkError(err)
+		rows, err := db.Query("SELECT "+BUCKET_COLUMNS+" FROM public.bucket WHERE id=$1 AND ownerid=$2;", id, owner)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
 
 		var buckets []Bucket
 		for rows.Next() {
-			var id, ownerid int
-			var name string
-
-			err = rows.Scan(&id, &name, &ownerid)
+			bucket, err := scanBucket(rows)
 			checkError(err)
 
-			buckets = append(buckets, Bucket{
-				Id:    id,
-				Name:  name,
-				Owner: ownerid,
-			})
+			buckets = append(buckets, bucket)
 		}
 		InfoLogger.Println("Bucket Information retrieved.")
 
@@ -578,25 +925,36 @@ func bucketProcessId(id int, w http.ResponseWriter, r *http.Request) {
 		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
 		return
 	case "PUT":
-		db := db_init()
-		defer db.Close()
-
-		var bucket Bucket
-		if err := json.NewDecoder(r.Body).Decode(&bucket); err != nil {
+		var request Bucket
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		var updatedId int
-		err := db.QueryRow(
-			"UPDATE public.bucket SET \"name\"=$1 WHERE id=$2 RETURNING id;",
-			bucket.Name,
-			id,
-		).Scan(&updatedId)
+		// The budget is replaced as well, a missing budget removes it
+		if request.Budget != nil {
+			if err := checkBudget(request.Budget); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		bucket, err := scanBucket(db.QueryRow(
+			"UPDATE public.bucket SET \"name\"=$1, budget=$2, budget_period=$3, budget_start=$4, budget_days=$5 WHERE id=$6 AND ownerid=$7 RETURNING "+BUCKET_COLUMNS+";",
+			append(append([]interface{}{request.Name}, budgetColumns(request.Budget)...), id, owner)...,
+		))
 
-		checkError(err)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bucket Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
 		InfoLogger.Println("Bucket Information Updated.")
-		bucket.Id = id
 
 		if err := json.NewEncoder(w).Encode(bucket); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -604,21 +962,37 @@ func bucketProcessId(id int, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	case "DELETE":
-		db := db_init()
-		defer db.Close()
-
-		var bucket Bucket
-		err := db.QueryRow("DELETE FROM public.bucket where id = $1 RETURNING id,\"name\", ownerid;", id).Scan(
-			&bucket.Id,
-			&bucket.Name,
-			&bucket.Owner,
-		)
+		if !ownsRecord(db, "bucket", id, owner) {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bucket Information Empty/Not Found.")
+			return
+		}
+		uses, err := bucketReferences(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		if uses != "" {
+			http.Error(w, "Bucket is still used by "+uses+", delete them first.", http.StatusConflict)
+			WarningLogger.Println("Bucket deletion rejected, the bucket is still in use.")
+			return
+		}
+
+		bucket, err := scanBucket(db.QueryRow("DELETE FROM public.bucket where id = $1 AND ownerid = $2 RETURNING "+BUCKET_COLUMNS+";", id, owner))
+
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Bucket Information Empty/Not Found.")
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
 		}
 		InfoLogger.Println("Bucket Information deleted.")
+
 		if err := json.NewEncoder(w).Encode(bucket); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
@@ -627,35 +1001,47 @@ func bucketProcessId(id int, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func lineitemProcess(w http.ResponseWriter, r *http.Request) {
+func lineitemProcess(owner int, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case "POST":
-		db := db_init()
-		defer db.Close()
+		var request LineItem
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		var lineitem LineItem
-		if err := json.NewDecoder(r.Body).Decode(&lineitem); err != nil {
+		// Line items without a date occurred today
+		if request.OccurredOn == "" {
+			request.OccurredOn = today()
+		} else if _, err := parseDate(request.OccurredOn); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		var newLineItemId int
-		err := db.QueryRow(
-			"INSERT INTO public.lineitem (title, description, amount, bucket, bank, ownerid) VALUES($1, $2, $3, $4, $5, $6) RETURNING id;",
-			lineitem.Title,
-			lineitem.Description,
-			lineitem.Amount,
-			lineitem.Bucket,
-			lineitem.Bank,
-			lineitem.Owner,
-		).Scan(&newLineItemId)
+		if !lineitemRefsOwned(db, request, owner) {
+			http.Error(w, "Bucket or Bank not found.", http.StatusBadRequest)
+			ErrorLogger.Println("Line Item references a Bucket or Bank of another user.")
+			return
+		}
 
-		checkError(err)
+		lineitem, err := scanLineItem(db.QueryRow(
+			"INSERT INTO public.lineitem (title, description, amount, bucket, bank, ownerid, occurred_on) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING "+LINEITEM_COLUMNS+";",
+			request.Title,
+			request.Description,
+			request.Amount,
+			request.Bucket,
+			request.Bank,
+			owner,
+			request.OccurredOn,
+		))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
 		InfoLogger.Println("New Line Item Entry created.")
 
-		lineitem.Id = newLineItemId
-
 		if err := json.NewEncoder(w).Encode(lineitem); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
@@ -663,34 +1049,35 @@ func lineitemProcess(w http.ResponseWriter, r *http.Request) {
 		}
 
 	case "GET":
-		db := db_init()
-		defer db.Close()
-
-		rows, err := db.Query("SELECT id, title, description, amount, bucket, bank, ownerid FROM public.lineitem;")
+		options, err := parseListOptions(r.URL.Query(), LINEITEM_SORT_FIELDS, "occurred_on")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, err := lineitemFilter(owner, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		checkError(err)
+		rows, total, err := queryPage("lineitem", LINEITEM_COLUMNS, f, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
 
 		var lineitems []LineItem
 		for rows.Next() {
-			var id, bucket, bank, ownerid int
-			var title, description string
-			var amount float64
-
-			err = rows.Scan(&id, &title, &description, &amount, &bucket, &bank, &ownerid)
+			lineitem, err := scanLineItem(rows)
 			checkError(err)
 
-			lineitems = append(lineitems, LineItem{
-				Id:          id,
-				Title:       title,
-				Description: description,
-				Amount:      amount,
-				Bucket:      bucket,
-				Bank:        bank,
-				Owner:       ownerid,
-			})
+			lineitems = append(lineitems, lineitem)
 		}
 		InfoLogger.Println("Line Item Entries retrieved.")
 
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
 		if err := json.NewEncoder(w).Encode(lineitems); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
@@ -707,35 +1094,24 @@ func lineitemProcess(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func lineitemProcessId(id int, w http.ResponseWriter, r *http.Request) {
+func lineitemProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case "GET":
-		db := db_init()
-		defer db.Close()
-
-		rows, err := db.Query("SELECT id, title, description, amount, bucket, bank, ownerid FROM public.lineitem WHERE id=$1;", id)
-
-		checkError(err)
+		rows, err := db.Query("SELECT "+LINEITEM_COLUMNS+" FROM public.lineitem WHERE id=$1 AND ownerid=$2;", id, owner)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
 
 		var lineitems []LineItem
 		for rows.Next() {
-			var id, bucket, bank, ownerid int
-			var amount float64
-			var title, description string
-
-			err = rows.Scan(&id, &title, &description, &amount, &bucket, &bank, &ownerid)
+			lineitem, err := scanLineItem(rows)
 			checkError(err)
 
-			lineitems = append(lineitems, LineItem{
-				Id:          id,
-				Title:       title,
-				Description: description,
-				Amount:      amount,
-				Bucket:      bucket,
-				Bank:        bank,
-				Owner:       ownerid,
-			})
+			lineitems = append(lineitems, lineitem)
 		}
 
 		if lineitems == nil || len(lineitems) < 1 {
@@ -756,51 +1132,85 @@ func lineitemProcessId(id int, w http.ResponseWriter, r *http.Request) {
 		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
 		return
 	case "PUT":
-		db := db_init()
-		defer db.Close()
-
-		var lineitem LineItem
-		if err := json.NewDecoder(r.Body).Decode(&lineitem); err != nil {
+		var request LineItem
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		var updatedId int
-		err := db.QueryRow(
-			"UPDATE public.lineitem SET title=$1, description=$2, amount=$3, bucket=$4, bank=$5 WHERE id=$6 RETURNING id;",
-			lineitem.Title,
-			lineitem.Description,
-			lineitem.Amount,
-			lineitem.Bucket,
-			lineitem.Bank,
+		if transfer := lineitemTransfer(id, owner); transfer != 0 {
+			http.Error(w, "Line Item is part of Transfer "+strconv.Itoa(transfer)+", change the transfer instead.", http.StatusConflict)
+			WarningLogger.Println("Change to a Line Item of a Transfer rejected.")
+			return
+		}
+		if lineitemReconciled(id, owner) != 0 {
+			http.Error(w, errReconciled.Error(), http.StatusConflict)
+			WarningLogger.Println("Change to a reconciled Line Item rejected.")
+			return
+		}
+
+		// An empty date keeps the date the line item already has
+		if request.OccurredOn != "" {
+			if _, err := parseDate(request.OccurredOn); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if !lineitemRefsOwned(db, request, owner) {
+			http.Error(w, "Bucket or Bank not found.", http.StatusBadRequest)
+			ErrorLogger.Println("Line Item references a Bucket or Bank of another user.")
+			return
+		}
+
+		lineitem, err := scanLineItem(db.QueryRow(
+			"UPDATE public.lineitem SET title=$1, description=$2, amount=$3, bucket=$4, bank=$5, occurred_on=coalesce($6::date, occurred_on) WHERE id=$7 AND ownerid=$8 AND reconciliation IS NULL RETURNING "+LINEITEM_COLUMNS+";",
+			request.Title,
+			request.Description,
+			request.Amount,
+			request.Bucket,
+			request.Bank,
+			nullDate(request.OccurredOn),
 			id,
-		).Scan(&updatedId)
+			owner,
+		))
 
-		checkError(err)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Line Item Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
 		InfoLogger.Println("Line Item Entry Information Updated.")
 
-		lineitem.Id = id
-
 		if err := json.NewEncoder(w).Encode(lineitem); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
 		}
 	case "DELETE":
-		db := db_init()
-		defer db.Close()
-
-		var lineitem LineItem
-		err := db.QueryRow("DELETE FROM public.lineitem where id = $1 RETURNING id, title, description, amount, bucket, bank, ownerid;", id).Scan(
-			&lineitem.Id,
-			&lineitem.Title,
-			&lineitem.Description,
-			&lineitem.Amount,
-			&lineitem.Bucket,
-			&lineitem.Bank,
-			&lineitem.Owner,
-		)
+		if transfer := lineitemTransfer(id, owner); transfer != 0 {
+			http.Error(w, "Line Item is part of Transfer "+strconv.Itoa(transfer)+", change the transfer instead.", http.StatusConflict)
+			WarningLogger.Println("Change to a Line Item of a Transfer rejected.")
+			return
+		}
+		if lineitemReconciled(id, owner) != 0 {
+			http.Error(w, errReconciled.Error(), http.StatusConflict)
+			WarningLogger.Println("Change to a reconciled Line Item rejected.")
+			return
+		}
 
+		lineitem, err := scanLineItem(db.QueryRow("DELETE FROM public.lineitem where id = $1 AND ownerid = $2 AND reconciliation IS NULL RETURNING "+LINEITEM_COLUMNS+";", id, owner))
+
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Line Item Information Empty/Not Found.")
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
@@ -826,9 +1236,6 @@ func authorize(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "POST":
-		db := db_init()
-		defer db.Close()
-
 		var login Login
 
 		if err := json.NewDecoder(r.Body).Decode(&login); err != nil {
@@ -836,34 +1243,59 @@ func authorize(w http.ResponseWriter, r *http.Request) {
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
 		}
-		var users []UserAccount
-
-		rows, err := db.Query("SELECT id, username, \"name\", pin FROM public.useraccount WHERE username=$1 and pin=$2 LIMIT 1;", login.Username, login.Pin)
-		checkError(err)
-
-		for rows.Next() {
-			var id, pin int
-			var username, name string
-
-			err = rows.Scan(&id, &username, &name, &pin)
-			checkError(err)
+		InfoLogger.Println("Authorization request received.")
 
-			users = append(users, UserAccount{
-				Id:       id,
-				Username: username,
-				Name:     name,
-				Pin:      pin,
-			})
+		// Throttle repeated failures, by username and by client IP
+		ip := clientIP(r)
+		userKey := "user:" + login.Username
+		ipKey := "ip:" + ip
+
+		// Attempts are counted before the PIN is checked, so parallel guesses all count
+		wait, userLocked := loginLimiter.Reserve(userKey)
+		ipLocked := false
+		if wait == 0 {
+			if wait, ipLocked = loginLimiter.Reserve(ipKey); wait > 0 {
+				loginLimiter.Release(userKey)
+			}
+		}
+		if wait > 0 {
+			w.Header().Set("Retry-After", retryAfter(wait))
+			http.Error(w, "Too many failed attempts. Try again later.", http.StatusTooManyRequests)
+			WarningLogger.Println("Authorization throttled for username " + login.Username + " from " + ip + ".")
+			return
 		}
-		InfoLogger.Println("Authorization request received.")
 
-		if len(users) == 0 {
+		user, err := checkPin(db, login.Username, login.Pin)
+		if err == errInvalidPin {
+			if userLocked {
+				WarningLogger.Println("Username " + login.Username + " locked out after repeated failed authorizations.")
+			}
+			if ipLocked {
+				WarningLogger.Println("Client " + ip + " locked out after repeated failed authorizations.")
+			}
 			http.Error(w, "Not Found", http.StatusNotFound)
+			WarningLogger.Println("Failed authorization for username " + login.Username + ".")
+			return
+		}
+		if err != nil {
+			loginLimiter.Release(userKey)
+			loginLimiter.Release(ipKey)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		loginLimiter.Success(userKey)
+		loginLimiter.Release(ipKey)
+
+		session, err := issueSession(db, user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
 		}
 
-		if err := json.NewEncoder(w).Encode(users[0]); err != nil {
+		if err := json.NewEncoder(w).Encode(session); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			ErrorLogger.Println("Internal Error Occured. " + err.Error())
 			return
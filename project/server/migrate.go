@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Schema migrations, embedded in the binary
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Advisory lock held while migrating, so concurrent server starts apply each migration once
+const MIGRATION_LOCK_KEY = 7346519
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// loadMigrations reads the migrations of a directory, sorted by version.
+// Every version needs an up file; a down file is optional.
+func loadMigrations(files fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(files, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// withMigrationLock runs fn on a connection holding the migration lock.
+// Advisory locks belong to a database session, so everything runs on that one connection.
+func withMigrationLock(db *sql.DB, fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", MIGRATION_LOCK_KEY); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1);", MIGRATION_LOCK_KEY)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS public.schema_migrations (
+		version int primary key,
+		name text not null,
+		applied_at timestamptz not null default now()
+	);`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions returns the versions recorded in schema_migrations.
+func appliedVersions(conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version FROM public.schema_migrations;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// runMigration applies one migration step and records it, in a single transaction.
+func runMigration(conn *sql.Conn, m Migration, up bool) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := m.Up
+	record := "INSERT INTO public.schema_migrations (version, name) VALUES($1, $2);"
+	args := []interface{}{m.Version, m.Name}
+	if !up {
+		script = m.Down
+		record = "DELETE FROM public.schema_migrations WHERE version=$1;"
+		args = args[:1]
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateUp applies every migration that was not applied yet, in order.
+func migrateUp(db *sql.DB, migrations []Migration) error {
+	return withMigrationLock(db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if applied[m.Version] {
+				continue
+			}
+			if err := runMigration(conn, m, true); err != nil {
+				return err
+			}
+			InfoLogger.Printf("Applied migration %d_%s.", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+// migrateDown reverts the last steps applied migrations, newest first.
+func migrateDown(db *sql.DB, migrations []Migration, steps int) error {
+	return withMigrationLock(db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if !applied[m.Version] {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s can not be reverted, it has no down file", m.Version, m.Name)
+			}
+			if err := runMigration(conn, m, false); err != nil {
+				return err
+			}
+			InfoLogger.Printf("Reverted migration %d_%s.", m.Version, m.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// migrationStatus prints every migration and whether it was applied.
+func migrationStatus(db *sql.DB, migrations []Migration) error {
+	return withMigrationLock(db, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			state := "pending"
+			if applied[m.Version] {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, state)
+		}
+		return nil
+	})
+}
+
+// runMigrateCommand runs the migrate subcommand: migrate [up | down [steps] | status].
+func runMigrateCommand(db *sql.DB, args []string) error {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return migrateUp(db, migrations)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		return migrateDown(db, migrations, steps)
+	case "status":
+		return migrationStatus(db, migrations)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+}
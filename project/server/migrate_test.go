@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	files := fstest.MapFS{
+		"m/0002_sessions.up.sql":   {Data: []byte("create table b ();")},
+		"m/0001_init.up.sql":       {Data: []byte("create table a ();")},
+		"m/0001_init.down.sql":     {Data: []byte("drop table a;")},
+		"m/0010_later_one.up.sql":  {Data: []byte("create table c ();")},
+		"m/0002_sessions.down.sql": {Data: []byte("drop table b;")},
+	}
+
+	migrations, err := loadMigrations(files, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Migration{
+		{Version: 1, Name: "init", Up: "create table a ();", Down: "drop table a;"},
+		{Version: 2, Name: "sessions", Up: "create table b ();", Down: "drop table b;"},
+		{Version: 10, Name: "later_one", Up: "create table c ();"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("loadMigrations() returned %d migrations, want %d", len(migrations), len(want))
+	}
+	for i := range want {
+		if migrations[i] != want[i] {
+			t.Errorf("migration %d = %+v, want %+v", i, migrations[i], want[i])
+		}
+	}
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		message string
+	}{
+		{
+			name:    "Unexpected file name",
+			files:   fstest.MapFS{"m/setup.sql": {Data: []byte("")}},
+			message: "unexpected migration file",
+		},
+		{
+			name:    "Down without up",
+			files:   fstest.MapFS{"m/0001_init.down.sql": {Data: []byte("drop table a;")}},
+			message: "no up file",
+		},
+		{
+			name: "Version used twice",
+			files: fstest.MapFS{
+				"m/0001_init.up.sql":  {Data: []byte("create table a ();")},
+				"m/0001_other.up.sql": {Data: []byte("create table b ();")},
+			},
+			message: "two names",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("loadMigrations() error = %v, want an error containing %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d: versions must be consecutive", m.Name, m.Version, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
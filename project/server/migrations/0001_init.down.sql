@@ -0,0 +1,4 @@
+drop table if exists LineItem;
+drop table if exists Bucket;
+drop table if exists BankAccount;
+drop table if exists UserAccount;
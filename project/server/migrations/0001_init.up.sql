@@ -1,4 +1,4 @@
-create table UserAccount (
+create table if not exists UserAccount (
 	id SERIAL,
 	username VARCHAR(50) not null unique,
 	name text not null,
@@ -7,7 +7,7 @@ create table UserAccount (
 );
 
 
-create table BankAccount (
+create table if not exists BankAccount (
 	id SERIAL,
 	name text not null,
 	ownerid int,
@@ -17,7 +17,7 @@ create table BankAccount (
 			references UserAccount(id)
 );
 
-create table Bucket (
+create table if not exists Bucket (
 	id SERIAL,
 	name text not null,
 	ownerid int,
@@ -27,7 +27,7 @@ create table Bucket (
 			references UserAccount(id)
 );
 
-create table LineItem (
+create table if not exists LineItem (
 	id SERIAL,
 	title text not null,
 	description text,
@@ -0,0 +1,15 @@
+create table if not exists Session (
+	id SERIAL,
+	userid int not null,
+	refresh_hash text not null,
+	expires_at timestamptz not null,
+	revoked_at timestamptz,
+	created_at timestamptz not null default now(),
+	primary key (id),
+	constraint sessionowner
+		foreign key (userid)
+			references UserAccount(id)
+			on delete cascade
+);
+
+create index if not exists session_refresh_hash on Session (refresh_hash);
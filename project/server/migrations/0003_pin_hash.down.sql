@@ -0,0 +1,3 @@
+-- Hashed PINs can not be turned back into plain PINs: accounts created or
+-- migrated since keep a NULL pin and need a new PIN.
+alter table UserAccount drop column if exists pin_hash;
@@ -0,0 +1,3 @@
+-- PINs are stored as salted hashes in pin_hash.
+-- The server hashes the plain PIN of existing accounts on startup and clears the pin column.
+alter table UserAccount add column if not exists pin_hash text;
@@ -0,0 +1,20 @@
+drop trigger if exists lineitem_updated_at on LineItem;
+drop trigger if exists bucket_updated_at on Bucket;
+drop trigger if exists bankaccount_updated_at on BankAccount;
+drop trigger if exists useraccount_updated_at on UserAccount;
+drop function if exists set_updated_at();
+
+drop index if exists lineitem_owner_occurred_on;
+
+alter table LineItem drop column if exists updated_at;
+alter table LineItem drop column if exists created_at;
+alter table LineItem drop column if exists occurred_on;
+
+alter table Bucket drop column if exists updated_at;
+alter table Bucket drop column if exists created_at;
+
+alter table BankAccount drop column if exists updated_at;
+alter table BankAccount drop column if exists created_at;
+
+alter table UserAccount drop column if exists updated_at;
+alter table UserAccount drop column if exists created_at;
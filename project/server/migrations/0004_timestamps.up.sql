@@ -0,0 +1,32 @@
+-- Creation and last update time of every entity, and the date a line item occurred on.
+-- Existing line items are dated on the day of the migration.
+alter table UserAccount add column if not exists created_at timestamptz not null default now();
+alter table UserAccount add column if not exists updated_at timestamptz not null default now();
+
+alter table BankAccount add column if not exists created_at timestamptz not null default now();
+alter table BankAccount add column if not exists updated_at timestamptz not null default now();
+
+alter table Bucket add column if not exists created_at timestamptz not null default now();
+alter table Bucket add column if not exists updated_at timestamptz not null default now();
+
+alter table LineItem add column if not exists occurred_on date not null default current_date;
+alter table LineItem add column if not exists created_at timestamptz not null default now();
+alter table LineItem add column if not exists updated_at timestamptz not null default now();
+
+create index if not exists lineitem_owner_occurred_on on LineItem (ownerid, occurred_on);
+
+create or replace function set_updated_at() returns trigger as $$
+begin
+	new.updated_at = now();
+	return new;
+end;
+$$ language plpgsql;
+
+create trigger useraccount_updated_at before update on UserAccount
+	for each row execute procedure set_updated_at();
+create trigger bankaccount_updated_at before update on BankAccount
+	for each row execute procedure set_updated_at();
+create trigger bucket_updated_at before update on Bucket
+	for each row execute procedure set_updated_at();
+create trigger lineitem_updated_at before update on LineItem
+	for each row execute procedure set_updated_at();
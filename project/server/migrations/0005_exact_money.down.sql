@@ -0,0 +1,4 @@
+alter table BankAccount drop constraint if exists bankaccount_currency;
+alter table BankAccount drop column if exists currency;
+
+alter table LineItem alter column amount type float using amount::float;
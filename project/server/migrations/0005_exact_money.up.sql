@@ -0,0 +1,7 @@
+-- Amounts are exact decimals with two decimal places instead of floats.
+-- Existing amounts are rounded to the nearest cent, which also drops float noise such as 4.499999.
+alter table LineItem alter column amount type numeric(18,2) using round(amount::numeric, 2);
+
+-- Currency of the amounts recorded against a bank account, an ISO 4217 code.
+alter table BankAccount add column if not exists currency char(3) not null default 'USD';
+alter table BankAccount add constraint bankaccount_currency check (currency ~ '^[A-Z]{3}$');
@@ -0,0 +1,5 @@
+drop index if exists lineitem_owner_amount;
+drop index if exists lineitem_owner_bank;
+drop index if exists lineitem_owner_bucket;
+drop index if exists bucket_owner;
+drop index if exists bankaccount_owner;
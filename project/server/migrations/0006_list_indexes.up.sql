@@ -0,0 +1,7 @@
+-- Indexes behind the filters and sort orders of the collection endpoints.
+-- Every query is scoped to the owner, so ownerid leads each index.
+create index if not exists bankaccount_owner on BankAccount (ownerid);
+create index if not exists bucket_owner on Bucket (ownerid);
+create index if not exists lineitem_owner_bucket on LineItem (ownerid, bucket);
+create index if not exists lineitem_owner_bank on LineItem (ownerid, bank);
+create index if not exists lineitem_owner_amount on LineItem (ownerid, amount);
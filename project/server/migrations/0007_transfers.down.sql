@@ -0,0 +1,6 @@
+drop index if exists lineitem_transfer;
+alter table LineItem drop column if exists transfer;
+
+drop table if exists Transfer;
+
+alter table LineItem drop constraint if exists lineitem_pkey;
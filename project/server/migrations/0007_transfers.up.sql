@@ -0,0 +1,37 @@
+-- LineItem was created without a primary key; transfers reference it.
+alter table LineItem add primary key (id);
+
+-- A transfer moves money between two bank accounts of the same owner.
+-- It is recorded as two line items: a debit on from_bank and a credit on to_bank.
+create table if not exists Transfer (
+	id SERIAL,
+	title text not null,
+	description text not null default '',
+	amount numeric(18,2) not null check (amount > 0),
+	from_bank int not null,
+	to_bank int not null,
+	occurred_on date not null default current_date,
+	ownerid int not null,
+	created_at timestamptz not null default now(),
+	updated_at timestamptz not null default now(),
+	primary key (id),
+	check (from_bank <> to_bank),
+	constraint transferowner
+		foreign key (ownerid)
+			references UserAccount(id),
+	constraint transferfrombank
+		foreign key (from_bank)
+			references BankAccount(id),
+	constraint transfertobank
+		foreign key (to_bank)
+			references BankAccount(id)
+);
+
+create index if not exists transfer_owner_occurred_on on Transfer (ownerid, occurred_on);
+
+create trigger transfer_updated_at before update on Transfer
+	for each row execute procedure set_updated_at();
+
+-- The two line items of a transfer are deleted with it
+alter table LineItem add column if not exists transfer int references Transfer(id) on delete cascade;
+create index if not exists lineitem_transfer on LineItem (transfer);
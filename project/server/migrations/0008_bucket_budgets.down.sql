@@ -0,0 +1,4 @@
+alter table Bucket drop column if exists budget_days;
+alter table Bucket drop column if exists budget_start;
+alter table Bucket drop column if exists budget_period;
+alter table Bucket drop column if exists budget;
@@ -0,0 +1,6 @@
+-- Optional budget of a bucket: an amount per monthly, weekly or custom period.
+-- budget_start anchors weekly and custom periods; budget_days is the length of a custom period.
+alter table Bucket add column if not exists budget numeric(18,2) check (budget >= 0);
+alter table Bucket add column if not exists budget_period text check (budget_period in ('monthly', 'weekly', 'custom'));
+alter table Bucket add column if not exists budget_start date;
+alter table Bucket add column if not exists budget_days int check (budget_days > 0);
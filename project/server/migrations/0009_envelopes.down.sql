@@ -0,0 +1,3 @@
+drop table if exists EnvelopeClose;
+drop table if exists Rollover;
+drop table if exists Allocation;
@@ -0,0 +1,61 @@
+-- Envelope budgeting: income is allocated to buckets per month, and what is left
+-- in (or overspent from) a bucket at the end of a month rolls into the next one.
+create table if not exists Allocation (
+	id SERIAL,
+	bucket int not null,
+	period date not null,
+	amount numeric(18,2) not null,
+	lineitem int,
+	note text not null default '',
+	ownerid int not null,
+	created_at timestamptz not null default now(),
+	updated_at timestamptz not null default now(),
+	primary key (id),
+	check (period = date_trunc('month', period)),
+	constraint allocationowner
+		foreign key (ownerid)
+			references UserAccount(id),
+	constraint allocationbucket
+		foreign key (bucket)
+			references Bucket(id)
+			on delete cascade,
+	constraint allocationlineitem
+		foreign key (lineitem)
+			references LineItem(id)
+			on delete set null
+);
+
+create index if not exists allocation_owner_period on Allocation (ownerid, period);
+create index if not exists allocation_lineitem on Allocation (lineitem);
+
+create trigger allocation_updated_at before update on Allocation
+	for each row execute procedure set_updated_at();
+
+-- Balance carried into a month, written when the month before it is closed
+create table if not exists Rollover (
+	bucket int not null,
+	period date not null,
+	amount numeric(18,2) not null,
+	ownerid int not null,
+	primary key (bucket, period),
+	constraint rolloverowner
+		foreign key (ownerid)
+			references UserAccount(id),
+	constraint rolloverbucket
+		foreign key (bucket)
+			references Bucket(id)
+			on delete cascade
+);
+
+create index if not exists rollover_owner_period on Rollover (ownerid, period);
+
+-- Months that were closed
+create table if not exists EnvelopeClose (
+	ownerid int not null,
+	period date not null,
+	closed_at timestamptz not null default now(),
+	primary key (ownerid, period),
+	constraint envelopecloseowner
+		foreign key (ownerid)
+			references UserAccount(id)
+);
@@ -0,0 +1,6 @@
+drop index if exists lineitem_recurring_occurrence;
+alter table LineItem drop column if exists recurring_on;
+alter table LineItem drop column if exists recurring;
+
+drop table if exists RecurringSkip;
+drop table if exists Recurring;
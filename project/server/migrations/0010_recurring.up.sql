@@ -0,0 +1,44 @@
+-- Templates of line items that repeat on a schedule.
+-- next_date is the first occurrence that was not created yet, NULL once the schedule ended.
+create table if not exists Recurring (
+	id SERIAL,
+	title text not null,
+	description text not null default '',
+	amount numeric(18,2) not null,
+	bucket int,
+	bank int,
+	frequency text not null check (frequency in ('daily', 'weekly', 'monthly')),
+	repeat_interval int not null default 1 check (repeat_interval > 0),
+	day_of_month int check (day_of_month between 1 and 31),
+	start_date date not null,
+	end_date date,
+	next_date date,
+	ownerid int not null,
+	created_at timestamptz not null default now(),
+	updated_at timestamptz not null default now(),
+	primary key (id),
+	constraint recurringowner
+		foreign key (ownerid)
+			references UserAccount(id)
+);
+
+create index if not exists recurring_next_date on Recurring (next_date);
+
+create trigger recurring_updated_at before update on Recurring
+	for each row execute procedure set_updated_at();
+
+-- Single occurrences that are not to be created
+create table if not exists RecurringSkip (
+	recurring int not null,
+	occurs_on date not null,
+	primary key (recurring, occurs_on),
+	constraint recurringskiprecurring
+		foreign key (recurring)
+			references Recurring(id)
+			on delete cascade
+);
+
+-- Line items created from a template, at most one per occurrence
+alter table LineItem add column if not exists recurring int references Recurring(id) on delete set null;
+alter table LineItem add column if not exists recurring_on date;
+create unique index if not exists lineitem_recurring_occurrence on LineItem (recurring, recurring_on);
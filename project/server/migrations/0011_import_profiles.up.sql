@@ -0,0 +1,30 @@
+-- Saved column mappings for importing the CSV statements of a bank account
+create table if not exists ImportProfile (
+	id SERIAL,
+	"name" text not null,
+	bank int not null,
+	delimiter text not null default ',',
+	has_header boolean not null default true,
+	date_column text not null,
+	description_column text not null,
+	amount_column text not null default '',
+	debit_column text not null default '',
+	credit_column text not null default '',
+	sign text not null default 'negative_expenses' check (sign in ('negative_expenses', 'positive_expenses', 'debit_credit')),
+	date_format text not null default 'YYYY-MM-DD',
+	decimal_separator text not null default '.' check (decimal_separator in ('.', ',')),
+	ownerid int not null,
+	created_at timestamptz not null default now(),
+	updated_at timestamptz not null default now(),
+	primary key (id),
+	constraint importprofileowner
+		foreign key (ownerid)
+			references UserAccount(id),
+	constraint importprofilebank
+		foreign key (bank)
+			references BankAccount(id)
+			on delete cascade
+);
+
+create trigger importprofile_updated_at before update on ImportProfile
+	for each row execute procedure set_updated_at();
@@ -0,0 +1,2 @@
+drop index if exists lineitem_bank_fitid;
+alter table LineItem drop column if exists fitid;
@@ -0,0 +1,4 @@
+-- Transaction id of an imported statement line (the FITID of OFX files), so a statement
+-- imported twice does not create its line items twice
+alter table LineItem add column if not exists fitid text;
+create unique index if not exists lineitem_bank_fitid on LineItem (bank, fitid);
@@ -0,0 +1,22 @@
+-- Pairs of line items the user reviewed and marked as not duplicates, lineitem < other
+create table if not exists DuplicateDismissal (
+	lineitem int not null,
+	other int not null,
+	ownerid int not null,
+	created_at timestamptz not null default now(),
+	primary key (lineitem, other),
+	check (lineitem < other),
+	constraint duplicatedismissalowner
+		foreign key (ownerid)
+			references UserAccount(id),
+	constraint duplicatedismissallineitem
+		foreign key (lineitem)
+			references LineItem(id)
+			on delete cascade,
+	constraint duplicatedismissalother
+		foreign key (other)
+			references LineItem(id)
+			on delete cascade
+);
+
+create index if not exists duplicatedismissal_owner on DuplicateDismissal (ownerid);
@@ -0,0 +1,3 @@
+drop index if exists lineitem_bank_occurred_on;
+alter table BankAccount drop column if exists opening_date;
+alter table BankAccount drop column if exists opening_balance;
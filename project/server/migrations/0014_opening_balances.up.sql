@@ -0,0 +1,6 @@
+-- Balance of a bank account at the start of opening_date. Line items before that date are
+-- part of the opening balance; without an opening date all line items count.
+alter table BankAccount add column if not exists opening_balance numeric(18,2) not null default 0;
+alter table BankAccount add column if not exists opening_date date;
+
+create index if not exists lineitem_bank_occurred_on on LineItem (bank, occurred_on);
@@ -0,0 +1,4 @@
+drop table if exists AuditLog;
+alter table LineItem drop column if exists reconciliation;
+alter table LineItem drop column if exists cleared;
+drop table if exists Reconciliation;
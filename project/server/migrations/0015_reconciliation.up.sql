@@ -0,0 +1,49 @@
+-- Reconciliation of a bank account against a statement: the line items cleared up to
+-- statement_date must add up to ending_balance. Finishing it locks those line items.
+create table if not exists Reconciliation (
+	id SERIAL,
+	bank int not null,
+	statement_date date not null,
+	ending_balance numeric(18,2) not null,
+	status text not null default 'open' check (status in ('open', 'finished')),
+	finished_at timestamptz,
+	ownerid int not null,
+	created_at timestamptz not null default now(),
+	updated_at timestamptz not null default now(),
+	primary key (id),
+	constraint reconciliationowner
+		foreign key (ownerid)
+			references UserAccount(id),
+	constraint reconciliationbank
+		foreign key (bank)
+			references BankAccount(id)
+			on delete cascade
+);
+
+-- At most one reconciliation in progress per bank account
+create unique index if not exists reconciliation_open on Reconciliation (bank) where status = 'open';
+create index if not exists reconciliation_owner on Reconciliation (ownerid);
+
+create trigger reconciliation_updated_at before update on Reconciliation
+	for each row execute procedure set_updated_at();
+
+-- A cleared line item appeared on a statement; a line item with a reconciliation is locked
+alter table LineItem add column if not exists cleared boolean not null default false;
+alter table LineItem add column if not exists reconciliation int references Reconciliation(id) on delete set null;
+
+-- Changes that bypass a safeguard, such as unlocking reconciled line items
+create table if not exists AuditLog (
+	id SERIAL,
+	action text not null,
+	entity text not null,
+	entity_id int not null,
+	detail text not null default '',
+	ownerid int not null,
+	created_at timestamptz not null default now(),
+	primary key (id),
+	constraint auditlogowner
+		foreign key (ownerid)
+			references UserAccount(id)
+);
+
+create index if not exists auditlog_owner_created_at on AuditLog (ownerid, created_at);
@@ -0,0 +1,32 @@
+-- Savings goal: reach target_amount by target_date, in a bucket or in a bank account
+create table if not exists Goal (
+	id SERIAL,
+	"name" text not null,
+	target_amount numeric(18,2) not null check (target_amount > 0),
+	target_date date not null,
+	start_date date not null default current_date,
+	bucket int,
+	bank int,
+	ownerid int not null,
+	created_at timestamptz not null default now(),
+	updated_at timestamptz not null default now(),
+	primary key (id),
+	check ((bucket is null) <> (bank is null)),
+	check (target_date > start_date),
+	constraint goalowner
+		foreign key (ownerid)
+			references UserAccount(id),
+	constraint goalbucket
+		foreign key (bucket)
+			references Bucket(id)
+			on delete cascade,
+	constraint goalbank
+		foreign key (bank)
+			references BankAccount(id)
+			on delete cascade
+);
+
+create index if not exists goal_owner on Goal (ownerid);
+
+create trigger goal_updated_at before update on Goal
+	for each row execute procedure set_updated_at();
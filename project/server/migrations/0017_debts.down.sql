@@ -0,0 +1,3 @@
+drop index if exists lineitem_debt;
+alter table LineItem drop column if exists debt;
+drop table if exists Debt;
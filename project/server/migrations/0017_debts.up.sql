@@ -0,0 +1,37 @@
+-- Loan or mortgage repaid in term_months monthly payments on payment_day, from the month after start_date.
+-- rate is the annual interest rate in percent.
+create table if not exists Debt (
+	id SERIAL,
+	"name" text not null,
+	principal numeric(18,2) not null check (principal > 0),
+	rate numeric(7,4) not null check (rate >= 0 and rate < 100),
+	term_months int not null check (term_months > 0),
+	payment_day int not null check (payment_day between 1 and 31),
+	start_date date not null,
+	bank int,
+	bucket int,
+	ownerid int not null,
+	created_at timestamptz not null default now(),
+	updated_at timestamptz not null default now(),
+	primary key (id),
+	constraint debtowner
+		foreign key (ownerid)
+			references UserAccount(id),
+	constraint debtbank
+		foreign key (bank)
+			references BankAccount(id)
+			on delete set null,
+	constraint debtbucket
+		foreign key (bucket)
+			references Bucket(id)
+			on delete set null
+);
+
+create index if not exists debt_owner on Debt (ownerid);
+
+create trigger debt_updated_at before update on Debt
+	for each row execute procedure set_updated_at();
+
+-- A line item that pays a debt; its split into principal and interest follows from the payments before it
+alter table LineItem add column if not exists debt int references Debt(id) on delete set null;
+create index if not exists lineitem_debt on LineItem (debt, occurred_on);
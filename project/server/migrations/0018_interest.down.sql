@@ -0,0 +1,4 @@
+drop table if exists InterestPosting;
+drop table if exists InterestTier;
+alter table BankAccount drop column if exists interest_start;
+alter table BankAccount drop column if exists account_type;
@@ -0,0 +1,33 @@
+-- Type of a bank account; credit cards and loans are liabilities
+alter table BankAccount add column if not exists account_type text not null default 'checking'
+	check (account_type in ('checking', 'savings', 'credit', 'loan'));
+
+-- Interest accrues on a savings account from interest_start, set when it gets interest tiers
+alter table BankAccount add column if not exists interest_start date;
+
+-- Annual rate, in percent, on the whole balance of a savings account once it reaches min_balance
+create table if not exists InterestTier (
+	bank int not null,
+	min_balance numeric(18,2) not null,
+	rate numeric(7,4) not null check (rate >= 0 and rate < 100),
+	primary key (bank, min_balance),
+	constraint interesttierbank
+		foreign key (bank)
+			references BankAccount(id)
+			on delete cascade
+);
+
+-- Interest posted for a month (period is its first day), so a month is never posted twice.
+-- The posting stays when its line item is deleted.
+create table if not exists InterestPosting (
+	bank int not null,
+	period date not null,
+	amount numeric(18,2) not null,
+	lineitem int references LineItem(id) on delete set null,
+	created_at timestamptz not null default now(),
+	primary key (bank, period),
+	constraint interestpostingbank
+		foreign key (bank)
+			references BankAccount(id)
+			on delete cascade
+);
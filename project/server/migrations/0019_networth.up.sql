@@ -0,0 +1,15 @@
+-- Net worth of a user at the end of a day, per currency. Snapshots are taken by the scheduler and
+-- can be rebuilt from the line items, so they go with the user.
+create table if not exists NetWorthSnapshot (
+	ownerid int not null,
+	taken_on date not null,
+	currency char(3) not null,
+	assets numeric(18,2) not null,
+	liabilities numeric(18,2) not null,
+	created_at timestamptz not null default now(),
+	primary key (ownerid, taken_on, currency),
+	constraint networthsnapshotowner
+		foreign key (ownerid)
+			references UserAccount(id)
+			on delete cascade
+);
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in minor units (cents), stored as numeric(18,2).
+// Negative amounts are expenses, positive amounts are income.
+//
+// In JSON a Money is a number with two decimals, e.g. -4.50. A string such
+// as "-4.50" is accepted as well. Amounts are parsed as decimals, never
+// through a float, so they round-trip without loss.
+type Money int64
+
+// Largest number of digits before the decimal point of a numeric(18,2)
+const MONEY_INTEGER_DIGITS = 16
+
+var moneyPattern = regexp.MustCompile(`^([+-]?)(\d+)(?:\.(\d{1,2}))?$`)
+
+var errInvalidMoney = errors.New("invalid amount, expected a decimal with at most two decimal places")
+
+// ParseMoney parses a decimal amount such as "12", "-4.5" or "1234.56".
+func ParseMoney(value string) (Money, error) {
+	match := moneyPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, errInvalidMoney
+	}
+
+	digits := strings.TrimLeft(match[2], "0")
+	if len(digits) > MONEY_INTEGER_DIGITS {
+		return 0, errors.New("amount out of range")
+	}
+
+	fraction := match[3]
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+	cents, err := strconv.ParseInt(match[2]+fraction, 10, 64)
+	if err != nil {
+		return 0, errInvalidMoney
+	}
+
+	if match[1] == "-" {
+		cents = -cents
+	}
+	return Money(cents), nil
+}
+
+// String formats the amount with two decimals, e.g. -4.50.
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Abs returns the amount without its sign.
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*m = 0
+		return nil
+	}
+
+	value := string(data)
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	parsed, err := ParseMoney(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a numeric column. The driver hands numerics over as text, so no float is involved.
+func (m *Money) Scan(src interface{}) error {
+	var parsed Money
+	var err error
+
+	switch v := src.(type) {
+	case nil:
+		parsed = 0
+	case []byte:
+		parsed, err = ParseMoney(string(v))
+	case string:
+		parsed, err = ParseMoney(v)
+	case int64:
+		parsed = Money(v * 100)
+	default:
+		return fmt.Errorf("can not scan %T into Money", src)
+	}
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value writes the amount as a decimal string, which Postgres reads into numeric exactly.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Currency codes are ISO 4217 alphabetic codes, e.g. USD or EUR
+const DEFAULT_CURRENCY = "USD"
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Decimal places of the ISO 4217 currencies whose minor unit is not a hundredth.
+// Money always has two decimals, so amounts in these would be stored and shown wrong.
+var currencyDecimals = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// normalizeCurrency upper-cases a currency code, defaulting to DEFAULT_CURRENCY, and checks its form.
+// Currencies without two decimal places are rejected.
+func normalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return DEFAULT_CURRENCY, nil
+	}
+	if !currencyPattern.MatchString(code) {
+		return "", fmt.Errorf("invalid currency %q, expected a three letter ISO 4217 code", code)
+	}
+	if decimals, ok := currencyDecimals[code]; ok {
+		return "", fmt.Errorf("unsupported currency %s, it has %d decimal places and amounts are kept with two", code, decimals)
+	}
+	return code, nil
+}
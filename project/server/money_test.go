@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  Money
+		valid bool
+	}{
+		{
+			name:  "Zero",
+			value: "0",
+			want:  0,
+			valid: true,
+		},
+		{
+			name:  "Whole amount",
+			value: "12",
+			want:  1200,
+			valid: true,
+		},
+		{
+			name:  "One decimal",
+			value: "4.5",
+			want:  450,
+			valid: true,
+		},
+		{
+			name:  "Two decimals",
+			value: "4.50",
+			want:  450,
+			valid: true,
+		},
+		{
+			name:  "Negative",
+			value: "-4.05",
+			want:  -405,
+			valid: true,
+		},
+		{
+			name:  "Explicit plus sign",
+			value: "+1.99",
+			want:  199,
+			valid: true,
+		},
+		{
+			name:  "Leading zero",
+			value: "0.1",
+			want:  10,
+			valid: true,
+		},
+		{
+			name:  "Leading zeros",
+			value: "00012.30",
+			want:  1230,
+			valid: true,
+		},
+		{
+			name:  "Largest amount",
+			value: "9999999999999999.99",
+			want:  999999999999999999,
+			valid: true,
+		},
+		{
+			name:  "Too large",
+			value: "10000000000000000",
+			want:  0,
+			valid: false,
+		},
+		{
+			name:  "Three decimals",
+			value: "4.499",
+			want:  0,
+			valid: false,
+		},
+		{
+			name:  "Exponent",
+			value: "1e3",
+			want:  0,
+			valid: false,
+		},
+		{
+			name:  "Decimal comma",
+			value: "4,50",
+			want:  0,
+			valid: false,
+		},
+		{
+			name:  "Missing whole part",
+			value: ".5",
+			want:  0,
+			valid: false,
+		},
+		{
+			name:  "Empty",
+			value: "",
+			want:  0,
+			valid: false,
+		},
+		{
+			name:  "Not a number",
+			value: "abc",
+			want:  0,
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.value)
+			if (err == nil) != tt.valid {
+				t.Errorf("ParseMoney(%q) error = %v, want valid %v", tt.value, err, tt.valid)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		name  string
+		money Money
+		want  string
+	}{
+		{
+			name:  "Zero",
+			money: 0,
+			want:  "0.00",
+		},
+		{
+			name:  "Cents",
+			money: 5,
+			want:  "0.05",
+		},
+		{
+			name:  "Negative cents",
+			money: -5,
+			want:  "-0.05",
+		},
+		{
+			name:  "Trailing zero",
+			money: 450,
+			want:  "4.50",
+		},
+		{
+			name:  "Negative amount",
+			money: -1234,
+			want:  "-12.34",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.money.String(); got != tt.want {
+				t.Errorf("Money(%d).String() = %q, want %q", int64(tt.money), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Money
+		out   string
+	}{
+		{
+			name:  "Number",
+			input: `{"amount": 4.5}`,
+			want:  450,
+			out:   `{"amount":4.50}`,
+		},
+		{
+			name:  "Negative string",
+			input: `{"amount": "-0.10"}`,
+			want:  -10,
+			out:   `{"amount":-0.10}`,
+		},
+		{
+			name:  "Small number",
+			input: `{"amount": 0.07}`,
+			want:  7,
+			out:   `{"amount":0.07}`,
+		},
+		{
+			name:  "Null",
+			input: `{"amount": null}`,
+			want:  0,
+			out:   `{"amount":0.00}`,
+		},
+		{
+			name:  "Largest amount",
+			input: `{"amount": 9999999999999999.99}`,
+			want:  999999999999999999,
+			out:   `{"amount":9999999999999999.99}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v struct {
+				Amount Money `json:"amount"`
+			}
+			if err := json.Unmarshal([]byte(tt.input), &v); err != nil {
+				t.Errorf("Unmarshal(%s) error = %v", tt.input, err)
+				return
+			}
+			if v.Amount != tt.want {
+				t.Errorf("Unmarshal(%s) = %d, want %d", tt.input, v.Amount, tt.want)
+			}
+			out, _ := json.Marshal(v)
+			if string(out) != tt.out {
+				t.Errorf("Marshal(%d) = %s, want %s", v.Amount, out, tt.out)
+			}
+		})
+	}
+
+	var v struct {
+		Amount Money `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 4.499999}`), &v); err == nil {
+		t.Errorf("Unmarshal of an amount with more than two decimals succeeded")
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("-4.50")); err != nil || m != -450 {
+		t.Errorf("Scan([]byte(-4.50)) = %d, %v", m, err)
+	}
+	if err := m.Scan(nil); err != nil || m != 0 {
+		t.Errorf("Scan(nil) = %d, %v", m, err)
+	}
+	if err := m.Scan(4.5); err == nil {
+		t.Errorf("Scan(float64) succeeded")
+	}
+}
+
+func TestNormalizeCurrency(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		want  string
+		valid bool
+	}{
+		{
+			name:  "Default currency",
+			code:  "",
+			want:  DEFAULT_CURRENCY,
+			valid: true,
+		},
+		{
+			name:  "Lower case",
+			code:  "eur",
+			want:  "EUR",
+			valid: true,
+		},
+		{
+			name:  "Surrounding spaces",
+			code:  " GBP ",
+			want:  "GBP",
+			valid: true,
+		},
+		{
+			name:  "No decimal places",
+			code:  "JPY",
+			want:  "",
+			valid: false,
+		},
+		{
+			name:  "Three decimal places",
+			code:  "kwd",
+			want:  "",
+			valid: false,
+		},
+		{
+			name:  "Too long",
+			code:  "EURO",
+			want:  "",
+			valid: false,
+		},
+		{
+			name:  "Not a letter",
+			code:  "U$D",
+			want:  "",
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeCurrency(tt.code)
+			if (err == nil) != tt.valid || got != tt.want {
+				t.Errorf("normalizeCurrency(%q) = %q, %v, want %q", tt.code, got, err, tt.want)
+			}
+		})
+	}
+}
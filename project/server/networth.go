@@ -0,0 +1,398 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Balance of a bank account in a net worth
+type NetWorthAccount struct {
+	Bank        int    `json:"bank"`
+	Name        string `json:"name"`
+	AccountType string `json:"account_type"`
+	Balance     Money  `json:"balance"`
+}
+
+// Net worth of a user in one currency at the end of Date. Assets are the balances of checking and
+// savings accounts; Liabilities what is owed on credit and loan accounts, positive when owing.
+// Accounts is left out of the snapshots of /networth/history.
+type NetWorth struct {
+	Date        string            `json:"date"`
+	Currency    string            `json:"currency"`
+	Assets      Money             `json:"assets"`
+	Liabilities Money             `json:"liabilities"`
+	NetWorth    Money             `json:"net_worth"`
+	Accounts    []NetWorthAccount `json:"accounts,omitempty"`
+}
+
+// Response of POST /networth/rebuild: the days rebuilt and the number of snapshots stored
+type NetWorthRebuild struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Snapshots int    `json:"snapshots"`
+}
+
+// Periods /networth/history can return a snapshot per, as units of date_trunc
+var NETWORTH_PERIODS = map[string]bool{
+	"day":   true,
+	"week":  true,
+	"month": true,
+	"year":  true,
+}
+
+// isLiability reports whether the balance of an account type is owed rather than owned.
+func isLiability(accountType string) bool {
+	return accountType == ACCOUNT_CREDIT || accountType == ACCOUNT_LOAN
+}
+
+// netWorthSeries returns the net worth per currency at the end of every day from from up to and
+// including to, from the opening balances of the bank accounts and the changes of their balances
+// by date since their opening date. An account counts from its opening date on.
+func netWorthSeries(banks []BankAccount, changes map[int]map[string]Money, from time.Time, to time.Time) []NetWorth {
+	balances := make([]Money, len(banks))
+	for i, bank := range banks {
+		balances[i] = bank.OpeningBalance
+		for date, amount := range changes[bank.Id] {
+			if date < from.Format(DATE_LAYOUT) {
+				balances[i] += amount
+			}
+		}
+	}
+
+	series := []NetWorth{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(DATE_LAYOUT)
+		byCurrency := map[string]*NetWorth{}
+		var currencies []string
+		for i, bank := range banks {
+			balances[i] += changes[bank.Id][date]
+			if bank.OpeningDate != "" && date < bank.OpeningDate {
+				continue
+			}
+
+			worth := byCurrency[bank.Currency]
+			if worth == nil {
+				worth = &NetWorth{Date: date, Currency: bank.Currency}
+				byCurrency[bank.Currency] = worth
+				currencies = append(currencies, bank.Currency)
+			}
+			if isLiability(bank.AccountType) {
+				worth.Liabilities -= balances[i]
+			} else {
+				worth.Assets += balances[i]
+			}
+			worth.NetWorth += balances[i]
+			worth.Accounts = append(worth.Accounts, NetWorthAccount{Bank: bank.Id, Name: bank.Name, AccountType: bank.AccountType, Balance: balances[i]})
+		}
+
+		sort.Strings(currencies)
+		for _, currency := range currencies {
+			series = append(series, *byCurrency[currency])
+		}
+	}
+	return series
+}
+
+// netWorthHistory loads the bank accounts of owner and the changes of their balances by date up to to.
+func netWorthHistory(q queryRower, owner int, to time.Time) ([]BankAccount, map[int]map[string]Money, error) {
+	rows, err := q.Query("SELECT "+BANK_COLUMNS+" FROM public.bankaccount WHERE ownerid=$1 ORDER BY id;", owner)
+	if err != nil {
+		return nil, nil, err
+	}
+	var banks []BankAccount
+	for rows.Next() {
+		bank, err := scanBankAccount(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		banks = append(banks, bank)
+	}
+	rows.Close()
+
+	// Line items before the opening date are held by the opening balance
+	rows, err = q.Query(
+		`SELECT l.bank, to_char(l.occurred_on, 'YYYY-MM-DD'), sum(l.amount) FROM public.lineitem l
+		JOIN public.bankaccount b ON b.id = l.bank
+		WHERE b.ownerid = $1 AND l.occurred_on <= $2 AND (b.opening_date IS NULL OR l.occurred_on >= b.opening_date)
+		GROUP BY 1, 2;`,
+		owner,
+		to.Format(DATE_LAYOUT),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	changes := map[int]map[string]Money{}
+	for rows.Next() {
+		var bank int
+		var date string
+		var amount Money
+		if err := rows.Scan(&bank, &date, &amount); err != nil {
+			return nil, nil, err
+		}
+		if changes[bank] == nil {
+			changes[bank] = map[string]Money{}
+		}
+		changes[bank][date] = amount
+	}
+	return banks, changes, rows.Err()
+}
+
+// saveSnapshots replaces the net worth snapshots of owner from from to to with the ones the line
+// items give, and returns the number stored. The user row is locked, so concurrent runs wait
+// instead of storing the same days twice.
+func saveSnapshots(owner int, from time.Time, to time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRow("SELECT id FROM public.useraccount WHERE id=$1 FOR UPDATE;", owner).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	banks, changes, err := netWorthHistory(tx, owner, to)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM public.networthsnapshot WHERE ownerid=$1 AND taken_on BETWEEN $2 AND $3;",
+		owner,
+		from.Format(DATE_LAYOUT),
+		to.Format(DATE_LAYOUT),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	series := netWorthSeries(banks, changes, from, to)
+	for _, worth := range series {
+		_, err := tx.Exec(
+			"INSERT INTO public.networthsnapshot (ownerid, taken_on, currency, assets, liabilities) VALUES($1, $2, $3, $4, $5);",
+			owner,
+			worth.Date,
+			worth.Currency,
+			worth.Assets,
+			worth.Liabilities,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(series), tx.Commit()
+}
+
+// takeDueSnapshots takes the net worth snapshot of today for every user with a bank account.
+// The last snapshot of a user is taken again, as its day may not have ended when it was taken,
+// and the days missed while the server was down are taken too.
+func takeDueSnapshots() error {
+	rows, err := db.Query(
+		`SELECT u.id, coalesce(to_char(max(s.taken_on), 'YYYY-MM-DD'), '') FROM public.useraccount u
+		LEFT JOIN public.networthsnapshot s ON s.ownerid = u.id
+		WHERE EXISTS (SELECT 1 FROM public.bankaccount b WHERE b.ownerid = u.id)
+		GROUP BY u.id;`,
+	)
+	if err != nil {
+		return err
+	}
+	due := map[int]string{}
+	for rows.Next() {
+		var owner int
+		var last string
+		if err := rows.Scan(&owner, &last); err != nil {
+			rows.Close()
+			return err
+		}
+		due[owner] = last
+	}
+	rows.Close()
+
+	now, _ := parseDate(today())
+	for owner, last := range due {
+		from := now
+		if date, err := parseDate(last); err == nil && date.Before(now) {
+			from = date
+		}
+		if _, err := saveSnapshots(owner, from, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Net worth of the user per currency at the end of a day (?date=, today by default), with the
+// balance of every bank account
+func netWorthProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	date, _ := parseDate(today())
+	if value := r.URL.Query().Get("date"); value != "" {
+		var err error
+		if date, err = parseDate(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	banks, changes, err := netWorthHistory(db, owner, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	InfoLogger.Println("Net Worth computed.")
+
+	if err := json.NewEncoder(w).Encode(netWorthSeries(banks, changes, date, date)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Stored net worth snapshots of the user in date order, optionally limited by from/to dates and
+// currency. With period=week, month or year (day by default), the last snapshot of every period.
+func netWorthHistoryProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	query := r.URL.Query()
+	period := query.Get("period")
+	if period == "" {
+		period = "day"
+	}
+	if !NETWORTH_PERIODS[period] {
+		http.Error(w, fmt.Sprintf("invalid period %q, expected day, week, month or year", period), http.StatusBadRequest)
+		return
+	}
+	dates, err := parseDateRange(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var f filter
+	f.add("ownerid=?", owner)
+	if dates.From != "" {
+		f.add("taken_on>=?", dates.From)
+	}
+	if dates.To != "" {
+		f.add("taken_on<=?", dates.To)
+	}
+	if currency := query.Get("currency"); currency != "" {
+		f.add("currency=?", currency)
+	}
+
+	rows, err := db.Query(
+		"SELECT * FROM (SELECT DISTINCT ON (currency, date_trunc('"+period+"', taken_on)) "+
+			"to_char(taken_on, 'YYYY-MM-DD'), currency, assets, liabilities FROM public.networthsnapshot"+f.where()+
+			" ORDER BY currency, date_trunc('"+period+"', taken_on), taken_on DESC) snapshots ORDER BY 1, 2;",
+		f.args...,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	defer rows.Close()
+
+	history := []NetWorth{}
+	for rows.Next() {
+		var worth NetWorth
+		if err := rows.Scan(&worth.Date, &worth.Currency, &worth.Assets, &worth.Liabilities); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		worth.NetWorth = worth.Assets - worth.Liabilities
+		history = append(history, worth)
+	}
+	InfoLogger.Println("Net Worth history retrieved.")
+
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Rebuild the net worth snapshots of the user from the line items, for every day from from (the
+// first opening date or line item) to to (today)
+func netWorthRebuildProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	query := r.URL.Query()
+	dates, err := parseDateRange(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if dates.To == "" {
+		dates.To = today()
+	}
+	if dates.To > today() {
+		http.Error(w, fmt.Sprintf("invalid to %s, expected a date up to today", dates.To), http.StatusBadRequest)
+		return
+	}
+
+	if dates.From == "" {
+		var first sql.NullString
+		err := db.QueryRow(
+			`SELECT to_char(least(min(b.opening_date), min(l.occurred_on)), 'YYYY-MM-DD') FROM public.bankaccount b
+			LEFT JOIN public.lineitem l ON l.bank = b.id WHERE b.ownerid = $1;`,
+			owner,
+		).Scan(&first)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		dates.From = dates.To
+		if first.Valid && first.String < dates.To {
+			dates.From = first.String
+		}
+	}
+
+	from, _ := parseDate(dates.From)
+	to, _ := parseDate(dates.To)
+	if to.Before(from) {
+		http.Error(w, fmt.Sprintf("from %s is after to %s", dates.From, dates.To), http.StatusBadRequest)
+		return
+	}
+
+	rebuild := NetWorthRebuild{From: dates.From, To: dates.To}
+	if rebuild.Snapshots, err = saveSnapshots(owner, from, to); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	InfoLogger.Printf("Rebuilt %d net worth snapshots.", rebuild.Snapshots)
+
+	if err := json.NewEncoder(w).Encode(rebuild); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
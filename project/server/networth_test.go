@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsLiability(t *testing.T) {
+	tests := []struct {
+		name        string
+		accountType string
+		want        bool
+	}{
+		{
+			name:        "Checking",
+			accountType: ACCOUNT_CHECKING,
+			want:        false,
+		},
+		{
+			name:        "Savings",
+			accountType: ACCOUNT_SAVINGS,
+			want:        false,
+		},
+		{
+			name:        "Credit card",
+			accountType: ACCOUNT_CREDIT,
+			want:        true,
+		},
+		{
+			name:        "Loan",
+			accountType: ACCOUNT_LOAN,
+			want:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isLiability(tt.accountType); got != tt.want {
+				t.Errorf("isLiability(%q) = %v, want %v", tt.accountType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNetWorthSeries(t *testing.T) {
+	banks := []BankAccount{
+		{Id: 1, Name: "Checking", Currency: "USD", AccountType: ACCOUNT_CHECKING, OpeningBalance: 100000, OpeningDate: "2021-03-02"},
+		{Id: 2, Name: "Card", Currency: "USD", AccountType: ACCOUNT_CREDIT},
+		{Id: 3, Name: "Savings", Currency: "EUR", AccountType: ACCOUNT_SAVINGS, OpeningBalance: 50000, OpeningDate: "2021-03-03"},
+	}
+	changes := map[int]map[string]Money{
+		1: {"2021-03-02": -5000, "2021-03-03": 2000},
+		2: {"2021-03-01": -3000, "2021-03-03": 1000},
+	}
+	checking := func(balance Money) NetWorthAccount {
+		return NetWorthAccount{Bank: 1, Name: "Checking", AccountType: ACCOUNT_CHECKING, Balance: balance}
+	}
+	card := func(balance Money) NetWorthAccount {
+		return NetWorthAccount{Bank: 2, Name: "Card", AccountType: ACCOUNT_CREDIT, Balance: balance}
+	}
+	lastDay := []NetWorth{
+		{Date: "2021-03-03", Currency: "EUR", Assets: 50000, NetWorth: 50000,
+			Accounts: []NetWorthAccount{{Bank: 3, Name: "Savings", AccountType: ACCOUNT_SAVINGS, Balance: 50000}}},
+		{Date: "2021-03-03", Currency: "USD", Assets: 97000, Liabilities: 2000, NetWorth: 95000,
+			Accounts: []NetWorthAccount{checking(97000), card(-2000)}},
+	}
+
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want []NetWorth
+	}{
+		{
+			name: "Accounts counted from their opening date",
+			from: "2021-03-01",
+			to:   "2021-03-03",
+			want: append([]NetWorth{
+				{Date: "2021-03-01", Currency: "USD", Liabilities: 3000, NetWorth: -3000, Accounts: []NetWorthAccount{card(-3000)}},
+				{Date: "2021-03-02", Currency: "USD", Assets: 95000, Liabilities: 3000, NetWorth: 92000,
+					Accounts: []NetWorthAccount{checking(95000), card(-3000)}},
+			}, lastDay...),
+		},
+		{
+			name: "Changes before the first day",
+			from: "2021-03-03",
+			to:   "2021-03-03",
+			want: lastDay,
+		},
+		{
+			name: "Before the opening dates",
+			from: "2021-02-28",
+			to:   "2021-02-28",
+			want: []NetWorth{{Date: "2021-02-28", Currency: "USD", Accounts: []NetWorthAccount{card(0)}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, _ := parseDate(tt.from)
+			to, _ := parseDate(tt.to)
+			if got := netWorthSeries(banks, changes, from, to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("netWorthSeries = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
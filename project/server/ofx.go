@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Transactions read from an OFX or QIF statement
+type Statement struct {
+	Currency  string // empty if the file does not name one
+	LineItems []LineItem
+	Errors    []ImportRowError
+}
+
+// statementIds gives transactions without an id of their own (QIF files, and OFX files
+// without FITID) one derived from their fields. Identical transactions of a file are
+// numbered, so they stay apart but get the same ids when the file is imported again.
+type statementIds map[string]int
+
+func (ids statementIds) derive(fields ...string) string {
+	key := strings.Join(fields, "\x00")
+	ids[key]++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d", key, ids[key])))
+	return "derived:" + hex.EncodeToString(sum[:8])
+}
+
+// An element of an OFX document: an opening tag with the text that follows it, or a closing tag
+type ofxToken struct {
+	Name    string
+	Closing bool
+	Text    string
+	Line    int
+}
+
+// ofxTokens splits the body of an OFX document into tags.
+// Version 1 files are SGML where elements holding a value are not closed, version 2 files
+// are XML; reading the text that follows every opening tag works for both.
+func ofxTokens(document string) ([]ofxToken, error) {
+	start := strings.Index(strings.ToUpper(document), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("not an OFX file, <OFX> not found")
+	}
+	line := strings.Count(document[:start], "\n") + 1
+	document = document[start:]
+
+	var tokens []ofxToken
+	for len(document) > 0 {
+		open := strings.Index(document, "<")
+		if open < 0 {
+			break
+		}
+		line += strings.Count(document[:open], "\n")
+		end := strings.Index(document[open:], ">")
+		if end < 0 {
+			return nil, fmt.Errorf("line %d: unterminated tag", line)
+		}
+		tag := document[open+1 : open+end]
+		document = document[open+end+1:]
+
+		next := strings.Index(document, "<")
+		if next < 0 {
+			next = len(document)
+		}
+		text := document[:next]
+
+		token := ofxToken{Line: line, Text: html.UnescapeString(strings.TrimSpace(text))}
+		if strings.HasPrefix(tag, "/") {
+			token.Closing = true
+			tag = tag[1:]
+		}
+		// Skip XML declarations, processing instructions and comments
+		if strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!") {
+			continue
+		}
+		token.Name = strings.ToUpper(strings.TrimSpace(strings.TrimSuffix(tag, "/")))
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// parseOFXDate reads the date of an OFX date time, YYYYMMDD followed by an optional time and zone.
+// The date is taken as written, without converting between time zones.
+func parseOFXDate(value string) (string, error) {
+	if len(value) < 8 {
+		return "", fmt.Errorf("invalid date %q", value)
+	}
+	date, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q", value)
+	}
+	return date.Format(DATE_LAYOUT), nil
+}
+
+// parseOFX reads the transactions of an OFX statement, version 1 (SGML) or 2 (XML).
+// Every transaction keeps its FITID. Transactions that can not be read are reported
+// with the line of their <STMTTRN> tag.
+func parseOFX(file io.Reader) (Statement, error) {
+	var statement Statement
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return statement, err
+	}
+	tokens, err := ofxTokens(string(content))
+	if err != nil {
+		return statement, err
+	}
+
+	ids := statementIds{}
+	var fields map[string]string
+	var line int
+	for _, token := range tokens {
+		switch {
+		case token.Name == "CURDEF" && !token.Closing:
+			statement.Currency = strings.ToUpper(token.Text)
+		case token.Name == "STMTTRN" && !token.Closing:
+			fields = map[string]string{}
+			line = token.Line
+		case token.Name == "STMTTRN" && token.Closing && fields != nil:
+			lineitem, err := ofxLineItem(fields, ids)
+			if err != nil {
+				statement.Errors = append(statement.Errors, ImportRowError{Row: line, Error: err.Error()})
+			} else {
+				statement.LineItems = append(statement.LineItems, lineitem)
+			}
+			fields = nil
+		case fields != nil && !token.Closing && token.Text != "":
+			fields[token.Name] = token.Text
+		}
+	}
+	if fields != nil {
+		statement.Errors = append(statement.Errors, ImportRowError{Row: line, Error: "transaction not closed"})
+	}
+	return statement, nil
+}
+
+// ofxLineItem builds the line item of the fields of one <STMTTRN>.
+func ofxLineItem(fields map[string]string, ids statementIds) (LineItem, error) {
+	var lineitem LineItem
+	var err error
+
+	if lineitem.OccurredOn, err = parseOFXDate(fields["DTPOSTED"]); err != nil {
+		return lineitem, err
+	}
+
+	amount := fields["TRNAMT"]
+	decimalSeparator := "."
+	if strings.Contains(amount, ",") && !strings.Contains(amount, ".") {
+		decimalSeparator = ","
+	}
+	if lineitem.Amount, err = parseStatementAmount(amount, decimalSeparator); err != nil || amount == "" {
+		return lineitem, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	lineitem.Title = fields["NAME"]
+	lineitem.Description = fields["MEMO"]
+	if lineitem.Title == "" {
+		lineitem.Title, lineitem.Description = lineitem.Description, ""
+	}
+	if lineitem.Title == "" {
+		lineitem.Title = fields["TRNTYPE"]
+	}
+
+	lineitem.FitId = fields["FITID"]
+	if lineitem.FitId == "" {
+		lineitem.FitId = ids.derive(lineitem.OccurredOn, lineitem.Amount.String(), lineitem.Title, lineitem.Description, fields["CHECKNUM"])
+	}
+	return lineitem, nil
+}
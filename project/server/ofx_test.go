@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func readStatement(t *testing.T, path string, parse func(*os.File) (Statement, error)) Statement {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	statement, err := parse(file)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return statement
+}
+
+func checkLineItems(t *testing.T, got []LineItem, want []LineItem) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d line items, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		// Derived ids are only checked for their form
+		if strings.HasPrefix(want[i].FitId, "derived:") && strings.HasPrefix(got[i].FitId, "derived:") {
+			want[i].FitId = got[i].FitId
+		}
+		if got[i] != want[i] {
+			t.Errorf("line item %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseOFXSGML(t *testing.T) {
+	statement := readStatement(t, "testdata/statement-v1.ofx", func(file *os.File) (Statement, error) { return parseOFX(file) })
+
+	if statement.Currency != "USD" {
+		t.Errorf("Currency = %q, want USD", statement.Currency)
+	}
+	checkLineItems(t, statement.LineItems, []LineItem{
+		{Title: "ACME PAYROLL", Description: "Salary March", Amount: 250000, OccurredOn: "2021-03-01", FitId: "202103010001"},
+		{Title: "Smith & Sons Grocery", Amount: -4510, OccurredOn: "2021-03-02", FitId: "202103020002"},
+		{Title: "Rent", Amount: -120000, OccurredOn: "2021-03-05", FitId: "202103050003"},
+	})
+	if len(statement.Errors) != 1 || statement.Errors[0].Row != 62 {
+		t.Errorf("Errors = %+v, want the transaction on line 62", statement.Errors)
+	}
+}
+
+func TestParseOFXXML(t *testing.T) {
+	statement := readStatement(t, "testdata/statement-v2.ofx", func(file *os.File) (Statement, error) { return parseOFX(file) })
+
+	if statement.Currency != "EUR" {
+		t.Errorf("Currency = %q, want EUR", statement.Currency)
+	}
+	if len(statement.Errors) > 0 {
+		t.Errorf("Errors = %+v, want none", statement.Errors)
+	}
+	checkLineItems(t, statement.LineItems, []LineItem{
+		{Title: "Streaming Service", Description: "Monthly plan", Amount: -1999, OccurredOn: "2021-03-10", FitId: "CC-7781"},
+		{Title: "Cashback", Amount: 500, OccurredOn: "2021-03-15", FitId: "derived:"},
+		{Title: "Cashback", Amount: 500, OccurredOn: "2021-03-15", FitId: "derived:"},
+	})
+
+	// Identical transactions without FITID get different ids, the same ones on every import
+	if statement.LineItems[1].FitId == statement.LineItems[2].FitId {
+		t.Errorf("identical transactions share the id %s", statement.LineItems[1].FitId)
+	}
+	again := readStatement(t, "testdata/statement-v2.ofx", func(file *os.File) (Statement, error) { return parseOFX(file) })
+	for i := range again.LineItems {
+		if again.LineItems[i].FitId != statement.LineItems[i].FitId {
+			t.Errorf("line item %d has id %s on the second import, %s on the first", i, again.LineItems[i].FitId, statement.LineItems[i].FitId)
+		}
+	}
+}
+
+func TestParseOFXInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{
+			name:     "Not OFX",
+			document: "Date,Payee,Amount\n2021-03-01,Coffee,-3.50\n",
+		},
+		{
+			name:     "Unterminated tag",
+			document: "<OFX><STMTTRN><TRNAMT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseOFX(strings.NewReader(tt.document)); err == nil {
+				t.Errorf("parseOFX accepted the document")
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PINs are stored as salted PBKDF2-HMAC-SHA256 hashes, in the form
+// pbkdf2-sha256$<iterations>$<salt>$<hash> (salt and hash base64 encoded).
+// The iteration count is stored with each hash so it can be raised later
+// without invalidating existing accounts.
+const (
+	PIN_HASH_SCHEME     = "pbkdf2-sha256"
+	PIN_HASH_ITERATIONS = 600000
+	PIN_SALT_LENGTH     = 16
+	PIN_KEY_LENGTH      = 32
+)
+
+// Hash compared against when the username does not exist, so that
+// unknown usernames take as long to reject as wrong PINs.
+// Computed on first use, not on every start.
+var (
+	dummyPinHashOnce sync.Once
+	dummyPinHash     string
+)
+
+// dummyHash returns dummyPinHash, hashing it the first time.
+func dummyHash() string {
+	dummyPinHashOnce.Do(func() {
+		dummyPinHash = hashPin(0)
+	})
+	return dummyPinHash
+}
+
+// pbkdf2 derives a key of keyLen bytes from password and salt (RFC 8018).
+func pbkdf2(password []byte, salt []byte, iterations int, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	buf := make([]byte, 4)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf, uint32(block))
+		prf.Write(buf)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// hashPin returns the encoded salted hash of a PIN.
+func hashPin(pin int) string {
+	salt := make([]byte, PIN_SALT_LENGTH)
+	if _, err := rand.Read(salt); err != nil {
+		panic(err)
+	}
+	key := pbkdf2([]byte(strconv.Itoa(pin)), salt, PIN_HASH_ITERATIONS, PIN_KEY_LENGTH)
+
+	return fmt.Sprintf("%s$%d$%s$%s",
+		PIN_HASH_SCHEME,
+		PIN_HASH_ITERATIONS,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// verifyPin reports whether pin matches the encoded hash.
+func verifyPin(pin int, encoded string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != PIN_HASH_SCHEME {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	got := pbkdf2([]byte(strconv.Itoa(pin)), salt, iterations, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// hashLegacyPins replaces the plain PINs of accounts created before PINs were hashed.
+// Runs on startup, accounts already migrated are left untouched.
+func hashLegacyPins(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, pin FROM public.useraccount WHERE pin_hash IS NULL AND pin IS NOT NULL;")
+	if err != nil {
+		return err
+	}
+
+	legacy := map[int]int{}
+	for rows.Next() {
+		var id, pin int
+		if err := rows.Scan(&id, &pin); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy[id] = pin
+	}
+	rows.Close()
+
+	for id, pin := range legacy {
+		_, err := db.Exec("UPDATE public.useraccount SET pin_hash=$1, pin=NULL WHERE id=$2 AND pin_hash IS NULL;", hashPin(pin), id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(legacy) > 0 {
+		InfoLogger.Printf("Hashed the PIN of %d existing user accounts.", len(legacy))
+	}
+	return nil
+}
+
+var errInvalidPin = errors.New("invalid username or PIN")
+
+// checkPin looks up the user account with the given username and checks its PIN.
+// Returns errInvalidPin if the username does not exist or the PIN does not match.
+func checkPin(db *sql.DB, username string, pin int) (UserAccount, error) {
+	var user UserAccount
+	var pinHash sql.NullString
+	err := db.QueryRow("SELECT "+USER_COLUMNS+", pin_hash FROM public.useraccount WHERE username=$1;", username).Scan(
+		&user.Id,
+		&user.Username,
+		&user.Name,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&pinHash,
+	)
+
+	if err == sql.ErrNoRows {
+		verifyPin(pin, dummyHash())
+		return UserAccount{}, errInvalidPin
+	}
+	if err != nil {
+		return UserAccount{}, err
+	}
+	if !pinHash.Valid || !verifyPin(pin, pinHash.String) {
+		return UserAccount{}, errInvalidPin
+	}
+
+	return user, nil
+}
+
+// Change the PIN of a user account
+// The current PIN must be supplied, a valid session alone is not enough.
+// Every other session of the user is revoked once the PIN changed.
+func userPinProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if id != owner {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		WarningLogger.Println("Access to another user account denied. Ignoring request...")
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		var change PinChange
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var username string
+		err := db.QueryRow("SELECT username FROM public.useraccount WHERE id=$1;", id).Scan(&username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		// Failures count towards the same throttle and lockout as /authorize, so the PIN cannot
+		// be guessed here instead
+		ip := clientIP(r)
+		userKey := "user:" + username
+		ipKey := "ip:" + ip
+
+		wait, userLocked := loginLimiter.Reserve(userKey)
+		ipLocked := false
+		if wait == 0 {
+			if wait, ipLocked = loginLimiter.Reserve(ipKey); wait > 0 {
+				loginLimiter.Release(userKey)
+			}
+		}
+		if wait > 0 {
+			w.Header().Set("Retry-After", retryAfter(wait))
+			http.Error(w, "Too many failed attempts. Try again later.", http.StatusTooManyRequests)
+			WarningLogger.Println("PIN change throttled for username " + username + " from " + ip + ".")
+			return
+		}
+
+		user, err := checkPin(db, username, change.OldPin)
+		if err == errInvalidPin {
+			if userLocked {
+				WarningLogger.Println("Username " + username + " locked out after repeated failed PIN changes.")
+			}
+			if ipLocked {
+				WarningLogger.Println("Client " + ip + " locked out after repeated failed PIN changes.")
+			}
+			http.Error(w, "Current PIN does not match.", http.StatusForbidden)
+			WarningLogger.Println("PIN change rejected, current PIN does not match.")
+			return
+		}
+		if err != nil {
+			loginLimiter.Release(userKey)
+			loginLimiter.Release(ipKey)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		loginLimiter.Success(userKey)
+		loginLimiter.Release(ipKey)
+
+		_, err = db.Exec("UPDATE public.useraccount SET pin_hash=$1 WHERE id=$2;", hashPin(change.NewPin), id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		claims, _ := verifyToken(bearerToken(r))
+		_, err = db.Exec("UPDATE public.session SET revoked_at=now() WHERE userid=$1 AND id<>$2 AND revoked_at IS NULL;", id, claims.Session)
+		checkError(err)
+		InfoLogger.Println("PIN of a specific user changed.")
+
+		if err := json.NewEncoder(w).Encode(user); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring request...")
+		return
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPbkdf2(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 test vectors, as published alongside RFC 6070 and in RFC 7914 section 11
+	tests := []struct {
+		name       string
+		password   string
+		salt       string
+		iterations int
+		keyLen     int
+		want       string
+	}{
+		{
+			name:       "One iteration",
+			password:   "password",
+			salt:       "salt",
+			iterations: 1,
+			keyLen:     32,
+			want:       "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b",
+		},
+		{
+			name:       "Two iterations",
+			password:   "password",
+			salt:       "salt",
+			iterations: 2,
+			keyLen:     32,
+			want:       "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43",
+		},
+		{
+			name:       "4096 iterations",
+			password:   "password",
+			salt:       "salt",
+			iterations: 4096,
+			keyLen:     32,
+			want:       "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a",
+		},
+		{
+			name:       "Key longer than one block",
+			password:   "passwordPASSWORDpassword",
+			salt:       "saltSALTsaltSALTsaltSALTsaltSALTsalt",
+			iterations: 4096,
+			keyLen:     40,
+			want:       "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9",
+		},
+		{
+			name:       "RFC 7914 two blocks",
+			password:   "passwd",
+			salt:       "salt",
+			iterations: 1,
+			keyLen:     64,
+			want:       "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hex.EncodeToString(pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+			if got != tt.want {
+				t.Errorf("pbkdf2(%q, %q, %d, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, tt.keyLen, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashPin(t *testing.T) {
+	encoded := hashPin(1234)
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != PIN_HASH_SCHEME || parts[1] != "600000" {
+		t.Fatalf("hashPin(1234) = %q, want %s$%d$<salt>$<hash>", encoded, PIN_HASH_SCHEME, PIN_HASH_ITERATIONS)
+	}
+	if encoded == hashPin(1234) {
+		t.Errorf("hashPin(1234) returned the same hash twice, want a new salt every time")
+	}
+
+	tests := []struct {
+		name string
+		pin  int
+		want bool
+	}{
+		{
+			name: "Matching PIN",
+			pin:  1234,
+			want: true,
+		},
+		{
+			name: "Wrong PIN",
+			pin:  1235,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPin(tt.pin, encoded); got != tt.want {
+				t.Errorf("verifyPin(%d) = %v, want %v", tt.pin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPinMalformed(t *testing.T) {
+	// "1234" hashed with one iteration and the salt "salt"
+	key := pbkdf2([]byte("1234"), []byte("salt"), 1, PIN_KEY_LENGTH)
+	valid := PIN_HASH_SCHEME + "$1$c2FsdA$" + base64.RawStdEncoding.EncodeToString(key)
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{
+			name:    "Well formed",
+			encoded: valid,
+			want:    true,
+		},
+		{
+			name:    "Empty",
+			encoded: "",
+			want:    false,
+		},
+		{
+			name:    "Plain PIN",
+			encoded: "1234",
+			want:    false,
+		},
+		{
+			name:    "Unknown scheme",
+			encoded: strings.Replace(valid, PIN_HASH_SCHEME, "bcrypt", 1),
+			want:    false,
+		},
+		{
+			name:    "Missing part",
+			encoded: PIN_HASH_SCHEME + "$1$c2FsdA",
+			want:    false,
+		},
+		{
+			name:    "Invalid iterations",
+			encoded: strings.Replace(valid, "$1$", "$x$", 1),
+			want:    false,
+		},
+		{
+			name:    "Zero iterations",
+			encoded: strings.Replace(valid, "$1$", "$0$", 1),
+			want:    false,
+		},
+		{
+			name:    "Invalid salt",
+			encoded: strings.Replace(valid, "c2FsdA", "c2F*dA", 1),
+			want:    false,
+		},
+		{
+			name:    "Invalid hash",
+			encoded: valid + "*",
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPin(1234, tt.encoded); got != tt.want {
+				t.Errorf("verifyPin(1234, %q) = %v, want %v", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+// legacyDriver is a database/sql driver serving the user accounts with plain PINs to
+// hashLegacyPins and recording the PIN hashes it stores
+type legacyDriver struct {
+	pins   [][]driver.Value
+	hashed map[int64]string
+}
+
+func (d *legacyDriver) Open(name string) (driver.Conn, error) { return legacyConn{d}, nil }
+
+type legacyConn struct{ d *legacyDriver }
+
+func (c legacyConn) Prepare(query string) (driver.Stmt, error) {
+	return legacyStmt{c.d}, nil
+}
+func (c legacyConn) Close() error              { return nil }
+func (c legacyConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type legacyStmt struct{ d *legacyDriver }
+
+func (s legacyStmt) Close() error  { return nil }
+func (s legacyStmt) NumInput() int { return -1 }
+
+func (s legacyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.hashed[args[1].(int64)] = args[0].(string)
+	return driver.RowsAffected(1), nil
+}
+
+func (s legacyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &legacyRows{rows: s.d.pins}, nil
+}
+
+type legacyRows struct {
+	rows [][]driver.Value
+}
+
+func (r *legacyRows) Columns() []string { return []string{"id", "pin"} }
+func (r *legacyRows) Close() error      { return nil }
+
+func (r *legacyRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestHashLegacyPins(t *testing.T) {
+	legacy := &legacyDriver{
+		pins:   [][]driver.Value{{int64(1), int64(1234)}, {int64(2), int64(42)}},
+		hashed: map[int64]string{},
+	}
+	sql.Register("legacypins", legacy)
+	db, err := sql.Open("legacypins", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := hashLegacyPins(db); err != nil {
+		t.Fatalf("hashLegacyPins error = %v", err)
+	}
+	if len(legacy.hashed) != 2 {
+		t.Fatalf("hashLegacyPins hashed %d accounts, want 2", len(legacy.hashed))
+	}
+	if !verifyPin(1234, legacy.hashed[1]) || !verifyPin(42, legacy.hashed[2]) {
+		t.Errorf("hashLegacyPins stored %v, want the hashes of 1234 and 42", legacy.hashed)
+	}
+}
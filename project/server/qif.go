@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Account types of QIF transaction lists that can be imported
+var qifAccountTypes = map[string]bool{
+	"bank":  true,
+	"cash":  true,
+	"ccard": true,
+	"oth a": true,
+	"oth l": true,
+}
+
+// parseQIFDate reads a QIF date. Quicken writes month/day/year, with a two digit year
+// after an apostrophe for years from 2000 (3/ 5'21); dayFirst reads day/month/year instead.
+// Four digit years and year-month-day dates are read as well.
+func parseQIFDate(value string, dayFirst bool) (string, error) {
+	invalid := fmt.Errorf("invalid date %q", value)
+
+	since2000 := strings.Contains(value, "'")
+	parts := strings.FieldsFunc(strings.ReplaceAll(value, " ", ""), func(r rune) bool {
+		return r == '/' || r == '\'' || r == '-' || r == '.'
+	})
+	if len(parts) != 3 {
+		return "", invalid
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return "", invalid
+		}
+		numbers[i] = n
+	}
+
+	var year, month, day int
+	switch {
+	case len(parts[0]) == 4:
+		year, month, day = numbers[0], numbers[1], numbers[2]
+	case dayFirst:
+		day, month, year = numbers[0], numbers[1], numbers[2]
+	default:
+		month, day, year = numbers[0], numbers[1], numbers[2]
+	}
+	if len(parts[2]) <= 2 && len(parts[0]) != 4 {
+		if since2000 || year < 70 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+		return "", invalid
+	}
+	return date.Format(DATE_LAYOUT), nil
+}
+
+// parseQIF reads the transactions of a QIF file: bank, cash, credit card and other asset
+// or liability lists. Investment lists and the other sections are skipped.
+// QIF has no transaction ids, so every line item gets one derived from its fields.
+// Transactions that can not be read are reported with the line they start on.
+func parseQIF(file io.Reader, dayFirst bool) (Statement, error) {
+	var statement Statement
+	scanner := bufio.NewScanner(file)
+
+	ids := statementIds{}
+	importing := false
+	sections := 0
+	fields := map[string]string{}
+	start := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "!") {
+			header := strings.ToLower(text)
+			if strings.HasPrefix(header, "!type:") {
+				importing = qifAccountTypes[strings.TrimSpace(strings.TrimPrefix(header, "!type:"))]
+				if importing {
+					sections++
+				}
+			} else if !strings.HasPrefix(header, "!option") && !strings.HasPrefix(header, "!clear") {
+				importing = false
+			}
+			fields = map[string]string{}
+			continue
+		}
+		if !importing {
+			continue
+		}
+
+		if len(fields) == 0 {
+			start = line
+		}
+		if text[0] != '^' {
+			// Split lines (S, E, $) describe categories, the first value of a code is kept
+			code := text[:1]
+			if _, ok := fields[code]; !ok {
+				fields[code] = strings.TrimSpace(text[1:])
+			}
+			continue
+		}
+
+		if len(fields) > 0 {
+			lineitem, err := qifLineItem(fields, dayFirst, ids)
+			if err != nil {
+				statement.Errors = append(statement.Errors, ImportRowError{Row: start, Error: err.Error()})
+			} else {
+				statement.LineItems = append(statement.LineItems, lineitem)
+			}
+		}
+		fields = map[string]string{}
+	}
+	if err := scanner.Err(); err != nil {
+		return statement, err
+	}
+	if sections == 0 {
+		return statement, errors.New("not a QIF file, no !Type:Bank, Cash, CCard, Oth A or Oth L section found")
+	}
+	if len(fields) > 0 {
+		statement.Errors = append(statement.Errors, ImportRowError{Row: start, Error: "transaction not ended with ^"})
+	}
+	return statement, nil
+}
+
+// qifLineItem builds the line item of the fields of one QIF transaction.
+func qifLineItem(fields map[string]string, dayFirst bool, ids statementIds) (LineItem, error) {
+	var lineitem LineItem
+	var err error
+
+	if lineitem.OccurredOn, err = parseQIFDate(fields["D"], dayFirst); err != nil {
+		return lineitem, err
+	}
+
+	amount, ok := fields["T"]
+	if !ok {
+		amount = fields["U"]
+	}
+	decimalSeparator := "."
+	if strings.Contains(amount, ",") && !strings.Contains(amount, ".") {
+		decimalSeparator = ","
+	}
+	if lineitem.Amount, err = parseStatementAmount(amount, decimalSeparator); err != nil || amount == "" {
+		return lineitem, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	lineitem.Title = fields["P"]
+	lineitem.Description = fields["M"]
+	if lineitem.Title == "" {
+		lineitem.Title, lineitem.Description = lineitem.Description, ""
+	}
+	if lineitem.Title == "" {
+		lineitem.Title = fields["L"]
+	}
+	if lineitem.Title == "" {
+		return lineitem, errors.New("transaction without payee or memo")
+	}
+
+	lineitem.FitId = ids.derive(lineitem.OccurredOn, lineitem.Amount.String(), lineitem.Title, lineitem.Description, fields["N"])
+	return lineitem, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseQIFDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		dayFirst bool
+		date     string
+	}{
+		{
+			name:     "Apostrophe year",
+			value:    "3/ 5'21",
+			dayFirst: false,
+			date:     "2021-03-05",
+		},
+		{
+			name:     "Month first",
+			value:    "03/05/2021",
+			dayFirst: false,
+			date:     "2021-03-05",
+		},
+		{
+			name:     "Two digit year in the 1900s",
+			value:    "3/5/98",
+			dayFirst: false,
+			date:     "1998-03-05",
+		},
+		{
+			name:     "Two digit year in the 2000s",
+			value:    "3/5/05",
+			dayFirst: false,
+			date:     "2005-03-05",
+		},
+		{
+			name:     "Apostrophe year in the 2000s",
+			value:    "12/31'99",
+			dayFirst: false,
+			date:     "2099-12-31",
+		},
+		{
+			name:     "Day first",
+			value:    "05/03/2021",
+			dayFirst: true,
+			date:     "2021-03-05",
+		},
+		{
+			name:     "Day first with dots",
+			value:    "5.3.21",
+			dayFirst: true,
+			date:     "2021-03-05",
+		},
+		{
+			name:     "ISO date",
+			value:    "2021-03-05",
+			dayFirst: false,
+			date:     "2021-03-05",
+		},
+		{
+			name:     "Invalid day",
+			value:    "2/30'21",
+			dayFirst: false,
+			date:     "",
+		},
+		{
+			name:     "Invalid month",
+			value:    "13/01/2021",
+			dayFirst: false,
+			date:     "",
+		},
+		{
+			name:     "Month name",
+			value:    "March 5",
+			dayFirst: false,
+			date:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, err := parseQIFDate(tt.value, tt.dayFirst)
+			if tt.date == "" {
+				if err == nil {
+					t.Errorf("parseQIFDate(%q) = %s, want an error", tt.value, date)
+				}
+				return
+			}
+			if err != nil || date != tt.date {
+				t.Errorf("parseQIFDate(%q, %v) = %q, %v, want %s", tt.value, tt.dayFirst, date, err, tt.date)
+			}
+		})
+	}
+}
+
+func TestParseQIF(t *testing.T) {
+	parse := func(file *os.File) (Statement, error) { return parseQIF(file, false) }
+	statement := readStatement(t, "testdata/statement.qif", parse)
+
+	checkLineItems(t, statement.LineItems, []LineItem{
+		{Title: "ACME Payroll", Description: "Salary March", Amount: 250000, OccurredOn: "2021-03-01", FitId: "derived:"},
+		{Title: "Grocery", Amount: -4510, OccurredOn: "2021-03-02", FitId: "derived:"},
+		{Title: "Landlord", Description: "Rent", Amount: -120000, OccurredOn: "2021-03-05", FitId: "derived:"},
+		{Title: "Coffee", Amount: -350, OccurredOn: "2021-03-07", FitId: "derived:"},
+		{Title: "Coffee", Amount: -350, OccurredOn: "2021-03-07", FitId: "derived:"},
+	})
+	if len(statement.Errors) != 1 || statement.Errors[0].Row != 35 {
+		t.Errorf("Errors = %+v, want the transaction on line 35", statement.Errors)
+	}
+
+	// The two coffees are told apart, and keep their ids when the file is imported again
+	if statement.LineItems[3].FitId == statement.LineItems[4].FitId {
+		t.Errorf("identical transactions share the id %s", statement.LineItems[3].FitId)
+	}
+	again := readStatement(t, "testdata/statement.qif", parse)
+	known := map[string]bool{}
+	for _, lineitem := range statement.LineItems {
+		known[lineitem.FitId] = true
+	}
+	if fresh, duplicates := splitDuplicates(again.LineItems, known); len(fresh) != 0 || duplicates != len(statement.LineItems) {
+		t.Errorf("importing the file again creates %d line items and skips %d, want all skipped", len(fresh), duplicates)
+	}
+}
+
+func TestParseQIFWithoutTransactions(t *testing.T) {
+	file, err := os.Open("testdata/statement-v1.ofx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := parseQIF(file, false); err == nil {
+		t.Error("parseQIF accepted an OFX file")
+	}
+}
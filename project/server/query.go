@@ -0,0 +1,201 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Page size of the collection endpoints when no limit is given, and the largest limit accepted
+const (
+	DEFAULT_PAGE_SIZE = 100
+	MAX_PAGE_SIZE     = 1000
+)
+
+// ListOptions are the paging and sorting parameters shared by the collection endpoints:
+// limit, offset, sort (a field name) and order (asc or desc).
+type ListOptions struct {
+	Limit  int
+	Offset int
+	Sort   string // column to sort by
+	Desc   bool
+}
+
+// parseListOptions reads the paging and sorting parameters.
+// sortable maps the field names accepted by sort to their columns.
+func parseListOptions(query url.Values, sortable map[string]string, defaultSort string) (ListOptions, error) {
+	options := ListOptions{Limit: DEFAULT_PAGE_SIZE, Sort: sortable[defaultSort]}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MAX_PAGE_SIZE {
+			return options, fmt.Errorf("invalid limit %q, expected 1 to %d", value, MAX_PAGE_SIZE)
+		}
+		options.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return options, fmt.Errorf("invalid offset %q", value)
+		}
+		options.Offset = offset
+	}
+	if value := query.Get("sort"); value != "" {
+		column, ok := sortable[value]
+		if !ok {
+			return options, fmt.Errorf("can not sort by %q", value)
+		}
+		options.Sort = column
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		options.Desc = true
+	default:
+		return options, fmt.Errorf("invalid order %q, expected asc or desc", query.Get("order"))
+	}
+	return options, nil
+}
+
+// orderBy returns the ORDER BY, LIMIT and OFFSET clauses.
+// Ties are broken by id, so pages do not overlap or skip rows.
+func (o ListOptions) orderBy() string {
+	direction := "ASC"
+	if o.Desc {
+		direction = "DESC"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT %d OFFSET %d", o.Sort, direction, direction, o.Limit, o.Offset)
+}
+
+// filter collects the conditions of a WHERE clause and their arguments.
+// Conditions use ? for their arguments, which are numbered $1, $2, ... in order.
+type filter struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (f *filter) add(condition string, args ...interface{}) {
+	for _, arg := range args {
+		f.args = append(f.args, arg)
+		condition = strings.Replace(condition, "?", "$"+strconv.Itoa(len(f.args)), 1)
+	}
+	f.conditions = append(f.conditions, condition)
+}
+
+func (f filter) where() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// likePattern turns text into an ILIKE pattern matching it anywhere, with its wildcards escaped.
+func likePattern(text string) string {
+	text = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+	return "%" + text + "%"
+}
+
+// queryPage selects one page of the rows of table matching f, and counts all matching rows.
+// The caller must close the rows.
+func queryPage(table string, columns string, f filter, options ListOptions) (*sql.Rows, int, error) {
+	var total int
+	if err := db.QueryRow("SELECT count(*) FROM public."+table+f.where()+";", f.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query("SELECT "+columns+" FROM public."+table+f.where()+options.orderBy()+";", f.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+// Fields the collection endpoints can be sorted by, and their columns
+var (
+	BANK_SORT_FIELDS = map[string]string{
+		"id":         "id",
+		"name":       "\"name\"",
+		"currency":   "currency",
+		"created_at": "created_at",
+	}
+	BUCKET_SORT_FIELDS = map[string]string{
+		"id":         "id",
+		"name":       "\"name\"",
+		"created_at": "created_at",
+	}
+	LINEITEM_SORT_FIELDS = map[string]string{
+		"id":          "id",
+		"occurred_on": "occurred_on",
+		"amount":      "amount",
+		"title":       "title",
+		"created_at":  "created_at",
+	}
+)
+
+// nameFilter reads the q parameter of /banks and /buckets: text the name contains.
+func nameFilter(owner int, query url.Values) filter {
+	var f filter
+	f.add("ownerid=?", owner)
+	if q := query.Get("q"); q != "" {
+		f.add("\"name\" ILIKE ?", likePattern(q))
+	}
+	return f
+}
+
+// lineitemFilter reads the filters of /lineitems:
+// bucket, bank and transfer ids (0 for line items not linked to one), min_amount and max_amount,
+// q (text the title or description contains), and the from/to date range.
+func lineitemFilter(owner int, query url.Values) (filter, error) {
+	var f filter
+	f.add("ownerid=?", owner)
+
+	for _, ref := range []string{"bucket", "bank", "transfer"} {
+		value := query.Get(ref)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 0 {
+			return f, fmt.Errorf("invalid %s %q", ref, value)
+		}
+		if id == 0 {
+			f.add("coalesce(" + ref + ", 0) = 0")
+		} else {
+			f.add(ref+"=?", id)
+		}
+	}
+
+	if value := query.Get("min_amount"); value != "" {
+		amount, err := ParseMoney(value)
+		if err != nil {
+			return f, fmt.Errorf("invalid min_amount %q", value)
+		}
+		f.add("amount >= ?", amount)
+	}
+	if value := query.Get("max_amount"); value != "" {
+		amount, err := ParseMoney(value)
+		if err != nil {
+			return f, fmt.Errorf("invalid max_amount %q", value)
+		}
+		f.add("amount <= ?", amount)
+	}
+
+	if q := query.Get("q"); q != "" {
+		pattern := likePattern(q)
+		f.add("(title ILIKE ? OR description ILIKE ?)", pattern, pattern)
+	}
+
+	dates, err := parseDateRange(query)
+	if err != nil {
+		return f, err
+	}
+	if dates.From != "" {
+		f.add("occurred_on >= ?::date", dates.From)
+	}
+	if dates.To != "" {
+		f.add("occurred_on <= ?::date", dates.To)
+	}
+	return f, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseListOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  ListOptions
+		valid bool
+	}{
+		{
+			name:  "Defaults",
+			query: "",
+			want:  ListOptions{Limit: DEFAULT_PAGE_SIZE, Sort: "occurred_on"},
+			valid: true,
+		},
+		{
+			name:  "Page",
+			query: "limit=10&offset=20",
+			want:  ListOptions{Limit: 10, Offset: 20, Sort: "occurred_on"},
+			valid: true,
+		},
+		{
+			name:  "Sort descending",
+			query: "sort=amount&order=desc",
+			want:  ListOptions{Limit: DEFAULT_PAGE_SIZE, Sort: "amount", Desc: true},
+			valid: true,
+		},
+		{
+			name:  "Order without sort",
+			query: "order=asc",
+			want:  ListOptions{Limit: DEFAULT_PAGE_SIZE, Sort: "occurred_on"},
+			valid: true,
+		},
+		{
+			name:  "Zero limit",
+			query: "limit=0",
+			want:  ListOptions{},
+			valid: false,
+		},
+		{
+			name:  "Limit above maximum",
+			query: "limit=1001",
+			want:  ListOptions{},
+			valid: false,
+		},
+		{
+			name:  "Negative offset",
+			query: "offset=-1",
+			want:  ListOptions{},
+			valid: false,
+		},
+		{
+			name:  "Field not sortable",
+			query: "sort=ownerid",
+			want:  ListOptions{},
+			valid: false,
+		},
+		{
+			name:  "Injected sort field",
+			query: "sort=amount%3Bdrop+table+lineitem",
+			want:  ListOptions{},
+			valid: false,
+		},
+		{
+			name:  "Invalid order",
+			query: "order=up",
+			want:  ListOptions{},
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := parseListOptions(query, LINEITEM_SORT_FIELDS, "occurred_on")
+			if (err == nil) != tt.valid {
+				t.Errorf("parseListOptions(%q) error = %v, want valid %v", tt.query, err, tt.valid)
+				return
+			}
+			if tt.valid && got != tt.want {
+				t.Errorf("parseListOptions(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListOptionsOrderBy(t *testing.T) {
+	options := ListOptions{Limit: 10, Offset: 30, Sort: "amount", Desc: true}
+	want := " ORDER BY amount DESC, id DESC LIMIT 10 OFFSET 30"
+	if got := options.orderBy(); got != want {
+		t.Errorf("orderBy() = %q, want %q", got, want)
+	}
+}
+
+func TestLineitemFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		where string
+		args  []interface{}
+		valid bool
+	}{
+		{
+			name:  "Owner only",
+			query: "",
+			where: " WHERE ownerid=$1",
+			args:  []interface{}{7},
+			valid: true,
+		},
+		{
+			name:  "Bucket and no bank",
+			query: "bucket=3&bank=0",
+			where: " WHERE ownerid=$1 AND bucket=$2 AND coalesce(bank, 0) = 0",
+			args:  []interface{}{7, 3},
+			valid: true,
+		},
+		{
+			name:  "Amount range and search",
+			query: "min_amount=-100&max_amount=-0.5&q=50%25_off",
+			where: " WHERE ownerid=$1 AND amount >= $2 AND amount <= $3 AND (title ILIKE $4 OR description ILIKE $5)",
+			args:  []interface{}{7, Money(-10000), Money(-50), `%50\%\_off%`, `%50\%\_off%`},
+			valid: true,
+		},
+		{
+			name:  "Date range",
+			query: "from=2021-01-01&to=2021-01-31",
+			where: " WHERE ownerid=$1 AND occurred_on >= $2::date AND occurred_on <= $3::date",
+			args:  []interface{}{7, "2021-01-01", "2021-01-31"},
+			valid: true,
+		},
+		{
+			name:  "Invalid bucket",
+			query: "bucket=abc",
+			where: "",
+			args:  nil,
+			valid: false,
+		},
+		{
+			name:  "Negative bank",
+			query: "bank=-1",
+			where: "",
+			args:  nil,
+			valid: false,
+		},
+		{
+			name:  "Three decimals",
+			query: "min_amount=1.234",
+			where: "",
+			args:  nil,
+			valid: false,
+		},
+		{
+			name:  "From after to",
+			query: "from=2021-02-01&to=2021-01-01",
+			where: "",
+			args:  nil,
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			f, err := lineitemFilter(7, query)
+			if (err == nil) != tt.valid {
+				t.Errorf("lineitemFilter(%q) error = %v, want valid %v", tt.query, err, tt.valid)
+				return
+			}
+			if !tt.valid {
+				return
+			}
+			if got := f.where(); got != tt.where {
+				t.Errorf("lineitemFilter(%q) where = %q, want %q", tt.query, got, tt.where)
+			}
+			if !reflect.DeepEqual(f.args, tt.args) {
+				t.Errorf("lineitemFilter(%q) args = %v, want %v", tt.query, f.args, tt.args)
+			}
+		})
+	}
+}
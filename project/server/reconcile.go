@@ -0,0 +1,550 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Status of a line item
+const (
+	STATUS_UNCLEARED  = "uncleared"
+	STATUS_CLEARED    = "cleared"    // appeared on a statement
+	STATUS_RECONCILED = "reconciled" // cleared and locked by a finished reconciliation
+)
+
+// Status of a reconciliation
+const (
+	RECONCILIATION_OPEN     = "open"
+	RECONCILIATION_FINISHED = "finished"
+)
+
+// Reconciliation of a bank account against a statement
+// ClearedBalance is the opening balance plus the cleared line items up to StatementDate;
+// Difference is what is left to explain, the reconciliation can only finish at zero.
+type Reconciliation struct {
+	Id             int        `json:"id"`
+	Bank           int        `json:"bank"`
+	StatementDate  string     `json:"statement_date"`
+	EndingBalance  Money      `json:"ending_balance"`
+	Status         string     `json:"status"`
+	ClearedBalance Money      `json:"cleared_balance"`
+	Difference     Money      `json:"difference"`
+	FinishedAt     *time.Time `json:"finished_at"`
+	Owner          int        `json:"ownerid"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Response of GET /reconciliation/{id}: the line items of the statement period, cleared or not,
+// that are not locked yet; the line items it locked once finished
+type ReconciliationDetail struct {
+	Reconciliation
+	LineItems []LineItem `json:"lineitems"`
+}
+
+// Payload of /lineitem/{id}/status
+type StatusChange struct {
+	Status string `json:"status"`
+}
+
+// Payload of /reconciliation/{id}/unlock
+type Unlock struct {
+	Reason string `json:"reason"`
+}
+
+// Opening balance plus the cleared line items of the bank up to the statement date, selected
+// from public.reconciliation. A finished reconciliation balanced, so it holds its ending balance.
+const CLEARED_BALANCE = "CASE WHEN status = 'finished' THEN ending_balance ELSE " +
+	"(SELECT b.opening_balance + coalesce(sum(l.amount) FILTER (WHERE l.cleared AND l.occurred_on <= reconciliation.statement_date " +
+	"AND l.occurred_on >= coalesce(b.opening_date, '-infinity')), 0) " +
+	"FROM public.bankaccount b LEFT JOIN public.lineitem l ON l.bank = b.id WHERE b.id = reconciliation.bank GROUP BY b.id) END"
+
+const RECONCILIATION_COLUMNS = "id, bank, to_char(statement_date, 'YYYY-MM-DD'), ending_balance, status, " + CLEARED_BALANCE + ", " +
+	"finished_at, ownerid, created_at, updated_at"
+
+// Fields /reconciliations can be sorted by
+var RECONCILIATION_SORT_FIELDS = map[string]string{
+	"id":             "id",
+	"statement_date": "statement_date",
+	"created_at":     "created_at",
+}
+
+var errReconciled = errors.New("line item is reconciled, unlock its reconciliation first")
+
+func scanReconciliation(row rowScanner) (Reconciliation, error) {
+	var reconciliation Reconciliation
+	err := row.Scan(
+		&reconciliation.Id,
+		&reconciliation.Bank,
+		&reconciliation.StatementDate,
+		&reconciliation.EndingBalance,
+		&reconciliation.Status,
+		&reconciliation.ClearedBalance,
+		&reconciliation.FinishedAt,
+		&reconciliation.Owner,
+		&reconciliation.CreatedAt,
+		&reconciliation.UpdatedAt,
+	)
+	reconciliation.Difference = reconciliation.EndingBalance - reconciliation.ClearedBalance
+	return reconciliation, err
+}
+
+// lineitemStatus returns the status of a line item.
+func lineitemStatus(cleared bool, reconciliation int) string {
+	switch {
+	case reconciliation != 0:
+		return STATUS_RECONCILED
+	case cleared:
+		return STATUS_CLEARED
+	default:
+		return STATUS_UNCLEARED
+	}
+}
+
+// checkReconciliation validates a reconciliation request.
+func checkReconciliation(reconciliation Reconciliation, now time.Time) error {
+	if reconciliation.Bank == 0 {
+		return errors.New("a reconciliation needs a bank")
+	}
+	date, err := parseDate(reconciliation.StatementDate)
+	if err != nil {
+		return err
+	}
+	if date.After(now) {
+		return errors.New("statement date must not be in the future")
+	}
+	return nil
+}
+
+// lineitemReconciled returns the reconciliation that locked a line item, 0 if none.
+func lineitemReconciled(id int, owner int) int {
+	var reconciliation int
+	db.QueryRow("SELECT coalesce(reconciliation, 0) FROM public.lineitem WHERE id=$1 AND ownerid=$2;", id, owner).Scan(&reconciliation)
+	return reconciliation
+}
+
+// transferReconciled reports whether a line item of a transfer is locked.
+func transferReconciled(id int, owner int) bool {
+	var locked bool
+	db.QueryRow("SELECT exists(SELECT 1 FROM public.lineitem WHERE transfer=$1 AND ownerid=$2 AND reconciliation IS NOT NULL);", id, owner).Scan(&locked)
+	return locked
+}
+
+// readReconciliation returns a reconciliation of owner, sql.ErrNoRows if there is none.
+func readReconciliation(q queryRower, id int, owner int, lock string) (Reconciliation, error) {
+	return scanReconciliation(q.QueryRow("SELECT "+RECONCILIATION_COLUMNS+" FROM public.reconciliation WHERE id=$1 AND ownerid=$2"+lock+";", id, owner))
+}
+
+// reconciliationLineItems returns the line items shown with a reconciliation.
+func reconciliationLineItems(reconciliation Reconciliation) ([]LineItem, error) {
+	var f filter
+	f.add("bank=?", reconciliation.Bank)
+	if reconciliation.Status == RECONCILIATION_FINISHED {
+		f.add("reconciliation=?", reconciliation.Id)
+	} else {
+		f.add("reconciliation IS NULL")
+		f.add("occurred_on <= ?", reconciliation.StatementDate)
+		f.add("occurred_on >= coalesce((SELECT opening_date FROM public.bankaccount WHERE id=bank), '-infinity')")
+	}
+
+	rows, err := db.Query("SELECT "+LINEITEM_COLUMNS+" FROM public.lineitem"+f.where()+" ORDER BY occurred_on, id;", f.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lineitems := []LineItem{}
+	for rows.Next() {
+		lineitem, err := scanLineItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		lineitems = append(lineitems, lineitem)
+	}
+	return lineitems, rows.Err()
+}
+
+// Start and list reconciliations (optionally of one bank)
+// A bank account has at most one reconciliation in progress.
+func reconciliationProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "POST":
+		var request Reconciliation
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := checkReconciliation(request, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !ownsRecord(db, "bankaccount", request.Bank, owner) {
+			http.Error(w, "Bank not found.", http.StatusBadRequest)
+			ErrorLogger.Println("Reconciliation references a Bank of another user.")
+			return
+		}
+
+		var open int
+		db.QueryRow("SELECT id FROM public.reconciliation WHERE bank=$1 AND status='open';", request.Bank).Scan(&open)
+		if open != 0 {
+			http.Error(w, "Reconciliation "+strconv.Itoa(open)+" of the bank is still open, finish or delete it first.", http.StatusConflict)
+			return
+		}
+
+		reconciliation, err := scanReconciliation(db.QueryRow(
+			"INSERT INTO public.reconciliation (bank, statement_date, ending_balance, ownerid) VALUES($1, $2, $3, $4) RETURNING "+RECONCILIATION_COLUMNS+";",
+			request.Bank,
+			request.StatementDate,
+			request.EndingBalance,
+			owner,
+		))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("New Reconciliation started.")
+
+		if err := json.NewEncoder(w).Encode(reconciliation); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	case "GET":
+		options, err := parseListOptions(r.URL.Query(), RECONCILIATION_SORT_FIELDS, "statement_date")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var f filter
+		f.add("ownerid=?", owner)
+		if value := r.URL.Query().Get("bank"); value != "" {
+			bank, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid bank %q", value), http.StatusBadRequest)
+				return
+			}
+			f.add("bank=?", bank)
+		}
+
+		rows, total, err := queryPage("reconciliation", RECONCILIATION_COLUMNS, f, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
+
+		reconciliations := []Reconciliation{}
+		for rows.Next() {
+			reconciliation, err := scanReconciliation(rows)
+			checkError(err)
+
+			reconciliations = append(reconciliations, reconciliation)
+		}
+		InfoLogger.Println("Reconciliations retrieved.")
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if err := json.NewEncoder(w).Encode(reconciliations); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+// Read a reconciliation with its line items, or change or delete it while it is open
+func reconciliationProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	current, err := readReconciliation(db, id, owner, "")
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Reconciliation Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	if (r.Method == "PUT" || r.Method == "DELETE") && current.Status != RECONCILIATION_OPEN {
+		http.Error(w, "Reconciliation is finished, unlock it first.", http.StatusConflict)
+		return
+	}
+
+	var response interface{} = current
+	switch r.Method {
+	case "GET":
+		detail := ReconciliationDetail{Reconciliation: current}
+		detail.LineItems, err = reconciliationLineItems(current)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Reconciliation Information retrieved.")
+		response = detail
+	case "PUT":
+		var request Reconciliation
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Bank = current.Bank
+		if err := checkReconciliation(request, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		response, err = scanReconciliation(db.QueryRow(
+			"UPDATE public.reconciliation SET statement_date=$1, ending_balance=$2 WHERE id=$3 AND ownerid=$4 RETURNING "+RECONCILIATION_COLUMNS+";",
+			request.StatementDate,
+			request.EndingBalance,
+			id,
+			owner,
+		))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Reconciliation Information Updated.")
+	case "DELETE":
+		// Line items cleared during the reconciliation stay cleared
+		if _, err := db.Exec("DELETE FROM public.reconciliation WHERE id=$1 AND ownerid=$2;", id, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Reconciliation Information deleted.")
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Finish a reconciliation whose difference is zero (POST)
+// Locks its cleared line items against changes and records it in the audit log.
+func reconciliationFinishProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	reconciliation, err := readReconciliation(tx, id, owner, " FOR UPDATE")
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Reconciliation Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	if reconciliation.Status != RECONCILIATION_OPEN {
+		http.Error(w, "Reconciliation is already finished.", http.StatusConflict)
+		return
+	}
+	if reconciliation.Difference != 0 {
+		http.Error(w, "Reconciliation does not balance yet, the difference is "+reconciliation.Difference.String()+".", http.StatusConflict)
+		return
+	}
+
+	result, err := tx.Exec(
+		"UPDATE public.lineitem SET reconciliation=$1 WHERE bank=$2 AND ownerid=$3 AND cleared AND reconciliation IS NULL AND occurred_on <= $4;",
+		id,
+		reconciliation.Bank,
+		owner,
+		reconciliation.StatementDate,
+	)
+	var locked int64
+	if err == nil {
+		locked, err = result.RowsAffected()
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE public.reconciliation SET status='finished', finished_at=now() WHERE id=$1;", id)
+	}
+	if err == nil {
+		err = writeAudit(tx, owner, AUDIT_RECONCILE, "reconciliation", id,
+			fmt.Sprintf("Statement of %s with ending balance %s, %d line items locked.", reconciliation.StatementDate, reconciliation.EndingBalance, locked))
+	}
+	if err == nil {
+		reconciliation, err = readReconciliation(tx, id, owner, "")
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	InfoLogger.Println("Reconciliation finished.")
+
+	if err := json.NewEncoder(w).Encode(reconciliation); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Unlock the line items of a finished reconciliation and open it again (POST, with a reason)
+// The reason is kept in the audit log. The line items stay cleared.
+func reconciliationUnlockProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	var request Unlock
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Reason == "" {
+		http.Error(w, "unlocking a reconciliation needs a reason", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	reconciliation, err := readReconciliation(tx, id, owner, " FOR UPDATE")
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Reconciliation Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	if reconciliation.Status != RECONCILIATION_FINISHED {
+		http.Error(w, "Reconciliation is not finished.", http.StatusConflict)
+		return
+	}
+
+	var open int
+	tx.QueryRow("SELECT id FROM public.reconciliation WHERE bank=$1 AND status='open';", reconciliation.Bank).Scan(&open)
+	if open != 0 {
+		http.Error(w, "Reconciliation "+strconv.Itoa(open)+" of the bank is open, finish or delete it first.", http.StatusConflict)
+		return
+	}
+
+	result, err := tx.Exec("UPDATE public.lineitem SET reconciliation=NULL WHERE reconciliation=$1;", id)
+	var unlocked int64
+	if err == nil {
+		unlocked, err = result.RowsAffected()
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE public.reconciliation SET status='open', finished_at=NULL WHERE id=$1;", id)
+	}
+	if err == nil {
+		err = writeAudit(tx, owner, AUDIT_UNLOCK, "reconciliation", id, fmt.Sprintf("%d line items unlocked: %s", unlocked, request.Reason))
+	}
+	if err == nil {
+		reconciliation, err = readReconciliation(tx, id, owner, "")
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	WarningLogger.Println("Reconciliation unlocked.")
+
+	if err := json.NewEncoder(w).Encode(reconciliation); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Mark a line item as cleared or uncleared (PUT, {"status": "cleared"})
+func lineitemStatusProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "PUT" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	var request StatusChange
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Status != STATUS_CLEARED && request.Status != STATUS_UNCLEARED {
+		http.Error(w, fmt.Sprintf("invalid status %q, expected cleared or uncleared", request.Status), http.StatusBadRequest)
+		return
+	}
+	if lineitemReconciled(id, owner) != 0 {
+		http.Error(w, errReconciled.Error(), http.StatusConflict)
+		WarningLogger.Println("Change to a reconciled Line Item rejected.")
+		return
+	}
+
+	lineitem, err := scanLineItem(db.QueryRow(
+		"UPDATE public.lineitem SET cleared=$1 WHERE id=$2 AND ownerid=$3 AND reconciliation IS NULL RETURNING "+LINEITEM_COLUMNS+";",
+		request.Status == STATUS_CLEARED,
+		id,
+		owner,
+	))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Line Item Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	InfoLogger.Println("Line Item Status Updated.")
+
+	if err := json.NewEncoder(w).Encode(lineitem); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
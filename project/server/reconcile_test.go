@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLineItemStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		cleared        bool
+		reconciliation int
+		want           string
+	}{
+		{
+			name:           "Uncleared",
+			cleared:        false,
+			reconciliation: 0,
+			want:           STATUS_UNCLEARED,
+		},
+		{
+			name:           "Cleared",
+			cleared:        true,
+			reconciliation: 0,
+			want:           STATUS_CLEARED,
+		},
+		{
+			name:           "Reconciled",
+			cleared:        true,
+			reconciliation: 3,
+			want:           STATUS_RECONCILED,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lineitemStatus(tt.cleared, tt.reconciliation); got != tt.want {
+				t.Errorf("lineitemStatus(%v, %d) = %q, want %q", tt.cleared, tt.reconciliation, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckReconciliation(t *testing.T) {
+	now := time.Date(2021, 4, 2, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		reconciliation Reconciliation
+		valid          bool
+	}{
+		{
+			name:           "Statement",
+			reconciliation: Reconciliation{Bank: 1, StatementDate: "2021-03-31", EndingBalance: 123456},
+			valid:          true,
+		},
+		{
+			name:           "Negative balance",
+			reconciliation: Reconciliation{Bank: 1, StatementDate: "2021-03-31", EndingBalance: -5000},
+			valid:          true,
+		},
+		{
+			name:           "Today",
+			reconciliation: Reconciliation{Bank: 1, StatementDate: "2021-04-02"},
+			valid:          true,
+		},
+		{
+			name:           "No bank",
+			reconciliation: Reconciliation{StatementDate: "2021-03-31"},
+			valid:          false,
+		},
+		{
+			name:           "No date",
+			reconciliation: Reconciliation{Bank: 1},
+			valid:          false,
+		},
+		{
+			name:           "Invalid date",
+			reconciliation: Reconciliation{Bank: 1, StatementDate: "2021-02-30"},
+			valid:          false,
+		},
+		{
+			name:           "Future",
+			reconciliation: Reconciliation{Bank: 1, StatementDate: "2021-04-03"},
+			valid:          false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkReconciliation(tt.reconciliation, now)
+			if (err == nil) != tt.valid {
+				t.Errorf("checkReconciliation error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Schedule frequencies of recurring line items
+const (
+	FREQUENCY_DAILY   = "daily"
+	FREQUENCY_WEEKLY  = "weekly"
+	FREQUENCY_MONTHLY = "monthly"
+)
+
+// Template of a line item that repeats on a schedule: every Interval days, weeks or months
+// from Start, until End if set. Monthly schedules fall on DayOfMonth (the day of Start if 0),
+// or on the last day of shorter months.
+// NextDate is the first occurrence not created yet, empty once the schedule ended.
+type Recurring struct {
+	Id          int       `json:"id" bson:"id"`
+	Title       string    `json:"title" bson:"title"`
+	Description string    `json:"description" bson:"description"`
+	Amount      Money     `json:"amount" bson:"amount"`
+	Bucket      int       `json:"bucket" bson:"bucket"`
+	Bank        int       `json:"bank" bson:"bank"`
+	Frequency   string    `json:"frequency" bson:"frequency"`
+	Interval    int       `json:"interval" bson:"interval"`
+	DayOfMonth  int       `json:"day_of_month" bson:"day_of_month"`
+	Start       string    `json:"start" bson:"start"`
+	End         string    `json:"end" bson:"end"`
+	NextDate    string    `json:"next_date" bson:"next_date"`
+	Owner       int       `json:"ownerid" bson:"ownerid"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// An upcoming occurrence of a recurring line item
+type Occurrence struct {
+	Date    string `json:"date"`
+	Skipped bool   `json:"skipped"`
+}
+
+// Request to skip a single occurrence
+type RecurringSkip struct {
+	Date string `json:"date"`
+}
+
+// Number of occurrences /recurring/{id}/preview returns by default, and at most
+const (
+	DEFAULT_PREVIEW_COUNT = 5
+	MAX_PREVIEW_COUNT     = 100
+)
+
+const RECURRING_COLUMNS = "id, title, description, amount, coalesce(bucket, 0), coalesce(bank, 0), frequency, repeat_interval, coalesce(day_of_month, 0), " +
+	"to_char(start_date, 'YYYY-MM-DD'), coalesce(to_char(end_date, 'YYYY-MM-DD'), ''), coalesce(to_char(next_date, 'YYYY-MM-DD'), ''), ownerid, created_at, updated_at"
+
+var RECURRING_SORT_FIELDS = map[string]string{
+	"id":         "id",
+	"title":      "title",
+	"amount":     "amount",
+	"next_date":  "next_date",
+	"created_at": "created_at",
+}
+
+func scanRecurring(row rowScanner) (Recurring, error) {
+	var recurring Recurring
+	err := row.Scan(
+		&recurring.Id,
+		&recurring.Title,
+		&recurring.Description,
+		&recurring.Amount,
+		&recurring.Bucket,
+		&recurring.Bank,
+		&recurring.Frequency,
+		&recurring.Interval,
+		&recurring.DayOfMonth,
+		&recurring.Start,
+		&recurring.End,
+		&recurring.NextDate,
+		&recurring.Owner,
+		&recurring.CreatedAt,
+		&recurring.UpdatedAt,
+	)
+	return recurring, err
+}
+
+// Parsed schedule of a Recurring
+type Schedule struct {
+	Frequency  string
+	Interval   int
+	DayOfMonth int
+	Start      time.Time
+	End        time.Time // zero if the schedule does not end
+}
+
+// checkRecurring validates a template and fills in its defaults.
+func checkRecurring(recurring *Recurring) error {
+	if recurring.Title == "" {
+		return errors.New("title is required")
+	}
+	if recurring.Amount == 0 {
+		return errors.New("amount must not be zero")
+	}
+	if recurring.Interval == 0 {
+		recurring.Interval = 1
+	}
+	if recurring.Interval < 0 {
+		return errors.New("interval must be positive")
+	}
+
+	switch recurring.Frequency {
+	case FREQUENCY_MONTHLY:
+		if recurring.DayOfMonth < 0 || recurring.DayOfMonth > 31 {
+			return errors.New("day_of_month must be between 1 and 31")
+		}
+	case FREQUENCY_DAILY, FREQUENCY_WEEKLY:
+		recurring.DayOfMonth = 0
+	default:
+		return fmt.Errorf("invalid frequency %q, expected daily, weekly or monthly", recurring.Frequency)
+	}
+
+	if recurring.Start == "" {
+		recurring.Start = today()
+	}
+	start, err := parseDate(recurring.Start)
+	if err != nil {
+		return err
+	}
+	if recurring.End != "" {
+		end, err := parseDate(recurring.End)
+		if err != nil {
+			return err
+		}
+		if end.Before(start) {
+			return errors.New("end is before start")
+		}
+	}
+	return nil
+}
+
+// schedule returns the schedule of a template that passed checkRecurring.
+func (recurring Recurring) schedule() Schedule {
+	schedule := Schedule{
+		Frequency:  recurring.Frequency,
+		Interval:   recurring.Interval,
+		DayOfMonth: recurring.DayOfMonth,
+	}
+	schedule.Start, _ = parseDate(recurring.Start)
+	if recurring.End != "" {
+		schedule.End, _ = parseDate(recurring.End)
+	}
+	if schedule.Frequency == FREQUENCY_MONTHLY && schedule.DayOfMonth == 0 {
+		schedule.DayOfMonth = schedule.Start.Day()
+	}
+	return schedule
+}
+
+// occurrence returns the n-th occurrence of the schedule, counted from 0.
+// Every occurrence is computed from Start, so short months do not shift the ones after them.
+func (s Schedule) occurrence(n int) time.Time {
+	switch s.Frequency {
+	case FREQUENCY_DAILY:
+		return s.Start.AddDate(0, 0, n*s.Interval)
+	case FREQUENCY_WEEKLY:
+		return s.Start.AddDate(0, 0, 7*n*s.Interval)
+	default:
+		// The first occurrence is in the month of Start, or the month after if the day already passed
+		month := s.Start.Month()
+		if monthDay(s.Start.Year(), month, s.DayOfMonth).Before(s.Start) {
+			month++
+		}
+		return monthDay(s.Start.Year(), month+time.Month(n*s.Interval), s.DayOfMonth)
+	}
+}
+
+// next returns the first occurrence on or after date, and false if the schedule ended before it.
+func (s Schedule) next(date time.Time) (time.Time, bool) {
+	// Start from an estimate of n, then walk to the exact occurrence
+	n := 0
+	if date.After(s.Start) {
+		days := int(date.Sub(s.Start).Hours() / 24)
+		switch s.Frequency {
+		case FREQUENCY_DAILY:
+			n = days / s.Interval
+		case FREQUENCY_WEEKLY:
+			n = days / (7 * s.Interval)
+		default:
+			n = days / (31 * s.Interval)
+		}
+	}
+	for n > 0 && !s.occurrence(n-1).Before(date) {
+		n--
+	}
+	for s.occurrence(n).Before(date) {
+		n++
+	}
+
+	occurrence := s.occurrence(n)
+	if !s.End.IsZero() && occurrence.After(s.End) {
+		return time.Time{}, false
+	}
+	return occurrence, true
+}
+
+// between returns the occurrences from from up to and including to.
+func (s Schedule) between(from time.Time, to time.Time) []time.Time {
+	var dates []time.Time
+	for date, ok := s.next(from); ok && !date.After(to); date, ok = s.next(date.AddDate(0, 0, 1)) {
+		dates = append(dates, date)
+	}
+	return dates
+}
+
+// firstPending returns the first occurrence of the schedule on or after from, nil if there is none.
+func (s Schedule) firstPending(from time.Time) interface{} {
+	if from.Before(s.Start) {
+		from = s.Start
+	}
+	if next, ok := s.next(from); ok {
+		return next.Format(DATE_LAYOUT)
+	}
+	return nil
+}
+
+// readRecurring decodes and validates a template request.
+func readRecurring(r *http.Request, owner int) (Recurring, int, error) {
+	var request Recurring
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return request, http.StatusBadRequest, err
+	}
+	if err := checkRecurring(&request); err != nil {
+		return request, http.StatusBadRequest, err
+	}
+	if !lineitemRefsOwned(db, LineItem{Bucket: request.Bucket, Bank: request.Bank}, owner) {
+		return request, http.StatusBadRequest, errors.New("Bucket or Bank not found.")
+	}
+	return request, 0, nil
+}
+
+// Create and list recurring line item templates
+// Occurrences that are already due are created right away.
+func recurringProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "POST":
+		request, status, err := readRecurring(r, owner)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		var id int
+		err = db.QueryRow(
+			`INSERT INTO public.recurring (title, description, amount, bucket, bank, frequency, repeat_interval, day_of_month, start_date, end_date, next_date, ownerid)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9::date, $10::date, $11::date, $12) RETURNING id;`,
+			request.Title,
+			request.Description,
+			request.Amount,
+			request.Bucket,
+			request.Bank,
+			request.Frequency,
+			request.Interval,
+			nullInt(request.DayOfMonth),
+			request.Start,
+			nullDate(request.End),
+			request.schedule().firstPending(time.Time{}),
+			owner,
+		).Scan(&id)
+		if err == nil {
+			err = generateRecurring(id)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("New Recurring Line Item created.")
+
+		recurring, err := scanRecurring(db.QueryRow("SELECT "+RECURRING_COLUMNS+" FROM public.recurring WHERE id=$1;", id))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(recurring); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	case "GET":
+		options, err := parseListOptions(r.URL.Query(), RECURRING_SORT_FIELDS, "id")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var f filter
+		f.add("ownerid=?", owner)
+		rows, total, err := queryPage("recurring", RECURRING_COLUMNS, f, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
+
+		var templates []Recurring
+		for rows.Next() {
+			recurring, err := scanRecurring(rows)
+			checkError(err)
+
+			templates = append(templates, recurring)
+		}
+		InfoLogger.Println("Recurring Line Items retrieved.")
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if err := json.NewEncoder(w).Encode(templates); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+// Read, change or stop a recurring line item template
+// A change applies to all future occurrences; line items created before are left as they are.
+func recurringProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	current, err := scanRecurring(db.QueryRow("SELECT "+RECURRING_COLUMNS+" FROM public.recurring WHERE id=$1 AND ownerid=$2;", id, owner))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Recurring Line Item Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		InfoLogger.Println("Recurring Line Item Information retrieved.")
+	case "PUT":
+		request, status, err := readRecurring(r, owner)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		// Continue after the occurrences already created
+		var from time.Time
+		if current.NextDate != "" {
+			from, _ = parseDate(current.NextDate)
+		} else if current.End != "" {
+			end, _ := parseDate(current.End)
+			from = end.AddDate(0, 0, 1)
+		}
+
+		_, err = db.Exec(
+			`UPDATE public.recurring SET title=$1, description=$2, amount=$3, bucket=$4, bank=$5, frequency=$6, repeat_interval=$7,
+			day_of_month=$8, start_date=$9::date, end_date=$10::date, next_date=$11::date WHERE id=$12 AND ownerid=$13;`,
+			request.Title,
+			request.Description,
+			request.Amount,
+			request.Bucket,
+			request.Bank,
+			request.Frequency,
+			request.Interval,
+			nullInt(request.DayOfMonth),
+			request.Start,
+			nullDate(request.End),
+			request.schedule().firstPending(from),
+			id,
+			owner,
+		)
+		if err == nil {
+			err = generateRecurring(id)
+		}
+		if err == nil {
+			current, err = scanRecurring(db.QueryRow("SELECT "+RECURRING_COLUMNS+" FROM public.recurring WHERE id=$1;", id))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Recurring Line Item Information Updated.")
+	case "DELETE":
+		// Line items created from the template are kept
+		if _, err := db.Exec("DELETE FROM public.recurring WHERE id=$1 AND ownerid=$2;", id, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Recurring Line Item Information deleted.")
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(current); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
+
+// Upcoming occurrences of a template that were not created yet (?count=5 by default)
+func recurringPreviewProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "GET":
+		count := DEFAULT_PREVIEW_COUNT
+		if value := r.URL.Query().Get("count"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > MAX_PREVIEW_COUNT {
+				http.Error(w, fmt.Sprintf("invalid count %q, expected 1 to %d", value, MAX_PREVIEW_COUNT), http.StatusBadRequest)
+				return
+			}
+			count = n
+		}
+
+		recurring, err := scanRecurring(db.QueryRow("SELECT "+RECURRING_COLUMNS+" FROM public.recurring WHERE id=$1 AND ownerid=$2;", id, owner))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Recurring Line Item Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		skipped, err := skippedDates(db, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		occurrences := []Occurrence{}
+		if recurring.NextDate != "" {
+			schedule := recurring.schedule()
+			date, err := parseDate(recurring.NextDate)
+			for ; err == nil && len(occurrences) < count; date = date.AddDate(0, 0, 1) {
+				next, more := schedule.next(date)
+				if !more {
+					break
+				}
+				date = next
+				occurrences = append(occurrences, Occurrence{Date: next.Format(DATE_LAYOUT), Skipped: skipped[next.Format(DATE_LAYOUT)]})
+			}
+		}
+		InfoLogger.Println("Recurring Line Item occurrences previewed.")
+
+		if err := json.NewEncoder(w).Encode(occurrences); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+// Skip a single upcoming occurrence (POST), or stop skipping it (DELETE)
+func recurringSkipProcess(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var request RecurringSkip
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	date, err := parseDate(request.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recurring, err := scanRecurring(db.QueryRow("SELECT "+RECURRING_COLUMNS+" FROM public.recurring WHERE id=$1 AND ownerid=$2;", id, owner))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		ErrorLogger.Println("Recurring Line Item Information Empty/Not Found.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+
+	if next, ok := recurring.schedule().next(date); !ok || !next.Equal(date) {
+		http.Error(w, request.Date+" is not an occurrence of the schedule.", http.StatusBadRequest)
+		return
+	}
+	if recurring.NextDate == "" || request.Date < recurring.NextDate {
+		http.Error(w, "The line item of "+request.Date+" was already created, delete it instead.", http.StatusConflict)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		_, err = db.Exec("INSERT INTO public.recurringskip (recurring, occurs_on) VALUES($1, $2::date) ON CONFLICT DO NOTHING;", id, request.Date)
+	case "DELETE":
+		_, err = db.Exec("DELETE FROM public.recurringskip WHERE recurring=$1 AND occurs_on=$2::date;", id, request.Date)
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	InfoLogger.Println("Recurring Line Item occurrence skip changed.")
+
+	if err := json.NewEncoder(w).Encode(Occurrence{Date: request.Date, Skipped: r.Method == "POST"}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckRecurring(t *testing.T) {
+	tests := []struct {
+		name      string
+		recurring Recurring
+		valid     bool
+	}{
+		{
+			name:      "Monthly",
+			recurring: Recurring{Title: "Rent", Amount: -120000, Frequency: FREQUENCY_MONTHLY, Start: "2021-03-01"},
+			valid:     true,
+		},
+		{
+			name:      "Default start",
+			recurring: Recurring{Title: "Rent", Amount: -120000, Frequency: FREQUENCY_MONTHLY},
+			valid:     true,
+		},
+		{
+			name:      "Weekly with end",
+			recurring: Recurring{Title: "Gym", Amount: -1500, Frequency: FREQUENCY_WEEKLY, Start: "2021-03-01", End: "2021-06-01"},
+			valid:     true,
+		},
+		{
+			name:      "Day of month",
+			recurring: Recurring{Title: "Salary", Amount: 300000, Frequency: FREQUENCY_MONTHLY, DayOfMonth: 31},
+			valid:     true,
+		},
+		{
+			name:      "No title",
+			recurring: Recurring{Amount: -1, Frequency: FREQUENCY_DAILY},
+			valid:     false,
+		},
+		{
+			name:      "Zero amount",
+			recurring: Recurring{Title: "Rent", Frequency: FREQUENCY_DAILY},
+			valid:     false,
+		},
+		{
+			name:      "Negative interval",
+			recurring: Recurring{Title: "Rent", Amount: -1, Frequency: FREQUENCY_DAILY, Interval: -2},
+			valid:     false,
+		},
+		{
+			name:      "Unknown frequency",
+			recurring: Recurring{Title: "Rent", Amount: -1, Frequency: "yearly"},
+			valid:     false,
+		},
+		{
+			name:      "Day of month out of range",
+			recurring: Recurring{Title: "Rent", Amount: -1, Frequency: FREQUENCY_MONTHLY, DayOfMonth: 32},
+			valid:     false,
+		},
+		{
+			name:      "Invalid start",
+			recurring: Recurring{Title: "Rent", Amount: -1, Frequency: FREQUENCY_DAILY, Start: "tomorrow"},
+			valid:     false,
+		},
+		{
+			name:      "End before start",
+			recurring: Recurring{Title: "Rent", Amount: -1, Frequency: FREQUENCY_DAILY, Start: "2021-03-01", End: "2021-02-01"},
+			valid:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recurring := tt.recurring
+			err := checkRecurring(&recurring)
+			if (err == nil) != tt.valid {
+				t.Errorf("checkRecurring error = %v, want valid %v", err, tt.valid)
+			}
+			if err == nil && (recurring.Interval < 1 || recurring.Start == "") {
+				t.Errorf("checkRecurring left interval %d and start %q unset", recurring.Interval, recurring.Start)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	tests := []struct {
+		name      string
+		recurring Recurring
+		date      string
+		next      string // empty if the schedule ended
+	}{
+		{
+			name:      "Daily",
+			recurring: Recurring{Frequency: FREQUENCY_DAILY, Interval: 1, Start: "2021-03-01"},
+			date:      "2021-03-10",
+			next:      "2021-03-10",
+		},
+		{
+			name:      "Before start",
+			recurring: Recurring{Frequency: FREQUENCY_DAILY, Interval: 1, Start: "2021-03-01"},
+			date:      "2021-01-10",
+			next:      "2021-03-01",
+		},
+		{
+			name:      "Every 3 days",
+			recurring: Recurring{Frequency: FREQUENCY_DAILY, Interval: 3, Start: "2021-03-01"},
+			date:      "2021-03-05",
+			next:      "2021-03-07",
+		},
+		{
+			name:      "Weekly",
+			recurring: Recurring{Frequency: FREQUENCY_WEEKLY, Interval: 1, Start: "2021-03-01"},
+			date:      "2021-03-02",
+			next:      "2021-03-08",
+		},
+		{
+			name:      "Biweekly",
+			recurring: Recurring{Frequency: FREQUENCY_WEEKLY, Interval: 2, Start: "2021-03-01"},
+			date:      "2021-03-09",
+			next:      "2021-03-15",
+		},
+		{
+			name:      "Monthly",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 1, Start: "2021-01-15"},
+			date:      "2021-03-16",
+			next:      "2021-04-15",
+		},
+		{
+			name:      "Monthly on the day",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 1, Start: "2021-01-15"},
+			date:      "2021-03-15",
+			next:      "2021-03-15",
+		},
+		{
+			name:      "Day already passed",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 1, DayOfMonth: 5, Start: "2021-01-15"},
+			date:      "2021-01-01",
+			next:      "2021-02-05",
+		},
+		{
+			name:      "End of february",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 1, Start: "2021-01-31"},
+			date:      "2021-02-01",
+			next:      "2021-02-28",
+		},
+		{
+			name:      "Back to the 31st",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 1, Start: "2021-01-31"},
+			date:      "2021-03-01",
+			next:      "2021-03-31",
+		},
+		{
+			name:      "Leap year",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 1, DayOfMonth: 30, Start: "2024-01-01"},
+			date:      "2024-02-01",
+			next:      "2024-02-29",
+		},
+		{
+			name:      "Quarterly",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 3, Start: "2021-01-10"},
+			date:      "2021-02-01",
+			next:      "2021-04-10",
+		},
+		{
+			name:      "Across years",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 1, Start: "2021-11-20"},
+			date:      "2021-12-21",
+			next:      "2022-01-20",
+		},
+		{
+			name:      "Last occurrence",
+			recurring: Recurring{Frequency: FREQUENCY_WEEKLY, Interval: 1, Start: "2021-03-01", End: "2021-03-15"},
+			date:      "2021-03-15",
+			next:      "2021-03-15",
+		},
+		{
+			name:      "Ended",
+			recurring: Recurring{Frequency: FREQUENCY_WEEKLY, Interval: 1, Start: "2021-03-01", End: "2021-03-20"},
+			date:      "2021-03-16",
+			next:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, _ := parseDate(tt.date)
+			next, ok := tt.recurring.schedule().next(date)
+			got := ""
+			if ok {
+				got = next.Format(DATE_LAYOUT)
+			}
+			if got != tt.next {
+				t.Errorf("next(%s) = %q, want %q", tt.date, got, tt.next)
+			}
+		})
+	}
+}
+
+func TestScheduleBetween(t *testing.T) {
+	tests := []struct {
+		name      string
+		recurring Recurring
+		from      string
+		to        string
+		dates     string
+	}{
+		{
+			name:      "Catch up",
+			recurring: Recurring{Frequency: FREQUENCY_WEEKLY, Interval: 1, Start: "2021-03-01"},
+			from:      "2021-03-01",
+			to:        "2021-03-22",
+			dates:     "2021-03-01 2021-03-08 2021-03-15 2021-03-22",
+		},
+		{
+			name:      "Nothing due",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 1, Start: "2021-03-10"},
+			from:      "2021-03-11",
+			to:        "2021-04-09",
+			dates:     "",
+		},
+		{
+			name:      "Short months",
+			recurring: Recurring{Frequency: FREQUENCY_MONTHLY, Interval: 1, Start: "2021-01-31"},
+			from:      "2021-01-01",
+			to:        "2021-05-01",
+			dates:     "2021-01-31 2021-02-28 2021-03-31 2021-04-30",
+		},
+		{
+			name:      "Stops at end",
+			recurring: Recurring{Frequency: FREQUENCY_DAILY, Interval: 2, Start: "2021-03-01", End: "2021-03-06"},
+			from:      "2021-03-01",
+			to:        "2021-03-31",
+			dates:     "2021-03-01 2021-03-03 2021-03-05",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, _ := parseDate(tt.from)
+			to, _ := parseDate(tt.to)
+			var dates []string
+			for _, date := range tt.recurring.schedule().between(from, to) {
+				dates = append(dates, date.Format(DATE_LAYOUT))
+			}
+			if got := strings.Join(dates, " "); got != tt.dates {
+				t.Errorf("between(%s, %s) = %q, want %q", tt.from, tt.to, got, tt.dates)
+			}
+		})
+	}
+}
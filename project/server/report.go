@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Periods the reports group line items by
+const (
+	REPORT_MONTH = "month"
+	REPORT_YEAR  = "year"
+)
+
+// Number of titles /reports/payees returns by default, and at most
+const (
+	DEFAULT_PAYEES = 10
+	MAX_PAYEES     = 100
+)
+
+// Income and expenses of one period and currency. Expenses are positive; transfers are left out.
+type IncomeExpense struct {
+	Period   string `json:"period"`
+	Currency string `json:"currency"`
+	Income   Money  `json:"income"`
+	Expenses Money  `json:"expenses"`
+	Net      Money  `json:"net"`
+}
+
+// Spending of a bucket in one period: its expenses less refunds. Bucket 0 holds the expenses without a bucket;
+// income without a bucket is income, not a refund.
+type BucketSpending struct {
+	Period   string `json:"period"`
+	Currency string `json:"currency"`
+	Bucket   int    `json:"bucket"`
+	Name     string `json:"name"`
+	Spent    Money  `json:"spent"`
+}
+
+// Line items of the same title (ignoring case), with the title written most often
+type PayeeTotal struct {
+	Title    string `json:"title"`
+	Currency string `json:"currency"`
+	Count    int    `json:"count"`
+	Total    Money  `json:"total"`
+}
+
+// Money in and out of a bank account in one period, transfers included. Bank 0 holds the line items without a bank.
+type CashFlow struct {
+	Period   string `json:"period"`
+	Bank     int    `json:"bank"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	Inflow   Money  `json:"inflow"`
+	Outflow  Money  `json:"outflow"`
+	Net      Money  `json:"net"`
+}
+
+// A span of days compared by /reports/compare, both inclusive
+type ReportRange struct {
+	Label string `json:"label"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// An amount in the current period, the period before and the same period a year before.
+// The changes are in percent, null when the earlier amount is zero.
+type Comparison struct {
+	Current        Money    `json:"current"`
+	Previous       Money    `json:"previous"`
+	LastYear       Money    `json:"last_year"`
+	ChangePrevious *float64 `json:"change_previous"`
+	ChangeLastYear *float64 `json:"change_last_year"`
+}
+
+type ComparisonTotals struct {
+	Currency string     `json:"currency"`
+	Income   Comparison `json:"income"`
+	Expenses Comparison `json:"expenses"`
+	Net      Comparison `json:"net"`
+}
+
+type ComparisonBucket struct {
+	Currency string     `json:"currency"`
+	Bucket   int        `json:"bucket"`
+	Name     string     `json:"name"`
+	Spent    Comparison `json:"spent"`
+}
+
+// Response of /reports/compare: this month against last month and the same month last year,
+// or this year against last year
+type ReportComparison struct {
+	Period   string             `json:"period"`
+	Current  ReportRange        `json:"current"`
+	Previous ReportRange        `json:"previous"`
+	LastYear ReportRange        `json:"last_year"`
+	Totals   []ComparisonTotals `json:"totals"`
+	Buckets  []ComparisonBucket `json:"buckets"`
+}
+
+// Line items (l) with their bank (b) and bucket (k); the line items of the owner ($1) in a date range ($2 to $3)
+const (
+	REPORT_FROM  = " FROM public.lineitem l LEFT JOIN public.bankaccount b ON b.id = l.bank LEFT JOIN public.bucket k ON k.id = l.bucket"
+	REPORT_WHERE = " WHERE l.ownerid=$1 AND l.occurred_on BETWEEN coalesce($2::date, '-infinity') AND coalesce($3::date, 'infinity')"
+)
+
+// Currency of a line item; line items without a bank are in the default currency
+const REPORT_CURRENCY = "coalesce(b.currency, '" + DEFAULT_CURRENCY + "')"
+
+// parseReportPeriod reads the period query parameter, month by default.
+func parseReportPeriod(query url.Values) (string, error) {
+	switch period := query.Get("period"); period {
+	case "", REPORT_MONTH:
+		return REPORT_MONTH, nil
+	case REPORT_YEAR:
+		return REPORT_YEAR, nil
+	default:
+		return "", fmt.Errorf("invalid period %q, expected month or year", period)
+	}
+}
+
+// periodColumn returns the label of the period of a line item: 2021-03 for a month, 2021 for a year.
+func periodColumn(period string) string {
+	if period == REPORT_YEAR {
+		return "to_char(l.occurred_on, 'YYYY')"
+	}
+	return "to_char(l.occurred_on, 'YYYY-MM')"
+}
+
+// compareRanges returns the period holding date, the period before it and the same period a year before.
+// For a year, the period before is the year before.
+func compareRanges(period string, date time.Time) (ReportRange, ReportRange, ReportRange) {
+	span := func(start time.Time, end time.Time, layout string) ReportRange {
+		return ReportRange{Label: start.Format(layout), From: start.Format(DATE_LAYOUT), To: end.AddDate(0, 0, -1).Format(DATE_LAYOUT)}
+	}
+
+	if period == REPORT_YEAR {
+		start := time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		previous := span(start.AddDate(-1, 0, 0), start, "2006")
+		return span(start, start.AddDate(1, 0, 0), "2006"), previous, previous
+	}
+	start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return span(start, start.AddDate(0, 1, 0), "2006-01"),
+		span(start.AddDate(0, -1, 0), start, "2006-01"),
+		span(start.AddDate(-1, 0, 0), start.AddDate(-1, 1, 0), "2006-01")
+}
+
+// percentChange returns the change from before to now in percent, nil if before is zero.
+func percentChange(before Money, now Money) *float64 {
+	if before == 0 {
+		return nil
+	}
+	change := float64(now-before) / float64(before.Abs()) * 100
+	return &change
+}
+
+func (c *Comparison) add(index int, amount Money) {
+	switch index {
+	case 0:
+		c.Current += amount
+	case 1:
+		c.Previous += amount
+	case 2:
+		c.LastYear += amount
+	}
+}
+
+func (c *Comparison) changes() {
+	c.ChangePrevious = percentChange(c.Previous, c.Current)
+	c.ChangeLastYear = percentChange(c.LastYear, c.Current)
+}
+
+// incomeExpenseReport sums income and expenses per period and currency.
+func incomeExpenseReport(owner int, period string, dates DateRange) ([]IncomeExpense, error) {
+	rows, err := db.Query(
+		"SELECT "+periodColumn(period)+", "+REPORT_CURRENCY+", "+
+			"coalesce(sum(l.amount) FILTER (WHERE l.amount > 0), 0), coalesce(-sum(l.amount) FILTER (WHERE l.amount < 0), 0), sum(l.amount)"+
+			REPORT_FROM+REPORT_WHERE+" AND l.transfer IS NULL GROUP BY 1, 2 ORDER BY 1, 2;",
+		owner, nullDate(dates.From), nullDate(dates.To),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []IncomeExpense{}
+	for rows.Next() {
+		var row IncomeExpense
+		if err := rows.Scan(&row.Period, &row.Currency, &row.Income, &row.Expenses, &row.Net); err != nil {
+			return nil, err
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// bucketReport sums the spending of every bucket per period and currency, the most spent first.
+func bucketReport(owner int, period string, dates DateRange) ([]BucketSpending, error) {
+	rows, err := db.Query(
+		"SELECT "+periodColumn(period)+", "+REPORT_CURRENCY+", coalesce(k.id, 0), coalesce(k.\"name\", ''), -sum(l.amount)"+
+			REPORT_FROM+REPORT_WHERE+" AND l.transfer IS NULL AND (l.amount < 0 OR k.id IS NOT NULL) GROUP BY 1, 2, 3, 4 ORDER BY 1, 2, 5 DESC, 3;",
+		owner, nullDate(dates.From), nullDate(dates.To),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []BucketSpending{}
+	for rows.Next() {
+		var row BucketSpending
+		if err := rows.Scan(&row.Period, &row.Currency, &row.Bucket, &row.Name, &row.Spent); err != nil {
+			return nil, err
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// payeeReport returns the titles with the largest expenses, or the largest income.
+func payeeReport(owner int, income bool, limit int, dates DateRange) ([]PayeeTotal, error) {
+	sign, total := "l.amount < 0", "-sum(l.amount)"
+	if income {
+		sign, total = "l.amount > 0", "sum(l.amount)"
+	}
+
+	rows, err := db.Query(
+		"SELECT mode() WITHIN GROUP (ORDER BY l.title), "+REPORT_CURRENCY+", count(*), "+total+
+			REPORT_FROM+REPORT_WHERE+" AND l.transfer IS NULL AND "+sign+
+			" GROUP BY lower(btrim(l.title)), 2 ORDER BY 4 DESC, 1 LIMIT $4;",
+		owner, nullDate(dates.From), nullDate(dates.To), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []PayeeTotal{}
+	for rows.Next() {
+		var row PayeeTotal
+		if err := rows.Scan(&row.Title, &row.Currency, &row.Count, &row.Total); err != nil {
+			return nil, err
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// cashFlowReport sums the money in and out of every bank account per period.
+func cashFlowReport(owner int, period string, dates DateRange) ([]CashFlow, error) {
+	rows, err := db.Query(
+		"SELECT "+periodColumn(period)+", coalesce(b.id, 0), coalesce(b.\"name\", ''), "+REPORT_CURRENCY+", "+
+			"coalesce(sum(l.amount) FILTER (WHERE l.amount > 0), 0), coalesce(-sum(l.amount) FILTER (WHERE l.amount < 0), 0), sum(l.amount)"+
+			REPORT_FROM+REPORT_WHERE+" GROUP BY 1, 2, 3, 4 ORDER BY 1, 2;",
+		owner, nullDate(dates.From), nullDate(dates.To),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []CashFlow{}
+	for rows.Next() {
+		var row CashFlow
+		if err := rows.Scan(&row.Period, &row.Bank, &row.Name, &row.Currency, &row.Inflow, &row.Outflow, &row.Net); err != nil {
+			return nil, err
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// comparisonReport compares income, expenses and the spending of every bucket between the periods.
+func comparisonReport(owner int, period string, date time.Time) (ReportComparison, error) {
+	comparison := ReportComparison{Period: period}
+	comparison.Current, comparison.Previous, comparison.LastYear = compareRanges(period, date)
+	ranges := []ReportRange{comparison.Current, comparison.Previous, comparison.LastYear}
+
+	rows, err := db.Query(
+		"SELECT r.n, "+REPORT_CURRENCY+", coalesce(k.id, 0), coalesce(k.\"name\", ''), "+
+			"coalesce(sum(l.amount) FILTER (WHERE l.amount > 0), 0), coalesce(-sum(l.amount) FILTER (WHERE l.amount < 0), 0)"+REPORT_FROM+
+			" JOIN (VALUES (0, $2::date, $3::date), (1, $4::date, $5::date), (2, $6::date, $7::date)) AS r(n, from_date, to_date)"+
+			" ON l.occurred_on BETWEEN r.from_date AND r.to_date WHERE l.ownerid=$1 AND l.transfer IS NULL GROUP BY 1, 2, 3, 4;",
+		owner, ranges[0].From, ranges[0].To, ranges[1].From, ranges[1].To, ranges[2].From, ranges[2].To,
+	)
+	if err != nil {
+		return comparison, err
+	}
+	defer rows.Close()
+
+	totals := map[string]*ComparisonTotals{}
+	buckets := map[string]*ComparisonBucket{}
+	for rows.Next() {
+		var index, bucket int
+		var currency, name string
+		var income, expenses Money
+		if err := rows.Scan(&index, &currency, &bucket, &name, &income, &expenses); err != nil {
+			return comparison, err
+		}
+
+		if totals[currency] == nil {
+			totals[currency] = &ComparisonTotals{Currency: currency}
+		}
+		totals[currency].Income.add(index, income)
+		totals[currency].Expenses.add(index, expenses)
+		totals[currency].Net.add(index, income-expenses)
+
+		key := currency + "/" + strconv.Itoa(bucket)
+		if buckets[key] == nil {
+			buckets[key] = &ComparisonBucket{Currency: currency, Bucket: bucket, Name: name}
+		}
+		if bucket == 0 {
+			buckets[key].Spent.add(index, expenses)
+		} else {
+			buckets[key].Spent.add(index, expenses-income)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return comparison, err
+	}
+
+	comparison.Totals = []ComparisonTotals{}
+	for _, total := range totals {
+		total.Income.changes()
+		total.Expenses.changes()
+		total.Net.changes()
+		comparison.Totals = append(comparison.Totals, *total)
+	}
+	sort.Slice(comparison.Totals, func(i, j int) bool { return comparison.Totals[i].Currency < comparison.Totals[j].Currency })
+
+	comparison.Buckets = []ComparisonBucket{}
+	for _, bucket := range buckets {
+		if bucket.Spent.Current == 0 && bucket.Spent.Previous == 0 && bucket.Spent.LastYear == 0 {
+			continue
+		}
+		bucket.Spent.changes()
+		comparison.Buckets = append(comparison.Buckets, *bucket)
+	}
+	sort.Slice(comparison.Buckets, func(i, j int) bool {
+		a, b := comparison.Buckets[i], comparison.Buckets[j]
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		if a.Spent.Current != b.Spent.Current {
+			return a.Spent.Current > b.Spent.Current
+		}
+		return a.Bucket < b.Bucket
+	})
+	return comparison, nil
+}
+
+// Reports over the line items of the user, optionally limited by from/to dates
+// /reports/income-expense, /reports/buckets and /reports/cashflow group by period=month (default) or year;
+// /reports/payees returns the limit (10) titles with the largest expenses, or with type=income the largest income;
+// /reports/compare compares the period holding date (today) with the one before and the same one a year before.
+func reportProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+
+	query := r.URL.Query()
+	period, err := parseReportPeriod(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dates, err := parseDateRange(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var report interface{}
+	switch r.URL.Path {
+	case "/reports/income-expense":
+		report, err = incomeExpenseReport(owner, period, dates)
+	case "/reports/buckets":
+		report, err = bucketReport(owner, period, dates)
+	case "/reports/cashflow":
+		report, err = cashFlowReport(owner, period, dates)
+	case "/reports/payees":
+		limit := DEFAULT_PAYEES
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > MAX_PAYEES {
+				http.Error(w, fmt.Sprintf("invalid limit %q, expected 1 to %d", value, MAX_PAYEES), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		var income bool
+		switch query.Get("type") {
+		case "", "expenses":
+		case "income":
+			income = true
+		default:
+			http.Error(w, fmt.Sprintf("invalid type %q, expected expenses or income", query.Get("type")), http.StatusBadRequest)
+			return
+		}
+		report, err = payeeReport(owner, income, limit, dates)
+	case "/reports/compare":
+		date, _ := parseDate(today())
+		if value := query.Get("date"); value != "" {
+			if date, err = parseDate(value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		report, err = comparisonReport(owner, period, date)
+	default:
+		http.Error(w, "Not Found!", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+	InfoLogger.Println("Report " + r.URL.Path + " retrieved.")
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		ErrorLogger.Println("Internal Error Occured. " + err.Error())
+		return
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseReportPeriod(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+		valid bool
+	}{
+		{
+			name:  "Default period",
+			value: "",
+			want:  REPORT_MONTH,
+			valid: true,
+		},
+		{
+			name:  "Month",
+			value: "month",
+			want:  REPORT_MONTH,
+			valid: true,
+		},
+		{
+			name:  "Year",
+			value: "year",
+			want:  REPORT_YEAR,
+			valid: true,
+		},
+		{
+			name:  "Unknown period",
+			value: "week",
+			want:  "",
+			valid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseReportPeriod(url.Values{"period": {tt.value}})
+			if (err == nil) != tt.valid || got != tt.want {
+				t.Errorf("parseReportPeriod(%q) = %q, %v, want %q, valid %v", tt.value, got, err, tt.want, tt.valid)
+			}
+		})
+	}
+}
+
+func TestCompareRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		period   string
+		date     string
+		current  ReportRange
+		previous ReportRange
+		lastYear ReportRange
+	}{
+		{
+			name:     "Middle of a month",
+			period:   REPORT_MONTH,
+			date:     "2021-03-15",
+			current:  ReportRange{"2021-03", "2021-03-01", "2021-03-31"},
+			previous: ReportRange{"2021-02", "2021-02-01", "2021-02-28"},
+			lastYear: ReportRange{"2020-03", "2020-03-01", "2020-03-31"},
+		},
+		{
+			name:     "End of January",
+			period:   REPORT_MONTH,
+			date:     "2021-01-31",
+			current:  ReportRange{"2021-01", "2021-01-01", "2021-01-31"},
+			previous: ReportRange{"2020-12", "2020-12-01", "2020-12-31"},
+			lastYear: ReportRange{"2020-01", "2020-01-01", "2020-01-31"},
+		},
+		{
+			name:     "February in a leap year last year",
+			period:   REPORT_MONTH,
+			date:     "2021-02-01",
+			current:  ReportRange{"2021-02", "2021-02-01", "2021-02-28"},
+			previous: ReportRange{"2021-01", "2021-01-01", "2021-01-31"},
+			lastYear: ReportRange{"2020-02", "2020-02-01", "2020-02-29"},
+		},
+		{
+			name:     "Year",
+			period:   REPORT_YEAR,
+			date:     "2021-06-30",
+			current:  ReportRange{"2021", "2021-01-01", "2021-12-31"},
+			previous: ReportRange{"2020", "2020-01-01", "2020-12-31"},
+			lastYear: ReportRange{"2020", "2020-01-01", "2020-12-31"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, _ := parseDate(tt.date)
+			current, previous, lastYear := compareRanges(tt.period, date)
+			if current != tt.current || previous != tt.previous || lastYear != tt.lastYear {
+				t.Errorf("compareRanges(%s, %s) = %v, %v, %v, want %v, %v, %v",
+					tt.period, tt.date, current, previous, lastYear, tt.current, tt.previous, tt.lastYear)
+			}
+		})
+	}
+}
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  Money
+		now     Money
+		want    float64
+		defined bool
+	}{
+		{
+			name:    "Increase",
+			before:  10000,
+			now:     15000,
+			want:    50,
+			defined: true,
+		},
+		{
+			name:    "Decrease",
+			before:  10000,
+			now:     5000,
+			want:    -50,
+			defined: true,
+		},
+		{
+			name:    "Unchanged",
+			before:  10000,
+			now:     10000,
+			want:    0,
+			defined: true,
+		},
+		{
+			name:    "Smaller negative",
+			before:  -10000,
+			now:     -5000,
+			want:    50,
+			defined: true,
+		},
+		{
+			name:    "From zero",
+			before:  0,
+			now:     5000,
+			want:    0,
+			defined: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := percentChange(tt.before, tt.now)
+			if (got != nil) != tt.defined || (got != nil && *got != tt.want) {
+				t.Errorf("percentChange(%s, %s) = %v, want %v (defined %v)", tt.before, tt.now, got, tt.want, tt.defined)
+			}
+		})
+	}
+}
+
+func TestComparison(t *testing.T) {
+	var c Comparison
+	c.add(0, 3000)
+	c.add(0, 1000)
+	c.add(1, 2000)
+	c.changes()
+
+	if c.Current != 4000 || c.Previous != 2000 || c.LastYear != 0 {
+		t.Fatalf("Comparison = %s, %s, %s, want 40.00, 20.00, 0.00", c.Current, c.Previous, c.LastYear)
+	}
+	if c.ChangePrevious == nil || *c.ChangePrevious != 100 {
+		t.Errorf("ChangePrevious = %v, want 100", c.ChangePrevious)
+	}
+	if c.ChangeLastYear != nil {
+		t.Errorf("ChangeLastYear = %v, want none without an amount last year", *c.ChangeLastYear)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+// Columns selected for each entity, in the order the scan helpers expect them.
+// Line items not linked to a Bucket or Bank are read back as 0.
+const (
+	USER_COLUMNS     = "id, username, \"name\", created_at, updated_at"
+	BANK_COLUMNS     = "id, \"name\", ownerid, currency, account_type, opening_balance, coalesce(to_char(opening_date, 'YYYY-MM-DD'), ''), opening_balance + " + BANK_BALANCE + ", created_at, updated_at"
+	BUCKET_COLUMNS   = "id, \"name\", ownerid, budget, coalesce(budget_period, ''), coalesce(to_char(budget_start, 'YYYY-MM-DD'), ''), coalesce(budget_days, 0), created_at, updated_at"
+	LINEITEM_COLUMNS = "id, title, coalesce(description, ''), amount, coalesce(bucket, 0), coalesce(bank, 0), ownerid, to_char(occurred_on, 'YYYY-MM-DD'), coalesce(transfer, 0), coalesce(fitid, ''), cleared, coalesce(reconciliation, 0), created_at, updated_at"
+)
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner) (UserAccount, error) {
+	var user UserAccount
+	err := row.Scan(&user.Id, &user.Username, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+	return user, err
+}
+
+func scanBankAccount(row rowScanner) (BankAccount, error) {
+	var bank BankAccount
+	err := row.Scan(
+		&bank.Id,
+		&bank.Name,
+		&bank.Owner,
+		&bank.Currency,
+		&bank.AccountType,
+		&bank.OpeningBalance,
+		&bank.OpeningDate,
+		&bank.Balance,
+		&bank.CreatedAt,
+		&bank.UpdatedAt,
+	)
+	return bank, err
+}
+
+// A bucket without a budget period has no budget.
+func scanBucket(row rowScanner) (Bucket, error) {
+	var bucket Bucket
+	var budget Budget
+	err := row.Scan(
+		&bucket.Id,
+		&bucket.Name,
+		&bucket.Owner,
+		&budget.Amount,
+		&budget.Period,
+		&budget.Start,
+		&budget.Days,
+		&bucket.CreatedAt,
+		&bucket.UpdatedAt,
+	)
+	if budget.Period != "" {
+		bucket.Budget = &budget
+	}
+	return bucket, err
+}
+
+func scanLineItem(row rowScanner) (LineItem, error) {
+	var lineitem LineItem
+	var cleared bool
+	err := row.Scan(
+		&lineitem.Id,
+		&lineitem.Title,
+		&lineitem.Description,
+		&lineitem.Amount,
+		&lineitem.Bucket,
+		&lineitem.Bank,
+		&lineitem.Owner,
+		&lineitem.OccurredOn,
+		&lineitem.Transfer,
+		&lineitem.FitId,
+		&cleared,
+		&lineitem.Reconciliation,
+		&lineitem.CreatedAt,
+		&lineitem.UpdatedAt,
+	)
+	lineitem.Status = lineitemStatus(cleared, lineitem.Reconciliation)
+	return lineitem, err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runScheduler creates the due line items of every recurring template, posts the interest of
+// savings accounts and takes the net worth snapshots, now and then every interval.
+// Runs until the server exits.
+func runScheduler(interval time.Duration) {
+	for {
+		if err := generateDueRecurring(); err != nil {
+			ErrorLogger.Println("Failed to create recurring line items. " + err.Error())
+		}
+		if err := postDueInterest(); err != nil {
+			ErrorLogger.Println("Failed to post interest. " + err.Error())
+		}
+		if err := takeDueSnapshots(); err != nil {
+			ErrorLogger.Println("Failed to take net worth snapshots. " + err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+// generateDueRecurring creates the line items of all templates with occurrences up to today.
+// Occurrences missed while the server was down are created too.
+// A template that fails is logged and left for the next run, the others are still created.
+func generateDueRecurring() error {
+	rows, err := db.Query("SELECT id FROM public.recurring WHERE next_date <= $1::date;", today())
+	if err != nil {
+		return err
+	}
+	var due []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, id)
+	}
+	rows.Close()
+
+	var failed []string
+	for _, id := range due {
+		if err := generateRecurring(id); err != nil {
+			ErrorLogger.Printf("Failed to create the line items of recurring template %d. %s", id, err.Error())
+			failed = append(failed, strconv.Itoa(id))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d due recurring templates failed: %s", len(failed), len(due), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// generateRecurring creates the due line items of one template and moves its next_date past today.
+// The template row is locked, so concurrent runs (or server instances) skip it instead of
+// creating its line items twice; the unique index on (recurring, recurring_on) guards the rest.
+func generateRecurring(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	recurring, err := scanRecurring(tx.QueryRow(
+		"SELECT "+RECURRING_COLUMNS+" FROM public.recurring WHERE id=$1 AND next_date <= $2::date FOR UPDATE SKIP LOCKED;",
+		id,
+		today(),
+	))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	skipped, err := skippedDates(tx, id)
+	if err != nil {
+		return err
+	}
+
+	schedule := recurring.schedule()
+	from, _ := parseDate(recurring.NextDate)
+	now, _ := parseDate(today())
+
+	created := 0
+	for _, date := range schedule.between(from, now) {
+		occurs := date.Format(DATE_LAYOUT)
+		if skipped[occurs] {
+			continue
+		}
+		result, err := tx.Exec(
+			`INSERT INTO public.lineitem (title, description, amount, bucket, bank, ownerid, occurred_on, recurring, recurring_on)
+			VALUES($1, $2, $3, $4, $5, $6, $7::date, $8, $7::date) ON CONFLICT (recurring, recurring_on) DO NOTHING;`,
+			recurring.Title,
+			recurring.Description,
+			recurring.Amount,
+			recurring.Bucket,
+			recurring.Bank,
+			recurring.Owner,
+			occurs,
+			id,
+		)
+		if err != nil {
+			return err
+		}
+		n, _ := result.RowsAffected()
+		created += int(n)
+	}
+
+	var nextDate interface{}
+	if next, ok := schedule.next(now.AddDate(0, 0, 1)); ok {
+		nextDate = next.Format(DATE_LAYOUT)
+	}
+	if _, err := tx.Exec("UPDATE public.recurring SET next_date=$1 WHERE id=$2;", nextDate, id); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if created > 0 {
+		InfoLogger.Printf("Created %d line items of recurring template %d.", created, id)
+	}
+	return nil
+}
+
+// queryRower is implemented by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// skippedDates returns the skipped occurrences of a template.
+func skippedDates(q queryRower, id int) (map[string]bool, error) {
+	rows, err := q.Query("SELECT to_char(occurs_on, 'YYYY-MM-DD') FROM public.recurringskip WHERE recurring=$1;", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	skipped := map[string]bool{}
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, err
+		}
+		skipped[date] = true
+	}
+	return skipped, rows.Err()
+}
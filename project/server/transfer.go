@@ -0,0 +1,399 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Money moved from one bank account of the user to another.
+// A transfer is recorded as two linked line items, a debit of -Amount on FromBank
+// and a credit of +Amount on ToBank. Both line items carry the id of the transfer,
+// are left out of income and expense totals, and can only be changed through the transfer.
+type Transfer struct {
+	Id          int       `json:"id" bson:"id"`
+	Title       string    `json:"title" bson:"title"`
+	Description string    `json:"description" bson:"description"`
+	Amount      Money     `json:"amount" bson:"amount"`
+	FromBank    int       `json:"from_bank" bson:"from_bank"`
+	ToBank      int       `json:"to_bank" bson:"to_bank"`
+	OccurredOn  string    `json:"occurred_on" bson:"occurred_on"`
+	Owner       int       `json:"ownerid" bson:"ownerid"`
+	Debit       int       `json:"debit_item" bson:"debit_item"`
+	Credit      int       `json:"credit_item" bson:"credit_item"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+const TRANSFER_COLUMNS = "id, title, description, amount, from_bank, to_bank, ownerid, to_char(occurred_on, 'YYYY-MM-DD'), " +
+	"coalesce((SELECT l.id FROM public.lineitem l WHERE l.transfer = transfer.id AND l.amount < 0), 0), " +
+	"coalesce((SELECT l.id FROM public.lineitem l WHERE l.transfer = transfer.id AND l.amount > 0), 0), " +
+	"created_at, updated_at"
+
+var TRANSFER_SORT_FIELDS = map[string]string{
+	"id":          "id",
+	"occurred_on": "occurred_on",
+	"amount":      "amount",
+	"created_at":  "created_at",
+}
+
+func scanTransfer(row rowScanner) (Transfer, error) {
+	var transfer Transfer
+	err := row.Scan(
+		&transfer.Id,
+		&transfer.Title,
+		&transfer.Description,
+		&transfer.Amount,
+		&transfer.FromBank,
+		&transfer.ToBank,
+		&transfer.Owner,
+		&transfer.OccurredOn,
+		&transfer.Debit,
+		&transfer.Credit,
+		&transfer.CreatedAt,
+		&transfer.UpdatedAt,
+	)
+	return transfer, err
+}
+
+// checkTransfer checks the fields of a transfer request and fills in its defaults.
+func checkTransfer(transfer *Transfer) error {
+	if transfer.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	if transfer.FromBank == 0 || transfer.ToBank == 0 {
+		return errors.New("from_bank and to_bank are required")
+	}
+	if transfer.FromBank == transfer.ToBank {
+		return errors.New("from_bank and to_bank must differ")
+	}
+	if transfer.OccurredOn == "" {
+		transfer.OccurredOn = today()
+	} else if _, err := parseDate(transfer.OccurredOn); err != nil {
+		return err
+	}
+	if transfer.Title == "" {
+		transfer.Title = "Transfer"
+	}
+	return nil
+}
+
+// validateTransfer checks a transfer request and fills in its defaults.
+// Both banks must belong to owner and use the same currency.
+func validateTransfer(transfer *Transfer, owner int) error {
+	if err := checkTransfer(transfer); err != nil {
+		return err
+	}
+
+	var currencies int
+	var banks int
+	err := db.QueryRow(
+		"SELECT count(*), count(DISTINCT currency) FROM public.bankaccount WHERE id IN ($1, $2) AND ownerid=$3;",
+		transfer.FromBank,
+		transfer.ToBank,
+		owner,
+	).Scan(&banks, &currencies)
+	if err != nil {
+		return err
+	}
+	if banks != 2 {
+		return errors.New("bank not found")
+	}
+	if currencies != 1 {
+		return errors.New("both banks must use the same currency")
+	}
+	return nil
+}
+
+// writeTransferItems writes the two line items of a transfer, inside tx.
+// Line items the transfer already has are updated in place, so the fields the
+// transfer does not carry, such as cleared, are kept.
+func writeTransferItems(tx *sql.Tx, transfer Transfer) error {
+	for _, item := range []struct {
+		amount Money
+		bank   int
+		side   string
+	}{
+		{-transfer.Amount, transfer.FromBank, "amount < 0"},
+		{transfer.Amount, transfer.ToBank, "amount > 0"},
+	} {
+		result, err := tx.Exec(
+			"UPDATE public.lineitem SET title=$1, description=$2, amount=$3, bank=$4, occurred_on=$5 WHERE transfer=$6 AND "+item.side+";",
+			transfer.Title,
+			transfer.Description,
+			item.amount,
+			item.bank,
+			transfer.OccurredOn,
+			transfer.Id,
+		)
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if updated > 0 {
+			continue
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO public.lineitem (title, description, amount, bank, ownerid, occurred_on, transfer) VALUES($1, $2, $3, $4, $5, $6, $7);",
+			transfer.Title,
+			transfer.Description,
+			item.amount,
+			item.bank,
+			transfer.Owner,
+			transfer.OccurredOn,
+			transfer.Id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineitemTransfer returns the transfer a line item belongs to, 0 if none.
+func lineitemTransfer(id int, owner int) int {
+	var transfer int
+	db.QueryRow("SELECT coalesce(transfer, 0) FROM public.lineitem WHERE id=$1 AND ownerid=$2;", id, owner).Scan(&transfer)
+	return transfer
+}
+
+func transferProcess(owner int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "POST":
+		var request Transfer
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateTransfer(&request, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Owner = owner
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer tx.Rollback()
+
+		err = tx.QueryRow(
+			"INSERT INTO public.transfer (title, description, amount, from_bank, to_bank, occurred_on, ownerid) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id;",
+			request.Title,
+			request.Description,
+			request.Amount,
+			request.FromBank,
+			request.ToBank,
+			request.OccurredOn,
+			owner,
+		).Scan(&request.Id)
+		if err == nil {
+			err = writeTransferItems(tx, request)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("New Transfer created.")
+
+		transfer, err := scanTransfer(db.QueryRow("SELECT "+TRANSFER_COLUMNS+" FROM public.transfer WHERE id=$1;", request.Id))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(transfer); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	case "GET":
+		options, err := parseListOptions(r.URL.Query(), TRANSFER_SORT_FIELDS, "occurred_on")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var f filter
+		f.add("ownerid=?", owner)
+		dates, err := parseDateRange(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if dates.From != "" {
+			f.add("occurred_on >= ?::date", dates.From)
+		}
+		if dates.To != "" {
+			f.add("occurred_on <= ?::date", dates.To)
+		}
+
+		rows, total, err := queryPage("transfer", TRANSFER_COLUMNS, f, options)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer rows.Close()
+
+		var transfers []Transfer
+		for rows.Next() {
+			transfer, err := scanTransfer(rows)
+			checkError(err)
+
+			transfers = append(transfers, transfer)
+		}
+		InfoLogger.Println("Transfers retrieved.")
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		if err := json.NewEncoder(w).Encode(transfers); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
+
+func transferProcessId(owner int, id int, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method {
+	case "GET":
+		transfer, err := scanTransfer(db.QueryRow("SELECT "+TRANSFER_COLUMNS+" FROM public.transfer WHERE id=$1 AND ownerid=$2;", id, owner))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Transfer Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Transfer Information retrieved.")
+
+		if err := json.NewEncoder(w).Encode(transfer); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	case "PUT":
+		var request Transfer
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateTransfer(&request, owner); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Id = id
+		request.Owner = owner
+		if transferReconciled(id, owner) {
+			http.Error(w, errReconciled.Error(), http.StatusConflict)
+			WarningLogger.Println("Change to a reconciled Transfer rejected.")
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		defer tx.Rollback()
+
+		var updatedId int
+		err = tx.QueryRow(
+			"UPDATE public.transfer SET title=$1, description=$2, amount=$3, from_bank=$4, to_bank=$5, occurred_on=$6 WHERE id=$7 AND ownerid=$8 RETURNING id;",
+			request.Title,
+			request.Description,
+			request.Amount,
+			request.FromBank,
+			request.ToBank,
+			request.OccurredOn,
+			id,
+			owner,
+		).Scan(&updatedId)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Transfer Information Empty/Not Found.")
+			return
+		}
+		if err == nil {
+			err = writeTransferItems(tx, request)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Transfer Information Updated.")
+
+		transfer, err := scanTransfer(db.QueryRow("SELECT "+TRANSFER_COLUMNS+" FROM public.transfer WHERE id=$1;", id))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(transfer); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	case "DELETE":
+		// The line items of the transfer are deleted with it (on delete cascade)
+		if transferReconciled(id, owner) {
+			http.Error(w, errReconciled.Error(), http.StatusConflict)
+			WarningLogger.Println("Change to a reconciled Transfer rejected.")
+			return
+		}
+		transfer, err := scanTransfer(db.QueryRow("SELECT "+TRANSFER_COLUMNS+" FROM public.transfer WHERE id=$1 AND ownerid=$2;", id, owner))
+		if err == nil {
+			_, err = db.Exec("DELETE FROM public.transfer WHERE id=$1 AND ownerid=$2;", id, owner)
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not Found!", http.StatusNotFound)
+			ErrorLogger.Println("Transfer Information Empty/Not Found.")
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+		InfoLogger.Println("Transfer Information deleted.")
+
+		if err := json.NewEncoder(w).Encode(transfer); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			ErrorLogger.Println("Internal Error Occured. " + err.Error())
+			return
+		}
+	default:
+		http.Error(w, "Not allowed!", http.StatusMethodNotAllowed)
+		WarningLogger.Println("Invalid Operation Requested. Ignoring Request.")
+		return
+	}
+}
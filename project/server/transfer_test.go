@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckTransfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		transfer Transfer
+		valid    bool
+	}{
+		{
+			name:     "Valid",
+			transfer: Transfer{Amount: 1000, FromBank: 1, ToBank: 2, OccurredOn: "2021-03-01", Title: "Savings"},
+			valid:    true,
+		},
+		{
+			name:     "Defaults",
+			transfer: Transfer{Amount: 1, FromBank: 1, ToBank: 2},
+			valid:    true,
+		},
+		{
+			name:     "Zero amount",
+			transfer: Transfer{Amount: 0, FromBank: 1, ToBank: 2},
+			valid:    false,
+		},
+		{
+			name:     "Negative amount",
+			transfer: Transfer{Amount: -500, FromBank: 1, ToBank: 2},
+			valid:    false,
+		},
+		{
+			name:     "Missing bank",
+			transfer: Transfer{Amount: 500, FromBank: 1},
+			valid:    false,
+		},
+		{
+			name:     "Same bank",
+			transfer: Transfer{Amount: 500, FromBank: 1, ToBank: 1},
+			valid:    false,
+		},
+		{
+			name:     "Invalid date",
+			transfer: Transfer{Amount: 500, FromBank: 1, ToBank: 2, OccurredOn: "01/03/2021"},
+			valid:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer := tt.transfer
+			err := checkTransfer(&transfer)
+			if (err == nil) != tt.valid {
+				t.Errorf("checkTransfer error = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+
+	transfer := Transfer{Amount: 1, FromBank: 1, ToBank: 2}
+	checkTransfer(&transfer)
+	if transfer.Title != "Transfer" || transfer.OccurredOn != today() {
+		t.Errorf("checkTransfer defaults = %q, %q, want Transfer, %s", transfer.Title, transfer.OccurredOn, today())
+	}
+}
+
+// recordDriver is a database/sql driver recording the statements executed on it. Every
+// statement affects the given number of rows, and queries return the single value of
+// transfer, as the transfer of a line item.
+type recordDriver struct {
+	affected int64
+	transfer int64
+	execs    []recordedExec
+}
+
+type recordedExec struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *recordDriver) Open(name string) (driver.Conn, error) { return recordConn{d}, nil }
+
+func (d *recordDriver) Connect(context.Context) (driver.Conn, error) { return recordConn{d}, nil }
+func (d *recordDriver) Driver() driver.Driver                        { return d }
+
+type recordConn struct{ d *recordDriver }
+
+func (c recordConn) Prepare(query string) (driver.Stmt, error) {
+	return recordStmt{c.d, query}, nil
+}
+func (c recordConn) Close() error              { return nil }
+func (c recordConn) Begin() (driver.Tx, error) { return recordTx{}, nil }
+
+type recordTx struct{}
+
+func (recordTx) Commit() error   { return nil }
+func (recordTx) Rollback() error { return nil }
+
+type recordStmt struct {
+	d     *recordDriver
+	query string
+}
+
+func (s recordStmt) Close() error  { return nil }
+func (s recordStmt) NumInput() int { return -1 }
+
+func (s recordStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.execs = append(s.d.execs, recordedExec{s.query, args})
+	return driver.RowsAffected(s.d.affected), nil
+}
+
+func (s recordStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &recordRows{values: []driver.Value{s.d.transfer}}, nil
+}
+
+type recordRows struct {
+	values []driver.Value
+}
+
+func (r *recordRows) Columns() []string { return []string{"transfer"} }
+func (r *recordRows) Close() error      { return nil }
+
+func (r *recordRows) Next(dest []driver.Value) error {
+	if r.values == nil {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.values = nil
+	return nil
+}
+
+func TestWriteTransferItems(t *testing.T) {
+	transfer := Transfer{Id: 7, Title: "Savings", Description: "March", Amount: 2500, FromBank: 1, ToBank: 2, Owner: 3, OccurredOn: "2021-03-01"}
+
+	// UPDATE: title, description, amount, bank, occurred_on, transfer
+	// INSERT: title, description, amount, bank, ownerid, occurred_on, transfer
+	updateDebit := recordedExec{"UPDATE public.lineitem", []driver.Value{"Savings", "March", "-25.00", int64(1), "2021-03-01", int64(7)}}
+	updateCredit := recordedExec{"UPDATE public.lineitem", []driver.Value{"Savings", "March", "25.00", int64(2), "2021-03-01", int64(7)}}
+	insertDebit := recordedExec{"INSERT INTO public.lineitem", []driver.Value{"Savings", "March", "-25.00", int64(1), int64(3), "2021-03-01", int64(7)}}
+	insertCredit := recordedExec{"INSERT INTO public.lineitem", []driver.Value{"Savings", "March", "25.00", int64(2), int64(3), "2021-03-01", int64(7)}}
+
+	tests := []struct {
+		name     string
+		existing int64
+		want     []recordedExec
+	}{
+		{
+			name:     "New transfer",
+			existing: 0,
+			want:     []recordedExec{updateDebit, insertDebit, updateCredit, insertCredit},
+		},
+		{
+			name:     "Changed transfer",
+			existing: 1,
+			want:     []recordedExec{updateDebit, updateCredit},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &recordDriver{affected: tt.existing}
+			recorded := sql.OpenDB(record)
+			defer recorded.Close()
+
+			tx, err := recorded.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeTransferItems(tx, transfer); err != nil {
+				t.Fatalf("writeTransferItems error = %v", err)
+			}
+			tx.Commit()
+
+			if len(record.execs) != len(tt.want) {
+				t.Fatalf("writeTransferItems executed %d statements, want %d", len(record.execs), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := record.execs[i]
+				if !strings.HasPrefix(got.query, want.query) || !reflect.DeepEqual(got.args, want.args) {
+					t.Errorf("writeTransferItems statement %d = %q with %v, want %s with %v", i, got.query, got.args, want.query, want.args)
+				}
+			}
+			// The debit is the line item with a negative amount, the credit the one with a positive amount
+			if !strings.HasSuffix(record.execs[0].query, "amount < 0;") {
+				t.Errorf("writeTransferItems updated the debit with %q, want the line item with a negative amount", record.execs[0].query)
+			}
+		})
+	}
+}
+
+func TestLineItemOfTransfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		transfer int64
+		want     int
+	}{
+		{
+			name:     "Change a line item of a transfer",
+			method:   "PUT",
+			transfer: 7,
+			want:     http.StatusConflict,
+		},
+		{
+			name:     "Delete a line item of a transfer",
+			method:   "DELETE",
+			transfer: 7,
+			want:     http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &recordDriver{transfer: tt.transfer}
+			previous := db
+			db = sql.OpenDB(record)
+			defer func() {
+				db.Close()
+				db = previous
+			}()
+
+			recorder := httptest.NewRecorder()
+			lineitemProcessId(3, 10, recorder, httptest.NewRequest(tt.method, "/lineitems/10", strings.NewReader(`{"title": "Savings", "amount": "-20.00"}`)))
+			if recorder.Code != tt.want {
+				t.Errorf("%s of line item status = %d, want %d", tt.method, recorder.Code, tt.want)
+			}
+			if !strings.Contains(recorder.Body.String(), "Transfer 7") {
+				t.Errorf("%s of line item body = %q, want it to point to Transfer 7", tt.method, recorder.Body.String())
+			}
+			if len(record.execs) != 0 {
+				t.Errorf("%s of line item executed %v, want no changes", tt.method, record.execs)
+			}
+		})
+	}
+}